@@ -13,8 +13,6 @@ type GridManager struct {
 	walls map[string]shared.Coord
 }
 
-const playerSize int = 30
-
 // Creates a new grid manager for use in a logic node. Can perform checks on proposed coordinates.
 // Returns the created grid manager
 func CreateNewGridManager(settings shared.InitialGameSettings) (GridManager) {
@@ -27,13 +25,17 @@ func CreateNewGridManager(settings shared.InitialGameSettings) (GridManager) {
 	}
 
 	// Figure out how big our grid is
-	gridX := int(settings.WindowsX) / playerSize
-	gridY := int(settings.WindowsY) / playerSize
+	gridX, gridY := settings.GridSize()
 
 	gm := GridManager{x: gridX, y: gridY, walls: wallMap}
 	return gm
 }
 
+// Returns the width and height of the game board, in grid cells
+func (gm * GridManager) GetSize() (int, int) {
+	return gm.x, gm.y
+}
+
 // Checks if a given coordinate is in bounds on the current game board
 // Returns true if the coordinate is in bounds, false otherwise.
 func (gm * GridManager) IsInBounds(coord shared.Coord) (bool) {
@@ -74,11 +76,25 @@ func (gm * GridManager) IsNotTeleporting(origCoord shared.Coord, newCoord shared
 }
 
 func (gm * GridManager) GetRandomValidPos() (shared.Coord) {
+	return gm.randomValidPos(rand.Intn)
+}
+
+func (gm * GridManager) GetNewPos(oldMove shared.Coord) (shared.Coord) {
+	return gm.newPos(oldMove, rand.Intn)
+}
+
+// Same as GetNewPos, but draws from the given random source so that every node seeding it the same way respawns the
+// prey in the same place
+func (gm * GridManager) GetSeededNewPos(oldMove shared.Coord, r *rand.Rand) (shared.Coord) {
+	return gm.newPos(oldMove, r.Intn)
+}
+
+func (gm * GridManager) randomValidPos(intn func(int) int) (shared.Coord) {
 	var posX int
 	var posY int
 	for {
-		posX = rand.Intn(gm.x)
-		posY = rand.Intn(gm.y)
+		posX = intn(gm.x)
+		posY = intn(gm.y)
 		if gm.IsValidMove(shared.Coord{posX, posY}) {
 			break
 		}
@@ -86,8 +102,7 @@ func (gm * GridManager) GetRandomValidPos() (shared.Coord) {
 	return shared.Coord{X:posX, Y:posY}
 }
 
-
-func (gm * GridManager) GetNewPos(oldMove shared.Coord) (shared.Coord) {
+func (gm * GridManager) newPos(oldMove shared.Coord, intn func(int) int) (shared.Coord) {
 	posX := gm.x - oldMove.X
 	posY := gm.y - oldMove.Y
 
@@ -97,7 +112,7 @@ func (gm * GridManager) GetNewPos(oldMove shared.Coord) (shared.Coord) {
 
 	var pos shared.Coord
 	for {
-		pos = gm.GetRandomValidPos()
+		pos = gm.randomValidPos(intn)
 
 		if gm.isFarAway(oldMove.X, oldMove.Y, pos.X, pos.Y) {
 			break
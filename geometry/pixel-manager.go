@@ -1,50 +1,136 @@
 package geometry
 
 import (
+	"math"
 	"github.com/faiface/pixel"
 	"../shared"
 )
 
+// The board in the window shows the part of the map under a camera. Positions on the map are measured in pixels from
+// its bottom left corner, and positions on the board from the board's; the camera is where the board's bottom left
+// corner is on the map. On a map no bigger than the board, the camera stays at (0, 0) and the two are the same.
 type PixelManager struct {
 	x float64
 	y float64
 	spriteSize float64
 	wallVectors []pixel.Vec
 	scoreboardWidth float64
+
+	// The size of the map, in pixels
+	mapX float64
+	mapY float64
+
+	// Where the bottom left corner of the board is on the map
+	camera pixel.Vec
 }
 
-// Creates a new instance of a Geometry manager to handle movement.
+// Creates a new instance of a Geometry manager to handle movement, for a map the size of the board.
 // Takes the Pixel max dimensions of the window, the one-dimensional size of the square sprite and an array of wall coords.
 func CreatePixelManager(windowMaxX, windowMaxY, scoreboardWidth float64, spriteSize float64, walls []shared.Coord) (PixelManager) {
-	gm := PixelManager{x: windowMaxX, y: windowMaxY, spriteSize: spriteSize, scoreboardWidth: scoreboardWidth}
+	gm := PixelManager{x: windowMaxX, y: windowMaxY, spriteSize: spriteSize, scoreboardWidth: scoreboardWidth,
+		mapX: windowMaxX, mapY: windowMaxY}
 	gm.getWallVectors(walls)
 	return gm
 }
 
-// Takes a coordinate (x, y) value from the 'Wolfpack' grid and returns a Pixel-understandable vector.
+// Creates a new instance of a Geometry manager for the game's map, which scrolls if it is bigger than the board.
+// Takes the game's settings and the one-dimensional size of the square sprite.
+func CreateScrollingPixelManager(settings shared.InitialGameSettings, spriteSize float64) (PixelManager) {
+	gm := CreatePixelManager(settings.WindowsX, settings.WindowsY, settings.ScoreboardWidth, spriteSize,
+		settings.WallCoordinates)
+	gridX, gridY := settings.GridSize()
+	gm.mapX = math.Max(float64(gridX) * spriteSize, gm.x)
+	gm.mapY = math.Max(float64(gridY) * spriteSize, gm.y)
+	return gm
+}
+
+// Takes a coordinate (x, y) value from the 'Wolfpack' grid and returns a Pixel-understandable vector, on the board.
 func (gm *PixelManager) GetVectorFromCoords(coord shared.Coord) (pixel.Vec) {
+	return gm.ToBoard(gm.GetMapVectorFromCoords(coord))
+}
+
+// Takes a coordinate (x, y) value from the 'Wolfpack' grid and returns where it is on the map.
+func (gm *PixelManager) GetMapVectorFromCoords(coord shared.Coord) (pixel.Vec) {
 	xVec := float64(coord.X) * gm.spriteSize + 0.5 * gm.spriteSize
 	yVec := float64(coord.Y) * gm.spriteSize + 0.5 * gm.spriteSize
 	vec := pixel.V(xVec, yVec)
 	return vec
 }
 
+// Takes a position on the map and returns where it is on the board.
+func (gm *PixelManager) ToBoard(onMap pixel.Vec) (pixel.Vec) {
+	return pixel.V(onMap.X - gm.camera.X, onMap.Y - gm.camera.Y)
+}
+
+// Returns true if a sprite at the given position on the board can be seen, at least in part.
+func (gm *PixelManager) InView(onBoard pixel.Vec) (bool) {
+	half := gm.spriteSize / 2
+	return onBoard.X > -half && onBoard.X < gm.x + half && onBoard.Y > -half && onBoard.Y < gm.y + half
+}
+
+// Moves the camera so the given position on the map is in the middle of the board, or as near as it can be without
+// showing past the edge of the map.
+func (gm *PixelManager) CenterOn(onMap pixel.Vec) {
+	gm.camera = pixel.V(math.Max(0, math.Min(onMap.X - gm.x / 2, gm.mapX - gm.x)),
+		math.Max(0, math.Min(onMap.Y - gm.y / 2, gm.mapY - gm.y)))
+}
+
+// Returns where the bottom left corner of the board is on the map.
+func (gm *PixelManager) GetCamera() (pixel.Vec) {
+	return gm.camera
+}
+
+// Returns true if the map is bigger than the board, so the board shows only part of it.
+func (gm *PixelManager) Scrolls() (bool) {
+	return gm.mapX > gm.x || gm.mapY > gm.y
+}
+
+// Returns the width and height of the map (in pixels)
+func (gm *PixelManager) GetMapSize() (float64, float64) {
+	return gm.mapX, gm.mapY
+}
+
 // Takes a shared.Coord array and converts to a pixel vector array.
 // Assigns the vector array to the local "walls" attr.
 func (gm *PixelManager) getWallVectors(walls []shared.Coord) {
 	wallVecs := make([]pixel.Vec, len(walls))
 	for i, wall := range walls {
-		vec := gm.GetVectorFromCoords(wall)
+		vec := gm.GetMapVectorFromCoords(wall)
 		wallVecs[i] = vec
 	}
 	gm.wallVectors = wallVecs
 }
 
-// Returns all wall vectors for rendering.
+// Returns all wall vectors for rendering, on the board.
 func (gm *PixelManager) GetWallVectors() ([]pixel.Vec) {
+	if gm.camera.X == 0 && gm.camera.Y == 0 {
+		return gm.wallVectors
+	}
+	wallVecs := make([]pixel.Vec, len(gm.wallVectors))
+	for i, wall := range gm.wallVectors {
+		wallVecs[i] = gm.ToBoard(wall)
+	}
+	return wallVecs
+}
+
+// Returns the wall vectors, on the map.
+func (gm *PixelManager) GetMapWallVectors() ([]pixel.Vec) {
 	return gm.wallVectors
 }
 
+// Returns where the mini-map of a scrolling map goes in the scoreboard column: its bottom left corner, and how many
+// pixels wide a grid cell is on it. It is as wide as the column allows, less padding, but no taller than 40% of the
+// board, and sits above the player's score.
+func (gm *PixelManager) GetMinimap() (pixel.Vec, float64) {
+	const padding = 10
+	const bottom = 65 // clear of the score and held score lines
+	size := math.Min(gm.scoreboardWidth - 2 * padding, gm.y * 0.4)
+	cellsX, cellsY := gm.mapX / gm.spriteSize, gm.mapY / gm.spriteSize
+	cell := size / math.Max(cellsX, cellsY)
+	corner := pixel.V(gm.x + padding + (size - cellsX * cell) / 2, bottom + (size - cellsY * cell) / 2)
+	return corner, cell
+}
+
 // Returns the maximum gamespace X value (in pixels) as a float64
 func (gm *PixelManager) GetX() (float64) {
 	return gm.x
@@ -0,0 +1,150 @@
+package key_helpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+	"../wolferrors"
+)
+
+// The server can take RPCs over TLS. For a game that isn't behind a certificate from a public CA, CreateCerts makes a
+// local CA and a server certificate signed by it; the server is given the certificate and its key, and the nodes the
+// CA's certificate to check the server against.
+
+// The files CreateCerts writes, in the directory it is given
+const CA_CERT_FILE = "ca.pem"
+const CA_KEY_FILE = "ca-key.pem"
+const SERVER_CERT_FILE = "server.pem"
+const SERVER_KEY_FILE = "server-key.pem"
+
+// How long the certificates CreateCerts makes are valid
+const CERT_VALIDITY = 365 * 24 * time.Hour
+
+// The hosts a server certificate is made for when none are given
+var DefaultCertHosts = []string{"localhost", "127.0.0.1", "::1"}
+
+// Makes a CA and a server certificate for the given hosts (names or IP addresses), signed by the CA, and writes them to
+// the directory; keys are written with mode 0600
+// Returns an error if the directory can't be written, or already holds a CA
+func CreateCerts(dir string, hosts []string) (err error) {
+	if len(hosts) == 0 {
+		hosts = DefaultCertHosts
+	}
+	if _, err := os.Stat(filepath.Join(dir, CA_KEY_FILE)); err == nil {
+		return wolferrors.BadConfigError("there is already a CA in " + dir)
+	}
+	err = os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	caTemplate, err := certTemplate("Wolfpack local CA")
+	if err != nil {
+		return err
+	}
+	caTemplate.IsCA = true
+	caTemplate.BasicConstraintsValid = true
+	caTemplate.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+	caCert, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		return err
+	}
+
+	serverKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serverTemplate, err := certTemplate("Wolfpack server")
+	if err != nil {
+		return err
+	}
+	serverTemplate.KeyUsage = x509.KeyUsageDigitalSignature
+	serverTemplate.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			serverTemplate.IPAddresses = append(serverTemplate.IPAddresses, ip)
+		} else {
+			serverTemplate.DNSNames = append(serverTemplate.DNSNames, host)
+		}
+	}
+	serverDER, err := x509.CreateCertificate(rand.Reader, serverTemplate, caCert, &serverKey.PublicKey, caKey)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range []struct {
+		name  string
+		block *pem.Block
+		mode  os.FileMode
+	}{
+		{CA_CERT_FILE, &pem.Block{Type: "CERTIFICATE", Bytes: caDER}, 0644},
+		{SERVER_CERT_FILE, &pem.Block{Type: "CERTIFICATE", Bytes: serverDER}, 0644},
+		{CA_KEY_FILE, privateKeyBlock(caKey), 0600},
+		{SERVER_KEY_FILE, privateKeyBlock(serverKey), 0600},
+	} {
+		err = ioutil.WriteFile(filepath.Join(dir, file.name), pem.EncodeToMemory(file.block), file.mode)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the TLS config for dialing the server with the given name, trusting only the CA in the given file
+func ClientTLSConfig(caFile string, serverName string) (*tls.Config, error) {
+	caPEM, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(caPEM) {
+		return nil, wolferrors.BadConfigError("no certificates in " + caFile)
+	}
+	return &tls.Config{RootCAs: pool, ServerName: serverName, MinVersion: tls.VersionTLS12}, nil
+}
+
+// Returns the TLS config for a server with the certificate and key in the given files
+func ServerTLSConfig(certFile string, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+func certTemplate(commonName string) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(CERT_VALIDITY),
+	}, nil
+}
+
+func privateKeyBlock(privateKey *ecdsa.PrivateKey) (*pem.Block) {
+	der, _ := x509.MarshalPKCS8PrivateKey(privateKey)
+	return &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+}
@@ -1,74 +1,114 @@
 package key_helpers
 
 import (
+	"crypto"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"crypto/rand"
 	"encoding/pem"
 	"crypto/x509"
 	"log"
 	"crypto/elliptic"
+	"crypto/sha256"
 	"math/big"
+	"../shared"
+	"../wolferrors"
 )
 
+// Keys are encoded one way everywhere: public keys as PEM-encoded PKIX ("PUBLIC KEY"), and private keys as PEM-encoded
+// PKCS #8 ("PRIVATE KEY"). Both carry the key's algorithm and curve, so ECDSA keys on any curve and Ed25519 keys are
+// encoded and decoded the same way. Signatures are a pair of integers (r, s): the ECDSA signature, or the two 32-byte
+// halves of the Ed25519 one.
+
+// ECDSA over P-384, the default signing scheme
+const SCHEME_ECDSA = "ecdsa"
+
+// Ed25519, the alternative signing scheme
+const SCHEME_ED25519 = "ed25519"
+
 type ToVerify struct{
 	R *big.Int
 	S *big.Int
 }
 
-// Takes a public key that was converted into a string and turns it back into a public key
-// Returns the key
-func PublicKeyStringToKey(key string) *ecdsa.PublicKey {
-	publicKeyBytesRestored, _ := pem.Decode([]byte(key))
-	x509Encoded := publicKeyBytesRestored.Bytes
-	publicKey, err := x509.ParsePKIXPublicKey(x509Encoded)
+// Encodes a public key in the canonical encoding
+// Returns an error if the key is of a type that can't be encoded
+func EncodePublicKey(publicKey crypto.PublicKey) (string, error) {
+	// The server's records and older callers hold ECDSA keys by value
+	if value, ok := publicKey.(ecdsa.PublicKey); ok {
+		publicKey = &value
+	}
+	x509EncodedPub, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return "", wolferrors.BadKeyError(err.Error())
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509EncodedPub})), nil
+}
+
+// Decodes a public key in the canonical encoding
+// Returns the key, an *ecdsa.PublicKey or ed25519.PublicKey, or an error if the string isn't one
+func DecodePublicKey(key string) (crypto.PublicKey, error) {
+	block, _ := pem.Decode([]byte(key))
+	if block == nil {
+		return nil, wolferrors.BadKeyError("no PEM block found")
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
 	if err != nil {
-		log.Fatal("HERE", err)
+		return nil, wolferrors.BadKeyError(err.Error())
 	}
-	p, ok := publicKey.(*ecdsa.PublicKey)
-	if ok {
-		return p
-	} else {
-		log.Fatal("Not of type ecdsa.PublicKey")
-		return nil
+	switch publicKey.(type) {
+	case *ecdsa.PublicKey, ed25519.PublicKey:
+		return publicKey, nil
 	}
+	return nil, wolferrors.BadKeyError("not an ECDSA or Ed25519 key")
 }
 
 // Takes a private key that was converted into a string and turns it back into a private key
-// Returns the key
-func PrivateKeyStringToKey(key string) *ecdsa.PrivateKey {
+// Returns the key, an *ecdsa.PrivateKey or ed25519.PrivateKey, or an error if the string isn't one
+func ParsePrivateKey(key string) (crypto.Signer, error) {
 	privateKeyBytesRestored, _ := pem.Decode([]byte(key))
-	x509Encoded := privateKeyBytesRestored.Bytes
-	privateKey, err := x509.ParseECPrivateKey(x509Encoded)
+	if privateKeyBytesRestored == nil {
+		return nil, wolferrors.BadKeyError("no PEM block found")
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(privateKeyBytesRestored.Bytes)
 	if err != nil {
-		log.Fatal(err)
+		// Keys written before keys were PKCS #8 are SEC 1 EC keys
+		ecKey, ecErr := x509.ParseECPrivateKey(privateKeyBytesRestored.Bytes)
+		if ecErr != nil {
+			return nil, wolferrors.BadKeyError(err.Error())
+		}
+		return ecKey, nil
+	}
+	switch privateKey.(type) {
+	case *ecdsa.PrivateKey, ed25519.PrivateKey:
+		return privateKey.(crypto.Signer), nil
 	}
-	return privateKey
+	return nil, wolferrors.BadKeyError("not an ECDSA or Ed25519 key")
 }
 
 // Checks that the public and private keys that were restored from strings are still valid
 // Returns true if the key restore was successful
-func CheckKeyRestore(publicKey *ecdsa.PublicKey, privateKey *ecdsa.PrivateKey) bool {
+func CheckKeyRestore(publicKey crypto.PublicKey, privateKey crypto.Signer) bool {
 	data := []byte("data")
 	// Signing by private key
-	r, s, _ := ecdsa.Sign(rand.Reader, privateKey, data)
-
-	// Verifying against public key
-	if !ecdsa.Verify(publicKey, data, r, s) {
+	r, s, err := Sign(privateKey, data)
+	if err != nil {
 		return false
 	}
-	return true
+
+	// Verifying against public key
+	return Verify(publicKey, data, r, s)
 }
 
 // Encodes a public/private keypair to strings for easier storage and sending
 // https://stackoverflow.com/questions/21322182/how-to-store-ecdsa-private-key-in-go
-func Encode(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey) (privateKeyString string, publicKeyString string) {
-	x509Encoded, _ := x509.MarshalECPrivateKey(privateKey)
+func Encode(privateKey crypto.PrivateKey, publicKey crypto.PublicKey) (privateKeyString string, publicKeyString string) {
+	x509Encoded, _ := x509.MarshalPKCS8PrivateKey(privateKey)
 	pemEncoded := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: x509Encoded})
 
-	x509EncodedPub, _ := x509.MarshalPKIXPublicKey(publicKey)
-	pemEncodedPub := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: x509EncodedPub})
+	publicKeyString, _ = EncodePublicKey(publicKey)
 
-	return string(pemEncoded), string(pemEncodedPub)
+	return string(pemEncoded), publicKeyString
 }
 
 // Generates a new public/private keypair and returns them
@@ -81,15 +121,94 @@ func GenerateKeys() (*ecdsa.PublicKey, *ecdsa.PrivateKey){
 	return testPublicKey, testPrivateKey
 }
 
-// Converts a public key to string
-// Returns the string-encoded public key
-func PubKeyToString(key ecdsa.PublicKey) string {
-	return string(elliptic.Marshal(key.Curve, key.X, key.Y))
+// Generates a new keypair for the given signing scheme, SCHEME_ECDSA or SCHEME_ED25519
+// Returns an error if the scheme is unknown
+func GenerateKeysForScheme(scheme string) (crypto.PublicKey, crypto.Signer, error) {
+	switch scheme {
+	case SCHEME_ECDSA, "":
+		publicKey, privateKey := GenerateKeys()
+		return publicKey, privateKey, nil
+	case SCHEME_ED25519:
+		publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+		return publicKey, privateKey, err
+	}
+	return nil, nil, wolferrors.BadKeyError("unknown signing scheme " + scheme)
+}
+
+// Signs data with an ECDSA or Ed25519 private key
+// Returns the signature as the pair (r, s)
+func Sign(privateKey crypto.Signer, data []byte) (r, s *big.Int, err error) {
+	switch key := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		return ecdsa.Sign(rand.Reader, key, data)
+	case ed25519.PrivateKey:
+		signature := ed25519.Sign(key, data)
+		half := ed25519.SignatureSize / 2
+		return new(big.Int).SetBytes(signature[:half]), new(big.Int).SetBytes(signature[half:]), nil
+	}
+	return nil, nil, wolferrors.BadKeyError("not an ECDSA or Ed25519 key")
+}
+
+// Checks a signature made by Sign against an ECDSA or Ed25519 public key
+// Returns true if it is valid; false if not, or if the key is of another type
+func Verify(publicKey crypto.PublicKey, data []byte, r, s *big.Int) bool {
+	if r == nil || s == nil || r.Sign() < 0 || s.Sign() < 0 {
+		return false
+	}
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		return ecdsa.Verify(key, data, r, s)
+	case ed25519.PublicKey:
+		half := ed25519.SignatureSize / 2
+		if r.BitLen() > half*8 || s.BitLen() > half*8 {
+			return false
+		}
+		signature := make([]byte, ed25519.SignatureSize)
+		r.FillBytes(signature[:half])
+		s.FillBytes(signature[half:])
+		return ed25519.Verify(key, data, signature)
+	}
+	return false
+}
+
+// Converts a public key to a string in the canonical encoding, to key maps with and send
+// Returns the string-encoded public key, or "" if it can't be encoded
+func PubKeyToString(key crypto.PublicKey) string {
+	keyString, _ := EncodePublicKey(key)
+	return keyString
+}
+
+// Signs a call to one of the server's methods, over the nonce the server handed out for it
+// Returns the proof to send with the call
+func SignRPC(privateKey crypto.Signer, method string, nonce string) (shared.RPCAuth, error) {
+	auth := shared.RPCAuth{PubKey: PubKeyToString(privateKey.Public()), Nonce: nonce}
+	r, s, err := Sign(privateKey, rpcDigest(auth.PubKey, method, nonce))
+	if err != nil {
+		return shared.RPCAuth{}, err
+	}
+	auth.R = r.String()
+	auth.S = s.String()
+	return auth, nil
+}
+
+// Checks that a call to the given method was signed by the key it names
+// Returns the key if it was, or an error if it wasn't or the key is bad
+func VerifyRPC(auth shared.RPCAuth, method string) (crypto.PublicKey, error) {
+	publicKey, err := DecodePublicKey(auth.PubKey)
+	if err != nil {
+		return nil, err
+	}
+	r, okR := new(big.Int).SetString(auth.R, 10)
+	s, okS := new(big.Int).SetString(auth.S, 10)
+	if !okR || !okS || !Verify(publicKey, rpcDigest(auth.PubKey, method, auth.Nonce), r, s) {
+		return nil, wolferrors.UnauthenticatedError(method)
+	}
+	return publicKey, nil
 }
 
-// Decodes keys the way they are encoded by the above function
-func StringToPubKey(keyString string) ecdsa.PublicKey {
-	x, y := elliptic.Unmarshal(elliptic.P384(), []byte(keyString))
-	key := ecdsa.PublicKey{elliptic.P384(), x, y}
-	return key
+// The hash a call's signature is over; the fields are newline-separated, and none of them can hold a newline but the
+// PEM key, which comes last
+func rpcDigest(pubKey string, method string, nonce string) ([]byte) {
+	digest := sha256.Sum256([]byte("wolfpack rpc\n" + method + "\n" + nonce + "\n" + pubKey))
+	return digest[:]
 }
@@ -0,0 +1,283 @@
+package key_helpers
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"../wolferrors"
+)
+
+// A keystore is a directory of named identities. Each identity is a private key, in PEM in <name>.key, and its public
+// key in <name>.pub, so the public key can be exported without the passphrase. A private key given a passphrase is
+// encrypted with AES-256-GCM, under a key derived from the passphrase with PBKDF2-SHA256; the salt, nonce and
+// iteration count go in the PEM headers.
+
+// The identity used when none is named
+const DEFAULT_IDENTITY = "default"
+
+// The PBKDF2 iteration count for newly encrypted keys
+const KEY_ITERATIONS = 600000
+
+const KEY_CIPHER = "AES-256-GCM"
+
+type Keystore struct {
+	// The directory the identities are kept in
+	Dir    string
+
+	// The signing scheme new identities are created with (see GenerateKeysForScheme)
+	Scheme string
+}
+
+// Returns the keystore directory: $WOLFPACK_KEYSTORE if set, otherwise ~/.wolfpack/keys
+func DefaultKeystoreDir() (string) {
+	if dir := os.Getenv("WOLFPACK_KEYSTORE"); dir != "" {
+		return dir
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".wolfpack", "keys")
+	}
+	return filepath.Join(home, ".wolfpack", "keys")
+}
+
+// Returns the keystore in the given directory, which is created when the first identity is
+func OpenKeystore(dir string) (*Keystore) {
+	return &Keystore{Dir: dir}
+}
+
+// Generates a new identity and writes it to the keystore, encrypting the private key if a passphrase is given
+// Returns an error if the identity already exists or can't be written
+func (ks *Keystore) Create(name string, passphrase string) (crypto.Signer, error) {
+	keyPath, pubPath, err := ks.paths(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(keyPath); err == nil {
+		return nil, wolferrors.IdentityExistsError(name)
+	}
+	err = os.MkdirAll(ks.Dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	pubKey, privKey, err := GenerateKeysForScheme(ks.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	privPEM, err := EncodePrivateKey(privKey, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	_, pubPEM := Encode(privKey, pubKey)
+	// O_EXCL so two nodes creating the same identity at once don't overwrite each other's key
+	file, err := os.OpenFile(keyPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		if os.IsExist(err) {
+			return nil, wolferrors.IdentityExistsError(name)
+		}
+		return nil, err
+	}
+	_, err = file.Write(privPEM)
+	file.Close()
+	if err != nil {
+		os.Remove(keyPath)
+		return nil, err
+	}
+	err = ioutil.WriteFile(pubPath, []byte(pubPEM), 0644)
+	if err != nil {
+		return nil, err
+	}
+	return privKey, nil
+}
+
+// Loads an identity's private key from the keystore, decrypting it with the passphrase if it is encrypted
+// Returns an error if there is no such identity, or the passphrase is wrong
+func (ks *Keystore) Load(name string, passphrase string) (crypto.Signer, error) {
+	keyPath, _, err := ks.paths(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(keyPath); os.IsNotExist(err) {
+		return nil, wolferrors.UnknownIdentityError(name)
+	}
+	return LoadKeyFile(keyPath, passphrase)
+}
+
+// Loads an identity from the keystore, creating it first if it doesn't exist yet
+func (ks *Keystore) LoadOrCreate(name string, passphrase string) (crypto.Signer, error) {
+	privKey, err := ks.Load(name, passphrase)
+	if _, missing := err.(wolferrors.UnknownIdentityError); !missing {
+		return privKey, err
+	}
+	privKey, err = ks.Create(name, passphrase)
+	if _, exists := err.(wolferrors.IdentityExistsError); exists {
+		// Created by someone else in the meantime
+		return ks.Load(name, passphrase)
+	}
+	return privKey, err
+}
+
+// Returns the names of the identities in the keystore, sorted
+func (ks *Keystore) List() ([]string, error) {
+	files, err := ioutil.ReadDir(ks.Dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".key") {
+			names = append(names, strings.TrimSuffix(file.Name(), ".key"))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Returns true if the identity's private key is encrypted with a passphrase
+func (ks *Keystore) Encrypted(name string) (bool, error) {
+	keyPath, _, err := ks.paths(name)
+	if err != nil {
+		return false, err
+	}
+	data, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return false, err
+	}
+	block, _ := pem.Decode(data)
+	return block != nil && block.Headers["Cipher"] != "", nil
+}
+
+// Returns the identity's public key in PEM, as written by Encode
+func (ks *Keystore) ExportPublic(name string) (string, error) {
+	_, pubPath, err := ks.paths(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(pubPath)
+	if os.IsNotExist(err) {
+		return "", wolferrors.UnknownIdentityError(name)
+	}
+	return string(data), err
+}
+
+// Returns the paths of an identity's private and public key files
+// Returns an error if the name isn't a plain file name
+func (ks *Keystore) paths(name string) (keyPath string, pubPath string, err error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", "", wolferrors.UnknownIdentityError(name)
+	}
+	return filepath.Join(ks.Dir, name+".key"), filepath.Join(ks.Dir, name+".pub"), nil
+}
+
+// Loads a private key from a PEM file, decrypting it with the passphrase if it is encrypted
+func LoadKeyFile(path string, passphrase string) (crypto.Signer, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodePrivateKey(data, passphrase)
+}
+
+// Encodes a private key to PEM as Encode does, encrypting it if a passphrase is given
+func EncodePrivateKey(privKey crypto.Signer, passphrase string) ([]byte, error) {
+	privPEM, _ := Encode(privKey, privKey.Public())
+	if passphrase == "" {
+		return []byte(privPEM), nil
+	}
+	block, _ := pem.Decode([]byte(privPEM))
+
+	salt := make([]byte, 16)
+	_, err := rand.Read(salt)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := passphraseCipher(passphrase, salt, KEY_ITERATIONS)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return nil, err
+	}
+	encrypted := &pem.Block{
+		Type:    block.Type,
+		Headers: map[string]string{
+			"Cipher":     KEY_CIPHER,
+			"Iterations": strconv.Itoa(KEY_ITERATIONS),
+			"Salt":       hex.EncodeToString(salt),
+			"Nonce":      hex.EncodeToString(nonce),
+		},
+		Bytes:   aead.Seal(nil, nonce, block.Bytes, []byte(block.Type)),
+	}
+	return pem.EncodeToMemory(encrypted), nil
+}
+
+// Decodes a private key encoded by EncodePrivateKey
+// Returns an error if it isn't a private key, or is encrypted and the passphrase is wrong
+func DecodePrivateKey(data []byte, passphrase string) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, wolferrors.BadKeyError("no PEM block found")
+	}
+	if block.Headers["Cipher"] == "" {
+		return ParsePrivateKey(string(data))
+	}
+	if block.Headers["Cipher"] != KEY_CIPHER {
+		return nil, wolferrors.BadKeyError("unknown cipher " + block.Headers["Cipher"])
+	}
+	if passphrase == "" {
+		return nil, wolferrors.BadPassphraseError("key is encrypted; a passphrase is needed")
+	}
+	iterations, err := strconv.Atoi(block.Headers["Iterations"])
+	if err != nil {
+		return nil, wolferrors.BadKeyError("bad iteration count")
+	}
+	salt, err := hex.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, wolferrors.BadKeyError("bad salt")
+	}
+	nonce, err := hex.DecodeString(block.Headers["Nonce"])
+	if err != nil {
+		return nil, wolferrors.BadKeyError("bad nonce")
+	}
+	aead, err := passphraseCipher(passphrase, salt, iterations)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, wolferrors.BadKeyError("bad nonce")
+	}
+	plain, err := aead.Open(nil, nonce, block.Bytes, []byte(block.Type))
+	if err != nil {
+		return nil, wolferrors.BadPassphraseError("wrong passphrase, or the key file is corrupt")
+	}
+	return ParsePrivateKey(string(pem.EncodeToMemory(&pem.Block{Type: block.Type, Bytes: plain})))
+}
+
+// Derives the AES-GCM cipher for a passphrase
+func passphraseCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, passphrase, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,490 @@
+package key_helpers
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"sync"
+	"time"
+	"../shared"
+	"../wolferrors"
+)
+
+// Nodes in a game with EncryptTraffic set talk over sessions. Two nodes agree a session by each sending the other a
+// hello: a fresh X25519 public key, signed with the sender's identity key, which the receiver checks against the key
+// the server registered for the sender. Each side derives a key for each direction from the X25519 shared secret with
+// HKDF-SHA256, and every datagram after that is sealed with AES-256-GCM under the sender's key. A sealed datagram is
+// SEALED_MAGIC, the id of the key it was sealed under, a counter that makes up the nonce, and the ciphertext; the
+// receiver remembers which recent counters it has seen, so replayed datagrams are dropped. After REKEY_MESSAGES
+// datagrams or REKEY_INTERVAL, whichever comes first, the sender starts a new handshake; the session it replaces can
+// still open datagrams that were in flight until the one after it is agreed.
+
+// Sealed datagrams start with this, which no GoVector-encoded message does
+const SEALED_MAGIC = "WPS1"
+
+// Start a new session with a node after sealing this many datagrams for it
+const REKEY_MESSAGES = 1 << 20
+
+// Start a new session with a node once the current one is this old
+const REKEY_INTERVAL = 10 * time.Minute
+
+// Resend a hello that hasn't been answered after this long
+const HELLO_RETRY = time.Second
+
+// The most datagrams held for a node while a session with it is agreed; the oldest are dropped first
+const MAX_QUEUED = 64
+
+const keyIdSize = 8
+const counterSize = 8
+const headerSize = len(SEALED_MAGIC) + keyIdSize + counterSize
+
+// How many counters below the highest seen a receiver remembers
+const replayWindow = 64
+
+// The key for one direction of a session
+type sessionKey struct {
+	id      [keyIdSize]byte
+	aead    cipher.AEAD
+
+	// Sending: the counter for the next datagram
+	next    uint64
+
+	// Receiving: the highest counter seen, and which of the replayWindow counters up to it have been, the highest as
+	// the lowest bit
+	highest uint64
+	seen    uint64
+
+	// Receiving: the node that seals with the key
+	peer    string
+}
+
+type session struct {
+	send           *sessionKey
+	receive        *sessionKey
+
+	// The ephemeral key the other node agreed the session with, to spot a hello it resends
+	theirEphemeral []byte
+
+	// The hello we answered with when agreeing the session, if we did, to send again if the other node resends its own
+	reply          *shared.SessionHello
+
+	started        time.Time
+}
+
+// A handshake we have started, waiting for the other node's hello
+type pendingHello struct {
+	private *ecdh.PrivateKey
+	hello   *shared.SessionHello
+	sent    time.Time
+}
+
+type peerSessions struct {
+	current   *session
+	previous  *session
+	pending   *pendingHello
+
+	// The time of the last hello accepted from the node
+	lastHello int64
+
+	// Datagrams to seal once the current session is agreed
+	queued    [][]byte
+}
+
+// The sessions one node has with the others
+type SessionTable struct {
+	sync.Mutex
+
+	// The identifier this node's hellos are signed as
+	self          string
+	privKey       crypto.Signer
+	peers         map[string]*peerSessions
+
+	// Every key datagrams can currently be opened with, by id
+	keys          map[[keyIdSize]byte]*sessionKey
+
+	// When to start a new session; REKEY_MESSAGES and REKEY_INTERVAL unless changed, e.g. for testing
+	RekeyMessages uint64
+	RekeyInterval time.Duration
+}
+
+// Creates an empty session table for the node with the given identity key. Nothing can be sealed until the node's
+// identifier is set (see SetSelf)
+func CreateSessionTable(privKey crypto.Signer) (*SessionTable) {
+	return &SessionTable{
+		privKey:       privKey,
+		peers:         make(map[string]*peerSessions),
+		keys:          make(map[[keyIdSize]byte]*sessionKey),
+		RekeyMessages: REKEY_MESSAGES,
+		RekeyInterval: REKEY_INTERVAL,
+	}
+}
+
+// Sets the identifier this node's hellos are signed as, dropping any sessions agreed under another one
+func (t *SessionTable) SetSelf(identifier string) {
+	t.Lock()
+	defer t.Unlock()
+	if identifier == t.self {
+		return
+	}
+	t.self = identifier
+	t.peers = make(map[string]*peerSessions)
+	t.keys = make(map[[keyIdSize]byte]*sessionKey)
+}
+
+// Returns true if the datagram was sealed by a session table
+func IsSealed(datagram []byte) (bool) {
+	return len(datagram) >= headerSize && string(datagram[:len(SEALED_MAGIC)]) == SEALED_MAGIC
+}
+
+// Returns true if a session has been agreed with the given node
+func (t *SessionTable) Established(peer string) (bool) {
+	t.Lock()
+	defer t.Unlock()
+	state, ok := t.peers[peer]
+	return ok && state.current != nil
+}
+
+// Seals a datagram for the given node. With no session agreed with it yet, the datagram is held until there is one
+// (see HandleHello), and nil is returned. Also returns a hello to send the node, if a handshake needs starting or
+// its hello has gone unanswered.
+func (t *SessionTable) Seal(peer string, plaintext []byte) (sealed []byte, hello *shared.SessionHello, err error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.self == "" {
+		return nil, nil, wolferrors.SessionError("no identifier to sign hellos as")
+	}
+	state := t.peerSessions(peer)
+	now := time.Now()
+	if state.current == nil {
+		if len(state.queued) == MAX_QUEUED {
+			state.queued = state.queued[1:]
+		}
+		state.queued = append(state.queued, plaintext)
+		hello, err = t.helloFor(peer, state, now)
+		return nil, hello, err
+	}
+	sealed = state.current.send.seal(plaintext)
+	if state.pending != nil || state.current.send.next > t.RekeyMessages ||
+		now.Sub(state.current.started) >= t.RekeyInterval {
+		hello, err = t.helloFor(peer, state, now)
+	}
+	return sealed, hello, err
+}
+
+// Opens a datagram another node sealed for this one
+// Returns the identifier of the node that sealed it and its contents, or an error if it wasn't sealed under a current
+// session, has been tampered with, or has been opened before
+func (t *SessionTable) Open(sealed []byte) (peer string, plaintext []byte, err error) {
+	if !IsSealed(sealed) {
+		return "", nil, wolferrors.SessionError("not a sealed datagram")
+	}
+	var id [keyIdSize]byte
+	copy(id[:], sealed[len(SEALED_MAGIC):])
+	counter := binary.BigEndian.Uint64(sealed[len(SEALED_MAGIC)+keyIdSize:headerSize])
+
+	t.Lock()
+	defer t.Unlock()
+	key, ok := t.keys[id]
+	if !ok {
+		return "", nil, wolferrors.SessionError("unknown session key")
+	}
+	if !key.fresh(counter) {
+		return "", nil, wolferrors.SessionError("replayed datagram")
+	}
+	plaintext, err = key.aead.Open(nil, nonce(counter), sealed[headerSize:], sealed[:headerSize])
+	if err != nil {
+		return "", nil, wolferrors.SessionError("datagram failed authentication")
+	}
+	key.mark(counter)
+	return key.peer, plaintext, nil
+}
+
+// Handles a hello from another node, given the identity key the server registered for it, agreeing a new session
+// Returns the hello to answer with, if one is needed, and the datagrams held for the node, now sealed; or an error if
+// the hello isn't for this node, isn't signed with the node's key, or is older than one already accepted
+func (t *SessionTable) HandleHello(peer string, peerKey crypto.PublicKey,
+	hello *shared.SessionHello) (reply *shared.SessionHello, queued [][]byte, err error) {
+	if hello == nil {
+		return nil, nil, wolferrors.SessionError("empty hello")
+	}
+	t.Lock()
+	defer t.Unlock()
+	if t.self == "" || hello.To != t.self {
+		return nil, nil, wolferrors.SessionError("hello for another node")
+	}
+	state := t.peerSessions(peer)
+	if state.current != nil && bytes.Equal(hello.Ephemeral, state.current.theirEphemeral) {
+		// The node resent its hello before our answer reached it
+		if !hello.Reply && state.current.reply != nil {
+			return state.current.reply, nil, nil
+		}
+		return nil, nil, nil
+	}
+	if hello.Time <= state.lastHello {
+		return nil, nil, wolferrors.SessionError("replayed hello")
+	}
+	if !verifyHello(peer, peerKey, hello) {
+		return nil, nil, wolferrors.SessionError("hello not signed by " + peer)
+	}
+	theirEphemeral, err := ecdh.X25519().NewPublicKey(hello.Ephemeral)
+	if err != nil {
+		return nil, nil, wolferrors.SessionError("bad ephemeral key")
+	}
+
+	// If we started a handshake too, both sides agree on the two hellos already sent
+	pending := state.pending
+	if pending == nil {
+		if hello.Reply {
+			return nil, nil, wolferrors.SessionError("answer to a hello that wasn't sent")
+		}
+		pending, err = t.newPending(peer, time.Now())
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	if !hello.Reply {
+		reply, err = t.signHello(peer, pending.private, pending.hello.Time, true)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	secret, err := pending.private.ECDH(theirEphemeral)
+	if err != nil {
+		return nil, nil, wolferrors.SessionError("bad ephemeral key")
+	}
+	current, err := t.agree(peer, secret, pending.private.PublicKey().Bytes(), hello.Ephemeral)
+	if err != nil {
+		return nil, nil, err
+	}
+	current.reply = reply
+
+	state.lastHello = hello.Time
+	state.pending = nil
+	if state.previous != nil {
+		delete(t.keys, state.previous.receive.id)
+	}
+	state.previous = state.current
+	state.current = current
+	t.keys[current.receive.id] = current.receive
+	for _, plaintext := range state.queued {
+		queued = append(queued, current.send.seal(plaintext))
+	}
+	state.queued = nil
+	return reply, queued, nil
+}
+
+// Returns the hellos that have gone unanswered for HELLO_RETRY, by the node they are for, to be sent again
+func (t *SessionTable) Unanswered() (map[string]*shared.SessionHello) {
+	t.Lock()
+	defer t.Unlock()
+	hellos := make(map[string]*shared.SessionHello)
+	now := time.Now()
+	for peer, state := range t.peers {
+		if state.pending != nil && now.Sub(state.pending.sent) >= HELLO_RETRY {
+			state.pending.sent = now
+			hellos[peer] = state.pending.hello
+		}
+	}
+	return hellos
+}
+
+// Drops the sessions with a node that has left the game
+func (t *SessionTable) Forget(peer string) {
+	t.Lock()
+	defer t.Unlock()
+	state, ok := t.peers[peer]
+	if !ok {
+		return
+	}
+	for _, old := range []*session{state.current, state.previous} {
+		if old != nil {
+			delete(t.keys, old.receive.id)
+		}
+	}
+	delete(t.peers, peer)
+}
+
+func (t *SessionTable) peerSessions(peer string) (*peerSessions) {
+	state, ok := t.peers[peer]
+	if !ok {
+		state = &peerSessions{}
+		t.peers[peer] = state
+	}
+	return state
+}
+
+// Returns the hello to send a node: a new one if no handshake has been started, the pending one again if it has gone
+// unanswered for HELLO_RETRY, or nil
+func (t *SessionTable) helloFor(peer string, state *peerSessions, now time.Time) (*shared.SessionHello, error) {
+	if state.pending == nil {
+		pending, err := t.newPending(peer, now)
+		if err != nil {
+			return nil, err
+		}
+		state.pending = pending
+		return pending.hello, nil
+	}
+	if now.Sub(state.pending.sent) < HELLO_RETRY {
+		return nil, nil
+	}
+	state.pending.sent = now
+	return state.pending.hello, nil
+}
+
+// Makes a new ephemeral key, and the hello that offers it to a node
+func (t *SessionTable) newPending(peer string, now time.Time) (*pendingHello, error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	hello, err := t.signHello(peer, private, now.UnixNano(), false)
+	if err != nil {
+		return nil, err
+	}
+	return &pendingHello{private: private, hello: hello, sent: now}, nil
+}
+
+func (t *SessionTable) signHello(peer string, private *ecdh.PrivateKey, when int64,
+	reply bool) (*shared.SessionHello, error) {
+	hello := &shared.SessionHello{To: peer, Ephemeral: private.PublicKey().Bytes(), Time: when, Reply: reply}
+	digest := helloDigest(t.self, hello)
+	r, s, err := Sign(t.privKey, digest)
+	if err != nil {
+		return nil, err
+	}
+	hello.R = r.String()
+	hello.S = s.String()
+	return hello, nil
+}
+
+func verifyHello(from string, pubKey crypto.PublicKey, hello *shared.SessionHello) (bool) {
+	r, ok := new(big.Int).SetString(hello.R, 10)
+	if !ok {
+		return false
+	}
+	s, ok := new(big.Int).SetString(hello.S, 10)
+	if !ok {
+		return false
+	}
+	return Verify(pubKey, helloDigest(from, hello), r, s)
+}
+
+// The hash a hello's signature is over: who it is from and to, as well as its contents, so it can't be passed off as
+// coming from or going to any other node
+func helloDigest(from string, hello *shared.SessionHello) ([]byte) {
+	digest := sha256.New()
+	digest.Write([]byte("wolfpack hello"))
+	writeField(digest, []byte(from))
+	writeField(digest, []byte(hello.To))
+	writeField(digest, hello.Ephemeral)
+	binary.Write(digest, binary.BigEndian, hello.Time)
+	binary.Write(digest, binary.BigEndian, hello.Reply)
+	return digest.Sum(nil)
+}
+
+// Writes a length-prefixed field, so fields can't run into each other
+func writeField(w io.Writer, field []byte) {
+	binary.Write(w, binary.BigEndian, uint32(len(field)))
+	w.Write(field)
+}
+
+// Derives a session's keys from the shared secret. Both nodes hash the same transcript, ordered by identifier, so
+// they derive the same pair of keys.
+func (t *SessionTable) agree(peer string, secret []byte, ours []byte, theirs []byte) (*session, error) {
+	lowId, highId, lowEphemeral, highEphemeral := t.self, peer, ours, theirs
+	if peer < t.self {
+		lowId, highId, lowEphemeral, highEphemeral = peer, t.self, theirs, ours
+	}
+	transcript := sha256.New()
+	writeField(transcript, []byte(lowId))
+	writeField(transcript, []byte(highId))
+	writeField(transcript, lowEphemeral)
+	writeField(transcript, highEphemeral)
+	salt := transcript.Sum(nil)
+
+	send, err := deriveKey(secret, salt, t.self, peer)
+	if err != nil {
+		return nil, err
+	}
+	receive, err := deriveKey(secret, salt, peer, t.self)
+	if err != nil {
+		return nil, err
+	}
+	receive.peer = peer
+	return &session{send: send, receive: receive, theirEphemeral: theirs, started: time.Now()}, nil
+}
+
+// Derives the key datagrams from one node to another are sealed with, and its id
+func deriveKey(secret []byte, salt []byte, from string, to string) (*sessionKey, error) {
+	material, err := hkdf.Key(sha256.New, secret, salt, "wolfpack session "+from+" > "+to, 32+keyIdSize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(material[:32])
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	key := &sessionKey{aead: aead, next: 1}
+	copy(key.id[:], material[32:])
+	return key, nil
+}
+
+// Seals a datagram under the key with its next counter
+func (k *sessionKey) seal(plaintext []byte) ([]byte) {
+	counter := k.next
+	k.next++
+	sealed := make([]byte, headerSize, headerSize+len(plaintext)+k.aead.Overhead())
+	copy(sealed, SEALED_MAGIC)
+	copy(sealed[len(SEALED_MAGIC):], k.id[:])
+	binary.BigEndian.PutUint64(sealed[len(SEALED_MAGIC)+keyIdSize:], counter)
+	return k.aead.Seal(sealed, nonce(counter), plaintext, sealed[:headerSize])
+}
+
+// Returns true if a datagram with this counter hasn't been opened, and isn't too old to tell
+func (k *sessionKey) fresh(counter uint64) (bool) {
+	if counter == 0 {
+		return false
+	}
+	if counter > k.highest {
+		return true
+	}
+	if k.highest-counter >= replayWindow {
+		return false
+	}
+	return k.seen&(1<<(k.highest-counter)) == 0
+}
+
+// Records that a datagram with this counter has been opened
+func (k *sessionKey) mark(counter uint64) {
+	if counter > k.highest {
+		shift := counter - k.highest
+		if shift >= replayWindow {
+			k.seen = 0
+		} else {
+			k.seen <<= shift
+		}
+		k.seen |= 1
+		k.highest = counter
+		return
+	}
+	k.seen |= 1 << (k.highest - counter)
+}
+
+// The GCM nonce for a counter; each key seals each counter once
+func nonce(counter uint64) ([]byte) {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[12-counterSize:], counter)
+	return nonce
+}
@@ -0,0 +1,73 @@
+package impl
+
+import (
+	"math"
+	"math/rand"
+	"../../geometry"
+	"../../shared"
+)
+
+// Bots pick their next move with a strategy: given the grid, the bot's position and the prey's, it returns "up",
+// "down", "left", "right" or "still".
+type BotStrategy func(geo *geometry.GridManager, me shared.Coord, prey shared.Coord) string
+
+// Heads for the prey until within 3 cells of it, then wanders close by
+const BOT_CHASE = "chase"
+
+// Moves in a random valid direction each step
+const BOT_RANDOM = "random"
+
+var BotStrategies = map[string]BotStrategy{
+	BOT_CHASE:  chaseStrategy,
+	BOT_RANDOM: randomStrategy,
+}
+
+func chaseStrategy(geo *geometry.GridManager, myState shared.Coord, prey shared.Coord) string {
+	command := "still"
+	minVal := abs(myState.X-prey.X)+ abs(myState.Y-prey.Y)
+	if minVal <= 3{
+		minVal = math.MaxInt8
+	}
+	for _,i:= range []int{-1,1}{
+		val := abs(myState.X+i-prey.X)+ abs(myState.Y-prey.Y)
+		if val < minVal && geo.IsValidMove(shared.Coord{myState.X+i, myState.Y}) {
+			minVal = val
+			if i == -1{
+				command = "left"
+			}else{
+				command = "right"
+			}
+		}
+	}
+	for _,j:= range []int{-1,1}{
+		val := abs(myState.X-prey.X)+ abs(myState.Y+j-prey.Y)
+		if val < minVal &&  geo.IsValidMove(shared.Coord{myState.X, myState.Y+j}) {
+			minVal = val
+			if j == -1{
+				command = "down"
+			}else{
+				command = "up"
+			}
+		}
+	}
+	return command
+}
+
+func randomStrategy(geo *geometry.GridManager, myState shared.Coord, prey shared.Coord) string {
+	steps := map[string]shared.Coord{
+		"up":    {myState.X, myState.Y + 1},
+		"down":  {myState.X, myState.Y - 1},
+		"left":  {myState.X - 1, myState.Y},
+		"right": {myState.X + 1, myState.Y},
+	}
+	valid := []string{}
+	for _, command := range []string{"up", "down", "left", "right"} {
+		if geo.IsValidMove(steps[command]) {
+			valid = append(valid, command)
+		}
+	}
+	if len(valid) == 0 {
+		return "still"
+	}
+	return valid[rand.Intn(len(valid))]
+}
@@ -0,0 +1,163 @@
+package impl
+
+import (
+	"sync"
+	"github.com/rzlim08/GoVector/govec"
+	"../../wolferrors"
+)
+
+// Causal ordering of prey captures.
+//
+// Every NodeMessage carries the vector timestamp GoVector gave it on send (NodeMessage.VClock). Captures are keyed by
+// the prey move they claim (PreySeq), and only one capture per prey move can stand. When two captures claim the same
+// prey move, every node picks the same winner:
+//
+//   1. if one capture happened before the other (by vector clock), the earlier one wins;
+//   2. otherwise they are concurrent, and the one stamped with the lower game tick wins;
+//   3. if the ticks are equal too, the capture from the lexicographically smaller node identifier wins.
+//
+// A capture is stale, and rejected outright, if its vector clock shows the capturer had already heard from the prey
+// after the prey's next move; that is, the capture happened causally after the prey moved on.
+
+// The prefix GoVector process ids are given, followed by the node identifier
+const GOVEC_PREFIX = "LogicNodeId-"
+
+// How far behind the newest claim (in prey sequence numbers) old claims are forgotten
+const CLAIM_HISTORY = 1000
+
+// A single node's claim to have captured the prey
+type CaptureClaim struct {
+	Identifier string
+	// The capturer's move sequence number at the capture; with Identifier, it names the capture's score event
+	Seq        uint64
+	PreySeq    uint64
+	Tick       uint64
+	VClock     map[string]uint64
+	// The capturer's partition view when it made the capture; see partition.go
+	View       []string
+	Members    int
+}
+
+// Decides which captures stand, following the rules above
+type CaptureArbiter struct {
+	sync.Mutex
+
+	// The prey's own clock entry at each of its recent moves, by prey sequence number
+	preyMoveClocks map[uint64]uint64
+
+	// The claim currently standing for each prey move
+	claims map[uint64]*CaptureClaim
+}
+
+// Creates an empty capture arbiter
+func CreateCaptureArbiter() (*CaptureArbiter) {
+	return &CaptureArbiter{
+		preyMoveClocks: make(map[uint64]uint64),
+		claims:         make(map[uint64]*CaptureClaim),
+	}
+}
+
+// Remembers the vector timestamp of a prey move so later captures can be checked against it
+func (ca *CaptureArbiter) RecordPreyMove(seq uint64, vclock map[string]uint64) {
+	ca.Lock()
+	defer ca.Unlock()
+	ca.preyMoveClocks[seq] = vclock[GOVEC_PREFIX+"prey"]
+	// Only the last few moves can still be claimed
+	delete(ca.preyMoveClocks, seq-NUMMOVESTOKEEP)
+}
+
+// Checks that the claim wasn't made after the capturer had already seen the prey move on from the position it claims
+// Returns InvalidPreyCaptureError if it was
+func (ca *CaptureArbiter) CheckNotStale(claim *CaptureClaim) (err error) {
+	ca.Lock()
+	defer ca.Unlock()
+	if claim.VClock == nil {
+		return nil
+	}
+	nextMove, ok := ca.preyMoveClocks[claim.PreySeq+1]
+	if ok && claim.VClock[GOVEC_PREFIX+"prey"] >= nextMove {
+		return wolferrors.InvalidPreyCaptureError(claim.Identifier)
+	}
+	return nil
+}
+
+// Returns true if the claim would win against the claim currently standing for its prey move (or there is none)
+func (ca *CaptureArbiter) Beats(claim *CaptureClaim) (bool) {
+	ca.Lock()
+	defer ca.Unlock()
+	current, ok := ca.claims[claim.PreySeq]
+	return !ok || current.Identifier == claim.Identifier || claimBefore(claim, current)
+}
+
+// Records the claim as the one standing for its prey move
+// Returns the claim it displaced, or nil if it is the first for that move (or a repeat of the standing claim)
+func (ca *CaptureArbiter) Record(claim *CaptureClaim) (displaced *CaptureClaim) {
+	ca.Lock()
+	defer ca.Unlock()
+	current, ok := ca.claims[claim.PreySeq]
+	ca.claims[claim.PreySeq] = claim
+	for seq := range ca.claims {
+		if seq+CLAIM_HISTORY < claim.PreySeq {
+			delete(ca.claims, seq)
+		}
+	}
+	if ok && current.Identifier != claim.Identifier {
+		return current
+	}
+	return nil
+}
+
+// Returns true if a should win over b
+func claimBefore(a, b *CaptureClaim) (bool) {
+	if a.VClock != nil && b.VClock != nil {
+		switch CompareClocks(a.VClock, b.VClock) {
+		case -1:
+			return true
+		case 1:
+			return false
+		}
+	}
+	if a.Tick != b.Tick {
+		return a.Tick < b.Tick
+	}
+	return a.Identifier < b.Identifier
+}
+
+// Compares two vector clocks
+// Returns -1 if a happened before b, 1 if b happened before a, and 0 if they are equal or concurrent
+func CompareClocks(a, b map[string]uint64) (int) {
+	aBefore, bBefore := false, false
+	for id, aTime := range a {
+		if aTime < b[id] {
+			aBefore = true
+		} else if aTime > b[id] {
+			bBefore = true
+		}
+	}
+	for id, bTime := range b {
+		if _, ok := a[id]; !ok && bTime > 0 {
+			aBefore = true
+		}
+	}
+	switch {
+	case aBefore && !bBefore:
+		return -1
+	case bBefore && !aBefore:
+		return 1
+	}
+	return 0
+}
+
+// Returns the vector timestamp GoVector will give the next message sent by the given node: the current clock with
+// that node's own entry ticked
+func NextVectorTimestamp(goLog *govec.GoLog, identifier string) (map[string]uint64) {
+	if goLog == nil {
+		return nil
+	}
+	vclock := make(map[string]uint64)
+	for id, count := range goLog.GetCurrentVCAsClock() {
+		vclock[id] = count
+	}
+	vclock[GOVEC_PREFIX+identifier]++
+	return vclock
+}
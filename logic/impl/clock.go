@@ -0,0 +1,180 @@
+package impl
+
+import (
+	"container/heap"
+	"crypto"
+	"net/rpc"
+	"sync"
+	"time"
+)
+
+// Tick length used if the server's config doesn't give one
+const DEFAULT_TICK_MS = 50
+
+// Number of round trips made to the server each time the clock is synchronised; the fastest one is kept
+const CLOCK_SYNC_SAMPLES = 5
+
+// How often the clock is resynchronised with the server
+const CLOCK_SYNC_INTERVAL = 10 * time.Second
+
+// The game clock, shared by every node in a game. Local time is corrected by an offset estimated against the server's
+// clock (NTP-style), and game time is divided into fixed-length ticks that every move, capture and prey step is
+// stamped with.
+type GameClock struct {
+	sync.RWMutex
+
+	// Amount to add to the local clock to get the server's clock
+	offset time.Duration
+
+	// Length of a single tick
+	tickDuration time.Duration
+}
+
+// Creates a game clock with no offset and ticks of the given length in milliseconds (DEFAULT_TICK_MS if 0)
+func CreateGameClock(tickMs uint32) (*GameClock) {
+	clock := &GameClock{}
+	clock.SetTickDuration(tickMs)
+	return clock
+}
+
+// Sets the tick length in milliseconds, using DEFAULT_TICK_MS if 0
+func (c *GameClock) SetTickDuration(tickMs uint32) {
+	if tickMs == 0 {
+		tickMs = DEFAULT_TICK_MS
+	}
+	c.Lock()
+	c.tickDuration = time.Duration(tickMs) * time.Millisecond
+	c.Unlock()
+}
+
+// Returns the length of a tick
+func (c *GameClock) TickDuration() (time.Duration) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.tickDuration
+}
+
+// Returns the current estimate of the offset between the server's clock and the local one
+func (c *GameClock) Offset() (time.Duration) {
+	c.RLock()
+	defer c.RUnlock()
+	return c.offset
+}
+
+// Returns the current time on the server's clock
+func (c *GameClock) Now() (time.Time) {
+	return time.Now().Add(c.Offset())
+}
+
+// Returns the tick the game is currently in
+func (c *GameClock) CurrentTick() (uint64) {
+	return uint64(c.Now().UnixNano() / int64(c.TickDuration()))
+}
+
+// Returns how long until the given tick starts, or 0 if it already has
+func (c *GameClock) UntilTick(tick uint64) (time.Duration) {
+	start := time.Unix(0, int64(tick)*int64(c.TickDuration()))
+	wait := start.Sub(c.Now())
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Synchronises the clock with the server over the given RPC connection. Makes CLOCK_SYNC_SAMPLES calls to
+// GServer.GetTime, each signed with privKey, and for the one with the shortest round trip assumes the server read its
+// clock halfway through. Only the GetTime call itself is timed, not getting the nonce to sign it over.
+func (c *GameClock) Sync(conn *rpc.Client, privKey crypto.Signer) (err error) {
+	var bestRtt time.Duration = -1
+	var bestOffset time.Duration
+	for i := 0; i < CLOCK_SYNC_SAMPLES; i++ {
+		auth, signErr := SignServerCall(conn, privKey, "GServer.GetTime")
+		if signErr != nil {
+			return signErr
+		}
+		var serverNanos int64
+		sent := time.Now()
+		err = conn.Call("GServer.GetTime", auth, &serverNanos)
+		received := time.Now()
+		if err != nil {
+			return err
+		}
+		rtt := received.Sub(sent)
+		if bestRtt < 0 || rtt < bestRtt {
+			bestRtt = rtt
+			bestOffset = time.Unix(0, serverNanos).Sub(sent.Add(rtt / 2))
+		}
+	}
+	c.Lock()
+	c.offset = bestOffset
+	c.Unlock()
+	return nil
+}
+
+// A message stamped with the tick it was sent in, waiting to be applied in tick order
+type TickedMessage struct {
+	Tick       uint64
+	Identifier string
+	Seq        uint64
+
+	// Applies the message to this node's game state
+	Apply func()
+}
+
+// Holds received messages until their tick comes around, then hands them out in tick order. Messages stamped with
+// the same tick are ordered by sender identifier then sequence number, so every node applies them the same way.
+type TickQueue struct {
+	sync.Mutex
+	messages tickHeap
+}
+
+// Adds a message to the queue
+func (q *TickQueue) Push(message *TickedMessage) {
+	q.Lock()
+	defer q.Unlock()
+	heap.Push(&q.messages, message)
+}
+
+// Removes and returns every queued message stamped at or before the given tick, in the order they should be applied
+func (q *TickQueue) PopUpTo(tick uint64) ([]*TickedMessage) {
+	q.Lock()
+	defer q.Unlock()
+	var ready []*TickedMessage
+	for len(q.messages) > 0 && q.messages[0].Tick <= tick {
+		ready = append(ready, heap.Pop(&q.messages).(*TickedMessage))
+	}
+	return ready
+}
+
+// Returns the number of messages still waiting for their tick
+func (q *TickQueue) Len() (int) {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.messages)
+}
+
+// container/heap implementation backing TickQueue
+type tickHeap []*TickedMessage
+
+func (h tickHeap) Len() int { return len(h) }
+
+func (h tickHeap) Less(i, j int) bool {
+	if h[i].Tick != h[j].Tick {
+		return h[i].Tick < h[j].Tick
+	}
+	if h[i].Identifier != h[j].Identifier {
+		return h[i].Identifier < h[j].Identifier
+	}
+	return h[i].Seq < h[j].Seq
+}
+
+func (h tickHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *tickHeap) Push(x interface{}) { *h = append(*h, x.(*TickedMessage)) }
+
+func (h *tickHeap) Pop() interface{} {
+	old := *h
+	last := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return last
+}
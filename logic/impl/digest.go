@@ -0,0 +1,97 @@
+package impl
+
+import (
+	"crypto/md5"
+	"sort"
+	"strconv"
+	"../../shared"
+)
+
+// Anti-entropy for the game state.
+//
+// Every node periodically broadcasts a digest of its game state: a hash over its own position, every score and the
+// prey epoch. A node receiving a digest works out its own digest of the same things, with where it thinks the sender
+// is, and counts a mismatch if they differ. Moves still in flight make the odd mismatch normal, so only a peer whose
+// digest has disagreed twice in a row is treated as diverged; the two nodes then swap game states and each merges the
+// other's into its own (see MergeGameState).
+//
+// A digest only covers what that merge can repair. Each node is the authority on its own position, so every node's
+// view of a player's position is checked by that player's digests and repaired from that player's game state; two
+// nodes that disagree about where a third is leave it to the third. The prey's position isn't covered at all, as no
+// wolf is the authority on it; its epoch is, and a node behind on it takes the prey from the node ahead.
+
+// How often, in milliseconds, each node broadcasts its digest if the game config doesn't say
+const DEFAULT_DIGEST_MS = 1000
+
+// Returns the digest the given node (owner) would send of the game state and prey epoch: over the owner's position,
+// every score and the prey epoch. Two nodes that agree on those get the same digest, whatever order their maps happen
+// to iterate in. The owner's position is left out unless asked for, for games with an interest radius, where nodes
+// only know roughly where far away nodes are.
+func GameStateDigest(gameState *shared.GameState, preyEpoch uint64, owner string, positions bool) ([]byte) {
+	hash := md5.New()
+	arr := make([]byte, 0, 512)
+
+	arr = strconv.AppendQuote(arr, owner)
+	if positions {
+		gameState.PlayerLocs.RLock()
+		if pos, ok := gameState.PlayerLocs.Data[owner]; ok {
+			arr = strconv.AppendInt(arr, int64(pos.X), 10)
+			arr = append(arr, ',')
+			arr = strconv.AppendInt(arr, int64(pos.Y), 10)
+		}
+		gameState.PlayerLocs.RUnlock()
+	}
+	arr = append(arr, ';')
+
+	gameState.PlayerScores.RLock()
+	ids := make([]string, 0, len(gameState.PlayerScores.Data))
+	for id, score := range gameState.PlayerScores.Data {
+		// A score of nothing is the same as no score; nodes that haven't seen a player score may not list them
+		if score != 0 {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		arr = strconv.AppendQuote(arr, id)
+		arr = strconv.AppendInt(arr, int64(gameState.PlayerScores.Data[id]), 10)
+	}
+	gameState.PlayerScores.RUnlock()
+	arr = append(arr, ';')
+
+	arr = strconv.AppendUint(arr, preyEpoch, 10)
+
+	hash.Write(arr)
+	return hash.Sum(nil)
+}
+
+// Merges a game state received from another node (sender) into this node's (self's) game state:
+//   - each node is the authority on its own position, so the sender's position is taken from the sender, and ours is
+//     never overwritten; other nodes' positions are left for them to repair, as their own digests reach us;
+//   - the prey's position is taken from whichever side is on the later prey epoch;
+//   - scores are merged as replicated counters (see MergeScores).
+// Returns the merged prey epoch, and whether anything in the local game state changed
+func MergeGameState(local *shared.GameState, localEpoch uint64, self string,
+	remote *shared.GameState, remoteEpoch uint64, sender string) (epoch uint64, changed bool) {
+	epoch = localEpoch
+
+	local.PlayerLocs.Lock()
+	if pos, ok := remote.PlayerLocs.Data[sender]; ok && sender != self && local.PlayerLocs.Data[sender] != pos {
+		local.PlayerLocs.Data[sender] = pos
+		changed = true
+	}
+	if remoteEpoch > localEpoch {
+		epoch = remoteEpoch
+		changed = true
+		if pos, ok := remote.PlayerLocs.Data["prey"]; ok {
+			local.PlayerLocs.Data["prey"] = pos
+		}
+	}
+	local.PlayerLocs.Unlock()
+
+	if MergeScores(&local.PlayerScores, &remote.PlayerScores) {
+		changed = true
+	}
+
+	return epoch, changed
+}
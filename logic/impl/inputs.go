@@ -0,0 +1,121 @@
+package impl
+
+import (
+	"sync"
+)
+
+// Acknowledging the pixel node's inputs.
+//
+// The pixel node numbers its inputs, and shows the player where each will leave them before the logic node has played
+// it (see shared/prediction.go). Each state sent back carries the number of the last input it reflects, so the pixel
+// node can drop the inputs that are settled and replay the rest over the position in the state. An input is settled
+// once it has been passed over for a later one in the same tick, or played: as a move that was blocked, or one that
+// has been applied after reaching a quorum of ACKs (see ManageAcks).
+
+// How many numbered inputs can wait to be taken by the main node; more than the comm channel holds
+const INPUT_QUEUE_SIZE = 30
+
+// Tracks which of the pixel node's inputs are settled
+type InputAcks struct {
+	sync.Mutex
+
+	// The last input played or passed over
+	last     uint64
+
+	// Inputs played as moves that haven't been applied yet, by the move's sequence number
+	inFlight map[uint64]uint64
+
+	// The sequence number of the last of our moves applied
+	applied  uint64
+
+	// The numbers of the inputs passed to the main node, in the order they were passed
+	received chan uint64
+}
+
+func CreateInputAcks() (*InputAcks) {
+	return &InputAcks{inFlight: make(map[uint64]uint64), received: make(chan uint64, INPUT_QUEUE_SIZE)}
+}
+
+// Records the number of an input the pixel node sent; called just before the input is passed to the main node
+func (a *InputAcks) Received(input uint64) {
+	select {
+	case a.received <- input:
+	default:
+		// No one is taking inputs
+	}
+}
+
+// Returns the number of the input the main node has just taken from the comm channel, or 0 if it wasn't numbered
+func (a *InputAcks) Next() (uint64) {
+	select {
+	case input := <-a.received:
+		return input
+	default:
+		return 0
+	}
+}
+
+// Records an input as settled without a move to wait for
+func (a *InputAcks) Settled(input uint64) {
+	a.Lock()
+	defer a.Unlock()
+	if input > a.last {
+		a.last = input
+	}
+}
+
+// Records an input as played as the move with the given sequence number
+func (a *InputAcks) Played(input uint64, move uint64) {
+	a.Lock()
+	defer a.Unlock()
+	if input == 0 {
+		return
+	}
+	if input > a.last {
+		a.last = input
+	}
+	// The move may have been applied already
+	if move > a.applied {
+		a.inFlight[move] = input
+	}
+}
+
+// Records that the move with the given sequence number has been applied, and so every one of ours before it has been
+// applied or overtaken
+func (a *InputAcks) Applied(move uint64) {
+	a.Lock()
+	defer a.Unlock()
+	if move > a.applied {
+		a.applied = move
+	}
+	for seq := range a.inFlight {
+		if seq <= move {
+			delete(a.inFlight, seq)
+		}
+	}
+}
+
+// Returns the number of the last input the game state reflects: the last settled, unless an earlier one's move is
+// still waiting for a quorum
+func (a *InputAcks) Ack() (uint64) {
+	a.Lock()
+	defer a.Unlock()
+	ack := a.last
+	for _, input := range a.inFlight {
+		if input <= ack {
+			ack = input - 1
+		}
+	}
+	return ack
+}
+
+// Forgets every input, for a new pixel node, which numbers its inputs afresh
+func (a *InputAcks) Reset() {
+	a.Lock()
+	defer a.Unlock()
+	a.last = 0
+	a.inFlight = make(map[uint64]uint64)
+	for len(a.received) > 0 {
+		<-a.received
+	}
+}
@@ -0,0 +1,23 @@
+package impl
+
+import (
+	"../../shared"
+)
+
+// Area of interest.
+//
+// With an interest radius set in the game config, a node sends each of its moves only to the nodes within that many
+// grid cells of it (by Manhattan distance), and to the prey node. Every SummaryMs it re-sends its latest move to the
+// nodes further away, so they still know roughly where it is. A node we don't yet know the position of is treated as
+// near.
+
+// How often, in milliseconds, far nodes are sent our position if the game config doesn't say
+const DEFAULT_SUMMARY_MS = 1000
+
+// Returns true if a node at peer is within the area of interest of a node at pos; with no radius, everything is
+func WithinInterest(pos shared.Coord, peer shared.Coord, radius int) (bool) {
+	if radius <= 0 {
+		return true
+	}
+	return abs(pos.X-peer.X)+abs(pos.Y-peer.Y) <= radius
+}
@@ -4,9 +4,10 @@ import (
 	"../../shared"
 	"../../geometry"
 	"fmt"
-	"crypto/ecdsa"
+	"os"
+	"crypto"
 	"time"
-	"math"
+	"../../wolferrors"
 )
 
 // The "main" node part of the logic node. Deals with computation and checks; not communications
@@ -36,6 +37,9 @@ type PlayerNode struct {
 
 	// The game configuration provided upon registration from the server. Includes wall locations and board size.
 	GameConfig shared.InitialState
+
+	// Records the match to a replay file, if DefaultNodeOptions.Record is set; nil otherwise
+	recorder   *Recorder
 }
 
 // Creates the main logic node and required interfaces with the arguments passed in logic-node.go
@@ -43,14 +47,32 @@ type PlayerNode struct {
 // playerListenerAddr = where we expect to receive messages from the pixel-node
 // pixelSendAddr = where we will be sending new game states to the pixel node
 func CreatePlayerNode(nodeListenerAddr, playerListenerAddr string,
-	pubKey *ecdsa.PublicKey, privKey *ecdsa.PrivateKey, serverAddr string) (PlayerNode) {
+	pubKey crypto.PublicKey, privKey crypto.Signer, serverAddr string) (PlayerNode) {
+	return createNode(nodeListenerAddr, pubKey, privKey, serverAddr, false)
+}
+
+// Creates a logic node for a spectator, which follows the game without a wolf of its own: it registers with the server
+// as an observer, hears every move and capture, and never moves. Run it with RunSpectator.
+func CreateSpectatorNode(nodeListenerAddr, playerListenerAddr string,
+	pubKey crypto.PublicKey, privKey crypto.Signer, serverAddr string) (PlayerNode) {
+	return createNode(nodeListenerAddr, pubKey, privKey, serverAddr, true)
+}
+
+// Creates a player or spectator node
+func createNode(nodeListenerAddr string, pubKey crypto.PublicKey, privKey crypto.Signer, serverAddr string,
+	observer bool) (PlayerNode) {
 	// Setup the player communication buffered channel
 	playerCommChannel := make(chan string, 5)
 	playerSendChannel := make(chan shared.GameState, 5)
 
 	// Start the node to node interface
 	nodeInterface := CreateNodeCommInterface(pubKey, privKey, serverAddr)
-	addr, listener := StartListenerUDP(nodeListenerAddr)
+	nodeInterface.Observer = observer
+	addr, listener, err := StartListenerUDP(nodeListenerAddr)
+	if err != nil {
+		fmt.Printf("Could not listen for other nodes on [%s]: %s\n", nodeListenerAddr, err)
+		os.Exit(1)
+	}
 
 	nodeInterface.LocalAddr = addr
 	nodeInterface.IncomingMessages = listener
@@ -63,6 +85,13 @@ func CreatePlayerNode(nodeListenerAddr, playerListenerAddr string,
 	// Register with server, update info
 	uniqueId := nodeInterface.ServerRegister()
 	go nodeInterface.SendHeartbeat()
+	go nodeInterface.RunClockSync()
+	go nodeInterface.RunDigestExchange()
+	go nodeInterface.RunPartitionWatch()
+	go nodeInterface.RunMoveSummaries()
+	go nodeInterface.RunRelayKeepalive()
+	go nodeInterface.ApplyTickedMessages()
+	go nodeInterface.RunSessionUpkeep()
 
 	// Startup Pixel interface + listening
 	pixelInterface := CreatePixelInterface(playerCommChannel, playerSendChannel,
@@ -70,14 +99,18 @@ func CreatePlayerNode(nodeListenerAddr, playerListenerAddr string,
 
 	//// Make a gameState
 	playerLocs := make(map[string]shared.Coord)
-	playerLocs["prey"] = shared.Coord{5,5}
-	playerLocs[uniqueId] = shared.Coord{1,1}
-
+	startGrid := geometry.CreateNewGridManager(nodeInterface.Config.InitState.Settings)
+	playerLocs["prey"] = PreyStart(&startGrid)
 	playerScores := make(map[string]int)
-	playerScores[uniqueId] = 0
+
+	// A spectator has no spawn or score
+	if !observer {
+		playerLocs[uniqueId] = shared.Coord{1,1}
+		playerScores[uniqueId] = 0
+	}
 
 	playerMap := shared.PlayerLockMap{Data:playerLocs}
-	scoreMap := shared.ScoresLockMap{Data:playerScores}
+	scoreMap := shared.ScoresLockMap{Data:playerScores, Policy:nodeInterface.Config.PartitionPolicy}
 
 	// Make a gameState
 	gameState := shared.GameState{
@@ -97,36 +130,81 @@ func CreatePlayerNode(nodeListenerAddr, playerListenerAddr string,
 		GameConfig:        nodeInterface.Config.InitState,
 	}
 
+	if DefaultNodeOptions.Record != "" {
+		recorder, err := CreateRecorder(DefaultNodeOptions.Record, uniqueId, nodeInterface.Config.InitState.Settings)
+		if err != nil {
+			fmt.Println("Not recording the match:", err)
+		} else {
+			fmt.Println("Recording the match to", DefaultNodeOptions.Record)
+			pn.RecordWith(recorder)
+		}
+	}
+
 	// Allow the node-node interface to refer back to this node
 	nodeInterface.PlayerNode = &pn
 
+	// With no prey node in the game, this node moves the prey itself
+	if nodeInterface.Config.ReplicatedPrey {
+		go pn.RunReplicatedPrey()
+	}
+
 	return pn
 }
 
 // Runs the main node (listens for incoming messages from pixel interface) in a loop, must be called at the
-// end of main (or alternatively, in a goroutine)
+// end of main (or alternatively, in a goroutine). Player input is applied at most once per game tick: the latest
+// keystroke received during a tick is the one played when the next tick starts.
 func (pn * PlayerNode) RunGame(playerListener string) {
 	go pn.pixelInterface.RunPlayerListener(playerListener)
 	fmt.Println("listener running")
 
+	clock := pn.nodeInterface.Clock
+	inputs := pn.pixelInterface.inputs
+	tick := clock.CurrentTick()
+	pending := ""
+	var pendingInput uint64
 	for {
-		message := <-pn.playerCommChannel
-		switch message {
-		case "quit":
-			break
-		default:
+		select {
+		case message := <-pn.playerCommChannel:
+			input := inputs.Next()
+			if message == "quit" {
+				inputs.Settled(input)
+				continue
+			}
+			// A keystroke passed over for a later one in the same tick is settled, with no move
+			if pending != "" {
+				inputs.Settled(pendingInput)
+			}
+			pending = message
+			pendingInput = input
+		case <-time.After(clock.UntilTick(tick + 1)):
+			tick = clock.CurrentTick()
+			if pending == "" {
+				continue
+			}
+			message := pending
+			pending = ""
+
 			move, didMove := pn.movePlayer(message)
 			if didMove {
 				pn.nodeInterface.SendMoveToNodes(&move)
+				inputs.Played(pendingInput, sequenceNumber)
+			} else {
+				// Let the pixel node know the move was blocked
+				inputs.Settled(pendingInput)
+				pn.nodeInterface.GameStateToSend <- true
 			}
 			if pn.nodeInterface.CheckGotPrey(move) == nil {
 				fmt.Println("Got the prey")
-				pn.GameState.PlayerScores.Lock()
-				pn.GameState.PlayerScores.Data[pn.Identifier] += pn.GameConfig.CatchWorth
-				pn.nodeInterface.SendPreyCaptureToNodes(&move, pn.GameState.PlayerScores.Data[pn.Identifier])
+				score := AddCaptureEvent(&pn.GameState.PlayerScores, CaptureEventId(pn.Identifier, sequenceNumber),
+					pn.nodeInterface.CreateCaptureEvent())
+				pn.nodeInterface.SendPreyCaptureToNodes(&move, score)
 				pn.nodeInterface.RW.Add("captured_prey", sequenceNumber, &move)
-				fmt.Println(pn.GameState.PlayerScores.Data[pn.Identifier])
-				pn.GameState.PlayerScores.Unlock()
+				fmt.Println(score)
+				if pn.nodeInterface.Config.ReplicatedPrey {
+					pn.nodeInterface.RespawnReplicatedPrey()
+				}
+				pn.nodeInterface.recordApplied()
 			}
 			// pn.pixelInterface.SendPlayerGameState(pn.GameState)
 		}
@@ -134,6 +212,17 @@ func (pn * PlayerNode) RunGame(playerListener string) {
 
 }
 
+// Runs a spectator node: serves its pixel node game states with no player of its own, and ignores its input, which
+// the pixel node uses to pick who to follow. Like RunGame, must be called at the end of main.
+func (pn * PlayerNode) RunSpectator(playerListener string) {
+	go pn.pixelInterface.RunPlayerListener(playerListener)
+	fmt.Println("Spectating as", pn.Identifier)
+	for {
+		<-pn.playerCommChannel
+		pn.pixelInterface.inputs.Next()
+	}
+}
+
 // Given a string "up"/"down"/"left"/"right", changes the player state to make that move iff that move is valid
 // (not into a wall, out of bounds)
 func (pn * PlayerNode) movePlayer(move string) (newPos shared.Coord, changed bool) {
@@ -144,17 +233,7 @@ func (pn * PlayerNode) movePlayer(move string) (newPos shared.Coord, changed boo
 
 	originalPosition := shared.Coord{X: playerLoc.X, Y: playerLoc.Y}
 	// Calculate new position with move
-	newPosition := shared.Coord{X: playerLoc.X, Y: playerLoc.Y}
-	switch move {
-	case "up":
-		newPosition.Y = newPosition.Y + 1
-	case "down":
-		newPosition.Y = newPosition.Y - 1
-	case "left":
-		newPosition.X = newPosition.X - 1
-	case "right":
-		newPosition.X = newPosition.X + 1
-	}
+	newPosition := shared.MoveCoord(playerLoc, move)
 	// Check new move is valid, if so update player position
 	if pn.geo.IsValidMove(newPosition) && pn.geo.IsNotTeleporting(originalPosition, newPosition){
 		//pn.GameState.PlayerLocs.Lock()
@@ -165,6 +244,32 @@ func (pn * PlayerNode) movePlayer(move string) (newPos shared.Coord, changed boo
 	return playerLoc, false
 }
 
+// Moves the prey locally on every prey tick, for games with no prey node (GameConfig.ReplicatedPrey). Every logic node
+// runs this, so the prey's moves never cross the network; nodes agree on where it is as long as they agree on where
+// the wolves are.
+func (pn *PlayerNode) RunReplicatedPrey() {
+	RunPreySteps(pn.nodeInterface.Clock, func(tick uint64) {
+		pn.GameState.PlayerLocs.RLock()
+		preyLoc, ok := pn.GameState.PlayerLocs.Data["prey"]
+		pn.GameState.PlayerLocs.RUnlock()
+		if !ok {
+			return
+		}
+
+		wolves := WolfPositions(&pn.GameState.PlayerLocs)
+		move := NextPreyMove(pn.nodeInterface.Config.PreySeed, tick, preyLoc, wolves, &pn.geo)
+
+		pn.GameState.PlayerLocs.Lock()
+		pn.GameState.PlayerLocs.Data["prey"] = move
+		pn.GameState.PlayerLocs.Unlock()
+		pn.nodeInterface.recordApplied()
+
+		pn.nodeInterface.RW.Add("prey", tick, &move)
+		pn.nodeInterface.History.Add("prey", tick, move)
+		pn.nodeInterface.GameStateToSend <- true
+	})
+}
+
 // GETTERS
 // Returns the pixel interface; mainly of use for testing
 func (pn *PlayerNode) GetPixelInterface() (PixelInterface) {
@@ -185,38 +290,24 @@ func (pn *PlayerNode) GetPlayerCommChannel() (chan string) {
 	return pn.playerCommChannel
 }
 
-// Runs a bot game
+// Runs a bot game, chasing the prey
 func (pn * PlayerNode) RunBotGame(playerListener string) {
+	pn.RunBotStrategy(BOT_CHASE)
+}
+
+// Runs a bot game, moving by the named strategy (see bot.go); returns an error straight away if there is no such
+// strategy, and otherwise never returns
+func (pn * PlayerNode) RunBotStrategy(strategy string) (err error) {
+	chooseMove, ok := BotStrategies[strategy]
+	if !ok {
+		return wolferrors.UnknownBotStrategyError(strategy)
+	}
 	for {
+		pn.GameState.PlayerLocs.RLock()
 		myState := pn.GameState.PlayerLocs.Data[pn.Identifier]
 		prey := pn.GameState.PlayerLocs.Data["prey"]
-		command := "still"
-		minVal := abs(myState.X-prey.X)+ abs(myState.Y-prey.Y)
-		if minVal <= 3{
-			minVal = math.MaxInt8
-		}
-		for _,i:= range []int{-1,1}{
-			val := abs(myState.X+i-prey.X)+ abs(myState.Y-prey.Y)
-			if val < minVal && pn.geo.IsValidMove(shared.Coord{myState.X+i, myState.Y}) {
-				minVal = val
-				if i == -1{
-					command = "left"
-				}else{
-					command = "right"
-				}
-			}
-		}
-		for _,j:= range []int{-1,1}{
-			val := abs(myState.X-prey.X)+ abs(myState.Y+j-prey.Y)
-			if val < minVal &&  pn.geo.IsValidMove(shared.Coord{myState.X, myState.Y+j}) {
-				minVal = val
-				if j == -1{
-					command = "down"
-				}else{
-					command = "up"
-				}
-			}
-		}
+		pn.GameState.PlayerLocs.RUnlock()
+		command := chooseMove(&pn.geo, myState, prey)
 		move, ok := pn.movePlayer(command)
 		if ok{
 			pn.nodeInterface.SendMoveToNodes(&move)
@@ -225,12 +316,14 @@ func (pn * PlayerNode) RunBotGame(playerListener string) {
 		}
 		if pn.nodeInterface.CheckGotPrey(move) == nil {
 			fmt.Println("Got the prey")
-			pn.GameState.PlayerScores.Lock()
-			pn.GameState.PlayerScores.Data[pn.Identifier] += pn.GameConfig.CatchWorth
-			pn.nodeInterface.SendPreyCaptureToNodes(&move, pn.GameState.PlayerScores.Data[pn.Identifier])
+			score := AddCaptureEvent(&pn.GameState.PlayerScores, CaptureEventId(pn.Identifier, sequenceNumber),
+				pn.nodeInterface.CreateCaptureEvent())
+			pn.nodeInterface.SendPreyCaptureToNodes(&move, score)
 			pn.nodeInterface.RW.Add("captured_prey", sequenceNumber, &move)
-			fmt.Println(pn.GameState.PlayerScores.Data[pn.Identifier])
-			pn.GameState.PlayerScores.Unlock()
+			fmt.Println(score)
+			if pn.nodeInterface.Config.ReplicatedPrey {
+				pn.nodeInterface.RespawnReplicatedPrey()
+			}
 		}
 		// Take move off the channel
 		time.Sleep(time.Millisecond*400)
@@ -1,15 +1,15 @@
 package impl
 
 import (
+	"bytes"
 	"fmt"
 	"net"
 	"net/rpc"
 	"log"
 	"os"
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/elliptic"
 	"crypto/md5"
-	"crypto/rand"
 	"time"
 	"encoding/gob"
 	"encoding/hex"
@@ -17,6 +17,7 @@ import (
 	"github.com/rzlim08/GoVector/govec"
 	"math/big"
 	key "../../key-helpers"
+	relay "../../relay/impl"
 	"../../wolferrors"
 	"../../shared"
 	"sync"
@@ -29,10 +30,10 @@ type NodeCommInterface struct {
 	PlayerNode			*PlayerNode
 
 	// The public key of this nodes
-	PubKey 				*ecdsa.PublicKey
+	PubKey 				crypto.PublicKey
 
-	// The private key of this node, used to encrypt messages
-	PrivKey 			*ecdsa.PrivateKey
+	// The private key of this node, used to sign messages; an ECDSA or Ed25519 key (see key-helpers)
+	PrivKey 			crypto.Signer
 
 	// The gameconfig for the game, primarily used here to form connections to the given nodes
 	Config 				shared.GameConfig
@@ -53,7 +54,7 @@ type NodeCommInterface struct {
 	OtherNodes 			map[string]*net.UDPConn
 
 	// The current map of identifiers to public keys of nodes in play
-	NodeKeys		    map[string]*ecdsa.PublicKey
+	NodeKeys		    map[string]crypto.PublicKey
 
 	// The GoVector log
 	Log 				*govec.GoLog
@@ -98,6 +99,59 @@ type NodeCommInterface struct {
 
 	// Running Window
 	RW					  RunningWindow
+
+	// The number of times the prey has been captured; picks the prey's next spawn point when it is simulated locally
+	PreyEpoch			  uint64
+
+	// The game clock, synchronised with the server; every outgoing move and capture is stamped with its tick
+	Clock				  *GameClock
+
+	// Received moves and captures waiting to be applied in tick order
+	Pending				  *TickQueue
+
+	// The tick of the last move applied for each node, so moves that arrive out of order can be dropped
+	lastMoveTick		  map[string]uint64
+
+	// Decides which of several captures of the same prey move stands
+	Captures			  *CaptureArbiter
+
+	// Where every node has been over the last few seconds, by tick; captures are checked against it
+	History				  *TickHistory
+
+	// The number of times another node's game state digest has disagreed with ours
+	DigestMismatches	  uint64
+
+	// Nodes whose last digest disagreed with ours; a second disagreement in a row starts a repair
+	digestSuspects		  map[string]bool
+
+	// Which players this node can currently reach
+	Partition			  *PartitionTracker
+
+	// If set, messages from any node it returns true for are dropped on arrival (see SetDropIncoming)
+	dropIncoming		  func(identifier string) bool
+	dropLock			  sync.Mutex
+
+	// The connection to the game's relay, for nodes we can't reach directly
+	RelayLink			  RelayLink
+
+	// The relay this node runs for the game, if the server picked it to
+	RelayServer			  *relay.Relay
+
+	// Channel that the identifiers of nodes we should stop sending to directly are written to, so they can be handled
+	// by the goroutine that deals with sending messages and managing the player nodes
+	NodesToRelay		  chan string
+
+	// The nodes we send to through the relay rather than directly; only touched by ManageOtherNodes
+	relayed				  map[string]bool
+
+	// The sessions this node's messages are sealed under, in games with encrypted traffic (see secure.go)
+	Sessions			  *key.SessionTable
+
+	// The identity keys the server has registered for the other nodes, which their hellos are checked against
+	Registered			  *RegisteredKeys
+
+	// If true, this node registers as a spectator: it hears every move and capture, but never makes any
+	Observer			  bool
 }
 
 type StrikeLockMap struct {
@@ -107,10 +161,14 @@ type StrikeLockMap struct {
 
 
 // A message for another node with a recipient and a byte-encoded message. If the recipient is "all", the message is
-// sent to every node in OtherNodes.
+// sent to every node in OtherNodes. If it is "near" or "far", the message is sent to the nodes inside or outside the
+// area of interest around Around (see interest.go). A Plain message is sent as is even when traffic is encrypted:
+// connects and hellos, and messages that have already been sealed.
 type PendingMessage struct {
 	Recipient string
 	Message []byte
+	Around shared.Coord
+	Plain bool
 }
 
 // A struct to hold pending moves
@@ -118,6 +176,8 @@ type PendingMoveUpdates struct {
 	Seq	uint64
 	Coord *shared.Coord
 	Rejected int
+	// The number of nodes the move was sent to, if it wasn't sent to all of them
+	Recipients int
 }
 
 // A struct to form an ACK message
@@ -130,23 +190,20 @@ type ACKMessage struct {
 type OtherNode struct {
 	Identifier string
 	Conn *net.UDPConn
-	PubKey *ecdsa.PublicKey
+	PubKey crypto.PublicKey
+	// If true, the node couldn't be reached directly and is sent to through the relay
+	Relayed bool
 }
 
 // A playerinfo struct, provides identification information about this node: the address and public key
-type PlayerInfo struct {
-	Address 			net.Addr
-	PubKey 				ecdsa.PublicKey
-	Prey				bool
-}
-
 // The message struct that is sent for all node communication
 type NodeMessage struct {
 	// the id of the sending node
 	Identifier  string
 
 	// identifies the type of message so we know how to handle it
-	// can be: "move", "moveCommit", "gameState", "connect", "connected", "gamestateReq", "captured", "ack", '
+	// can be: "move", "moveCommit", "gameState", "connect", "connected", "gamestateReq", "captured", "ack", "digest",
+	// "hello"'
 	MessageType string
 
 	// a gamestate, included if MessageType is "gameState", else nil
@@ -170,22 +227,48 @@ type NodeMessage struct {
 	// Keep track of sequence number for response ACKs
 	Seq			uint64
 
+	// True if the message is a move summary (see RunMoveSummaries): where the sender is now, rather than a move of its
+	// own, so it has no sequence number and isn't ACKed
+	Summary		bool
+
 	// Prey Sequence number
 	PreySeq		uint64
+
+	// The game tick this message was sent in
+	Tick		uint64
+
+	// The vector timestamp GoVector gives this message on sending; see causal.go
+	VClock		map[string]uint64
+
+	// A digest of the sender's game state, included if the message type is digest; see digest.go
+	Digest		[]byte
+
+	// The sender's prey epoch, included with digests and gamestates
+	PreyEpoch	uint64
+
+	// The sender's partition view when it made a capture, included if the message type is captured
+	View		[]string
+	Members		int
+
+	// Half of the handshake that agrees a session, included if the message type is hello; see secure.go
+	Hello		*shared.SessionHello
 }
 
 var sequenceNumber uint64 = 0
 
 const STRIKE_OUT = 3
 
+// The most a single UDP datagram can carry; no message between nodes can be bigger
+const MAX_DATAGRAM_SIZE = 65507
+
 // Creates a node comm interface with initial empty arrays/maps
-func CreateNodeCommInterface(pubKey *ecdsa.PublicKey, privKey *ecdsa.PrivateKey, serverAddr string) (NodeCommInterface) {
+func CreateNodeCommInterface(pubKey crypto.PublicKey, privKey crypto.Signer, serverAddr string) (NodeCommInterface) {
 	return NodeCommInterface{
 		PubKey:                pubKey,
 		PrivKey:               privKey,
 		ServerAddr:           serverAddr,
 		OtherNodes:            make(map[string]*net.UDPConn),
-		NodeKeys:              make(map[string]*ecdsa.PublicKey),
+		NodeKeys:              make(map[string]crypto.PublicKey),
 		HeartAttack:           make(chan bool),
 		MoveCommits:           make(map[string]string),
 		MessagesToSend:        make(chan *PendingMessage, 30),
@@ -198,6 +281,17 @@ func CreateNodeCommInterface(pubKey *ecdsa.PublicKey, privKey *ecdsa.PrivateKey,
 		GameStateToSend:       make(chan bool, 30),
 		HasGameState: 		   false,
 		RW:		   			   RunningWindow{Map:make(map[string][NUMMOVESTOKEEP]MoveSeq)},
+		Clock:				   CreateGameClock(DEFAULT_TICK_MS),
+		Pending:			   &TickQueue{},
+		lastMoveTick:		   make(map[string]uint64),
+		Captures:			   CreateCaptureArbiter(),
+		History:			   CreateTickHistory(DEFAULT_HISTORY_TICKS),
+		digestSuspects:		   make(map[string]bool),
+		Partition:			   CreatePartitionTracker(PARTITION_TIMEOUT_DIGESTS * DEFAULT_DIGEST_MS * time.Millisecond),
+		NodesToRelay:		   make(chan string, 10),
+		relayed:			   make(map[string]bool),
+		Sessions:			   key.CreateSessionTable(privKey),
+		Registered:			   &RegisteredKeys{},
 	}
 }
 
@@ -210,17 +304,34 @@ func (n *NodeCommInterface) RunListener(listener *net.UDPConn, nodeListenerAddr
 	i := 0
 	for {
 		i++
-		buf := make([]byte, 2048)
-		_, _, err := listener.ReadFromUDP(buf)
+		buf := make([]byte, MAX_DATAGRAM_SIZE)
+		size, _, err := listener.ReadFromUDP(buf)
 		if err != nil {
 			fmt.Println(err)
+			continue
 		}
 
-		message := receiveMessage(n.Log, buf)
+		message, ok := n.openMessage(buf[:size])
+		if !ok {
+			continue
+		}
+		if n.dropping(message.Identifier) {
+			continue
+		}
+		// Spectators never move and have no say over captures, so moves, captures and rejections claiming to come
+		// from one are dropped
+		if shared.IsObserver(message.Identifier) && (message.MessageType == "move" ||
+			message.MessageType == "captured" || message.MessageType == "moveCommit" ||
+			message.MessageType == "rejected") {
+			continue
+		}
+		if n.Partition.Heard(message.Identifier, time.Now()) {
+			n.HandlePartitionHeal(message.Identifier)
+		}
 
 		switch message.MessageType {
 			case "gameState":
-				n.HandleReceivedGameState(message.Identifier, message.GameState)
+				n.HandleReceivedGameState(message.Identifier, message.GameState, message.PreyEpoch)
 			case "gamestateReq":
 				n.HandleGameStateConnReq(message.Identifier)
 			case "moveCommit":
@@ -240,12 +351,31 @@ func (n *NodeCommInterface) RunListener(listener *net.UDPConn, nodeListenerAddr
 					fmt.Println("Could not unmarshal")
 					fmt.Println(err)
 				} else {
-					n.HandleReceivedMoveNL(message.Identifier, &coords, message.Seq)
+					if message.Identifier == "prey" {
+						n.Captures.RecordPreyMove(message.Seq, message.VClock)
+					}
+					n.Pending.Push(&TickedMessage{Tick: message.Tick, Identifier: message.Identifier,
+						Seq: message.Seq, Apply: func() {
+						// A newer move from this node has already been applied; this one was overtaken in transit
+						if message.Tick < n.lastMoveTick[message.Identifier] {
+							return
+						}
+						n.lastMoveTick[message.Identifier] = message.Tick
+						if message.Summary {
+							if n.HandleReceivedMoveSummary(message.Identifier, &coords) == nil {
+								n.History.Add(message.Identifier, message.Tick, coords)
+							}
+						} else if n.HandleReceivedMoveNL(message.Identifier, &coords, message.Seq) == nil {
+							n.History.Add(message.Identifier, message.Tick, coords)
+						}
+					}})
 				}
 			case "connect":
 				n.HandleIncomingConnectionRequest(message.Identifier, message.Addr, message.PubKey)
 			case "connected":
 			// Do nothing
+			case "hello":
+				n.HandleHello(message.Identifier, message.Hello)
 			case "captured":
 				var coords shared.Coord
 				authentic := n.CheckAuthenticityOfMove(n.NodeKeys[message.Identifier], &message.Move)
@@ -258,12 +388,19 @@ func (n *NodeCommInterface) RunListener(listener *net.UDPConn, nodeListenerAddr
 					fmt.Println("Could not unmarshal")
 					fmt.Println(err)
 				} else {
-					scoreCalc, err:= n.HandleCapturedPreyRequest(message.Identifier, &coords, message.Score, message.PreySeq)
-					if err != nil {
-						fmt.Println("rejecting capturing prey", err)
-						n.SendPreyCaptureReject(message.Identifier, message.Move, message.Seq, scoreCalc)
-					}
+					n.Pending.Push(&TickedMessage{Tick: message.Tick, Identifier: message.Identifier,
+						Seq: message.Seq, Apply: func() {
+						claim := &CaptureClaim{Identifier: message.Identifier, Seq: message.Seq, PreySeq: message.PreySeq,
+							Tick: message.Tick, VClock: message.VClock, View: message.View, Members: message.Members}
+						scoreCalc, err:= n.HandleCausalCapture(claim, &coords, message.Score)
+						if err != nil && !n.Observer {
+							fmt.Println("rejecting capturing prey", err)
+							n.SendPreyCaptureReject(message.Identifier, message.Move, message.Seq, scoreCalc)
+						}
+					}})
 				}
+			case "digest":
+				n.HandleReceivedDigest(message.Identifier, message.Digest)
 			case "ack":
 				n.HandleReceivedAck(message.Identifier, message.Seq)
 			case "rejected":
@@ -274,7 +411,7 @@ func (n *NodeCommInterface) RunListener(listener *net.UDPConn, nodeListenerAddr
 					fmt.Println(err)
 
 				} else {
-					n.HandleRejectedCapture(coords, message.PreySeq, message.Score)
+					n.HandleRejectedCapture(coords, message.PreySeq)
 				}
 			default:
 				fmt.Println("Message type is incorrect")
@@ -282,16 +419,33 @@ func (n *NodeCommInterface) RunListener(listener *net.UDPConn, nodeListenerAddr
 	}
 }
 
+// Drops messages from any node drop returns true for as they arrive, or stops dropping them if drop is nil. For
+// testing partitions
+func (n *NodeCommInterface) SetDropIncoming(drop func(identifier string) bool) {
+	n.dropLock.Lock()
+	defer n.dropLock.Unlock()
+	n.dropIncoming = drop
+}
+
+// Returns true if messages from the given node are being dropped
+func (n *NodeCommInterface) dropping(identifier string) (bool) {
+	n.dropLock.Lock()
+	defer n.dropLock.Unlock()
+	return n.dropIncoming != nil && n.dropIncoming(identifier)
+}
+
 // Routine that handles all reads and writes of the OtherNodes map; single thread preventing concurrent iteration and write
 // exception. This routine therefore handles all sending of messages as well as that requires iteration over OtherNodes.
 func (n *NodeCommInterface) ManageOtherNodes() {
 	for {
 		select {
 		case toSend := <-n.MessagesToSend :
-			if toSend.Recipient != "all" {
+			if toSend.Recipient == "near" || toSend.Recipient == "far" {
+				n.sendMessageToNodesAround(toSend.Message, toSend.Around, toSend.Recipient == "near")
+			} else if toSend.Recipient != "all" {
 				// Send to the single node
 				if _, ok := n.OtherNodes[toSend.Recipient]; ok {
-					n.OtherNodes[toSend.Recipient].Write(toSend.Message)
+					n.writeToNode(toSend.Recipient, toSend.Message, toSend.Plain)
 				}
 			} else {
 				// Send the message to all nodes
@@ -300,14 +454,26 @@ func (n *NodeCommInterface) ManageOtherNodes() {
 		case toAdd := <- n.NodesToAdd:
 			n.OtherNodes[toAdd.Identifier] = toAdd.Conn
 			n.NodeKeys[toAdd.Identifier] = toAdd.PubKey
+			if toAdd.Relayed {
+				n.relayed[toAdd.Identifier] = true
+			}
+		case toRelay := <-n.NodesToRelay:
+			if _, ok := n.OtherNodes[toRelay]; ok && !n.relayed[toRelay] && n.RelayLink.Connected() {
+				fmt.Println("Falling back to the relay for", toRelay)
+				n.relayed[toRelay] = true
+			}
 		case toDelete := <-n.NodesToDelete:
 			fmt.Printf("To delete: %s\n", toDelete)
 			delete(n.OtherNodes, toDelete)
+			delete(n.relayed, toDelete)
+			n.Partition.Forget(toDelete)
+			n.Sessions.Forget(toDelete)
 			n.PlayerNode.GameState.PlayerLocs.Lock()
 			delete(n.PlayerNode.GameState.PlayerLocs.Data, toDelete)
 			delete(n.NodeKeys, toDelete)
 			fmt.Printf("PlayerLocs.Data %v\n", n.PlayerNode.GameState.PlayerLocs.Data)
 			n.PlayerNode.GameState.PlayerLocs.Unlock()
+			n.recordApplied()
 			n.GameStateToSend <- true
 		}
 	}
@@ -320,9 +486,9 @@ func (n *NodeCommInterface) ManageAcks() {
 	for {
 		select {
 		case ack := <-n.ACKSReceived:
-			lenOfOtherNodes := len(n.OtherNodes)
 			if len(n.MovesToSend) != 0 {
 				moveToSend := <-n.MovesToSend
+				lenOfOtherNodes := n.ackQuorum(moveToSend)
 				collectAcks[ack.Seq] = append(collectAcks[ack.Seq], ack.Identifier)
 				// if the # of acks > # of connected nodes (majority consensus)
 				if len(collectAcks[moveToSend.Seq]) > lenOfOtherNodes/2 {
@@ -331,6 +497,8 @@ func (n *NodeCommInterface) ManageAcks() {
 						n.PlayerNode.GameState.PlayerLocs.Lock()
 						n.PlayerNode.GameState.PlayerLocs.Data[n.PlayerNode.Identifier] = *moveToSend.Coord
 						n.PlayerNode.GameState.PlayerLocs.Unlock()
+						n.recordApplied()
+						n.PlayerNode.pixelInterface.inputs.Applied(moveToSend.Seq)
 						n.GameStateToSend <- true
 					}
 				} else {
@@ -340,19 +508,24 @@ func (n *NodeCommInterface) ManageAcks() {
 			}
 		case <-time.After(200 * time.Millisecond):
 			lenOfOtherNodes := len(n.OtherNodes)
-			// TODO: adjust this when prey can handle acks
-			if lenOfOtherNodes <= 2 {
-				if len(n.MovesToSend) != 0 {
-					moveToSend := <-n.MovesToSend
+			if len(n.MovesToSend) != 0 {
+				moveToSend := <-n.MovesToSend
+				// TODO: adjust this when prey can handle acks
+				if n.ackQuorum(moveToSend) <= 2 {
 					if moveToSend.Seq >= curAck {
 						curAck = moveToSend.Seq
 						n.PlayerNode.GameState.PlayerLocs.Lock()
 						n.PlayerNode.GameState.PlayerLocs.Data[n.PlayerNode.Identifier] = *moveToSend.Coord
 						n.PlayerNode.GameState.PlayerLocs.Unlock()
+						n.recordApplied()
+						n.PlayerNode.pixelInterface.inputs.Applied(moveToSend.Seq)
 						n.GameStateToSend <- true
 					}
+				} else {
+					n.MovesToSend <- moveToSend
 				}
-			} else {
+			}
+			if lenOfOtherNodes > 2 {
 				for k := range collectAcks {
 					if len(collectAcks[k]) > lenOfOtherNodes/2 {
 						delete(collectAcks, k)
@@ -363,13 +536,41 @@ func (n *NodeCommInterface) ManageAcks() {
 	}
 }
 
+// Returns the number of nodes a move needs a majority of ACKs from: the nodes it was sent to
+func (n *NodeCommInterface) ackQuorum(move *PendingMoveUpdates) (int) {
+	if move.Recipients > 0 {
+		return move.Recipients
+	}
+	return len(n.OtherNodes)
+}
+
+// Applies received moves and captures at the start of each tick, in tick order. Should be run in a goroutine.
+func (n *NodeCommInterface) ApplyTickedMessages() {
+	for {
+		tick := n.Clock.CurrentTick()
+		for _, message := range n.Pending.PopUpTo(tick) {
+			message.Apply()
+			n.recordApplied()
+		}
+		time.Sleep(n.Clock.UntilTick(tick + 1))
+	}
+}
+
+// Routine that strikes out nodes we fail to write to. A node that strikes out is sent to through the relay from then
+// on, if there is one; if it strikes out again, or there is no relay, it is deleted.
 func (n *NodeCommInterface) PruneNodes() {
+	fellBack := make(map[string]bool)
 	for {
 		select {
 		case id := <-n.NodesWriteConnRefused:
 			if id != "prey" {
 				n.Strikes.StrikeCount[id]++
-				if n.Strikes.StrikeCount[id] > STRIKE_OUT {
+				if n.Strikes.StrikeCount[id] > STRIKE_OUT && !fellBack[id] && n.RelayLink.Connected() {
+					fellBack[id] = true
+					n.NodesToRelay <- id
+					delete(n.Strikes.StrikeCount, id)
+				} else if n.Strikes.StrikeCount[id] > STRIKE_OUT {
+					delete(fellBack, id)
 					n.NodesToDelete <- id
 					fmt.Printf("Deleting this id: %s\n", id)
 					delete(n.Strikes.StrikeCount, id)
@@ -407,6 +608,9 @@ func sendMessage(goLog *govec.GoLog, message NodeMessage, tag string) []byte{
 	if goLog == nil{
 		return nil
 	}
+	if message.VClock == nil {
+		message.VClock = NextVectorTimestamp(goLog, message.Identifier)
+	}
 	var newMessage []byte
 	if tag == ""{
 		newMessage = goLog.PrepareSend("SendMessageToOtherNode", message)
@@ -422,7 +626,7 @@ func sendMessage(goLog *govec.GoLog, message NodeMessage, tag string) []byte{
 func (n *NodeCommInterface) ServerRegister() (id string) {
 	gob.Register(&net.UDPAddr{})
 	gob.Register(&elliptic.CurveParams{})
-	gob.Register(&PlayerInfo{})
+	gob.Register(&shared.PlayerInfo{})
 
 	if n.ServerConn == nil {
 		response, err := DialAndRegister(n)
@@ -430,10 +634,32 @@ func (n *NodeCommInterface) ServerRegister() (id string) {
 			os.Exit(1)
 		}
 		n.Log = govec.InitGoVectorMultipleExecutions("LogicNodeId-"+response.Identifier,
-			"LogicNodeFile")
+			DefaultNodeOptions.LogPath("LogicNodeFile"))
 
 		n.Config = response
 	}
+	if n.Config.Rejoined {
+		// Start above the sequence numbers our last session used, so our new moves and captures aren't taken for
+		// old ones
+		sequenceNumber = uint64(time.Now().UnixNano())
+	}
+	n.Clock.SetTickDuration(n.Config.TickMs)
+	n.History = CreateTickHistory(n.Config.HistoryTicks)
+	n.Partition.SetTimeout(PARTITION_TIMEOUT_DIGESTS * n.digestInterval())
+	n.Partition.SetSelf(n.Config.Identifier)
+	n.Sessions.SetSelf(n.Config.Identifier)
+	if n.Config.ActAsRelay {
+		n.StartRelay()
+	}
+	if n.Config.RelayAddr != "" {
+		err := n.RelayLink.Connect(n.Config.RelayAddr, n.Config.Identifier, n.Config.RelayToken)
+		if err != nil {
+			fmt.Println("Could not connect to relay:", err)
+		}
+	}
+	if err := n.Clock.Sync(n.ServerConn, n.PrivKey); err != nil {
+		fmt.Println("Could not synchronise clock with server:", err)
+	}
 	n.GetNodes()
 
 	return n.Config.Identifier
@@ -443,7 +669,7 @@ func (n *NodeCommInterface) ServerRegister() (id string) {
 func DialAndRegister(n *NodeCommInterface) (shared.GameConfig, error) {
 	// fmt.Printf("DEBUG - ServerRegister() n.ServerConn [%s] should be nil\n", n.ServerConn)
 	// Connect to server with RPC, port is always :8081
-	serverConn, err := rpc.Dial("tcp", n.ServerAddr)
+	serverConn, err := DialServer(n.ServerAddr)
 	if err != nil {
 		log.Println("Cannot dial server. Please ensure the server is running and try again.")
 		return shared.GameConfig{}, err
@@ -452,7 +678,12 @@ func DialAndRegister(n *NodeCommInterface) (shared.GameConfig, error) {
 	n.ServerConn = serverConn
 	var response shared.GameConfig
 	// Register with server
-	playerInfo := PlayerInfo{n.LocalAddr, *n.PubKey, false}
+	auth, err := SignServerCall(serverConn, n.PrivKey, "GServer.Register")
+	if err != nil {
+		return shared.GameConfig{}, err
+	}
+	playerInfo := shared.PlayerInfo{n.LocalAddr, key.PubKeyToString(n.PubKey), false, DefaultNodeOptions.Room, auth,
+		n.Observer}
 	// fmt.Printf("DEBUG - PlayerInfo Struct [%v]\n", playerInfo)
 	err = serverConn.Call("GServer.Register", playerInfo, &response)
 	if err != nil {
@@ -463,8 +694,7 @@ func DialAndRegister(n *NodeCommInterface) (shared.GameConfig, error) {
 
 // Requests the list of currently connected nodes from the server, and initiates a connection with them
 func (n *NodeCommInterface) GetNodes() {
-	var response map[string]shared.NodeRegistrationInfo
-	err := n.ServerConn.Call("GServer.GetNodes", *n.PubKey, &response)
+	response, err := n.fetchNodes()
 	if err != nil {
 		panic(err)
 		log.Fatal(err)
@@ -478,14 +708,42 @@ func (n *NodeCommInterface) GetNodes() {
 	}
 
 	for id, regInfo := range response {
-		nodeClient := n.GetClientFromAddrString(regInfo.Addr.String())
-		pubKey:= key.StringToPubKey(regInfo.PubKey)
-		node := OtherNode{Identifier: id, Conn: nodeClient, PubKey: &pubKey}
+		pubKey, err := key.DecodePublicKey(regInfo.PubKey)
+		if err != nil {
+			fmt.Printf("Ignoring node [%s] with a bad public key: %s\n", id, err)
+			continue
+		}
+		n.Registered.Add(id, regInfo.PubKey)
+		nodeClient, relayed, err := n.dialOrRelay(regInfo.Addr.String())
+		if err != nil {
+			fmt.Printf("Skipping node [%s], which can't be reached directly or through a relay: %s\n", id, err)
+			continue
+		}
+		node := OtherNode{Identifier: id, Conn: nodeClient, PubKey: pubKey, Relayed: relayed}
 		n.NodesToAdd <- &node
 		n.InitiateConnection(nodeClient, id)
 	}
 }
 
+// Makes a UDP connection to the node at the given address, falling back to the relay if it can't be dialed
+// Returns the connection, or nil and true if the node is to be reached through the relay, or an error if it can't be
+// reached either way
+func (n *NodeCommInterface) dialOrRelay(addr string) (*net.UDPConn, bool, error) {
+	nodeUdp, err := net.ResolveUDPAddr("udp", addr)
+	if err == nil {
+		var nodeClient *net.UDPConn
+		nodeClient, err = net.DialUDP("udp", nil, nodeUdp)
+		if err == nil {
+			return nodeClient, false, nil
+		}
+	}
+	if !n.RelayLink.Connected() {
+		return nil, false, err
+	}
+	fmt.Println("Could not dial", addr, "directly; using the relay")
+	return nil, true, nil
+}
+
 // Takes in an address string and makes a UDP connection to the client specified by the string. Returns the connection.
 func (n *NodeCommInterface) GetClientFromAddrString(addr string) (*net.UDPConn) {
 	nodeUdp, _ := net.ResolveUDPAddr("udp", addr)
@@ -505,7 +763,7 @@ func (n *NodeCommInterface) SendHeartbeat() {
 		case <-n.HeartAttack:
 			return
 		default:
-			err := n.ServerConn.Call("GServer.Heartbeat", *n.PubKey, &_ignored)
+			err := n.CallServer("GServer.Heartbeat", &_ignored)
 			if err != nil {
 				fmt.Printf("DEBUG - Heartbeat err: [%s]\n", err)
 				n.Config = n.Reregister()
@@ -516,6 +774,170 @@ func (n *NodeCommInterface) SendHeartbeat() {
 	}
 }
 
+// Periodically broadcasts a digest of this node's gamestate to all other nodes; should be run in a goroutine
+func (n *NodeCommInterface) RunDigestExchange() {
+	for {
+		time.Sleep(n.digestInterval())
+		if !n.HasGameState {
+			continue
+		}
+		n.settleScores()
+		message := NodeMessage{
+			MessageType: "digest",
+			Identifier:  n.PlayerNode.Identifier,
+			Addr:        n.LocalAddr.String(),
+			Digest:      GameStateDigest(&n.PlayerNode.GameState, n.PreyEpoch, n.PlayerNode.Identifier,
+				n.Config.InterestRadius <= 0),
+			PreyEpoch:   n.PreyEpoch,
+		}
+		toSend := sendMessage(n.Log, message, "Sendin' digest")
+		n.MessagesToSend <- &PendingMessage{Recipient: "all", Message: toSend}
+	}
+}
+
+// Settles the captures made more than SCORE_SETTLE_TIME ago, unless we're partitioned and some of them may yet be
+// dropped when it heals
+func (n *NodeCommInterface) settleScores() {
+	if n.Partition.Split() {
+		return
+	}
+	age := uint64(SCORE_SETTLE_TIME / n.Clock.TickDuration())
+	tick := n.Clock.CurrentTick()
+	if tick > age {
+		SettleScores(&n.PlayerNode.GameState.PlayerScores, tick-age)
+	}
+}
+
+// Returns how often digests are sent
+func (n *NodeCommInterface) digestInterval() (time.Duration) {
+	interval := n.Config.DigestMs
+	if interval == 0 {
+		interval = DEFAULT_DIGEST_MS
+	}
+	return time.Duration(interval) * time.Millisecond
+}
+
+// Watches for players going quiet, counting them as lost to a partition. While partitioned, also checks with the
+// server for lost players that have left the game altogether, so they no longer count toward a majority. Should be
+// run in a goroutine.
+func (n *NodeCommInterface) RunPartitionWatch() {
+	lastForget := time.Now()
+	for {
+		time.Sleep(n.digestInterval())
+		for _, id := range n.Partition.Sweep(time.Now()) {
+			view, members := n.Partition.View()
+			fmt.Printf("Lost contact with %s; partition view now %v of %d players\n", id, view, members)
+			// It may only be the direct route that's down
+			n.NodesToRelay <- id
+		}
+		if !n.Partition.Split() || time.Since(lastForget) < PARTITION_FORGET_INTERVAL {
+			continue
+		}
+		lastForget = time.Now()
+		registered, err := n.fetchNodes()
+		if err != nil {
+			fmt.Printf("DEBUG - Partition watch err: [%s]\n", err)
+			continue
+		}
+		for _, id := range n.Partition.Lost() {
+			if _, ok := registered[id]; !ok {
+				fmt.Println("Lost player has left the game:", id)
+				n.Partition.Forget(id)
+				n.NodesToDelete <- id
+			}
+		}
+	}
+}
+
+// Handles hearing again from a player lost to a partition: swaps gamestates with it so both sides' captures are
+// merged, and if we can reach everyone again, settles the captures made during the partition
+func (n *NodeCommInterface) HandlePartitionHeal(identifier string) {
+	if n.PlayerNode == nil {
+		return
+	}
+	fmt.Println("Partition healed with", identifier)
+	n.SendGameStateToNode(identifier)
+	n.RequestGameState(identifier)
+	n.settlePartition()
+}
+
+// Once no player is lost, drops the captures the partition policy held back, and shows the result on the scoreboard
+func (n *NodeCommInterface) settlePartition() {
+	if n.Partition.Split() {
+		return
+	}
+	dropped := SettlePartition(&n.PlayerNode.GameState.PlayerScores)
+	if dropped > 0 {
+		fmt.Printf("Partition settled: dropped %d captures made on the minority side\n", dropped)
+		n.recordApplied()
+		n.GameStateToSend <- true
+	}
+}
+
+// Runs the relay for the game on this node, at the same address as this node's listener but any free port, and tells
+// the server about it
+func (n *NodeCommInterface) StartRelay() {
+	host, _, _ := net.SplitHostPort(n.LocalAddr.String())
+	relayServer, err := relay.CreateRelay(":0")
+	if err != nil {
+		fmt.Println("Could not start relay:", err)
+		return
+	}
+	_, port, _ := net.SplitHostPort(relayServer.Addr().String())
+	addr := net.JoinHostPort(host, port)
+	auth, err := SignServerCall(n.ServerConn, n.PrivKey, "GServer.RegisterRelay")
+	var secret []byte
+	if err == nil {
+		err = n.ServerConn.Call("GServer.RegisterRelay", shared.RelayRegistration{Addr: addr, Auth: auth}, &secret)
+	}
+	if err != nil {
+		fmt.Println("Could not register relay with server:", err)
+		relayServer.Close()
+		return
+	}
+	relayServer.SetSecret(secret)
+	n.RelayServer = relayServer
+	go relayServer.Run()
+	n.Config.RelayAddr = addr
+	n.Config.RelayToken = shared.RelayToken(secret, n.Config.Identifier)
+	fmt.Println("Running relay at", addr)
+}
+
+// Keeps this node registered with the game's relay, and looks for one if we don't have one yet; should be run in a
+// goroutine
+func (n *NodeCommInterface) RunRelayKeepalive() {
+	for {
+		time.Sleep(relay.RELAY_KEEPALIVE)
+		if n.RelayLink.Connected() {
+			err := n.RelayLink.Register()
+			if err != nil {
+				fmt.Printf("DEBUG - Relay keepalive err: [%s]\n", err)
+			}
+			continue
+		}
+		var info shared.RelayInfo
+		err := n.CallServer("GServer.GetRelay", &info)
+		if err != nil || info.Addr == "" {
+			continue
+		}
+		err = n.RelayLink.Connect(info.Addr, n.Config.Identifier, info.Token)
+		if err != nil {
+			fmt.Println("Could not connect to relay:", err)
+		}
+	}
+}
+
+// Periodically resynchronises the game clock with the server to correct for drift; should be run in a goroutine
+func (n *NodeCommInterface) RunClockSync() {
+	for {
+		time.Sleep(CLOCK_SYNC_INTERVAL)
+		err := n.Clock.Sync(n.ServerConn, n.PrivKey)
+		if err != nil {
+			fmt.Printf("DEBUG - Clock sync err: [%s]\n", err)
+		}
+	}
+}
+
 // Function that is started when the server dies; will continue to reregister until the server comes back up
 func (n* NodeCommInterface) Reregister() shared.GameConfig {
 	response, register_failed_err := DialAndRegister(n)
@@ -542,16 +964,79 @@ func(n* NodeCommInterface) SendMoveToNodes(move *shared.Coord){
 		Move:        moveId,
 		Addr:        n.LocalAddr.String(),
 		Seq:         sequenceNumber,
+		Tick:        n.Clock.CurrentTick(),
 	}
 
 	toSend := sendMessage(n.Log, message, "Sendin' move")
-	n.MessagesToSend <- &PendingMessage{Recipient: "all", Message: toSend}
-	n.MovesToSend <- &PendingMoveUpdates{Seq: sequenceNumber, Coord: move, Rejected: 0}
+	if n.Config.InterestRadius <= 0 {
+		n.MessagesToSend <- &PendingMessage{Recipient: "all", Message: toSend}
+		n.MovesToSend <- &PendingMoveUpdates{Seq: sequenceNumber, Coord: move, Rejected: 0}
+		return
+	}
+	// Only the nodes near us get every move; the rest hear where we are from RunMoveSummaries
+	n.MessagesToSend <- &PendingMessage{Recipient: "near", Message: toSend, Around: *move}
+	n.MovesToSend <- &PendingMoveUpdates{Seq: sequenceNumber, Coord: move, Rejected: 0,
+		Recipients: n.countNodesNear(*move)}
+}
+
+// Periodically sends this node's latest position, as a move summary, to the nodes outside its area of interest, which
+// aren't sent every move; should be run in a goroutine. Does nothing in games with no interest radius.
+func (n *NodeCommInterface) RunMoveSummaries() {
+	interval := n.Config.SummaryMs
+	if interval == 0 {
+		interval = DEFAULT_SUMMARY_MS
+	}
+	for n.Config.InterestRadius > 0 {
+		time.Sleep(time.Duration(interval) * time.Millisecond)
+		if n.PlayerNode == nil {
+			continue
+		}
+		n.PlayerNode.GameState.PlayerLocs.RLock()
+		pos, ok := n.PlayerNode.GameState.PlayerLocs.Data[n.PlayerNode.Identifier]
+		n.PlayerNode.GameState.PlayerLocs.RUnlock()
+		if !ok {
+			continue
+		}
+		message := NodeMessage{
+			MessageType: "move",
+			Identifier:  n.PlayerNode.Identifier,
+			Move:        n.CreateMove(&pos),
+			Addr:        n.LocalAddr.String(),
+			Summary:     true,
+			Tick:        n.Clock.CurrentTick(),
+		}
+		toSend := sendMessage(n.Log, message, "Sendin' move summary")
+		n.MessagesToSend <- &PendingMessage{Recipient: "far", Message: toSend, Around: pos}
+	}
+}
+
+// Returns true if the given node should get every move made at pos: it's the prey node, it's within the interest
+// radius, or we don't know where it is
+func (n *NodeCommInterface) isNear(identifier string, pos shared.Coord) (bool) {
+	if identifier == "prey" {
+		return true
+	}
+	n.PlayerNode.GameState.PlayerLocs.RLock()
+	peer, ok := n.PlayerNode.GameState.PlayerLocs.Data[identifier]
+	n.PlayerNode.GameState.PlayerLocs.RUnlock()
+	return !ok || WithinInterest(pos, peer, n.Config.InterestRadius)
+}
+
+// Returns the number of nodes in the game with a known position within the interest radius of pos, plus the prey node
+func (n *NodeCommInterface) countNodesNear(pos shared.Coord) (count int) {
+	n.PlayerNode.GameState.PlayerLocs.RLock()
+	defer n.PlayerNode.GameState.PlayerLocs.RUnlock()
+	for id, peer := range n.PlayerNode.GameState.PlayerLocs.Data {
+		if id != n.PlayerNode.Identifier && (id == "prey" || WithinInterest(pos, peer, n.Config.InterestRadius)) {
+			count++
+		}
+	}
+	return count
 }
 
 func (n *NodeCommInterface)CreateMove(move *shared.Coord) shared.SignedMove {
 	moveBytes, err := json.Marshal(move)
-	r, s, err := ecdsa.Sign(rand.Reader, n.PrivKey, moveBytes)
+	r, s, err := key.Sign(n.PrivKey, moveBytes)
 	if err != nil {
 		fmt.Println("could not sign move")
 		panic(err)
@@ -569,6 +1054,7 @@ func(n* NodeCommInterface) SendPreyCaptureToNodes(move *shared.Coord, score int)
 		return
 	}
 	moveId := n.CreateMove(move)
+	event := n.ownCaptureEvent(sequenceNumber)
 	message := NodeMessage{
 		MessageType: "captured",
 		Identifier: n.PlayerNode.Identifier,
@@ -577,12 +1063,47 @@ func(n* NodeCommInterface) SendPreyCaptureToNodes(move *shared.Coord, score int)
 		Seq: sequenceNumber,
 		PreySeq:n.RW.PreySeq,
 		Addr: n.LocalAddr.String(),
+		Tick: event.Tick,
+		VClock: NextVectorTimestamp(n.Log, n.PlayerNode.Identifier),
+		View: event.View,
+		Members: event.Members,
+	}
+
+	// Stake our own claim, so a concurrent capture of the same prey move is judged against it. If another node's
+	// capture of this prey move already beats ours, ours never happened.
+	claim := &CaptureClaim{Identifier: n.PlayerNode.Identifier, Seq: message.Seq, PreySeq: message.PreySeq,
+		Tick: message.Tick, VClock: message.VClock, View: message.View, Members: message.Members}
+	if !n.Captures.Beats(claim) {
+		n.RevokeCapture(claim)
+		return
+	}
+	if displaced := n.Captures.Record(claim); displaced != nil {
+		n.RevokeCapture(displaced)
 	}
 
 	toSend := sendMessage(n.Log, message, "Sendin' capturedPreyUpdate")
 	n.MessagesToSend <- &PendingMessage{Recipient: "all", Message: toSend}
 }
 
+// Returns a capture event for a capture by this node, recording the partition view it was made in
+func (n *NodeCommInterface) CreateCaptureEvent() (shared.CaptureEvent) {
+	view, members := n.Partition.View()
+	return shared.CaptureEvent{Player: n.PlayerNode.Identifier, Worth: n.PlayerNode.GameConfig.CatchWorth,
+		View: view, Members: members, Tick: n.Clock.CurrentTick()}
+}
+
+// Returns the capture event this node already counted for its capture with the given sequence number, or a new one
+func (n *NodeCommInterface) ownCaptureEvent(seq uint64) (shared.CaptureEvent) {
+	scores := &n.PlayerNode.GameState.PlayerScores
+	scores.RLock()
+	event, ok := scores.Events[CaptureEventId(n.PlayerNode.Identifier, seq)]
+	scores.RUnlock()
+	if ok {
+		return event
+	}
+	return n.CreateCaptureEvent()
+}
+
 func(n* NodeCommInterface) SendPreyCaptureReject(toSendID string, move shared.SignedMove, seq uint64, score int) {
 	if move.MoveByte == nil{
 		return
@@ -601,11 +1122,13 @@ func(n* NodeCommInterface) SendPreyCaptureReject(toSendID string, move shared.Si
 	n.MessagesToSend <- &PendingMessage{Recipient: toSendID, Message: toSend}
 }
 
-func(n* NodeCommInterface) HandleRejectedCapture(move shared.Coord, seq uint64, score int){
+// Handles another node rejecting one of our captures by revoking it; the revocation reaches every other node with the
+// next digest repair
+func(n* NodeCommInterface) HandleRejectedCapture(move shared.Coord, seq uint64){
 	if n.RW.Match("captured_prey", seq, &move){
-		n.PlayerNode.GameState.PlayerScores.Lock()
-		n.PlayerNode.GameState.PlayerScores.Data[n.PlayerNode.Identifier] = score
-		n.PlayerNode.GameState.PlayerScores.Unlock()
+		RevokeCaptureEvent(&n.PlayerNode.GameState.PlayerScores, CaptureEventId(n.PlayerNode.Identifier, seq))
+		n.recordApplied()
+		n.GameStateToSend <- true
 	}else {
 		fmt.Println("I DID NOT DO IT")
 	}
@@ -619,9 +1142,15 @@ func (n* NodeCommInterface) SendGameStateToNode(otherNodeId string){
 		Identifier: n.PlayerNode.Identifier,
 		GameState: &n.PlayerNode.GameState,
 		Addr: n.LocalAddr.String(),
+		PreyEpoch: n.PreyEpoch,
 	}
 
+	// Other goroutines go on changing the gamestate while it's encoded
+	n.PlayerNode.GameState.PlayerLocs.RLock()
+	n.PlayerNode.GameState.PlayerScores.RLock()
 	toSend := sendMessage(n.Log, message, "Sendin' gamestate")
+	n.PlayerNode.GameState.PlayerScores.RUnlock()
+	n.PlayerNode.GameState.PlayerLocs.RUnlock()
 	n.MessagesToSend <- &PendingMessage{Recipient: otherNodeId, Message: toSend}
 }
 
@@ -640,8 +1169,8 @@ func (n *NodeCommInterface) SendMoveCommitToNodes(moveCommit *shared.MoveCommit)
 
 // Helper function to send message to other nodes; do not call directly; instead write to the messagesTosend channel
 func (n *NodeCommInterface) sendMessageToNodes(toSend []byte) {
-	for id, val := range n.OtherNodes{
-		_, err := val.Write(toSend)
+	for id := range n.OtherNodes{
+		err := n.writeToNode(id, toSend, false)
 		if err != nil{
 			fmt.Println(err)
 			n.NodesWriteConnRefused <- id
@@ -649,24 +1178,74 @@ func (n *NodeCommInterface) sendMessageToNodes(toSend []byte) {
 	}
 }
 
-// Handles a gamestate received from another node.
-func (n* NodeCommInterface) HandleReceivedGameState(identifier string, gameState *shared.GameState) {
-	//TODO: don't just wholesale replace this
-	if !n.HasGameState {
-		n.PlayerNode.GameState.PlayerLocs.Lock()
-		defer n.PlayerNode.GameState.PlayerLocs.Unlock()
-
-		for id, pos := range gameState.PlayerLocs.Data {
-			n.PlayerNode.GameState.PlayerLocs.Data[id] = pos
+// Helper function to send a message to the nodes inside (near) or outside (!near) the area of interest around pos; do
+// not call directly; instead write to the messagesTosend channel
+func (n *NodeCommInterface) sendMessageToNodesAround(toSend []byte, pos shared.Coord, near bool) {
+	for id := range n.OtherNodes{
+		if n.isNear(id, pos) != near {
+			continue
+		}
+		err := n.writeToNode(id, toSend, false)
+		if err != nil{
+			fmt.Println(err)
+			n.NodesWriteConnRefused <- id
 		}
+	}
+}
 
-		n.PlayerNode.GameState.PlayerScores.Lock()
-		defer n.PlayerNode.GameState.PlayerScores.Unlock()
-		for id, score := range gameState.PlayerScores.Data {
-			n.PlayerNode.GameState.PlayerScores.Data[id] = score
+// Handles a gamestate received from another node. On joining, the first gamestate received is taken as is; after that,
+// gamestates come from digest repairs and are merged into ours (see MergeGameState).
+func (n* NodeCommInterface) HandleReceivedGameState(identifier string, gameState *shared.GameState, preyEpoch uint64) {
+	if gameState == nil {
+		return
+	}
+	if n.HasGameState {
+		epoch, changed := MergeGameState(&n.PlayerNode.GameState, n.PreyEpoch, n.PlayerNode.Identifier,
+			gameState, preyEpoch, identifier)
+		n.PreyEpoch = epoch
+		if changed {
+			fmt.Println("Repaired gamestate from", identifier)
+			n.recordApplied()
+			n.GameStateToSend <- true
 		}
-		n.HasGameState = true
+		n.settlePartition()
+		return
+	}
+
+	n.PlayerNode.GameState.PlayerLocs.Lock()
+	for id, pos := range gameState.PlayerLocs.Data {
+		n.PlayerNode.GameState.PlayerLocs.Data[id] = pos
+	}
+
+	MergeScores(&n.PlayerNode.GameState.PlayerScores, &gameState.PlayerScores)
+	n.PreyEpoch = preyEpoch
+	n.HasGameState = true
+	n.PlayerNode.GameState.PlayerLocs.Unlock()
+	n.recordApplied()
+}
+
+// Handles a digest received from another node by comparing it with our own gamestate's digest as that node would make
+// it (see GameStateDigest). If the node's digest has disagreed with ours twice in a row, we send it our gamestate and
+// ask for its own, so both sides merge.
+func (n* NodeCommInterface) HandleReceivedDigest(identifier string, digest []byte) {
+	if !n.HasGameState || digest == nil {
+		return
+	}
+	// Our digest as the sender would make it, with where we think the sender is
+	if bytes.Equal(digest, GameStateDigest(&n.PlayerNode.GameState, n.PreyEpoch, identifier,
+		n.Config.InterestRadius <= 0)) {
+		delete(n.digestSuspects, identifier)
+		return
+	}
+	n.DigestMismatches++
+	fmt.Printf("Gamestate digest mismatch with %s (%d so far)\n", identifier, n.DigestMismatches)
+	if !n.digestSuspects[identifier] {
+		n.digestSuspects[identifier] = true
+		return
 	}
+	delete(n.digestSuspects, identifier)
+	n.SendGameStateToNode(identifier)
+	n.RequestGameState(identifier)
 }
 
 // Handle moves that require a move commit check (lockstep)
@@ -685,6 +1264,7 @@ func (n* NodeCommInterface) HandleReceivedMoveL(identifier string, move *shared.
 			n.PlayerNode.GameState.PlayerLocs.Lock()
 			n.PlayerNode.GameState.PlayerLocs.Data[identifier] = *move
 			n.PlayerNode.GameState.PlayerLocs.Unlock()
+			n.recordApplied()
 			// TODO: Note: I've commented this out to slow down the game
 			// n.GameStateToSend <- true
 			return nil
@@ -705,6 +1285,7 @@ func (n* NodeCommInterface) HandleReceivedMoveNL(identifier string, move *shared
 		n.PlayerNode.GameState.PlayerLocs.Lock()
 		n.PlayerNode.GameState.PlayerLocs.Data[identifier] = *move
 		n.PlayerNode.GameState.PlayerLocs.Unlock()
+		n.recordApplied()
 		// TODO: Note: I've commented this out to slow down the game
 		n.GameStateToSend <- true
 
@@ -718,6 +1299,22 @@ func (n* NodeCommInterface) HandleReceivedMoveNL(identifier string, move *shared
 	return wolferrors.InvalidMoveError("[" + string(move.X) + ", " + string(move.Y) + "]")
 }
 
+// Handles a move summary from a node outside our area of interest by moving it to where it says it is. Unlike a move,
+// a summary isn't ACKed, and isn't kept for matching captures against.
+// Returns InvalidMoveError if the position is not valid
+func (n* NodeCommInterface) HandleReceivedMoveSummary(identifier string, pos *shared.Coord) (err error) {
+	err = n.CheckMoveIsValid(*pos)
+	if err != nil {
+		return err
+	}
+	n.PlayerNode.GameState.PlayerLocs.Lock()
+	n.PlayerNode.GameState.PlayerLocs.Data[identifier] = *pos
+	n.PlayerNode.GameState.PlayerLocs.Unlock()
+	n.recordApplied()
+	n.GameStateToSend <- true
+	return nil
+}
+
 // Handles received move commits from other nodes by storing them in anticipation of receiving a move
 // Returns IncorrectPlayerError if the player that send the message is not the player they are claiming to be
 func (n* NodeCommInterface) HandleReceivedMoveCommit(identifier string, moveCommit *shared.MoveCommit) (err error) {
@@ -739,33 +1336,139 @@ func (n* NodeCommInterface) HandleReceivedAck(identifier string, seq uint64){
 
 // Handles "connect" messages received by other nodes by adding the incoming node to this node's OtherNodes
 func (n* NodeCommInterface) HandleIncomingConnectionRequest(identifier string, addr string, pubKeyString string) {
-	node := n.GetClientFromAddrString(addr)
-	pubKey := key.StringToPubKey(pubKeyString)
-	n.NodesToAdd <- &OtherNode{Identifier: identifier, Conn: node, PubKey: &pubKey}
+	pubKey, err := key.DecodePublicKey(pubKeyString)
+	if err != nil {
+		fmt.Printf("Refusing connection from [%s] with a bad public key: %s\n", identifier, err)
+		return
+	}
+	if n.Config.EncryptTraffic && !n.Registered.Matches(identifier, pubKey, n.fetchNodes) {
+		fmt.Printf("Refusing connection from [%s] with a key the server didn't register\n", identifier)
+		return
+	}
+	node, relayed, err := n.dialOrRelay(addr)
+	if err != nil {
+		fmt.Printf("Refusing connection from [%s], which can't be reached directly or through a relay: %s\n",
+			identifier, err)
+		return
+	}
+	n.NodesToAdd <- &OtherNode{Identifier: identifier, Conn: node, PubKey: pubKey, Relayed: relayed}
 }
 
+// Handles a capture with no causal information, judged on its game state checks alone
 func (n* NodeCommInterface) HandleCapturedPreyRequest(identifier string, move *shared.Coord, score int, preySeq uint64) (int, error) {
-	err := n.CheckGotPrey(*move)
+	// With no sequence number of its own, the capture is named after the prey move it claims
+	return n.HandleCausalCapture(&CaptureClaim{Identifier: identifier, Seq: preySeq, PreySeq: preySeq}, move, score)
+}
+
+// Handles a capture claimed by another node. The claim must not be stale, must beat any other claim on the same prey
+// move (see causal.go), and must pass the usual checks on position and score.
+// Returns the score this node holds for the claimer, and an error if the capture was rejected
+func (n* NodeCommInterface) HandleCausalCapture(claim *CaptureClaim, move *shared.Coord, score int) (int, error) {
+	defer n.recordApplied()
+	identifier := claim.Identifier
+	err := n.Captures.CheckNotStale(claim)
 	if err != nil {
-		if !n.RW.Match("prey", preySeq, move){
-			return score, err
-		}else{
-			fmt.Println("Successfully found old prey")
-		}
+		return n.scoreOf(identifier), err
+	}
+	if !n.Captures.Beats(claim) {
+		return n.scoreOf(identifier), wolferrors.InvalidPreyCaptureError(identifier)
+	}
+
+	err = n.CheckPreyWasAt(claim, move)
+	if err != nil {
+		return score, err
 	}
 	err = n.CheckMoveIsValid(*move)
 	if err != nil {
 		return score, err
 	}
-	scoreCalc, err := n.CheckAndUpdateScore(identifier, score)
+	event := shared.CaptureEvent{Player: identifier, Worth: n.PlayerNode.GameConfig.CatchWorth, View: claim.View,
+		Members: claim.Members, Tick: claim.Tick}
+	scoreCalc, err := n.CheckAndUpdateScore(CaptureEventId(identifier, claim.Seq), event, score)
 	if err != nil {
 		return scoreCalc, err
 	}
+
+	// If this capture beat one we'd already accepted, the prey has already been dealt with; just move the points
+	if displaced := n.Captures.Record(claim); displaced != nil {
+		n.RevokeCapture(displaced)
+		return score, nil
+	}
+
+	if n.Config.ReplicatedPrey {
+		n.RespawnReplicatedPrey()
+	} else {
+		n.PlayerNode.GameState.PlayerLocs.Lock()
+		delete(n.PlayerNode.GameState.PlayerLocs.Data, "prey")
+		n.PlayerNode.GameState.PlayerLocs.Unlock()
+	}
+
+	return score, nil
+}
+
+// Checks the prey was where the capture says, as the capturer would have seen it. A capture stamped with a tick is
+// checked against where the prey was over the MaxLagTicks before it, so a laggy wolf whose capture was valid when it
+// was made isn't turned down; one that arrives more than MaxLagTicks after it was made is rejected outright.
+// Returns CaptureTooLateError or InvalidPreyCaptureError if the capture can't stand
+func (n* NodeCommInterface) CheckPreyWasAt(claim *CaptureClaim, move *shared.Coord) (err error) {
+	err = n.CheckGotPrey(*move)
+	if err == nil {
+		return nil
+	}
+	if n.RW.Match("prey", claim.PreySeq, move) {
+		fmt.Println("Successfully found old prey")
+		return nil
+	}
+	if claim.Tick == 0 {
+		return err
+	}
+
+	maxLag := n.Config.MaxLagTicks
+	if maxLag == 0 {
+		maxLag = DEFAULT_MAX_LAG_TICKS
+	}
+	if claim.Tick+maxLag < n.Clock.CurrentTick() {
+		return wolferrors.CaptureTooLateError(claim.Identifier)
+	}
+	from := uint64(0)
+	if claim.Tick > maxLag {
+		from = claim.Tick - maxLag
+	}
+	if n.History.WasAt("prey", *move, from, claim.Tick) {
+		fmt.Println("Rewound prey for lagged capture")
+		return nil
+	}
+	return err
+}
+
+// Takes back the points a node was given for a capture that lost out to another capture of the same prey move
+func (n* NodeCommInterface) RevokeCapture(claim *CaptureClaim) {
+	fmt.Println("Revoking capture by", claim.Identifier)
+	RevokeCaptureEvent(&n.PlayerNode.GameState.PlayerScores, CaptureEventId(claim.Identifier, claim.Seq))
+	n.recordApplied()
+	n.GameStateToSend <- true
+}
+
+// Returns this node's view of the given node's score
+func (n* NodeCommInterface) scoreOf(identifier string) (int) {
+	n.PlayerNode.GameState.PlayerScores.RLock()
+	defer n.PlayerNode.GameState.PlayerScores.RUnlock()
+	return n.PlayerNode.GameState.PlayerScores.Data[identifier]
+}
+
+// Moves the prey to its next spawn point after a capture, for games where every node simulates the prey. There is no
+// prey node to send the new position, so each node derives it from the game seed and the number of captures so far.
+func (n* NodeCommInterface) RespawnReplicatedPrey() {
 	n.PlayerNode.GameState.PlayerLocs.Lock()
-	delete(n.PlayerNode.GameState.PlayerLocs.Data, "prey")
+	n.PreyEpoch++
+	preyLoc := n.PlayerNode.GameState.PlayerLocs.Data["prey"]
+	newPos := NextPreySpawn(n.Config.PreySeed, n.PreyEpoch, preyLoc, n.PlayerNode.GetGridManager())
+	n.PlayerNode.GameState.PlayerLocs.Data["prey"] = newPos
 	n.PlayerNode.GameState.PlayerLocs.Unlock()
+	n.History.Add("prey", n.Clock.CurrentTick(), newPos)
 
-	return score, nil
+	n.recordApplied()
+	n.GameStateToSend <- true
 }
 
 // If we are requested to send a gamestate, send it
@@ -782,10 +1485,10 @@ func (n* NodeCommInterface) InitiateConnection(nodeClient *net.UDPConn, id strin
 		Identifier:  n.Config.Identifier,
 		GameState:   nil,
 		Addr:        n.LocalAddr.String(),
-		PubKey: 	 key.PubKeyToString(*n.PubKey),
+		PubKey: 	 key.PubKeyToString(n.PubKey),
 	}
 	toSend := sendMessage(n.Log, message, "Initiating connection")
-	n.MessagesToSend <- &PendingMessage{Recipient: id, Message: toSend}
+	n.MessagesToSend <- &PendingMessage{Recipient: id, Message: toSend, Plain: true}
 
 	if !n.HasGameState {
 		n.RequestGameState(id)
@@ -841,24 +1544,28 @@ func (n *NodeCommInterface) CalculateHash(m shared.Coord, id string) ([]byte) {
 
 // Sign the move commit with private key
 func (n *NodeCommInterface) SignMoveCommit(hash []byte) (r, s *big.Int, err error) {
-	return ecdsa.Sign(rand.Reader, n.PrivKey, hash)
+	return key.Sign(n.PrivKey, hash)
 }
 
 // Checks to see if the hash is legit
 func (n *NodeCommInterface) CheckAuthenticityOfMoveCommit(m *shared.MoveCommit) (bool) {
-	publicKey := key.PublicKeyStringToKey(m.PubKey)
+	publicKey, err := key.DecodePublicKey(m.PubKey)
+	if err != nil {
+		fmt.Println("Move commit has a bad public key:", err)
+		return false
+	}
 	rBigInt := new(big.Int)
-	_, err := fmt.Sscan(m.R, rBigInt)
+	_, err = fmt.Sscan(m.R, rBigInt)
 
 	sBigInt := new(big.Int)
 	_, err = fmt.Sscan(m.S, sBigInt)
 	if err != nil {
 		fmt.Println("Trouble converting string to big int")
 	}
-	return ecdsa.Verify(publicKey, m.MoveHash, rBigInt, sBigInt)
+	return key.Verify(publicKey, m.MoveHash, rBigInt, sBigInt)
 }
 
-func (n *NodeCommInterface) CheckAuthenticityOfMove(publicKey *ecdsa.PublicKey, m *shared.SignedMove)(bool){
+func (n *NodeCommInterface) CheckAuthenticityOfMove(publicKey crypto.PublicKey, m *shared.SignedMove)(bool){
 	if publicKey == nil{
 		// public key is nil for some tests, just pass if this is the case
 		return true
@@ -872,7 +1579,7 @@ func (n *NodeCommInterface) CheckAuthenticityOfMove(publicKey *ecdsa.PublicKey,
 		fmt.Println("Trouble converting string to big int")
 	}
 
-	return ecdsa.Verify(publicKey, m.MoveByte, rBigInt, sBigInt)
+	return key.Verify(publicKey, m.MoveByte, rBigInt, sBigInt)
 }
 
 
@@ -909,25 +1616,25 @@ func (n *NodeCommInterface) CheckGotPrey(move shared.Coord) (err error) {
 	return wolferrors.InvalidPreyCaptureError("[" + string(move.X) + ", " + string(move.Y) + "]")
 }
 
-func (n *NodeCommInterface) CheckAndUpdateScore(identifier string, score int) (scoreCalc int, err error) {
-	_, exists := n.PlayerNode.GameState.PlayerScores.Data[identifier]
-	playerScore := n.PlayerNode.GameState.PlayerScores.Data[identifier]
-
-	if !exists && score == n.PlayerNode.GameConfig.CatchWorth {
-		n.PlayerNode.GameState.PlayerScores.Lock()
-		defer n.PlayerNode.GameState.PlayerScores.Unlock()
-		n.PlayerNode.GameState.PlayerScores.Data[identifier] = score
-		return score,nil
+// Checks the score a node sent with a capture is the one we hold for it plus the capture's worth (if the partition
+// policy counts it), and if so counts the capture event. A capture event we've already counted is let through unchanged.
+// Returns the score we hold for the node, and InvalidScoreUpdateError if the scores don't agree
+func (n *NodeCommInterface) CheckAndUpdateScore(eventId string, event shared.CaptureEvent, score int) (scoreCalc int, err error) {
+	identifier := event.Player
+	scores := &n.PlayerNode.GameState.PlayerScores
+	if HasCaptureEvent(scores, eventId) {
+		return n.scoreOf(identifier), nil
 	}
 
-	if exists && score != playerScore + n.PlayerNode.GameConfig.CatchWorth {
-		fmt.Println("exists: ", exists)
+	playerScore := n.scoreOf(identifier)
+	expected := playerScore
+	if CountsTowardScore(scores.Policy, event) {
+		expected += event.Worth
+	}
+	if score != expected {
 		fmt.Println("score sent: ", score)
-		fmt.Println("score held: ", playerScore + n.PlayerNode.GameConfig.CatchWorth)
+		fmt.Println("score held: ", expected)
 		return playerScore, wolferrors.InvalidScoreUpdateError(string(score))
 	}
-	n.PlayerNode.GameState.PlayerScores.Lock()
-	defer n.PlayerNode.GameState.PlayerScores.Unlock()
-	n.PlayerNode.GameState.PlayerScores.Data[identifier] += n.PlayerNode.GameConfig.CatchWorth
-	return score, nil
+	return AddCaptureEvent(scores, eventId, event), nil
 }
\ No newline at end of file
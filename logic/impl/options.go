@@ -0,0 +1,35 @@
+package impl
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Settings for a node that aren't given to its constructor; set before creating the node (see wolfpack/wolfpack.go)
+type NodeOptions struct {
+	// The room to join on the server; nodes only play with the other nodes in their room
+	Room   string
+
+	// The directory GoVector logs are written to
+	LogDir string
+
+	// The CA certificate file to check the server's TLS certificate against; if empty, the server is dialed without
+	// TLS (see DialServer)
+	ServerCA string
+
+	// The file to record the match to, for replaying later (see replay.go); if empty, the match isn't recorded
+	Record   string
+}
+
+// The defaults; ServerCA and Record are set from WOLFPACK_SERVER_CA and WOLFPACK_RECORD in the environment
+var DefaultNodeOptions = NodeOptions{LogDir: ".", ServerCA: os.Getenv("WOLFPACK_SERVER_CA"),
+	Record: os.Getenv("WOLFPACK_RECORD")}
+
+// Returns the path to write the named GoVector log to, creating the log directory if needed
+func (o NodeOptions) LogPath(name string) (string) {
+	if o.LogDir == "" || o.LogDir == "." {
+		return name
+	}
+	os.MkdirAll(o.LogDir, 0755)
+	return filepath.Join(o.LogDir, name)
+}
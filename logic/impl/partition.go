@@ -0,0 +1,170 @@
+package impl
+
+import (
+	"sort"
+	"sync"
+	"time"
+	"../../shared"
+)
+
+// Network partitions.
+//
+// A node counts another as reachable while it keeps hearing from it; digests go out every DigestMs, so a node that has
+// been silent for PARTITION_TIMEOUT_DIGESTS digest intervals is counted as lost. Every capture records the capturer's
+// partition view: the players it could reach at the time, itself included, and how many players it knew of in all.
+//
+// How captures made during a partition count is set by the game's partition policy:
+//   - PARTITION_MAJORITY: only captures made on a side holding a strict majority of the players count. Captures made
+//     on a minority side are held, shown on the scoreboard but not counted, and dropped when the partition heals.
+//   - PARTITION_KEEP_BOTH: every capture counts, whichever side made it; on healing, both sides' histories are kept.
+// The policy decides the score from each capture's recorded view alone, so every node comes to the same scores once
+// it has merged the same captures.
+
+const PARTITION_MAJORITY = "majority"
+const PARTITION_KEEP_BOTH = "keep-both"
+
+// How many digest intervals a node can go unheard before it is counted as on the other side of a partition
+const PARTITION_TIMEOUT_DIGESTS = 3
+
+// How often, while partitioned, we check with the server which lost nodes are still in the game
+const PARTITION_FORGET_INTERVAL = 5 * time.Second
+
+// Tracks which players this node can currently reach
+type PartitionTracker struct {
+	sync.Mutex
+
+	// This node's identifier
+	self string
+
+	// How long a player can go unheard before it is counted as lost
+	timeout time.Duration
+
+	// When each player in the game was last heard from
+	lastHeard map[string]time.Time
+
+	// The players that have gone unheard for longer than the timeout, but are still in the game
+	lost map[string]bool
+}
+
+// Creates a partition tracker that counts a player as lost after the given time unheard
+func CreatePartitionTracker(timeout time.Duration) (*PartitionTracker) {
+	return &PartitionTracker{
+		timeout:   timeout,
+		lastHeard: make(map[string]time.Time),
+		lost:      make(map[string]bool),
+	}
+}
+
+// Sets the identifier of this node, which is always in its own view
+func (pt *PartitionTracker) SetSelf(identifier string) {
+	pt.Lock()
+	defer pt.Unlock()
+	pt.self = identifier
+}
+
+// Sets how long a player can go unheard before it is counted as lost
+func (pt *PartitionTracker) SetTimeout(timeout time.Duration) {
+	pt.Lock()
+	defer pt.Unlock()
+	pt.timeout = timeout
+}
+
+// Records hearing from a player; the prey and spectators aren't players, and don't count towards either side
+// Returns true if the player had been lost; that is, a partition between us just healed
+func (pt *PartitionTracker) Heard(identifier string, now time.Time) (healed bool) {
+	if identifier == "prey" || identifier == "" || shared.IsObserver(identifier) {
+		return false
+	}
+	pt.Lock()
+	defer pt.Unlock()
+	pt.lastHeard[identifier] = now
+	healed = pt.lost[identifier]
+	delete(pt.lost, identifier)
+	return healed
+}
+
+// Counts every player unheard for longer than the timeout as lost
+// Returns the players newly lost
+func (pt *PartitionTracker) Sweep(now time.Time) (newlyLost []string) {
+	pt.Lock()
+	defer pt.Unlock()
+	for id, heard := range pt.lastHeard {
+		if !pt.lost[id] && now.Sub(heard) > pt.timeout {
+			pt.lost[id] = true
+			newlyLost = append(newlyLost, id)
+		}
+	}
+	sort.Strings(newlyLost)
+	return newlyLost
+}
+
+// Forgets a player entirely, for players that have left the game rather than been cut off from us
+func (pt *PartitionTracker) Forget(identifier string) {
+	pt.Lock()
+	defer pt.Unlock()
+	delete(pt.lastHeard, identifier)
+	delete(pt.lost, identifier)
+}
+
+// Returns the players currently lost
+func (pt *PartitionTracker) Lost() (lost []string) {
+	pt.Lock()
+	defer pt.Unlock()
+	for id := range pt.lost {
+		lost = append(lost, id)
+	}
+	sort.Strings(lost)
+	return lost
+}
+
+// Returns true if any player in the game can't currently be reached
+func (pt *PartitionTracker) Split() (bool) {
+	pt.Lock()
+	defer pt.Unlock()
+	return len(pt.lost) > 0
+}
+
+// Returns this node's partition view: the sorted players it can reach, itself included, and how many players it
+// knows of in all
+func (pt *PartitionTracker) View() (view []string, members int) {
+	pt.Lock()
+	defer pt.Unlock()
+	view = []string{pt.self}
+	for id := range pt.lastHeard {
+		if !pt.lost[id] && id != pt.self {
+			view = append(view, id)
+		}
+	}
+	sort.Strings(view)
+	return view, len(view) + len(pt.lost)
+}
+
+// Returns true if the capture was made on a side of a partition without a strict majority of the players
+func InMinority(event shared.CaptureEvent) (bool) {
+	return event.Members > 0 && len(event.View)*2 <= event.Members
+}
+
+// Returns true if the capture counts toward the capturer's score under the given partition policy
+func CountsTowardScore(policy string, event shared.CaptureEvent) (bool) {
+	return policy != PARTITION_MAJORITY || !InMinority(event)
+}
+
+// Drops every held capture, once the partition it was made in has healed and the majority side's history has won
+// Returns the number of captures dropped
+func SettlePartition(scores *shared.ScoresLockMap) (dropped int) {
+	scores.Lock()
+	defer scores.Unlock()
+	initScores(scores)
+	players := make(map[string]bool)
+	for id, event := range scores.Events {
+		if !scores.Revoked[id] && !CountsTowardScore(scores.Policy, event) {
+			scores.Revoked[id] = true
+			players[event.Player] = true
+			dropped++
+		}
+	}
+	for player := range players {
+		recountScore(scores, player)
+	}
+	return dropped
+}
@@ -1,20 +1,31 @@
 package impl
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"net"
+	"sync"
 	"../../shared"
-	"encoding/json"
+	"../../wolferrors"
 	"fmt"
-	"log"
+	"time"
 )
 
-// The interface with the player's Pixel GUI (pixel-node.go) from the logic node
+// How long a pixel node has to send its hello after connecting
+const PIXEL_HANDSHAKE_TIMEOUT = 5 * time.Second
+
+// The interface with the player's Pixel GUI (pixel-node.go) from the logic node. The logic node keeps playing while
+// no pixel node is connected; the first to connect is given a session token, and after that a pixel node must
+// present it to take over (see shared/pixel-protocol.go).
 type PixelInterface struct {
 	// The TCP connection over which we wait for a pixel node to connect
 	pixelListener     *net.TCPListener
 
-	// The connection over which messages are sent after a connection is established
-	pixelWriter 	  *net.TCPConn
+	// The connected pixel node, if any, shared by every copy of this interface
+	session           *pixelSession
+
+	// Which of the pixel node's inputs are settled, also shared by every copy
+	inputs            *InputAcks
 
 	// The channel used to send player moves to the main node
 	playerCommChannel chan string
@@ -29,115 +40,315 @@ type PixelInterface struct {
 	Id string
 }
 
+type pixelSession struct {
+	sync.Mutex
+
+	// The connection over which frames are sent after a pixel node connects; nil while none is
+	conn      *shared.PixelConn
+
+	// The token a pixel node must present to resume the session; empty until the first one connects
+	token     string
+
+	// The latest state sent, or that would have been sent, to the pixel node, for one that reconnects
+	lastState *shared.GameRenderState
+
+	// The latest state the connected pixel node has, which deltas are worked out from; nil until it has one
+	sent      *shared.GameRenderState
+
+	// The number of the last state or delta sent on the connection
+	seq       uint64
+
+	// Closed once the first pixel node has connected
+	connected chan bool
+}
+
 // Creates & returns a pixel interface with a channel to send string information to the main node over
 // Called by the main logic node package
 func CreatePixelInterface(playerCommChannel chan string, playerSendChannel chan shared.GameState,
 	settings shared.InitialGameSettings, id string) PixelInterface {
 	pi := PixelInterface{playerCommChannel: playerCommChannel,playerSendChannel:playerSendChannel, Id: id,
-	gameConfig: settings}
+	gameConfig: settings, session: &pixelSession{connected: make(chan bool)}, inputs: CreateInputAcks()}
 	return pi
 }
 
-// To be run in a goroutine; waits for the notification a gamestate should be rendered then sends that gamestate
-// to the pixel node
+// To be run in a goroutine; waits for the notification a gamestate should be rendered then sends what changed in it
+// to the pixel node, and every KEYFRAME_INTERVAL, sends the latest state in full
 func (pi *PixelInterface) waitForGameStates() {
+	keyframes := time.NewTicker(shared.KEYFRAME_INTERVAL)
 	for {
-		state := <-pi.playerSendChannel
+		var err error
+		select {
+		case state := <-pi.playerSendChannel:
+			renderState := pi.renderState(state)
+			pi.session.Lock()
+			pi.session.lastState = &renderState
+			err = pi.session.sendState(renderState, false)
+			pi.session.Unlock()
+		case <-keyframes.C:
+			pi.session.Lock()
+			if pi.session.lastState != nil {
+				err = pi.session.sendState(*pi.session.lastState, true)
+			}
+			pi.session.Unlock()
+		}
+		if err != nil {
+			fmt.Println(err)
+		}
+	}
+}
 
+// Returns the state for the pixel node to render
+func (pi *PixelInterface) renderState(state shared.GameState) (shared.GameRenderState) {
+	// Read before the state, so every input acknowledged is in it
+	inputAck := pi.inputs.Ack()
 
-		state.PlayerLocs.Lock()
-		state.PlayerScores.Lock()
+	state.PlayerLocs.Lock()
+	state.PlayerScores.Lock()
 
-		// Create the player map without without this node or prey node
-		otherPlayers := make(map[string]shared.Coord)
-		for key, value := range state.PlayerLocs.Data {
-			if key != pi.Id && key != "prey" {
-				otherPlayers[key] = value
-			}
+	// Create the player map without without this node or prey node
+	otherPlayers := make(map[string]shared.Coord)
+	for key, value := range state.PlayerLocs.Data {
+		if key != pi.Id && key != "prey" {
+			otherPlayers[key] = value
 		}
+	}
 
-		otherScores := make(map[string]int)
-		for key, value := range state.PlayerScores.Data {
-			if key != pi.Id {
-				otherScores[key] = value
-			} else {
-				otherScores["ME"] = value
-			}
+	otherScores := make(map[string]int)
+	for key, value := range state.PlayerScores.Data {
+		if key != pi.Id {
+			otherScores[key] = value
+		} else {
+			otherScores["ME"] = value
 		}
+	}
 
-		renderState := shared.GameRenderState{
-			PlayerLoc:    state.PlayerLocs.Data[pi.Id],
-			Prey:         state.PlayerLocs.Data["prey"],
-			OtherPlayers: otherPlayers,
-			Scores: otherScores,
+	heldScores := make(map[string]int)
+	for key, value := range state.PlayerScores.Held {
+		if key != pi.Id {
+			heldScores[key] = value
+		} else {
+			heldScores["ME"] = value
 		}
+	}
 
-		state.PlayerScores.Unlock()
-		state.PlayerLocs.Unlock()
+	renderState := shared.GameRenderState{
+		PlayerLoc:    state.PlayerLocs.Data[pi.Id],
+		Prey:         state.PlayerLocs.Data["prey"],
+		OtherPlayers: otherPlayers,
+		Scores: otherScores,
+		HeldScores: heldScores,
+		Spectator: shared.IsObserver(pi.Id),
+		InputAck: inputAck,
+	}
 
-		toSend, err := json.Marshal(renderState)
-		if err != nil {
-			fmt.Println(err)
-		} else {
-			// Send position to player node
-			pi.pixelWriter.Write(toSend)
+	state.PlayerScores.Unlock()
+	state.PlayerLocs.Unlock()
+
+	return renderState
+}
+
+// Sends the pixel node holding the session, if any, a state: in full if keyframe is true or the pixel node has no
+// state to build on, or else as what changed since the last state it was sent; sends nothing if nothing changed.
+// Must be called with the session locked.
+func (session *pixelSession) sendState(state shared.GameRenderState, keyframe bool) (error) {
+	if session.conn == nil {
+		return nil
+	}
+	frame := shared.PixelFrame{Type: shared.FRAME_STATE, State: &state}
+	if !keyframe && session.sent != nil {
+		delta := shared.DiffStates(*session.sent, state)
+		if delta.Empty(session.sent.InputAck) {
+			return nil
 		}
+		frame = shared.PixelFrame{Type: shared.FRAME_DELTA, Delta: &delta}
 	}
+	session.seq++
+	frame.Seq = session.seq
+	session.sent = &state
+	return session.conn.Send(frame)
 }
+
 // Sends a game state to the player's pixel interface for rendering
 func (pi *PixelInterface) SendPlayerGameState(state shared.GameState) {
 	pi.playerSendChannel <- state
 }
 
-// Given two local UDP addresses, initializes the ports for sending and receiving messages from the
-// pixel-node, respectively. Must be run in a goroutine (infinite loop)
+// Listens for pixel nodes on the given address, and takes input from whichever holds the session. Must be run in a
+// goroutine (infinite loop)
 func (pi * PixelInterface) RunPlayerListener(receivingAddr string) {
 
 	addr, _ := net.ResolveTCPAddr("tcp",receivingAddr)
 	playerInput, _ := net.ListenTCP("tcp", addr)
 	pi.pixelListener = playerInput
-	fmt.Println("about to get to conn")
-	conn := pi.GetTCPConn()
-	fmt.Println("got conn")
-	pi.pixelWriter = conn
 
 	go pi.waitForGameStates()
 
-	// takes a listener client
-	// runs the listener in a infinite loop
-	player := pi.pixelWriter
 	for {
-		buf := make([]byte, 1024)
-		rlen, err := player.Read(buf)
+		fmt.Println("about to get to conn")
+		conn := pi.AcceptPixelNode()
+		fmt.Println("got conn")
+		go pi.servePixelNode(conn)
+	}
+}
+
+// Passes a pixel node's input on to the main node until it disconnects or another pixel node takes over
+func (pi * PixelInterface) servePixelNode(conn *shared.PixelConn) {
+	for {
+		frame, err := conn.Receive()
 		if err != nil {
-			log.Fatal("Pixel node disconnected")
-		} else if string(buf[0:rlen]) == "getgameconfig"{
-			SendGameConfig(pi, player)
-		} else {
+			pi.session.Lock()
+			if pi.session.conn == conn {
+				pi.session.conn = nil
+				fmt.Println("Pixel node disconnected, still playing; waiting for it to reconnect:", err)
+			}
+			pi.session.Unlock()
+			conn.Close()
+			return
+		}
+		switch frame.Type {
+		case shared.FRAME_INPUT:
+			if !shared.PixelInputs[frame.Input] {
+				conn.SendError("unknown input " + frame.Input)
+				continue
+			}
 			// Write to comm channel for node to receive
-			pi.playerCommChannel <- string(buf[0:rlen])
+			pi.inputs.Received(frame.Seq)
+			pi.playerCommChannel <- frame.Input
+		case shared.FRAME_CONFIG:
+			SendGameConfig(pi, conn)
+		case shared.FRAME_STATE:
+			// The pixel node missed a delta, and wants the latest state in full
+			pi.session.Lock()
+			if pi.session.conn == conn && pi.session.lastState != nil {
+				err = pi.session.sendState(*pi.session.lastState, true)
+			}
+			pi.session.Unlock()
+			if err != nil {
+				fmt.Println("Error resending state to pixel node:", err)
+			}
+		case shared.FRAME_PING:
+			if !frame.Reply {
+				conn.Send(shared.PixelFrame{Type: shared.FRAME_PING, Time: frame.Time, Reply: true})
+			}
+		case shared.FRAME_ERROR:
+			fmt.Println("Pixel node reported an error:", frame.Error)
+		default:
+			conn.SendError("unexpected " + frame.Type + " frame")
 		}
 	}
 }
 
-// Listener function that waits for a pixel node to connect, returns the resulting TCPConn after connection.
-func (pi * PixelInterface) GetTCPConn() (*net.TCPConn) {
+// Listener function that waits for a pixel node to connect and complete the handshake, returns the resulting
+// connection, which now holds the session. Connections that don't complete the handshake within
+// PIXEL_HANDSHAKE_TIMEOUT are closed.
+func (pi * PixelInterface) AcceptPixelNode() (*shared.PixelConn) {
 	// gets the initial TCP conn
 	player := pi.pixelListener
-	conn, err := player.AcceptTCP()
+	for {
+		tcpConn, err := player.AcceptTCP()
+		if err != nil {
+			fmt.Println(err)
+			continue
+		}
+		conn := shared.CreatePixelConn(tcpConn)
+		err = pi.handshake(tcpConn, conn)
+		if err != nil {
+			fmt.Printf("Pixel node [%s] rejected: %s\n", tcpConn.RemoteAddr(), err)
+			conn.Close()
+			continue
+		}
+		return conn
+	}
+}
+
+// Waits for a pixel node's hello, then answers it with ours, the game config and the latest state, and hands it the
+// session, closing the connection of any pixel node that held it before
+// Returns an error, after telling the pixel node why, if it doesn't speak our version of the protocol or doesn't
+// present the session token once one has been handed out
+func (pi * PixelInterface) handshake(tcpConn *net.TCPConn, conn *shared.PixelConn) (error) {
+	tcpConn.SetReadDeadline(time.Now().Add(PIXEL_HANDSHAKE_TIMEOUT))
+	defer tcpConn.SetReadDeadline(time.Time{})
+
+	hello, err := conn.Receive()
 	if err != nil {
-		fmt.Println(err)
+		return err
+	}
+	if hello.Type != shared.FRAME_HELLO {
+		conn.SendError("expected hello, got " + hello.Type)
+		return wolferrors.PixelProtocolError("expected hello, got " + hello.Type)
+	}
+	if hello.Version != shared.PIXEL_PROTOCOL_VERSION {
+		message := fmt.Sprintf("unsupported protocol version %d, this node speaks %d", hello.Version,
+			shared.PIXEL_PROTOCOL_VERSION)
+		conn.SendError(message)
+		return wolferrors.PixelProtocolError(message)
 	}
-	SendGameConfig(pi, conn)
-	return conn
+
+	session := pi.session
+	session.Lock()
+	defer session.Unlock()
+	if session.token == "" {
+		session.token, err = newPixelToken()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Pixel session token [%s]; a restarted client can resume the session with it\n", session.token)
+	} else if hello.Token != session.token {
+		conn.SendError("this player already has a client; resume its session with its token")
+		return wolferrors.PixelProtocolError("wrong session token")
+	}
+
+	err = conn.Send(shared.PixelFrame{Type: shared.FRAME_HELLO, Version: shared.PIXEL_PROTOCOL_VERSION,
+		Token: session.token})
+	if err != nil {
+		return err
+	}
+	err = SendGameConfig(pi, conn)
+	if err != nil {
+		return err
+	}
+	if session.conn != nil {
+		session.conn.Close()
+	}
+	session.conn = conn
+	session.sent = nil
+	session.seq = 0
+	// A new pixel node numbers its inputs from 1 again, so none of them have been acknowledged yet
+	pi.inputs.Reset()
+	if session.lastState != nil {
+		resumed := *session.lastState
+		resumed.InputAck = 0
+		session.lastState = &resumed
+		err = session.sendState(resumed, true)
+		if err != nil {
+			session.conn = nil
+			return err
+		}
+	}
+	select {
+	case <-session.connected:
+	default:
+		close(session.connected)
+	}
+	return nil
+}
+
+// Blocks until a pixel node has connected
+func (pi *PixelInterface) WaitForPixelNode() {
+	<-pi.session.connected
+}
+
+// Sends the pixel node the game config
+func SendGameConfig(pi *PixelInterface, conn *shared.PixelConn) (error) {
+	return conn.Send(shared.PixelFrame{Type: shared.FRAME_CONFIG, Config: &pi.gameConfig})
 }
 
-func SendGameConfig(pi *PixelInterface, conn *net.TCPConn) {
-	// Send the pixel node gameConfig immediately
-	marshalledConfig, err := json.Marshal(&pi.gameConfig)
+// Returns a new random session token
+func newPixelToken() (string, error) {
+	raw := make([]byte, 16)
+	_, err := rand.Read(raw)
 	if err != nil {
-		fmt.Println(err)
-	} else {
-		conn.Write(marshalledConfig)
+		return "", err
 	}
+	return hex.EncodeToString(raw), nil
 }
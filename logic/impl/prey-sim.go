@@ -0,0 +1,148 @@
+package impl
+
+import (
+	"../../shared"
+	"../../geometry"
+	"math/rand"
+	"time"
+)
+
+// How often the prey takes a step, in milliseconds
+const PREY_STEP_MS = 250
+
+// Fraction of steps on which the prey wanders randomly instead of running from the wolves
+const PREY_WANDER_CHANCE = 0.25
+
+// Returns the random source for the given prey step. Every node that knows the game seed gets the same source
+// for the same tick, so the prey's "random" choices are the same everywhere.
+func PreyRand(seed int64, tick uint64) (*rand.Rand) {
+	// Spread consecutive ticks across the seed space so neighbouring ticks don't share a sequence
+	return rand.New(rand.NewSource(seed ^ int64(tick*0x9E3779B97F4A7C15)))
+}
+
+// Calls step for every prey step, forever, passing the game tick the step falls on. Prey steps land on every tick
+// that is a multiple of the step length, so every node with a synchronised clock steps the prey on the same ticks.
+func RunPreySteps(clock *GameClock, step func(tick uint64)) {
+	tick := clock.CurrentTick()
+	for {
+		stepTicks := uint64(PREY_STEP_MS * time.Millisecond / clock.TickDuration())
+		if stepTicks == 0 {
+			stepTicks = 1
+		}
+		tick = (tick/stepTicks + 1) * stepTicks
+		time.Sleep(clock.UntilTick(tick))
+		step(tick)
+	}
+}
+
+// Computes where the prey moves to on the given tick. This is a pure function of its arguments: the game seed,
+// the tick, the prey's current position and the positions of the wolves (see WolfPositions).
+// Returns the prey's new position, which is its old position if it stays still or the chosen step is blocked.
+func NextPreyMove(seed int64, tick uint64, prey shared.Coord, wolves map[string]shared.Coord,
+	geo *geometry.GridManager) (shared.Coord) {
+	r := PreyRand(seed, tick)
+
+	var dir string
+	if r.Float64() < PREY_WANDER_CHANCE || len(wolves) < 1 {
+		random := r.Float64()
+		switch {
+		case random < 0.25:
+			dir = "up"
+		case random < 0.5:
+			dir = "down"
+		case random < 0.75:
+			dir = "right"
+		default:
+			dir = "left"
+		}
+	} else {
+		// Run in whichever direction takes us furthest from the wolves overall; directions are tried in a
+		// fixed order and only a strictly better one replaces the current pick, so ties resolve the same everywhere
+		dir = "still"
+		maxVal := -1
+		for _, step := range []string{"left", "right", "down", "up"} {
+			val := totalWolfDistance(stepCoord(prey, step), wolves, geo)
+			if val > maxVal {
+				maxVal = val
+				dir = step
+			}
+		}
+	}
+
+	newPosition := stepCoord(prey, dir)
+	if geo.IsValidMove(newPosition) && geo.IsNotTeleporting(prey, newPosition) {
+		return newPosition
+	}
+	return prey
+}
+
+// Computes where the prey respawns after its epoch-th capture. Like NextPreyMove this depends only on its
+// arguments, so every node that has seen the same captures respawns the prey in the same place.
+func NextPreySpawn(seed int64, epoch uint64, prey shared.Coord, geo *geometry.GridManager) (shared.Coord) {
+	// Use the bitwise complement so spawn draws never reuse the random sequence of a movement tick
+	return geo.GetSeededNewPos(prey, PreyRand(^seed, epoch))
+}
+
+// Where the prey starts the game, unless that is a wall on the map being played
+var PREY_START = shared.Coord{X: 5, Y: 5}
+
+// Returns where the prey starts on the given map: PREY_START, or if the prey can't go there, the nearest cell it can,
+// looking at cells the same distance away in a fixed order so every node picks the same one
+func PreyStart(geo *geometry.GridManager) (shared.Coord) {
+	if geo.IsValidMove(PREY_START) {
+		return PREY_START
+	}
+	x, y := geo.GetSize()
+	for dist := 1; dist < x+y; dist++ {
+		for dx := -dist; dx <= dist; dx++ {
+			dy := dist - abs(dx)
+			for _, pos := range []shared.Coord{{X: PREY_START.X + dx, Y: PREY_START.Y - dy},
+				{X: PREY_START.X + dx, Y: PREY_START.Y + dy}} {
+				if geo.IsValidMove(pos) {
+					return pos
+				}
+			}
+		}
+	}
+	return PREY_START
+}
+
+// Takes a snapshot of every wolf's position in the given location map, leaving out the prey
+func WolfPositions(playerLocs *shared.PlayerLockMap) (map[string]shared.Coord) {
+	playerLocs.RLock()
+	defer playerLocs.RUnlock()
+	wolves := make(map[string]shared.Coord)
+	for id, loc := range playerLocs.Data {
+		if id != "prey" {
+			wolves[id] = loc
+		}
+	}
+	return wolves
+}
+
+// Returns the sum of the Manhattan distances from pos to every wolf, or -1 if pos isn't somewhere the prey can go
+func totalWolfDistance(pos shared.Coord, wolves map[string]shared.Coord, geo *geometry.GridManager) (int) {
+	if !geo.IsValidMove(pos) {
+		return -1
+	}
+	dist := 0
+	for _, wolf := range wolves {
+		dist += abs(pos.X-wolf.X) + abs(pos.Y-wolf.Y)
+	}
+	return dist
+}
+
+// Returns the coordinate one step from pos in the given direction
+func stepCoord(pos shared.Coord, dir string) (shared.Coord) {
+	switch dir {
+	case "up":
+		pos.Y = pos.Y + 1
+	case "down":
+		pos.Y = pos.Y - 1
+	case "left":
+		pos.X = pos.X - 1
+	case "right":
+		pos.X = pos.X + 1
+	}
+	return pos
+}
@@ -0,0 +1,93 @@
+package impl
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"../../shared"
+)
+
+// A node's connection to the game's relay (see relay/impl), used for the nodes it can't reach directly
+type RelayLink struct {
+	sync.Mutex
+
+	// The identifier of this node, which the relay knows it by
+	identifier string
+
+	// The token the server issued this node for the relay
+	token      string
+
+	// The time this node last registered with the relay at
+	registered int64
+
+	// The connection to the relay, or nil if there is none
+	conn       *net.UDPConn
+}
+
+// Connects to the relay at the given address and registers with it as the given node, with the token the server issued
+// it for the relay
+// Returns an error if the relay's address can't be dialed
+func (rl *RelayLink) Connect(addr string, identifier string, token string) (err error) {
+	relayAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialUDP("udp", nil, relayAddr)
+	if err != nil {
+		return err
+	}
+	rl.Lock()
+	rl.identifier = identifier
+	rl.token = token
+	rl.conn = conn
+	rl.Unlock()
+	return rl.Register()
+}
+
+// Returns true if this node has a relay to fall back to
+func (rl *RelayLink) Connected() (bool) {
+	rl.Lock()
+	defer rl.Unlock()
+	return rl.conn != nil
+}
+
+// Tells the relay where to reach this node; sent periodically to keep it current
+func (rl *RelayLink) Register() (err error) {
+	rl.Lock()
+	// Each registration has to be later than the last, even if the clock has gone back
+	now := time.Now().UnixNano()
+	if now <= rl.registered {
+		now = rl.registered + 1
+	}
+	rl.registered = now
+	envelope := shared.RelayEnvelope{Type: "register", Time: now,
+		Proof: shared.RelayRegisterProof(rl.token, rl.identifier, now)}
+	rl.Unlock()
+	return rl.send(envelope)
+}
+
+// Sends a message to the given node (or "all") through the relay
+func (rl *RelayLink) Forward(to string, message []byte) (err error) {
+	return rl.send(shared.RelayEnvelope{Type: "forward", To: to, Payload: message})
+}
+
+func (rl *RelayLink) send(envelope shared.RelayEnvelope) (err error) {
+	rl.Lock()
+	defer rl.Unlock()
+	if rl.conn == nil {
+		return nil
+	}
+	envelope.From = rl.identifier
+	toSend, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+	if len(toSend) > MAX_DATAGRAM_SIZE {
+		fmt.Printf("Not relaying %d bytes to %s: too big for a datagram\n", len(toSend), envelope.To)
+		return nil
+	}
+	_, err = rl.conn.Write(toSend)
+	return err
+}
@@ -0,0 +1,289 @@
+package impl
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+	"../../shared"
+	"../../wolferrors"
+)
+
+// A logic node run with NodeOptions.Record set records its match to a replay file (see shared/replay.go). Every path
+// that applies a change to the game state (a move, a capture or revocation, a node leaving, a merged repair) has the
+// recorder compare the state with the last one it recorded and record the difference, stamped with when it was
+// applied. RunReplay plays a replay file back through a PixelInterface, so any client can watch.
+
+// Records the changes to a node's game state to a replay file
+type Recorder struct {
+	sync.Mutex
+	writer   *shared.ReplayWriter
+	start    time.Time
+
+	// The game state as last recorded
+	locs     map[string]shared.Coord
+	scores   map[string]int
+	held     map[string]int
+	captures map[string]bool
+	revoked  map[string]bool
+
+	// True once the replay file couldn't be written; nothing more is recorded
+	stopped  bool
+}
+
+// Creates a replay file recording the match as the node with the given identifier sees it
+func CreateRecorder(path string, self string, settings shared.InitialGameSettings) (*Recorder, error) {
+	start := time.Now()
+	writer, err := shared.CreateReplay(path, shared.ReplayHeader{Self: self, Settings: settings,
+		Start: start.UnixNano() / int64(time.Millisecond)})
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{writer: writer, start: start, locs: make(map[string]shared.Coord),
+		scores: make(map[string]int), held: make(map[string]int), captures: make(map[string]bool),
+		revoked: make(map[string]bool)}, nil
+}
+
+// Records whatever has changed in the game state since it was last recorded
+// Returns an error, and stops recording, if the replay file can't be written
+func (r *Recorder) Record(state *shared.GameState) (error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.stopped {
+		return nil
+	}
+	now := time.Since(r.start).Nanoseconds() / int64(time.Millisecond)
+	var events []shared.ReplayEvent
+	add := func(event shared.ReplayEvent) {
+		event.Time = now
+		events = append(events, event)
+	}
+
+	state.PlayerLocs.RLock()
+	for _, player := range sortedKeys(state.PlayerLocs.Data) {
+		at := state.PlayerLocs.Data[player]
+		last, ok := r.locs[player]
+		if !ok {
+			add(shared.ReplayEvent{Kind: shared.EVENT_JOIN, Player: player, At: &at})
+		} else if last != at {
+			add(shared.ReplayEvent{Kind: shared.EVENT_MOVE, Player: player, At: &at})
+		}
+		r.locs[player] = at
+	}
+	for _, player := range sortedKeys(r.locs) {
+		if _, ok := state.PlayerLocs.Data[player]; !ok {
+			add(shared.ReplayEvent{Kind: shared.EVENT_LEAVE, Player: player})
+			delete(r.locs, player)
+		}
+	}
+	state.PlayerLocs.RUnlock()
+
+	state.PlayerScores.RLock()
+	var ids []string
+	for id := range state.PlayerScores.Events {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !r.captures[id] {
+			event := state.PlayerScores.Events[id]
+			add(shared.ReplayEvent{Kind: shared.EVENT_CAPTURE, Player: event.Player, Value: event.Worth, Event: id})
+			r.captures[id] = true
+		}
+	}
+	ids = nil
+	for id := range state.PlayerScores.Revoked {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if !r.revoked[id] {
+			add(shared.ReplayEvent{Kind: shared.EVENT_REVOKE, Event: id})
+			r.revoked[id] = true
+		}
+	}
+	recordCounts(state.PlayerScores.Data, r.scores, shared.EVENT_SCORE, add)
+	recordCounts(state.PlayerScores.Held, r.held, shared.EVENT_HELD, add)
+	state.PlayerScores.RUnlock()
+
+	if len(events) == 0 {
+		return nil
+	}
+	err := r.writer.Write(events)
+	if err != nil {
+		r.stopped = true
+		r.writer.Close()
+	}
+	return err
+}
+
+// Stops recording, closing the replay file
+func (r *Recorder) Close() (error) {
+	r.Lock()
+	defer r.Unlock()
+	if r.stopped {
+		return nil
+	}
+	r.stopped = true
+	return r.writer.Close()
+}
+
+// Has the node record its match with the given recorder; createNode does this when NodeOptions.Record is set
+func (pn *PlayerNode) RecordWith(recorder *Recorder) {
+	pn.recorder = recorder
+}
+
+// Records the changes to this node's game state, if it is recording the match; must be called with no game state
+// locks held
+func (pn *PlayerNode) recordGameState() {
+	if pn.recorder == nil {
+		return
+	}
+	err := pn.recorder.Record(&pn.GameState)
+	if err != nil {
+		fmt.Println("Could not record the match, no longer recording:", err)
+	}
+}
+
+// Records the change to the game state just applied, as it is applied, if this node is recording the match
+func (n *NodeCommInterface) recordApplied() {
+	if n.PlayerNode != nil {
+		n.PlayerNode.recordGameState()
+	}
+}
+
+// Helper function to record the changes to one of the per-player counts in the score map
+func recordCounts(current map[string]int, recorded map[string]int, kind string, add func(shared.ReplayEvent)) {
+	var players []string
+	for player := range current {
+		players = append(players, player)
+	}
+	for player := range recorded {
+		if _, ok := current[player]; !ok {
+			players = append(players, player)
+		}
+	}
+	sort.Strings(players)
+	for _, player := range players {
+		if last, ok := recorded[player]; !ok || last != current[player] {
+			add(shared.ReplayEvent{Kind: kind, Player: player, Value: current[player]})
+			recorded[player] = current[player]
+		}
+	}
+}
+
+func sortedKeys(locs map[string]shared.Coord) ([]string) {
+	var keys []string
+	for key := range locs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// How a replay is played back: at some multiple of the speed it was recorded at, or one step each time the player
+// presses a key
+type ReplaySpeed struct {
+	Multiple float64
+	Step     bool
+}
+
+// Parses a replay speed: "step", or a multiple of real time such as "1" or "4"
+func ParseReplaySpeed(speed string) (ReplaySpeed, error) {
+	if speed == "step" {
+		return ReplaySpeed{Step: true}, nil
+	}
+	multiple, err := strconv.ParseFloat(speed, 64)
+	if err != nil || multiple <= 0 {
+		return ReplaySpeed{}, wolferrors.BadConfigError(fmt.Sprintf("bad replay speed %q: give 1, 4 or step", speed))
+	}
+	return ReplaySpeed{Multiple: multiple}, nil
+}
+
+// Applies a replay event to a game state
+func ApplyReplayEvent(state *shared.GameState, event shared.ReplayEvent) {
+	switch event.Kind {
+	case shared.EVENT_JOIN, shared.EVENT_MOVE:
+		if event.At != nil {
+			state.PlayerLocs.Lock()
+			state.PlayerLocs.Data[event.Player] = *event.At
+			state.PlayerLocs.Unlock()
+		}
+	case shared.EVENT_LEAVE:
+		state.PlayerLocs.Lock()
+		delete(state.PlayerLocs.Data, event.Player)
+		state.PlayerLocs.Unlock()
+	case shared.EVENT_SCORE:
+		state.PlayerScores.Lock()
+		state.PlayerScores.Data[event.Player] = event.Value
+		state.PlayerScores.Unlock()
+	case shared.EVENT_HELD:
+		state.PlayerScores.Lock()
+		state.PlayerScores.Held[event.Player] = event.Value
+		state.PlayerScores.Unlock()
+	}
+}
+
+// Returns a copy of a replay's game state that shares no maps with it
+func replayFrame(state *shared.GameState) (shared.GameState) {
+	frame := shared.GameState{
+		PlayerLocs:   shared.PlayerLockMap{Data: make(map[string]shared.Coord, len(state.PlayerLocs.Data))},
+		PlayerScores: shared.ScoresLockMap{Data: make(map[string]int, len(state.PlayerScores.Data)),
+			Held: make(map[string]int, len(state.PlayerScores.Held))},
+	}
+	for key, value := range state.PlayerLocs.Data {
+		frame.PlayerLocs.Data[key] = value
+	}
+	for key, value := range state.PlayerScores.Data {
+		frame.PlayerScores.Data[key] = value
+	}
+	for key, value := range state.PlayerScores.Held {
+		frame.PlayerScores.Held[key] = value
+	}
+	return frame
+}
+
+// Plays a replay file back to a pixel node connecting on pixelAddr: waits for one to connect, then sends it the game
+// state after each moment's events
+// Returns when the replay is over, or an error if the file can't be read
+func RunReplay(path string, pixelAddr string, speed ReplaySpeed) (error) {
+	header, events, err := shared.ReadReplay(path)
+	if err != nil {
+		return err
+	}
+	inputs := make(chan string, 5)
+	states := make(chan shared.GameState, 5)
+	pi := CreatePixelInterface(inputs, states, header.Settings, header.Self)
+	go pi.RunPlayerListener(pixelAddr)
+	fmt.Printf("Replaying %d events recorded by [%s]; waiting for a client on %s\n", len(events), header.Self,
+		pixelAddr)
+	pi.WaitForPixelNode()
+	if speed.Step {
+		fmt.Println("Press any arrow key in the client to step through the replay")
+	}
+
+	state := shared.GameState{
+		PlayerLocs:   shared.PlayerLockMap{Data: make(map[string]shared.Coord)},
+		PlayerScores: shared.ScoresLockMap{Data: make(map[string]int), Held: make(map[string]int)},
+	}
+	last := int64(0)
+	for i := 0; i < len(events); {
+		moment := events[i].Time
+		if speed.Step {
+			<-inputs
+		} else if speed.Multiple > 0 {
+			time.Sleep(time.Duration(float64(moment - last) / speed.Multiple * float64(time.Millisecond)))
+		}
+		last = moment
+		for ; i < len(events) && events[i].Time == moment; i++ {
+			ApplyReplayEvent(&state, events[i])
+		}
+		// The pixel interface reads the state it is sent while this goes on to the next moment, so it gets a copy
+		pi.SendPlayerGameState(replayFrame(&state))
+	}
+	// Let the last state reach the client before returning
+	time.Sleep(100 * time.Millisecond)
+	fmt.Println("Replay finished")
+	return nil
+}
@@ -0,0 +1,187 @@
+package impl
+
+import (
+	"strconv"
+	"time"
+	"../../shared"
+)
+
+// Functions on the replicated score counter (see shared.ScoresLockMap). Scores should only ever be changed through
+// these, so that Data always matches the events it is totalled from.
+//
+// Events would otherwise pile up for as long as the game runs, and every gamestate a node sends carries them all, so
+// captures old enough that nothing can revoke them any more are settled: folded into their player's base score and
+// dropped (see SettleScores). Each node settles on its own; when two nodes merge, the later horizon wins.
+
+// How old a capture has to be before it is settled; far longer than any capture can take to be checked or rejected
+const SCORE_SETTLE_TIME = 30 * time.Second
+
+// Returns the id of the capture a node made with the given move sequence number; every node names it the same way
+func CaptureEventId(identifier string, seq uint64) (string) {
+	return identifier + "/" + strconv.FormatUint(seq, 10)
+}
+
+// Returns true if the capture event has already been counted (or revoked)
+func HasCaptureEvent(scores *shared.ScoresLockMap, id string) (bool) {
+	scores.RLock()
+	defer scores.RUnlock()
+	_, ok := scores.Events[id]
+	return ok || scores.Revoked[id]
+}
+
+// Counts a capture for the player who made it. Adding an event that is already there changes nothing.
+// Returns the player's score afterwards
+func AddCaptureEvent(scores *shared.ScoresLockMap, id string, event shared.CaptureEvent) (int) {
+	scores.Lock()
+	defer scores.Unlock()
+	initScores(scores)
+	if _, ok := scores.Events[id]; !ok && event.Tick >= scores.Horizon {
+		scores.Events[id] = event
+		recountScore(scores, event.Player)
+	}
+	return scores.Data[event.Player]
+}
+
+// Revokes a capture, taking its points away from whoever made it. A capture can be revoked before it has been seen;
+// it won't count when it turns up.
+func RevokeCaptureEvent(scores *shared.ScoresLockMap, id string) {
+	scores.Lock()
+	defer scores.Unlock()
+	initScores(scores)
+	scores.Revoked[id] = true
+	if event, ok := scores.Events[id]; ok {
+		recountScore(scores, event.Player)
+	}
+}
+
+// Merges another node's scores into ours, as the union of both nodes' events and revocations. If the other node has
+// settled captures later than we have, its base scores replace ours and our events before its horizon are dropped; if
+// we have both settled up to the same tick, each player keeps the higher of the two base scores.
+// Returns true if any of our scores changed
+func MergeScores(local *shared.ScoresLockMap, remote *shared.ScoresLockMap) (changed bool) {
+	local.Lock()
+	defer local.Unlock()
+	initScores(local)
+
+	touched := make(map[string]bool)
+	if remote.Horizon > local.Horizon {
+		for player := range local.Base {
+			touched[player] = true
+		}
+		local.Base = make(map[string]int, len(remote.Base))
+		for player, points := range remote.Base {
+			local.Base[player] = points
+			touched[player] = true
+		}
+		local.Horizon = remote.Horizon
+		for id, event := range local.Events {
+			if event.Tick < local.Horizon {
+				delete(local.Events, id)
+				delete(local.Revoked, id)
+				touched[event.Player] = true
+			}
+		}
+	} else if remote.Horizon == local.Horizon {
+		for player, points := range remote.Base {
+			if points > local.Base[player] {
+				local.Base[player] = points
+				touched[player] = true
+			}
+		}
+	}
+	for id, event := range remote.Events {
+		if _, ok := local.Events[id]; !ok && event.Tick >= local.Horizon {
+			local.Events[id] = event
+			touched[event.Player] = true
+		}
+	}
+	for id := range remote.Revoked {
+		if !local.Revoked[id] {
+			local.Revoked[id] = true
+			if event, ok := local.Events[id]; ok {
+				touched[event.Player] = true
+			}
+		}
+	}
+
+	for player := range touched {
+		before, ok := local.Data[player]
+		recountScore(local, player)
+		if !ok || local.Data[player] != before {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// Settles every capture made before the horizon tick: folds the points it counts for into its player's base score, and
+// drops it and any revocation of it. Captures the partition policy is holding back are dropped without counting, so
+// don't settle while partitioned.
+// Returns the number of captures settled
+func SettleScores(scores *shared.ScoresLockMap, horizon uint64) (settled int) {
+	scores.Lock()
+	defer scores.Unlock()
+	initScores(scores)
+	if horizon <= scores.Horizon {
+		return 0
+	}
+	scores.Horizon = horizon
+	players := make(map[string]bool)
+	for id, event := range scores.Events {
+		if event.Tick >= horizon {
+			continue
+		}
+		if !scores.Revoked[id] && CountsTowardScore(scores.Policy, event) {
+			scores.Base[event.Player] += event.Worth
+		}
+		delete(scores.Events, id)
+		delete(scores.Revoked, id)
+		players[event.Player] = true
+		settled++
+	}
+	for player := range players {
+		recountScore(scores, player)
+	}
+	return settled
+}
+
+// Makes the maps of a score counter built without them
+func initScores(scores *shared.ScoresLockMap) {
+	if scores.Data == nil {
+		scores.Data = make(map[string]int)
+	}
+	if scores.Events == nil {
+		scores.Events = make(map[string]shared.CaptureEvent)
+	}
+	if scores.Revoked == nil {
+		scores.Revoked = make(map[string]bool)
+	}
+	if scores.Held == nil {
+		scores.Held = make(map[string]int)
+	}
+	if scores.Base == nil {
+		scores.Base = make(map[string]int)
+	}
+}
+
+// Totals the player's score from their base score and their events that haven't been revoked, holding back those the
+// partition policy doesn't count. The caller must hold the lock.
+func recountScore(scores *shared.ScoresLockMap, player string) {
+	total, held := scores.Base[player], 0
+	for id, event := range scores.Events {
+		if event.Player != player || scores.Revoked[id] {
+			continue
+		}
+		if CountsTowardScore(scores.Policy, event) {
+			total += event.Worth
+		} else {
+			held += event.Worth
+		}
+	}
+	scores.Data[player] = total
+	if held > 0 {
+		scores.Held[player] = held
+	} else {
+		delete(scores.Held, player)
+	}
+}
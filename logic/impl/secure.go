@@ -0,0 +1,181 @@
+package impl
+
+import (
+	"crypto"
+	"fmt"
+	"sync"
+	"time"
+	key "../../key-helpers"
+	"../../shared"
+	"../../wolferrors"
+)
+
+// In games with EncryptTraffic set, every message between nodes is sealed under a session agreed between the two of
+// them (see key-helpers/session.go). Only "connect" messages, which introduce a node, and "hello" messages, which
+// agree a session, go unsealed; anything else that arrives unsealed is dropped. Hellos are checked against the key the
+// server registered for their sender, not the one a "connect" message claims.
+
+// The identity keys the server has registered for the nodes in the game, as far as this node has heard
+type RegisteredKeys struct {
+	sync.Mutex
+
+	// Canonically-encoded public keys, by node identifier
+	keys      map[string]string
+
+	// When the server was last asked for them
+	refreshed time.Time
+}
+
+// Records the key the server registered for a node
+func (rk *RegisteredKeys) Add(identifier string, pubKey string) {
+	rk.Lock()
+	defer rk.Unlock()
+	if rk.keys == nil {
+		rk.keys = make(map[string]string)
+	}
+	rk.keys[identifier] = pubKey
+}
+
+// Returns the key the server registered for a node, asking the server again if it is one we haven't heard of; the
+// server is asked at most once every HELLO_RETRY, so a flood of hellos from unknown nodes doesn't become a flood of
+// requests
+// Returns an error if the server has no key for the node
+func (rk *RegisteredKeys) Lookup(identifier string,
+	fetch func() (map[string]shared.NodeRegistrationInfo, error)) (crypto.PublicKey, error) {
+	rk.Lock()
+	pubKey, ok := rk.keys[identifier]
+	refresh := !ok && time.Since(rk.refreshed) >= key.HELLO_RETRY
+	if refresh {
+		rk.refreshed = time.Now()
+	}
+	rk.Unlock()
+
+	if refresh {
+		response, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		for id, regInfo := range response {
+			rk.Add(id, regInfo.PubKey)
+		}
+		rk.Lock()
+		pubKey, ok = rk.keys[identifier]
+		rk.Unlock()
+	}
+	if !ok {
+		return nil, wolferrors.SessionError(identifier + " isn't registered with the server")
+	}
+	return key.DecodePublicKey(pubKey)
+}
+
+// Returns true if the key is the one the server registered for the node
+func (rk *RegisteredKeys) Matches(identifier string, pubKey crypto.PublicKey,
+	fetch func() (map[string]shared.NodeRegistrationInfo, error)) (bool) {
+	registered, err := rk.Lookup(identifier, fetch)
+	return err == nil && key.PubKeyToString(registered) == key.PubKeyToString(pubKey)
+}
+
+// Unpacks a datagram from another node, opening it first if it was sealed
+// Returns false if the message should be dropped: it couldn't be opened, it claims to be from a node other than the
+// one whose session sealed it, or traffic is encrypted and it wasn't sealed when it should have been
+func (n *NodeCommInterface) openMessage(datagram []byte) (NodeMessage, bool) {
+	if !key.IsSealed(datagram) {
+		message := receiveMessage(n.Log, datagram)
+		if n.Config.EncryptTraffic && message.MessageType != "hello" && message.MessageType != "connect" {
+			return message, false
+		}
+		return message, true
+	}
+	peer, plaintext, err := n.Sessions.Open(datagram)
+	if err != nil {
+		fmt.Println("Dropping datagram:", err)
+		return NodeMessage{}, false
+	}
+	message := receiveMessage(n.Log, plaintext)
+	return message, message.Identifier == peer
+}
+
+// Handles a hello from another node by agreeing a session with it, then answering the hello if it needs an answer
+// and sending the messages that were waiting for the session
+func (n *NodeCommInterface) HandleHello(identifier string, hello *shared.SessionHello) {
+	if !n.Config.EncryptTraffic {
+		return
+	}
+	pubKey, err := n.Registered.Lookup(identifier, n.fetchNodes)
+	if err != nil {
+		fmt.Printf("Ignoring hello from [%s]: %s\n", identifier, err)
+		return
+	}
+	reply, queued, err := n.Sessions.HandleHello(identifier, pubKey, hello)
+	if err != nil {
+		fmt.Printf("Ignoring hello from [%s]: %s\n", identifier, err)
+		return
+	}
+	if reply != nil {
+		n.MessagesToSend <- &PendingMessage{Recipient: identifier, Message: n.helloMessage(reply), Plain: true}
+	}
+	for _, sealed := range queued {
+		n.MessagesToSend <- &PendingMessage{Recipient: identifier, Message: sealed, Plain: true}
+	}
+}
+
+// Resends the hellos other nodes haven't answered; should be run in a goroutine. Does nothing in games with
+// unencrypted traffic.
+func (n *NodeCommInterface) RunSessionUpkeep() {
+	if !n.Config.EncryptTraffic {
+		return
+	}
+	for {
+		time.Sleep(key.HELLO_RETRY)
+		for id, hello := range n.Sessions.Unanswered() {
+			n.MessagesToSend <- &PendingMessage{Recipient: id, Message: n.helloMessage(hello), Plain: true}
+		}
+	}
+}
+
+// Returns a hello, packed as a message to send
+func (n *NodeCommInterface) helloMessage(hello *shared.SessionHello) ([]byte) {
+	message := NodeMessage{
+		MessageType: "hello",
+		Identifier:  n.Config.Identifier,
+		Addr:        n.LocalAddr.String(),
+		Hello:       hello,
+	}
+	return sendMessage(n.Log, message, "Sendin' hello")
+}
+
+// Helper function to send a message to a single node, sealing it first if traffic is encrypted and it isn't plain; do
+// not call directly; instead write to the messagesTosend channel. With no session agreed with the node yet, the
+// message is sent once there is one.
+func (n *NodeCommInterface) writeToNode(id string, toSend []byte, plain bool) (err error) {
+	if n.Config.EncryptTraffic && !plain {
+		sealed, hello, err := n.Sessions.Seal(id, toSend)
+		if err != nil {
+			return err
+		}
+		if hello != nil {
+			err = n.writeRaw(id, n.helloMessage(hello))
+			if err != nil {
+				return err
+			}
+		}
+		if sealed == nil {
+			return nil
+		}
+		toSend = sealed
+	}
+	return n.writeRaw(id, toSend)
+}
+
+// Writes a message to a single node as is, directly or through the relay
+func (n *NodeCommInterface) writeRaw(id string, toSend []byte) (err error) {
+	if len(toSend) > MAX_DATAGRAM_SIZE {
+		fmt.Printf("Not sending %d bytes to %s: too big for a datagram\n", len(toSend), id)
+		return nil
+	}
+	if n.relayed[id] {
+		return n.RelayLink.Forward(id, toSend)
+	}
+	_, err = n.OtherNodes[id].Write(toSend)
+	return err
+}
@@ -0,0 +1,63 @@
+package impl
+
+import (
+	"crypto"
+	"crypto/tls"
+	"net"
+	"net/rpc"
+	key "../../key-helpers"
+	"../../shared"
+)
+
+// Dials the server's RPC address: over TLS, checking the server's certificate against DefaultNodeOptions.ServerCA,
+// if that is set, and in the clear otherwise
+func DialServer(addr string) (*rpc.Client, error) {
+	if DefaultNodeOptions.ServerCA == "" {
+		return rpc.Dial("tcp", addr)
+	}
+	config, err := key.ClientTLSConfig(DefaultNodeOptions.ServerCA, serverName(addr))
+	if err != nil {
+		return nil, err
+	}
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	return rpc.NewClient(conn), nil
+}
+
+// Returns the name the server's certificate should be for: the host in its address, or localhost if it has none
+func serverName(addr string) (string) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil || host == "" {
+		return "localhost"
+	}
+	return host
+}
+
+// Gets a nonce from the server and signs a call to the given method over it
+// Returns the proof to send with the call (see server/impl/nonces.go)
+func SignServerCall(server *rpc.Client, privKey crypto.Signer, method string) (shared.RPCAuth, error) {
+	var nonce string
+	err := server.Call("GServer.Nonce", true, &nonce)
+	if err != nil {
+		return shared.RPCAuth{}, err
+	}
+	return key.SignRPC(privKey, method, nonce)
+}
+
+// Calls one of the server's methods that take nothing but proof of who is calling, e.g. GServer.Heartbeat
+func (n *NodeCommInterface) CallServer(method string, reply interface{}) (err error) {
+	auth, err := SignServerCall(n.ServerConn, n.PrivKey, method)
+	if err != nil {
+		return err
+	}
+	return n.ServerConn.Call(method, auth, reply)
+}
+
+// Returns the nodes the server has registered in this node's room
+func (n *NodeCommInterface) fetchNodes() (map[string]shared.NodeRegistrationInfo, error) {
+	var response map[string]shared.NodeRegistrationInfo
+	err := n.CallServer("GServer.GetNodes", &response)
+	return response, err
+}
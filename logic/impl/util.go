@@ -1,35 +1,118 @@
 package impl
 
 import (
+	"fmt"
 	"net"
-	"log"
+	"os"
+	"strconv"
 )
 
-// Starts a UDP listener over the given address string, returns the address and the connection
-func StartListenerUDP(ip_addr string) (*net.UDPAddr, *net.UDPConn) {
-	// takes an ip address and port to listen on
-	// returns the udp address and listener client
-	// starts Listener
-	udp_addr, _ := net.ResolveUDPAddr("udp", ip_addr)
-	client, err := net.ListenUDP("udp", udp_addr)
+// Where a node listens for other nodes, and the address it gives out for them to reach it at
+type ListenConfig struct {
+	// The address to bind the listener to, e.g. ":0", "10.0.0.5:4000" or "[::1]:0"
+	Bind      string
+
+	// The address other nodes are told to reach this node at, as a host or host:port; the port defaults to the one
+	// bound. If empty, it is worked out from the bind address and the machine's interfaces.
+	Advertise string
+
+	// If true, only listen on and advertise the loopback interface, for running several nodes on one machine
+	Loopback  bool
+}
+
+// The advertise address and loopback mode used by StartListenerUDP; set from WOLFPACK_ADVERTISE and
+// WOLFPACK_LOOPBACK ("1") in the environment
+var DefaultListenConfig = ListenConfig{
+	Advertise: os.Getenv("WOLFPACK_ADVERTISE"),
+	Loopback:  os.Getenv("WOLFPACK_LOOPBACK") == "1",
+}
+
+// Starts a UDP listener over the given address string, returns the address to advertise and the connection, or an
+// error if it can't listen there
+func StartListenerUDP(ip_addr string) (*net.UDPAddr, *net.UDPConn, error) {
+	config := DefaultListenConfig
+	config.Bind = ip_addr
+	return StartListener(config)
+}
+
+// Starts a UDP listener as configured
+// Returns the address other nodes should reach it at and the connection, or an error if it can't listen or the
+// advertise address is bad
+func StartListener(config ListenConfig) (*net.UDPAddr, *net.UDPConn, error) {
+	bindAddr, err := net.ResolveUDPAddr("udp", config.Bind)
+	if err != nil {
+		return nil, nil, err
+	}
+	if config.Loopback && (bindAddr.IP == nil || bindAddr.IP.IsUnspecified()) {
+		bindAddr.IP = loopbackFor(bindAddr.IP)
+	}
+	client, err := net.ListenUDP("udp", bindAddr)
 	if err != nil {
-		panic(err)
+		return nil, nil, err
+	}
+
+	local_udp := *client.LocalAddr().(*net.UDPAddr)
+	if config.Advertise != "" {
+		advertised, err := parseAdvertise(config.Advertise, local_udp.Port)
+		if err != nil {
+			client.Close()
+			return nil, nil, err
+		}
+		return advertised, client, nil
+	}
+	// Bound to a particular address, so that's the one to give out
+	if local_udp.IP != nil && !local_udp.IP.IsUnspecified() {
+		return &local_udp, client, nil
+	}
+	if config.Loopback {
+		local_udp.IP = loopbackFor(local_udp.IP)
+	} else {
+		local_udp.IP = GetOutboundIP()
+	}
+	return &local_udp, client, nil
+}
+
+// Parses an advertise address given as host or host:port, using the given port if it has none
+func parseAdvertise(advertise string, port int) (*net.UDPAddr, error) {
+	if _, _, err := net.SplitHostPort(advertise); err != nil {
+		// A bare host; IPv6 hosts need brackets to take a port
+		advertise = net.JoinHostPort(advertise, strconv.Itoa(port))
 	}
-	local_udp := client.LocalAddr().(*net.UDPAddr)
-	local_udp.IP = GetOutboundIP()
-	return local_udp, client
+	return net.ResolveUDPAddr("udp", advertise)
 }
 
-// Get the public IP of the current connection
+// Returns the loopback address of the same family as ip (IPv4 unless ip is IPv6)
+func loopbackFor(ip net.IP) (net.IP) {
+	if ip != nil && ip.To4() == nil {
+		return net.IPv6loopback
+	}
+	return net.IPv4(127, 0, 0, 1)
+}
+
+// Get the public IP of the current connection: the address of the interface used to route to the internet, over
+// IPv4 or IPv6. No packets are sent. With no route out, falls back to the first interface address that isn't
+// loopback, then to loopback itself.
 func GetOutboundIP() net.IP {
 	// https://stackoverflow.com/questions/23558425/how-do-i-get-the-local-ip-address-in-go
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		log.Fatal(err)
+	for _, target := range []string{"8.8.8.8:80", "[2001:4860:4860::8888]:80"} {
+		conn, err := net.Dial("udp", target)
+		if err != nil {
+			continue
+		}
+		localAddr := conn.LocalAddr().(*net.UDPAddr)
+		conn.Close()
+		return localAddr.IP
 	}
-	defer conn.Close()
-
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
 
-	return localAddr.IP
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				fmt.Println("No route out; advertising interface address", ipNet.IP)
+				return ipNet.IP
+			}
+		}
+	}
+	fmt.Println("No network interfaces up; advertising loopback")
+	return net.IPv4(127, 0, 0, 1)
 }
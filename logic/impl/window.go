@@ -47,4 +47,90 @@ func(rw *RunningWindow)Match(id string, seq uint64, coords * shared.Coord)bool{
 	}
 
 	return false
-}
\ No newline at end of file
+}
+
+// Ticks of history kept if the server's config doesn't say
+const DEFAULT_HISTORY_TICKS = 200
+
+// How far back, in ticks, a capture may rewind the prey if the server's config doesn't say
+const DEFAULT_MAX_LAG_TICKS = 10
+
+// A position stamped with the game tick it took effect
+type TickedCoord struct {
+	Tick  uint64
+	Coord shared.Coord
+}
+
+// A history of positions for each identifier, keyed by game tick. Unlike the RunningWindow, which keeps a fixed
+// number of moves, entries are kept for a fixed number of ticks, so a capture can be checked against where the prey
+// was at any time within that window however often it moved.
+type TickHistory struct {
+	sync.Mutex
+	retention uint64
+	entries   map[string][]TickedCoord
+}
+
+// Creates a tick history that keeps the given number of ticks of history (DEFAULT_HISTORY_TICKS if 0)
+func CreateTickHistory(retentionTicks uint64) *TickHistory {
+	if retentionTicks == 0 {
+		retentionTicks = DEFAULT_HISTORY_TICKS
+	}
+	return &TickHistory{retention: retentionTicks, entries: make(map[string][]TickedCoord)}
+}
+
+// Records that id moved to coords at the given tick, and forgets anything older than the retention window
+func (th *TickHistory) Add(id string, tick uint64, coords shared.Coord) {
+	th.Lock()
+	defer th.Unlock()
+	history := th.entries[id]
+
+	// Keep the history sorted; moves can be recorded slightly out of order
+	i := len(history)
+	for i > 0 && history[i-1].Tick > tick {
+		i--
+	}
+	history = append(history, TickedCoord{})
+	copy(history[i+1:], history[i:])
+	history[i] = TickedCoord{Tick: tick, Coord: coords}
+
+	// Drop entries that ended before the window began, keeping the one in effect at its start
+	newest := history[len(history)-1].Tick
+	drop := 0
+	for drop+1 < len(history) && history[drop+1].Tick+th.retention <= newest {
+		drop++
+	}
+	th.entries[id] = history[drop:]
+}
+
+// Returns where id was at the given tick, and false if that is outside the history
+func (th *TickHistory) At(id string, tick uint64) (shared.Coord, bool) {
+	th.Lock()
+	defer th.Unlock()
+	history := th.entries[id]
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Tick <= tick {
+			return history[i].Coord, true
+		}
+	}
+	return shared.Coord{}, false
+}
+
+// Returns true if id was at coords at any tick from "from" to "to" inclusive
+func (th *TickHistory) WasAt(id string, coords shared.Coord, from, to uint64) bool {
+	th.Lock()
+	defer th.Unlock()
+	history := th.entries[id]
+	for i, entry := range history {
+		// The entry is in effect from its own tick until the next entry's
+		if entry.Tick > to {
+			break
+		}
+		if i+1 < len(history) && history[i+1].Tick <= from {
+			continue
+		}
+		if entry.Coord == coords {
+			return true
+		}
+	}
+	return false
+}
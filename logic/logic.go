@@ -11,6 +11,7 @@ import (
 
 // Entrypoint for the player (logic) node, creates the node and all interfaces by calling the playerNode constructor
 // and calling runGame
+// Usage: go run logic.go [other-node-listener-addr] [pixel-listener-addr] [server-addr]; see also "wolfpack player"
 func main() {
 	fmt.Println("hello world")
 
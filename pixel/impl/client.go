@@ -0,0 +1,152 @@
+package impl
+
+import (
+	"os"
+	"path/filepath"
+	"github.com/faiface/pixel/pixelgl"
+	"github.com/faiface/pixel"
+	"fmt"
+	"../../shared"
+	"image"
+	"image/color"
+	"time"
+)
+
+// Opens the game window for the logic node at nodeAddr and plays until it is closed, loading sprites from spriteDir
+// A client replacing one that has already played on the logic node must give the session token it printed
+// Must be called from the main goroutine
+func RunClient(nodeAddr string, spriteDir string, token string) {
+	pixelgl.Run(func() {
+		runClient(nodeAddr, spriteDir, token)
+	})
+}
+
+// Creates the pixel node and then runs pixel's game library in a loop; must be run by pixelgl.Run
+func runClient(nodeAddr string, spriteDir string, token string) {
+	node := ResumePixelNode(nodeAddr, token)
+	go node.RunRemoteNodeListener()
+	winMaxX := node.Geom.GetX()
+	winMaxY := node.Geom.GetY()
+
+	// all of our code will be fired up from here
+	cfg := pixelgl.WindowConfig{
+		Title:  "Wolfpack",
+		Bounds: pixel.R(0, 0, winMaxX + node.Geom.GetScoreboardWidth(), winMaxY),
+		VSync:  true,
+	}
+
+	win, err := pixelgl.NewWindow(cfg)
+	if err != nil {
+		fmt.Println(err)
+	}
+	win.Clear(color.RGBA{0x2d, 0x2d, 0x2d, 0xff} )
+
+	// Create player sprite
+	pic, err := LoadPicture(filepath.Join(spriteDir, "wolf.jpg"))
+	if err != nil {
+		panic(err)
+	}
+	sprite := pixel.NewSprite(pic, pic.Bounds())
+
+	node.PlayerSprite = sprite
+	spritePos := node.Geom.GetVectorFromCoords(shared.Coord{1,1}) // starting position of sprite on grid
+
+	// Create prey sprite
+	pic, err = LoadPicture(filepath.Join(spriteDir, "prey.jpg"))
+	if err != nil {
+		panic(err)
+	}
+	preySprite := pixel.NewSprite(pic, pic.Bounds())
+	node.PreySprite = preySprite
+	preyPos := node.Geom.GetVectorFromCoords(shared.Coord{5,5})
+
+	// Create other player sprite
+	pic, err = LoadPicture(filepath.Join(spriteDir, "other-player.jpg"))
+	if err != nil {
+		panic(err)
+	}
+	otherPlayerSprite := pixel.NewSprite(pic, pic.Bounds())
+	node.OtherPlayerSprite = otherPlayerSprite
+
+	// Create wall sprite
+	pic, err = LoadPicture(filepath.Join(spriteDir, "wall.jpg"))
+	if err != nil {
+		panic(err)
+	}
+	wallSprite := pixel.NewSprite(pic, pic.Bounds())
+	node.WallSprite = wallSprite
+
+	node.DrawWalls(win) // call this to draw walls every update
+
+	sprite.Draw(win, pixel.IM.Moved(spritePos))
+	preySprite.Draw(win, pixel.IM.Moved(preyPos))
+
+	win.Update()
+
+	var lastState *shared.GameRenderState
+	var lastSent time.Time
+	for !win.Closed() {
+		redraw := false
+		// A spectator has no wolf to move; the arrow keys pick who to follow instead
+		if lastState != nil && lastState.Spectator {
+			for key, button := range arrowKeys {
+				if win.JustPressed(button) {
+					node.Following = shared.NextFollowTarget(*lastState, node.Following, shared.FollowStep(key))
+					redraw = true
+				}
+			}
+		} else if key, justPressed := heldArrow(win); key != "" &&
+			(justPressed || time.Since(lastSent) >= KEY_REPEAT) {
+			// The move shows straight away; the logic node's states bear it out, or put the player back
+			node.SendMove(key)
+			lastSent = time.Now()
+		}
+
+		// Update game state
+		if len(node.NewGameStates) > 0 {
+			curState := <- node.NewGameStates
+			lastState = &curState
+			node.Reconcile(curState)
+			node.Interpolator.Update(curState, time.Now())
+			redraw = true
+		}
+		if node.EasePlayer() || node.Interpolator.Animating(time.Now()) {
+			redraw = true
+		}
+		// Now, update the rendering
+		if redraw && lastState != nil {
+			node.RenderNewState(win, *lastState)
+		}
+		win.Update() // must be called frequently, or pixel will hang (can't update only when there is a new gamestate)
+	}
+}
+
+// While an arrow key is held, its move is sent again this often; a key just pressed is sent straight away
+const KEY_REPEAT = 200 * time.Millisecond
+
+var arrowKeys = map[string]pixelgl.Button{"up": pixelgl.KeyUp, "down": pixelgl.KeyDown, "left": pixelgl.KeyLeft,
+	"right": pixelgl.KeyRight}
+
+// Returns the move for the arrow key held down, if any, and whether it was only just pressed
+func heldArrow(win *pixelgl.Window) (string, bool) {
+	for _, key := range []string{"left", "right", "up", "down"} {
+		if win.Pressed(arrowKeys[key]) {
+			return key, win.JustPressed(arrowKeys[key])
+		}
+	}
+	return "", false
+}
+
+// Helper function to load a picture as a sprite
+func LoadPicture(path string) (pixel.Picture, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+	return pixel.PictureDataFromImage(img), nil
+}
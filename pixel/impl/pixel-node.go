@@ -7,15 +7,13 @@ import (
 	"../../shared"
 	_ "image/png"
 	_ "image/jpeg"
-	"net"
 	"fmt"
-	"encoding/json"
 	"github.com/faiface/pixel/imdraw"
 	"github.com/faiface/pixel/text"
 	"golang.org/x/image/font/basicfont"
-	"sort"
 	"os"
 	"image/color"
+	"time"
 )
 
 var NodeAddr string // must store as global to get it into run function
@@ -24,9 +22,13 @@ var MyAddr string
 // Sprite size
 const spriteStep = 30
 
+// How far, as a fraction of the distance left, the player's sprite moves towards where they are predicted to be each
+// frame; it slides rather than jumps, both onto predicted moves and back from mispredicted ones
+const PLAYER_EASE = 0.4
+
 type PixelNode struct {
-	// The TCP connection with the associated logic node
-	Sender            *net.TCPConn
+	// The connection with the associated logic node (see shared/pixel-protocol.go)
+	link              *shared.LogicLink
 
 	// This player's current position
 	playerPosition    shared.Coord
@@ -54,38 +56,46 @@ type PixelNode struct {
 
 	// The text atlas which is required to draw text with pixel
 	TextAtlas  		  *text.Atlas
+
+	// For a spectator, who to follow (see shared.FollowTargets); a followed wolf is drawn with PlayerSprite
+	Following         string
+
+	// Predicts where this player is, from their inputs the logic node hasn't acknowledged (see shared/prediction.go)
+	Predictor         *shared.Predictor
+
+	// Where this player's sprite is drawn, on the map; it eases towards where they are predicted to be
+	playerDrawnAt     pixel.Vec
+
+	// Where the other wolves and the prey have been, to slide them between states (see shared/interpolation.go)
+	Interpolator      *shared.Interpolator
+
+	// The walls on the mini-map, drawn in the scoreboard column when the map is bigger than the board
+	MinimapWalls      *imdraw.IMDraw
 }
 
 // Creates a pixel node by setting up the TCP connection with the logic node, and getting the associated game settings.
 // Returns the created pixel node.
 func CreatePixelNode(nodeAddr string) (PixelNode) {
+	return ResumePixelNode(nodeAddr, "")
+}
 
-	// Setup connection
-	remote := setupTCP(nodeAddr)
-
-	// Get initial game state (first message after tcp setup)
-	var buf = make([]byte, 2048)
-	var settings shared.InitialGameSettings
-	for {
-		// Get initial game state
-		rlen, err := remote.Read(buf)
-		if err != nil {
-			fmt.Println(err)
-		} else {
-			err := json.Unmarshal(buf[0:rlen], &settings)
-			if err == nil && settings.WindowsY != 0{
-				break
-			}
-		}
-		_, err = remote.Write([]byte("getgameconfig"))
+// Creates a pixel node for the logic node, resuming the session with the given token (from the logic node's output)
+// if another client has played on it before; the logic node sends the latest state to render straight away.
+// Returns the created pixel node.
+func ResumePixelNode(nodeAddr string, token string) (PixelNode) {
+
+	// Setup connection, and get initial game state (sent after the handshake)
+	remote, settings, err := shared.ConnectLogicNode(nodeAddr, token)
+	if err != nil {
+		fmt.Printf("No logic node found at %s, start a logic node and try again: %s\n", nodeAddr, err)
+		os.Exit(1)
 	}
 
 	// Init walls
 	wallCoords := settings.WallCoordinates
 
-	// Create geometry manager
-	geom := geometry.CreatePixelManager(settings.WindowsX, settings.WindowsY, settings.ScoreboardWidth,
-		spriteStep, wallCoords)
+	// Create geometry manager, with a camera for maps bigger than the board
+	geom := geometry.CreateScrollingPixelManager(settings, spriteStep)
 
 	// Create scoreboard
 	scoreboardBg := createScoreboard(settings.WindowsX, settings.WindowsY, settings.ScoreboardWidth)
@@ -93,8 +103,17 @@ func CreatePixelNode(nodeAddr string) (PixelNode) {
 	// Allow text rendering
 	basicAtlas := text.NewAtlas(basicfont.Face7x13, text.ASCII)
 
-	node := PixelNode{ Sender: remote, Geom: geom, NewGameStates: make(chan shared.GameRenderState, 5),
-	ScoreboardBg: scoreboardBg, TextAtlas: basicAtlas}
+	// Predict moves with the same checks the logic node makes
+	grid := geometry.CreateNewGridManager(settings)
+	start := shared.Coord{1,1}
+	predictor := shared.CreatePredictor(func(from shared.Coord, to shared.Coord) bool {
+		return grid.IsValidMove(to) && grid.IsNotTeleporting(from, to)
+	}, start)
+
+	node := PixelNode{ link: remote, Geom: geom, NewGameStates: make(chan shared.GameRenderState, 5),
+	ScoreboardBg: scoreboardBg, TextAtlas: basicAtlas, Following: shared.FOLLOW_PREY, Predictor: predictor,
+	playerDrawnAt: geom.GetMapVectorFromCoords(start), Interpolator: shared.CreateInterpolator(),
+	MinimapWalls: createMinimapWalls(&geom, wallCoords)}
 
 	return node
 }
@@ -106,53 +125,120 @@ func (pn * PixelNode) RenderNewState (win * pixelgl.Window, curState shared.Game
 	// Clear current render
 	win.Clear(color.RGBA{0x2d, 0x2d, 0x2d, 0xff})
 
+	// The prey and the other wolves are drawn sliding between the cells in the states they were in, as of now
+	now := time.Now()
+	_, following := shared.FollowedLoc(curState, pn.Following)
+
+	// Point the camera at this player, or for a spectator, whoever they follow
+	if !curState.Spectator {
+		pn.Geom.CenterOn(pn.playerDrawnAt)
+	} else if tween, ok := pn.Interpolator.Tween(following, now); ok {
+		pn.Geom.CenterOn(pn.tweenOnMap(tween))
+	} else if tween, ok := pn.Interpolator.Tween(shared.PREY_ID, now); ok {
+		pn.Geom.CenterOn(pn.tweenOnMap(tween))
+	}
+
 	// Render walls, first
 	pn.DrawWalls(win)
 
-	pn.DrawScore(win, curState)
-
 	// Render prey
-	preyPos := pn.Geom.GetVectorFromCoords(curState.Prey)
-	pMat := pixel.IM
-	pMat = pMat.Moved(preyPos)
-	pn.PreySprite.Draw(win, pMat)
+	pn.drawInterpolated(win, pn.PreySprite, shared.PREY_ID, now)
 
-	// Render other players
-	for _, player := range curState.OtherPlayers {
-		pn.OtherPlayerSprite.Draw(win, pixel.IM.Moved(pn.Geom.GetVectorFromCoords(player)))
+	// Render other players, including any that have left and are fading out
+	for _, id := range pn.Interpolator.Wolves() {
+		if curState.Spectator && id == following {
+			continue
+		}
+		pn.drawInterpolated(win, pn.OtherPlayerSprite, id, now)
 	}
 
-	// Render player
-	playerPos := pn.Geom.GetVectorFromCoords(curState.PlayerLoc)
-	mat := pixel.IM
-	mat = mat.Moved(playerPos)
-	pn.PlayerSprite.Draw(win, mat)
+	// A spectator has no player of their own; the wolf they follow is drawn as one
+	if curState.Spectator {
+		if following != shared.FOLLOW_PREY {
+			pn.drawInterpolated(win, pn.PlayerSprite, following, now)
+		}
+	} else {
+		// Render player, where they are predicted to be (see EasePlayer)
+		if at := pn.Geom.ToBoard(pn.playerDrawnAt); pn.Geom.InView(at) {
+			pn.PlayerSprite.Draw(win, pixel.IM.Moved(at))
+		}
+	}
+
+	// The scoreboard goes on top of any sprite partly off the edge of the board
+	pn.DrawScore(win, curState)
+}
+
+// Helper function to draw the prey or another wolf where the interpolator has it as of now, faded if it is stale
+func (pn * PixelNode) drawInterpolated(win * pixelgl.Window, sprite *pixel.Sprite, id string, now time.Time) {
+	tween, ok := pn.Interpolator.Tween(id, now)
+	if !ok {
+		return
+	}
+	at := pn.Geom.ToBoard(pn.tweenOnMap(tween))
+	if !pn.Geom.InView(at) {
+		return
+	}
+	mat := pixel.IM.Moved(at)
+	if tween.Alpha < 1 {
+		sprite.DrawColorMask(win, mat, pixel.Alpha(tween.Alpha))
+	} else {
+		sprite.Draw(win, mat)
+	}
+}
 
+// Helper function to find where on the map the interpolator has an entity
+func (pn * PixelNode) tweenOnMap(tween shared.Tween) (pixel.Vec) {
+	from := pn.Geom.GetMapVectorFromCoords(tween.From)
+	to := pn.Geom.GetMapVectorFromCoords(tween.To)
+	return from.Add(to.Sub(from).Scaled(tween.Progress))
 }
 
-// Sends a move as inputted by the player to the logic node
+// Sends a move as inputted by the player to the logic node, and predicts where it takes them
 func (pn * PixelNode) SendMove (move string) {
-	pn.Sender.Write([]byte(move))
+	seq, err := pn.link.SendInput(move)
+	if err != nil {
+		fmt.Println("Error sending move to logic node:", err)
+		return
+	}
+	pn.Predictor.Input(seq, move, time.Now())
 }
 
-// Listens for new game states from pixel node
-func (pn * PixelNode) RunRemoteNodeListener() {
-	// takes a Listener client
-	// runs the Listener in a infinite loop
-	node := pn.Sender
-	decode:= json.NewDecoder(node)
-	i := 0
-	for {
-		var playerPos shared.GameRenderState
-		i++
-		err := decode.Decode(&playerPos)
-		if err != nil {
-			fmt.Println("Error receiving new GameRenderState on PixelNode:", err)
-		} else {
-			pn.NewGameStates <- playerPos
-		}
+// Takes a new state from the logic node into the prediction of where this player is
+func (pn * PixelNode) Reconcile (state shared.GameRenderState) {
+	if state.Spectator {
+		return
 	}
+	_, corrected := pn.Predictor.Reconcile(state, time.Now())
+	if corrected {
+		fmt.Println("Move not played as predicted; sliding back to", pn.Predictor.Predicted())
+	}
+}
 
+// Moves this player's sprite a step towards where they are predicted to be
+// Returns true if it moved, and so needs drawing again
+func (pn * PixelNode) EasePlayer () (bool) {
+	target := pn.Geom.GetMapVectorFromCoords(pn.Predictor.Predicted())
+	if pn.playerDrawnAt == target {
+		return false
+	}
+	step := target.Sub(pn.playerDrawnAt)
+	if step.Len() < 1 {
+		pn.playerDrawnAt = target
+	} else {
+		pn.playerDrawnAt = pn.playerDrawnAt.Add(step.Scaled(PLAYER_EASE))
+	}
+	return true
+}
+
+// Listens for new game states from the logic node, reconnecting whenever the connection is lost; returns only if the
+// logic node turns us away
+func (pn * PixelNode) RunRemoteNodeListener() {
+	pn.link.RunListener(pn.NewGameStates)
+}
+
+// Returns the session token the logic node handed out
+func (pn * PixelNode) Token() (string) {
+	return pn.link.Token()
 }
 
 // Helper function to draw the scores on the board.
@@ -179,46 +265,115 @@ func (pn * PixelNode) DrawScore (window *pixelgl.Window, curState shared.GameRen
 	fmt.Fprintln(scores, scoreString)
 	scores.Draw(window, pixel.IM)
 
-	// Render my score
+	// Render my score, or for a spectator, who they follow
 	myScoreString := fmt.Sprintf("SCORE: %10d", scoreMap["ME"])
+	if curState.Spectator {
+		_, following := shared.FollowedLoc(curState, pn.Following)
+		myScoreString = fmt.Sprintf("WATCHING: %7s", following)
+	}
 	myScorePos := pixel.V(pn.Geom.GetX() + padding, textHeight * scoreMultiplier)
 	myScore := text.New(myScorePos, pn.TextAtlas)
 	fmt.Fprintln(myScore, myScoreString)
 	myScore.Draw(window, pixel.IM.Scaled(myScore.Orig, scoreMultiplier))
+
+	// Render points held back while the network is partitioned
+	if held := curState.HeldScores["ME"]; held > 0 {
+		heldString := fmt.Sprintf("HELD: %11d", held)
+		heldPos := pixel.V(pn.Geom.GetX() + padding, textHeight * scoreMultiplier * 3)
+		heldScore := text.New(heldPos, pn.TextAtlas)
+		fmt.Fprintln(heldScore, heldString)
+		heldScore.Draw(window, pixel.IM)
+	}
+
+	if pn.Geom.Scrolls() {
+		pn.DrawMinimap(window, curState)
+	}
 }
 
-// Helper function to take the score map and return a sorted list of all scores by player, formatted as a single string
-// for pixel to draw.
-// Couldn't be bothered to figure the sorting out myself, reference:
-// https://stackoverflow.com/questions/18695346/how-to-sort-a-mapstringint-by-its-values
-func SortScores (scoreMap map[string]int) (string) {
-	n := map[int][]string{}
-	var a []int
-	for k, v := range scoreMap {
-		n[v] = append(n[v], k)
-	}
-	for k := range n {
-		a = append(a, k)
-	}
-	sort.Sort(sort.Reverse(sort.IntSlice(a)))
-
-	i := 1
-	scoreString := ""
-	for _, k := range a {
-		sort.Strings(n[k])
-		for _, s := range n[k] {
-			scoreString += fmt.Sprintf("%2d. %-4s %9d points\n\n", i, s, k)
+// The colours of the mini-map
+var (
+	MinimapBackground = pixel.RGB(0.18, 0.18, 0.18)
+	MinimapWall       = pixel.RGB(0.5, 0.5, 0.5)
+	MinimapPrey       = pixel.RGB(1, 0.5, 0)
+	MinimapWolf       = pixel.RGB(0.6, 0.6, 1)
+	MinimapPlayer     = pixel.RGB(1, 1, 0)
+	MinimapView       = pixel.RGB(1, 1, 1)
+)
+
+// Helper function to draw the whole map small in the scoreboard column: the walls, the prey, every wolf (this player,
+// or the one a spectator follows, in its own colour) and the part of the map on the board
+func (pn * PixelNode) DrawMinimap (window *pixelgl.Window, curState shared.GameRenderState) {
+	corner, cell := pn.Geom.GetMinimap()
+	mapX, mapY := pn.Geom.GetMapSize()
+	scale := cell / pn.Geom.GetSpriteSize()
+	dots := imdraw.New(nil)
+
+	dots.Color = MinimapBackground
+	dots.Push(corner, pixel.V(corner.X + mapX * scale, corner.Y + mapY * scale))
+	dots.Rectangle(0)
+	dots.Draw(window)
+	pn.MinimapWalls.Draw(window)
+	dots.Clear()
+
+	_, following := shared.FollowedLoc(curState, pn.Following)
+	for id, loc := range curState.OtherPlayers {
+		dots.Color = MinimapWolf
+		if curState.Spectator && id == following {
+			dots.Color = MinimapPlayer
 		}
-		i++
+		pushMinimapCell(dots, corner, cell, loc)
+	}
+	dots.Color = MinimapPrey
+	pushMinimapCell(dots, corner, cell, curState.Prey)
+	if !curState.Spectator {
+		dots.Color = MinimapPlayer
+		pushMinimapCell(dots, corner, cell, pn.Predictor.Predicted())
+	}
+
+	// Outline the part of the map on the board
+	camera := pn.Geom.GetCamera()
+	dots.Color = MinimapView
+	dots.Push(pixel.V(corner.X + camera.X * scale, corner.Y + camera.Y * scale),
+		pixel.V(corner.X + (camera.X + pn.Geom.GetX()) * scale, corner.Y + (camera.Y + pn.Geom.GetY()) * scale))
+	dots.Rectangle(1)
+	dots.Draw(window)
+}
+
+// Helper function to create the mini-map's walls, which never move
+func createMinimapWalls(geom *geometry.PixelManager, walls []shared.Coord) (*imdraw.IMDraw) {
+	minimapWalls := imdraw.New(nil)
+	corner, cell := geom.GetMinimap()
+	minimapWalls.Color = MinimapWall
+	for _, wall := range walls {
+		pushMinimapCell(minimapWalls, corner, cell, wall)
 	}
+	return minimapWalls
+}
 
-	return scoreString
+// Helper function to add a grid cell to the mini-map, at least 2 pixels square so it can be seen
+func pushMinimapCell(dots *imdraw.IMDraw, corner pixel.Vec, cell float64, coord shared.Coord) {
+	size := cell
+	if size < 2 {
+		size = 2
+	}
+	x := corner.X + float64(coord.X) * cell
+	y := corner.Y + float64(coord.Y) * cell
+	dots.Push(pixel.V(x, y), pixel.V(x + size, y + size))
+	dots.Rectangle(0)
 }
 
-// Helper function to draw all the walls on each render update
+// Helper function to take the score map and return a sorted list of all scores by player, formatted as a single string
+// for pixel to draw (see shared.SortScores)
+func SortScores (scoreMap map[string]int) (string) {
+	return shared.SortScores(scoreMap)
+}
+
+// Helper function to draw all the walls in view on each render update
 func (pn * PixelNode ) DrawWalls(window *pixelgl.Window) {
 	for _, wall := range pn.Geom.GetWallVectors() {
-		pn.WallSprite.Draw(window, pixel.IM.Moved(wall))
+		if pn.Geom.InView(wall) {
+			pn.WallSprite.Draw(window, pixel.IM.Moved(wall))
+		}
 	}
 }
 
@@ -235,20 +390,3 @@ func createScoreboard(gameWidth, gameHeight, scoreboardWidth float64) (*imdraw.I
 	scoreboardBg.Polygon(0)
 	return scoreboardBg
 }
-
-// Function that sets up the TCP connection with the logic node
-func setupTCP(ip_addr string) (*net.TCPConn) {
-	tcpAddr, err := net.ResolveTCPAddr("tcp", ip_addr)
-	if err != nil {
-		fmt.Println("Invalid TCP address provided for logic node")
-		os.Exit(1)
-	}
-
-	tcpConn, err := net.DialTCP("tcp", nil, tcpAddr)
-	if err != nil {
-		fmt.Printf("No logic node found at %s, start a logic node and try again", tcpAddr.String())
-		os.Exit(1)
-	}
-
-	return tcpConn
-}
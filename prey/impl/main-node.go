@@ -3,10 +3,10 @@ package impl
 import (
 	"../../shared"
 	"../../geometry"
-	"crypto/ecdsa"
-	"time"
-	"math/rand"
+	"crypto"
 	"fmt"
+	"os"
+	li "../../logic/impl"
 )
 
 // The "main" node part of the logic node. Deals with computation and checks; not communications
@@ -37,13 +37,17 @@ type PreyNode struct {
 
 // nodeListenerAddr = where we expect to receive messages from other nodes
 func CreatePreyNode(nodeListenerAddr, playerListenerAddr string,
-	pubKey *ecdsa.PublicKey, privKey *ecdsa.PrivateKey, serverAddr string) (PreyNode) {
+	pubKey crypto.PublicKey, privKey crypto.Signer, serverAddr string) (PreyNode) {
 	// Setup the player communication buffered channel
 	playerCommChannel := make(chan string, 5)
 
 	// Start the node to node interface
 	nodeInterface := CreateNodeCommInterface(pubKey, privKey, serverAddr)
-	addr, listener := StartListenerUDP(nodeListenerAddr)
+	addr, listener, err := StartListenerUDP(nodeListenerAddr)
+	if err != nil {
+		fmt.Printf("Could not listen for other nodes on [%s]: %s\n", nodeListenerAddr, err)
+		os.Exit(1)
+	}
 	nodeInterface.LocalAddr = addr
 	nodeInterface.IncomingMessages = listener
 	go nodeInterface.RunListener(listener, nodeListenerAddr)
@@ -52,14 +56,17 @@ func CreatePreyNode(nodeListenerAddr, playerListenerAddr string,
 	// Register with server, update info
 	uniqueId := nodeInterface.ServerRegister()
 	go nodeInterface.SendHeartbeat()
+	go nodeInterface.RunClockSync()
+	go nodeInterface.RunSessionUpkeep()
 
 	// Make a gameState
 	playerLocs := make(map[string]shared.Coord)
-	playerLocs[uniqueId] = shared.Coord{5,5}
+	startGrid := geometry.CreateNewGridManager(nodeInterface.Config.InitState.Settings)
+	playerLocs[uniqueId] = li.PreyStart(&startGrid)
 	playerMap := shared.PlayerLockMap{Data:playerLocs}
 
 	playerScores := make(map[string]int)
-	playerScoreMap := shared.ScoresLockMap{Data:playerScores}
+	playerScoreMap := shared.ScoresLockMap{Data:playerScores, Policy:nodeInterface.Config.PartitionPolicy}
 
 	// Make a gameState
 	gameState := shared.GameState{
@@ -83,89 +90,25 @@ func CreatePreyNode(nodeListenerAddr, playerListenerAddr string,
 	return pn
 }
 
-// Runs the main node (listens for incoming messages from pixel interface) in a loop, must be called at the
-// end of main (or alternatively, in a goroutine)
+// Runs the prey in a loop, taking one step per prey step, must be called at the end of main (or alternatively, in a
+// goroutine). Steps are computed by li.NextPreyMove from the game's prey seed, so they can be reproduced by any node
+// that knows the seed, the tick and the wolf positions.
 func (pn * PreyNode) RunGame(playerListener string) {
-	ticker := time.NewTicker(time.Millisecond * 250)
-	for _ = range ticker.C {
-		var dir string
-		randMove := rand.Float64()
-		if randMove < 0.25 || len(pn.GameState.PlayerLocs.Data) <2{
-			go func() {
-				random := rand.Float64()
-				switch {
-				case random < 0.25:
-					dir = "up"
-				case random < 0.5:
-					dir = "down"
-				case random < 0.75:
-					dir = "right"
-				default:
-					dir = "left"
-				}
-
-				move := pn.MovePrey(dir)
-				pn.nodeInterface.SendMoveToNodes(&move)
-			}()
-		}else {
-			go func() {
-				dir := "still"
-				maxVal := -1
-				for _,i:= range []int{-1,1}{
-					val := pn.MaxDistance(pn.GameState.PlayerLocs, i, 0)
-						if val > maxVal {
-							maxVal = val
-							if i == -1{
-								dir = "left"
-							}else{
-								dir = "right"
-							}
-
-					}
-
-				}
-				for _,j:= range []int{-1,1}{
-					val := pn.MaxDistance(pn.GameState.PlayerLocs, 0, j)
-					if val > maxVal{
-						maxVal = val
-						if j == -1{
-							dir = "down"
-						}else{
-							dir = "up"
-						}
-					}
-				}
-
-				fmt.Println("move prey: ", dir)
-				move := pn.MovePrey(dir)
-				pn.nodeInterface.SendMoveToNodes(&move)
-			}()
-		}
-	}
-}
+	li.RunPreySteps(pn.nodeInterface.Clock, func(tick uint64) {
+		pn.GameState.PlayerLocs.RLock()
+		preyLoc := pn.GameState.PlayerLocs.Data["prey"]
+		pn.GameState.PlayerLocs.RUnlock()
 
-func (pn *PreyNode)MaxDistance(playerLocs shared.PlayerLockMap, moveX, moveY int)int {
-	playerLocs.RLock()
-	myLoc := playerLocs.Data["prey"]
-	newLoc := shared.Coord{myLoc.X+moveX, myLoc.Y+moveY}
-	if !pn.geo.IsValidMove(newLoc)	{
-		return -1
-	}
-	dist := 0
-	for val, nodeLoc := range playerLocs.Data {
-		if val != "prey"{
-			dist += abs(newLoc.X-nodeLoc.X)+ abs(newLoc.Y-nodeLoc.Y)
-		}
-	}
-	playerLocs.RUnlock()
-	return dist
-}
-func abs(num int)int {
-	if num <0{
-		return -num
-	}else{
-		return num
-	}
+		wolves := li.WolfPositions(&pn.GameState.PlayerLocs)
+		move := li.NextPreyMove(pn.nodeInterface.Config.PreySeed, tick, preyLoc, wolves, &pn.geo)
+
+		pn.GameState.PlayerLocs.Lock()
+		pn.GameState.PlayerLocs.Data["prey"] = move
+		pn.GameState.PlayerLocs.Unlock()
+		pn.nodeInterface.History.Add("prey", tick, move)
+
+		pn.nodeInterface.SendMoveToNodes(&move)
+	})
 }
 
 func (pn * PreyNode) MovePrey(move string) (shared.Coord) {
@@ -7,10 +7,9 @@ import (
 	"log"
 	"os"
 	"../../shared"
-	"crypto/ecdsa"
+	"crypto"
 	"crypto/elliptic"
 	"crypto/md5"
-	"crypto/rand"
 	"time"
 	"encoding/gob"
 	"encoding/hex"
@@ -27,8 +26,8 @@ import (
 // Node communication interface for communication with other player/logic nodes
 type NodeCommInterface struct {
 	PreyNode			*PreyNode
-	PubKey 				*ecdsa.PublicKey
-	PrivKey 			*ecdsa.PrivateKey
+	PubKey 				crypto.PublicKey
+	PrivKey 			crypto.Signer
 	Config 				shared.GameConfig
 	ServerAddr			string
 	ServerConn 			*rpc.Client
@@ -37,7 +36,7 @@ type NodeCommInterface struct {
 	OtherNodes 			map[string]*net.UDPConn
 
 	// The current map of identifiers to public keys of nodes in play
-	NodeKeys		    map[string]*ecdsa.PublicKey
+	NodeKeys		    map[string]crypto.PublicKey
 	Log 				*govec.GoLog
 	HeartAttack 		chan bool
 	MoveCommits			map[string]string
@@ -59,6 +58,24 @@ type NodeCommInterface struct {
 	// Whether this node has a gamestate yet or not
 	HasGameState		  bool
 	RW 					  li.RunningWindow
+
+	// The number of times the prey has been captured; seeds the prey's next spawn point
+	PreyEpoch			  uint64
+
+	// The game clock, synchronised with the server; decides which ticks the prey steps on
+	Clock				  *li.GameClock
+
+	// Decides which of several captures of the same prey move stands
+	Captures			  *li.CaptureArbiter
+
+	// Where the prey has been over the last few seconds, by tick; captures are checked against it
+	History				  *li.TickHistory
+
+	// The sessions this node's messages are sealed under, in games with encrypted traffic (see logic/impl/secure.go)
+	Sessions			  *key.SessionTable
+
+	// The identity keys the server has registered for the other nodes, which their hellos are checked against
+	Registered			  *li.RegisteredKeys
 }
 
 type StrikeLockMap struct {
@@ -68,10 +85,11 @@ type StrikeLockMap struct {
 
 
 // A message for another node with a recipient and a byte-encoded message. If the recipient is "all", the message is
-// sent to every node in OtherNodes.
+// sent to every node in OtherNodes. A Plain message is sent as is even when traffic is encrypted.
 type PendingMessage struct {
 	Recipient string
 	Message []byte
+	Plain bool
 }
 // A struct to hold pending moves
 type PendingMoveUpdates struct {
@@ -90,13 +108,7 @@ type ACKMessage struct {
 type OtherNode struct {
 	Identifier string
 	Conn *net.UDPConn
-	PubKey *ecdsa.PublicKey
-}
-
-type PlayerInfo struct {
-	Address 			net.Addr
-	PubKey 				ecdsa.PublicKey
-	Prey                bool
+	PubKey crypto.PublicKey
 }
 
 // The message struct that is sent for all node communication
@@ -105,7 +117,7 @@ type NodeMessage struct {
 	Identifier  string
 
 	// identifies the type of message
-	// can be: "move", "moveCommit", "gameState", "connect", "connected"
+	// can be: "move", "moveCommit", "gameState", "connect", "connected", "hello"
 	MessageType string
 
 	// a gamestate, included if MessageType is "gameState", else nil
@@ -131,6 +143,25 @@ type NodeMessage struct {
 
 	// Prey Sequence number
 	PreySeq		uint64
+
+	// The game tick this message was sent in
+	Tick		uint64
+
+	// The vector timestamp GoVector gives this message on sending
+	VClock		map[string]uint64
+
+	// A digest of the sender's game state, included if the message type is digest
+	Digest		[]byte
+
+	// The sender's prey epoch, included with digests and gamestates
+	PreyEpoch	uint64
+
+	// The sender's partition view when it made a capture, included if the message type is captured
+	View		[]string
+	Members		int
+
+	// Half of the handshake that agrees a session, included if the message type is hello
+	Hello		*shared.SessionHello
 }
 
 var sequenceNumber uint64 = 0
@@ -138,13 +169,13 @@ var sequenceNumber uint64 = 0
 const STRIKE_OUT = 3
 
 // Creates a node comm interface with initial empty arrays
-func CreateNodeCommInterface(pubKey *ecdsa.PublicKey, privKey *ecdsa.PrivateKey, serverAddr string) (NodeCommInterface) {
+func CreateNodeCommInterface(pubKey crypto.PublicKey, privKey crypto.Signer, serverAddr string) (NodeCommInterface) {
 	return NodeCommInterface{
 		PubKey:                pubKey,
 		PrivKey:               privKey,
 		ServerAddr:           serverAddr,
 		OtherNodes:            make(map[string]*net.UDPConn),
-		NodeKeys:              make(map[string]*ecdsa.PublicKey),
+		NodeKeys:              make(map[string]crypto.PublicKey),
 		HeartAttack:           make(chan bool),
 		MoveCommits:           make(map[string]string),
 		MessagesToSend:        make(chan *PendingMessage, 30),
@@ -154,6 +185,11 @@ func CreateNodeCommInterface(pubKey *ecdsa.PublicKey, privKey *ecdsa.PrivateKey,
 		Strikes:               StrikeLockMap{StrikeCount:make(map[string]int)},
 		HasGameState:		   false,
 		RW: 				   li.RunningWindow{Map:make(map[string][li.NUMMOVESTOKEEP]li.MoveSeq)},
+		Clock:				   li.CreateGameClock(li.DEFAULT_TICK_MS),
+		Captures:			   li.CreateCaptureArbiter(),
+		History:			   li.CreateTickHistory(li.DEFAULT_HISTORY_TICKS),
+		Sessions:			   key.CreateSessionTable(privKey),
+		Registered:			   &li.RegisteredKeys{},
 	}
 }
 
@@ -166,13 +202,24 @@ func (n *NodeCommInterface) RunListener(listener *net.UDPConn, nodeListenerAddr
 	i := 0
 	for {
 		i++
-		buf := make([]byte, 2048)
-		_, _, err := listener.ReadFromUDP(buf)
+		buf := make([]byte, li.MAX_DATAGRAM_SIZE)
+		size, _, err := listener.ReadFromUDP(buf)
 		if err != nil {
 			fmt.Println(err)
+			continue
 		}
 
-		message := receiveMessage(n.Log, buf)
+		message, ok := n.openMessage(buf[:size])
+		if !ok {
+			continue
+		}
+		// Spectators never move and have no say over captures, so moves, captures and rejections claiming to come
+		// from one are dropped
+		if shared.IsObserver(message.Identifier) && (message.MessageType == "move" ||
+			message.MessageType == "captured" || message.MessageType == "moveCommit" ||
+			message.MessageType == "rejected") {
+			continue
+		}
 
 		switch message.MessageType {
 		case "gameState":
@@ -202,6 +249,10 @@ func (n *NodeCommInterface) RunListener(listener *net.UDPConn, nodeListenerAddr
 			n.HandleIncomingConnectionRequest(message.Identifier, message.Addr, message.PubKey)
 		case "connected":
 			// Do nothing
+		case "hello":
+			n.HandleHello(message.Identifier, message.Hello)
+		case "digest":
+			// The prey is the authority on its own position and takes no part in digest repairs
 		case "captured":
 			var coords shared.Coord
 			authentic := n.CheckAuthenticityOfMove(n.NodeKeys[message.Identifier], &message.Move)
@@ -214,7 +265,9 @@ func (n *NodeCommInterface) RunListener(listener *net.UDPConn, nodeListenerAddr
 				fmt.Println("Could not unmarshal")
 				fmt.Println(err)
 			} else {
-				err := n.HandleCapturedPreyRequest(message.Identifier, &coords, message.Score, message.PreySeq)
+				claim := &li.CaptureClaim{Identifier: message.Identifier, Seq: message.Seq, PreySeq: message.PreySeq,
+					Tick: message.Tick, VClock: message.VClock, View: message.View, Members: message.Members}
+				err := n.HandleCausalCapture(claim, &coords, message.Score)
 				if err != nil {
 					fmt.Println("Rejecting captured prey: ", err)
 				}
@@ -234,14 +287,14 @@ func (n *NodeCommInterface) ManageOtherNodes() {
 			if toSend.Recipient != "all" {
 				// Send to the single node
 				if _, ok := n.OtherNodes[toSend.Recipient]; ok {
-					_, err := n.OtherNodes[toSend.Recipient].Write(toSend.Message)
+					err := n.writeToNode(toSend.Recipient, toSend.Message, toSend.Plain)
 					if err != nil {
 						n.NodesWriteConnRefused <- toSend.Recipient
 					}
 				}
 			} else {
 				// Send the message to all nodes
-				n.sendMessageToNodes(toSend.Message)
+				n.sendMessageToNodes(toSend.Message, toSend.Plain)
 			}
 		case toAdd := <- n.NodesToAdd:
 			n.OtherNodes[toAdd.Identifier] = toAdd.Conn
@@ -249,6 +302,7 @@ func (n *NodeCommInterface) ManageOtherNodes() {
 		case toDelete := <-n.NodesToDelete:
 			fmt.Printf("To delete: %s\n", toDelete)
 			delete(n.OtherNodes, toDelete)
+			n.Sessions.Forget(toDelete)
 			n.PreyNode.GameState.PlayerLocs.Lock()
 			delete(n.PreyNode.GameState.PlayerLocs.Data, toDelete)
 			delete(n.NodeKeys, toDelete)
@@ -293,6 +347,9 @@ func sendMessage(goLog *govec.GoLog, message NodeMessage, tag string) []byte{
 	if goLog == nil{
 		return nil
 	}
+	if message.VClock == nil {
+		message.VClock = li.NextVectorTimestamp(goLog, message.Identifier)
+	}
 	if tag == ""{
 		newMessage = goLog.PrepareSend("SendMessageToOtherNode", message)
 	}else{
@@ -314,10 +371,16 @@ func (n *NodeCommInterface) ServerRegister() (id string) {
 			os.Exit(1)
 		}
 		n.Log = govec.InitGoVectorMultipleExecutions("LogicNodeId-"+response.Identifier,
-			"LogicNodeFile")
+			li.DefaultNodeOptions.LogPath("LogicNodeFile"))
 
 		n.Config = response
 	}
+	n.Sessions.SetSelf(n.Config.Identifier)
+	n.Clock.SetTickDuration(n.Config.TickMs)
+	n.History = li.CreateTickHistory(n.Config.HistoryTicks)
+	if err := n.Clock.Sync(n.ServerConn, n.PrivKey); err != nil {
+		fmt.Println("Could not synchronise clock with server:", err)
+	}
 	n.GetNodes()
 
 	return "prey"
@@ -326,7 +389,7 @@ func (n *NodeCommInterface) ServerRegister() (id string) {
 func DialAndRegister(n *NodeCommInterface) (shared.GameConfig, error) {
 	// fmt.Printf("DEBUG - ServerRegister() n.ServerConn [%s] should be nil\n", n.ServerConn)
 	// Connect to server with RPC, port is always :8081
-	serverConn, err := rpc.Dial("tcp", n.ServerAddr)
+	serverConn, err := li.DialServer(n.ServerAddr)
 	if err != nil {
 		log.Println("Cannot dial server. Please ensure the server is running and try again.")
 		return shared.GameConfig{}, err
@@ -335,7 +398,12 @@ func DialAndRegister(n *NodeCommInterface) (shared.GameConfig, error) {
 	n.ServerConn = serverConn
 	var response shared.GameConfig
 	// Register with server
-	playerInfo := PlayerInfo{n.LocalAddr, *n.PubKey, true}
+	auth, err := li.SignServerCall(serverConn, n.PrivKey, "GServer.Register")
+	if err != nil {
+		return shared.GameConfig{}, err
+	}
+	playerInfo := shared.PlayerInfo{n.LocalAddr, key.PubKeyToString(n.PubKey), true, li.DefaultNodeOptions.Room, auth,
+		false}
 	err = serverConn.Call("GServer.Register", playerInfo, &response)
 	if err != nil {
 		return shared.GameConfig{}, err
@@ -345,8 +413,7 @@ func DialAndRegister(n *NodeCommInterface) (shared.GameConfig, error) {
 
 // Requests the list of currently connected nodes from the server, and initiates a connection with them
 func (n *NodeCommInterface) GetNodes() {
-	var response map[string]shared.NodeRegistrationInfo
-	err := n.ServerConn.Call("GServer.GetNodes", *n.PubKey, &response)
+	response, err := n.fetchNodes()
 	if err != nil {
 		panic(err)
 		log.Fatal(err)
@@ -360,14 +427,35 @@ func (n *NodeCommInterface) GetNodes() {
 	}
 
 	for id, regInfo := range response {
+		pubKey, err := key.DecodePublicKey(regInfo.PubKey)
+		if err != nil {
+			fmt.Printf("Ignoring node [%s] with a bad public key: %s\n", id, err)
+			continue
+		}
+		n.Registered.Add(id, regInfo.PubKey)
 		nodeClient := n.GetClientFromAddrString(regInfo.Addr.String())
-		pubKey:= key.StringToPubKey(regInfo.PubKey)
-		node := OtherNode{Identifier: id, Conn: nodeClient, PubKey: &pubKey}
+		node := OtherNode{Identifier: id, Conn: nodeClient, PubKey: pubKey}
 		n.NodesToAdd <- &node
 		n.InitiateConnection(nodeClient)
 	}
 }
 
+// Calls one of the server's methods that take nothing but proof of who is calling, e.g. GServer.Heartbeat
+func (n *NodeCommInterface) CallServer(method string, reply interface{}) (err error) {
+	auth, err := li.SignServerCall(n.ServerConn, n.PrivKey, method)
+	if err != nil {
+		return err
+	}
+	return n.ServerConn.Call(method, auth, reply)
+}
+
+// Returns the nodes the server has registered in this node's room
+func (n *NodeCommInterface) fetchNodes() (map[string]shared.NodeRegistrationInfo, error) {
+	var response map[string]shared.NodeRegistrationInfo
+	err := n.CallServer("GServer.GetNodes", &response)
+	return response, err
+}
+
 func (n *NodeCommInterface) GetClientFromAddrString(addr string) (*net.UDPConn) {
 	nodeUdp, _ := net.ResolveUDPAddr("udp", addr)
 	// Connect to other node
@@ -385,7 +473,7 @@ func (n *NodeCommInterface) SendHeartbeat() {
 		case <-n.HeartAttack:
 			return
 		default:
-			err := n.ServerConn.Call("GServer.Heartbeat", *n.PubKey, &_ignored)
+			err := n.CallServer("GServer.Heartbeat", &_ignored)
 			if err != nil {
 				fmt.Printf("DEBUG - Heartbeat err: [%s]\n", err)
 				n.Config = n.Reregister()
@@ -396,6 +484,17 @@ func (n *NodeCommInterface) SendHeartbeat() {
 	}
 }
 
+// Periodically resynchronises the game clock with the server to correct for drift; should be run in a goroutine
+func (n *NodeCommInterface) RunClockSync() {
+	for {
+		time.Sleep(li.CLOCK_SYNC_INTERVAL)
+		err := n.Clock.Sync(n.ServerConn, n.PrivKey)
+		if err != nil {
+			fmt.Printf("DEBUG - Clock sync err: [%s]\n", err)
+		}
+	}
+}
+
 func (n* NodeCommInterface)Reregister()shared.GameConfig{
 	response, register_failed_err := DialAndRegister(n)
 	for register_failed_err != nil {
@@ -419,15 +518,18 @@ func(n* NodeCommInterface) SendMoveToNodes(move *shared.Coord){
 		Move:        moveId,
 		Addr:        n.LocalAddr.String(),
 		Seq:         sequenceNumber,
+		Tick:        n.Clock.CurrentTick(),
+		VClock:      li.NextVectorTimestamp(n.Log, n.PreyNode.Identifier),
 	}
 	n.RW.Add("prey", sequenceNumber, move)
+	n.Captures.RecordPreyMove(sequenceNumber, message.VClock)
 	toSend := sendMessage(n.Log, message, "Sendin' move")
 	n.MessagesToSend <- &PendingMessage{Recipient: "all", Message: toSend}
 }
 
 func (n *NodeCommInterface) CreateMove(move *shared.Coord) shared.SignedMove {
 	moveBytes, err := json.Marshal(move)
-	r, s, err := ecdsa.Sign(rand.Reader, n.PrivKey, moveBytes)
+	r, s, err := key.Sign(n.PrivKey, moveBytes)
 	if err != nil {
 		fmt.Println("could not sign move")
 		panic(err)
@@ -446,16 +548,22 @@ func (n* NodeCommInterface) SendGameStateToNode(otherNodeId string){
 		Identifier: "prey",
 		GameState: &n.PreyNode.GameState,
 		Addr: n.LocalAddr.String(),
+		PreyEpoch: n.PreyEpoch,
 	}
 
+	// Other goroutines go on changing the gamestate while it's encoded
+	n.PreyNode.GameState.PlayerLocs.RLock()
+	n.PreyNode.GameState.PlayerScores.RLock()
 	toSend := sendMessage(n.Log, message, "Sendin' gamestate")
+	n.PreyNode.GameState.PlayerScores.RUnlock()
+	n.PreyNode.GameState.PlayerLocs.RUnlock()
 	n.MessagesToSend <- &PendingMessage{Recipient: otherNodeId, Message: toSend}
 }
 
 // Helper function to send a json marshaled message to other nodes
-func (n *NodeCommInterface) sendMessageToNodes(toSend []byte) {
-	for id, val := range n.OtherNodes{
-		_, err := val.Write(toSend)
+func (n *NodeCommInterface) sendMessageToNodes(toSend []byte, plain bool) {
+	for id := range n.OtherNodes{
+		err := n.writeToNode(id, toSend, plain)
 		if err != nil{
 			fmt.Println(err)
 			n.NodesWriteConnRefused <- id
@@ -474,11 +582,7 @@ func (n* NodeCommInterface) HandleReceivedGameState(identifier string, gameState
 			n.PreyNode.GameState.PlayerLocs.Data[id] = pos
 		}
 
-		n.PreyNode.GameState.PlayerScores.Lock()
-		defer n.PreyNode.GameState.PlayerScores.Unlock()
-		for id, score := range gameState.PlayerScores.Data {
-			n.PreyNode.GameState.PlayerScores.Data[id] = score
-		}
+		li.MergeScores(&n.PreyNode.GameState.PlayerScores, &gameState.PlayerScores)
 		n.HasGameState = true
 	}
 }
@@ -537,39 +641,97 @@ func (n* NodeCommInterface) HandleReceivedMoveCommit(identifier string, moveComm
 
 // Handles "connect" messages received by other nodes by adding the incoming node to this node's OtherNodes
 func (n* NodeCommInterface) HandleIncomingConnectionRequest(identifier string, addr string, pubKeyString string) {
+	pubKey, err := key.DecodePublicKey(pubKeyString)
+	if err != nil {
+		fmt.Printf("Refusing connection from [%s] with a bad public key: %s\n", identifier, err)
+		return
+	}
+	if n.Config.EncryptTraffic && !n.Registered.Matches(identifier, pubKey, n.fetchNodes) {
+		fmt.Printf("Refusing connection from [%s] with a key the server didn't register\n", identifier)
+		return
+	}
 	node := n.GetClientFromAddrString(addr)
-	pubKey := key.StringToPubKey(pubKeyString)
-	n.NodesToAdd <- &OtherNode{Identifier: identifier, Conn: node, PubKey: &pubKey}
+	n.NodesToAdd <- &OtherNode{Identifier: identifier, Conn: node, PubKey: pubKey}
 }
 
 func (n* NodeCommInterface) HandleCapturedPreyRequest(identifier string, move *shared.Coord, score int, preySeq uint64) (err error) {
-	err = n.CheckGotPrey(*move)
+	// With no sequence number of its own, the capture is named after the prey move it claims
+	return n.HandleCausalCapture(&li.CaptureClaim{Identifier: identifier, Seq: preySeq, PreySeq: preySeq}, move, score)
+}
+
+// Handles a capture claim, ordering it against other claims on the same prey move as the logic nodes do. The prey
+// only respawns for the first capture of a move; a later claim that beats it just takes the points.
+func (n* NodeCommInterface) HandleCausalCapture(claim *li.CaptureClaim, move *shared.Coord, score int) (err error) {
+	err = n.Captures.CheckNotStale(claim)
 	if err != nil {
-		if !n.RW.Match("prey", preySeq, move){
-			return err
-		}
+		return err
+	}
+	if !n.Captures.Beats(claim) {
+		return wolferrors.InvalidPreyCaptureError(claim.Identifier)
+	}
 
+	err = n.CheckPreyWasAt(claim, move)
+	if err != nil {
+		return err
 	}
 	err = n.CheckMoveIsValid(*move)
 	if err != nil {
 		return err
 	}
-	err = n.CheckAndUpdateScore(identifier, score)
+	event := shared.CaptureEvent{Player: claim.Identifier, Worth: n.PreyNode.GameConfig.CatchWorth, View: claim.View,
+		Members: claim.Members, Tick: claim.Tick}
+	err = n.CheckAndUpdateScore(li.CaptureEventId(claim.Identifier, claim.Seq), event, score)
 	if err != nil {
 		return err
 	}
 
+	if displaced := n.Captures.Record(claim); displaced != nil {
+		li.RevokeCaptureEvent(&n.PreyNode.GameState.PlayerScores, li.CaptureEventId(displaced.Identifier, displaced.Seq))
+		return nil
+	}
+
 	// Prey needs to reset if valid capture
 	n.PreyNode.GameState.PlayerLocs.Lock()
-	newPos := n.PreyNode.geo.GetNewPos(n.PreyNode.GameState.PlayerLocs.Data["prey"])
+	n.PreyEpoch++
+	newPos := li.NextPreySpawn(n.Config.PreySeed, n.PreyEpoch, n.PreyNode.GameState.PlayerLocs.Data["prey"],
+		&n.PreyNode.geo)
 	n.PreyNode.GameState.PlayerLocs.Data["prey"] = newPos
 	n.PreyNode.GameState.PlayerLocs.Unlock()
+	n.History.Add("prey", n.Clock.CurrentTick(), newPos)
 
 	n.SendMoveToNodes(&newPos)
 
 	return nil
 }
 
+// Checks the prey was where the capture says, rewinding it up to MaxLagTicks before the capture's tick if needed
+// Returns CaptureTooLateError or InvalidPreyCaptureError if the capture can't stand
+func (n* NodeCommInterface) CheckPreyWasAt(claim *li.CaptureClaim, move *shared.Coord) (err error) {
+	err = n.CheckGotPrey(*move)
+	if err == nil || n.RW.Match("prey", claim.PreySeq, move) {
+		return nil
+	}
+	if claim.Tick == 0 {
+		return err
+	}
+
+	maxLag := n.Config.MaxLagTicks
+	if maxLag == 0 {
+		maxLag = li.DEFAULT_MAX_LAG_TICKS
+	}
+	if claim.Tick+maxLag < n.Clock.CurrentTick() {
+		return wolferrors.CaptureTooLateError(claim.Identifier)
+	}
+	from := uint64(0)
+	if claim.Tick > maxLag {
+		from = claim.Tick - maxLag
+	}
+	if n.History.WasAt("prey", *move, from, claim.Tick) {
+		return nil
+	}
+	return err
+}
+
 func (n* NodeCommInterface) HandleGameStateConnReq(id string) {
 	if n.PreyNode != nil {
 		n.SendGameStateToNode(id)
@@ -582,11 +744,11 @@ func (n* NodeCommInterface) InitiateConnection(nodeClient *net.UDPConn) {
 		Identifier: "prey",
 		GameState: nil,
 		Addr: n.LocalAddr.String(),
-		PubKey: 	 key.PubKeyToString(*n.PubKey),
+		PubKey: 	 key.PubKeyToString(n.PubKey),
 	}
 
 	toSend := sendMessage(n.Log, message, "Initiating connection")
-	n.MessagesToSend <- &PendingMessage{Recipient: "all", Message: toSend}
+	n.MessagesToSend <- &PendingMessage{Recipient: "all", Message: toSend, Plain: true}
 }
 
 // Sends connection message to connections after receiving from server
@@ -608,6 +770,101 @@ func (n *NodeCommInterface) SendACK(identifier string, seq uint64) {
 	toSend := sendMessage(n.Log, message,  "Sendin' Ack")
 	n.MessagesToSend <- &PendingMessage{Recipient: identifier, Message: toSend}
 }
+// Unpacks a datagram from another node, opening it first if it was sealed
+// Returns false if the message should be dropped (see logic/impl/secure.go)
+func (n *NodeCommInterface) openMessage(datagram []byte) (NodeMessage, bool) {
+	if !key.IsSealed(datagram) {
+		message := receiveMessage(n.Log, datagram)
+		if n.Config.EncryptTraffic && message.MessageType != "hello" && message.MessageType != "connect" {
+			return message, false
+		}
+		return message, true
+	}
+	peer, plaintext, err := n.Sessions.Open(datagram)
+	if err != nil {
+		fmt.Println("Dropping datagram:", err)
+		return NodeMessage{}, false
+	}
+	message := receiveMessage(n.Log, plaintext)
+	return message, message.Identifier == peer
+}
+
+// Handles a hello from another node by agreeing a session with it, then answering the hello if it needs an answer
+// and sending the messages that were waiting for the session
+func (n *NodeCommInterface) HandleHello(identifier string, hello *shared.SessionHello) {
+	if !n.Config.EncryptTraffic {
+		return
+	}
+	pubKey, err := n.Registered.Lookup(identifier, n.fetchNodes)
+	if err != nil {
+		fmt.Printf("Ignoring hello from [%s]: %s\n", identifier, err)
+		return
+	}
+	reply, queued, err := n.Sessions.HandleHello(identifier, pubKey, hello)
+	if err != nil {
+		fmt.Printf("Ignoring hello from [%s]: %s\n", identifier, err)
+		return
+	}
+	if reply != nil {
+		n.MessagesToSend <- &PendingMessage{Recipient: identifier, Message: n.helloMessage(reply), Plain: true}
+	}
+	for _, sealed := range queued {
+		n.MessagesToSend <- &PendingMessage{Recipient: identifier, Message: sealed, Plain: true}
+	}
+}
+
+// Resends the hellos other nodes haven't answered; should be run in a goroutine. Does nothing in games with
+// unencrypted traffic.
+func (n *NodeCommInterface) RunSessionUpkeep() {
+	if !n.Config.EncryptTraffic {
+		return
+	}
+	for {
+		time.Sleep(key.HELLO_RETRY)
+		for id, hello := range n.Sessions.Unanswered() {
+			n.MessagesToSend <- &PendingMessage{Recipient: id, Message: n.helloMessage(hello), Plain: true}
+		}
+	}
+}
+
+// Returns a hello, packed as a message to send
+func (n *NodeCommInterface) helloMessage(hello *shared.SessionHello) ([]byte) {
+	message := NodeMessage{
+		MessageType: "hello",
+		Identifier:  "prey",
+		Addr:        n.LocalAddr.String(),
+		Hello:       hello,
+	}
+	return sendMessage(n.Log, message, "Sendin' hello")
+}
+
+// Helper function to send a message to a single node, sealing it first if traffic is encrypted and it isn't plain;
+// with no session agreed with the node yet, the message is sent once there is one
+func (n *NodeCommInterface) writeToNode(id string, toSend []byte, plain bool) (err error) {
+	if n.Config.EncryptTraffic && !plain {
+		sealed, hello, err := n.Sessions.Seal(id, toSend)
+		if err != nil {
+			return err
+		}
+		if hello != nil {
+			_, err = n.OtherNodes[id].Write(n.helloMessage(hello))
+			if err != nil {
+				return err
+			}
+		}
+		if sealed == nil {
+			return nil
+		}
+		toSend = sealed
+	}
+	if len(toSend) > li.MAX_DATAGRAM_SIZE {
+		fmt.Printf("Not sending %d bytes to %s: too big for a datagram\n", len(toSend), id)
+		return nil
+	}
+	_, err = n.OtherNodes[id].Write(toSend)
+	return err
+}
+
 ////////////////////////////////////////////// MOVE COMMIT HASH FUNCTIONS //////////////////////////////////////////////
 
 // Calculate the hash of the coordinates which will be sent at the move commitment stage
@@ -628,7 +885,7 @@ func (n *NodeCommInterface) CalculateHash(m shared.Coord, id string) ([]byte) {
 
 // Sign the move commit with private key
 func (n *NodeCommInterface) SignMoveCommit(hash []byte) (r *big.Int, s *big.Int, err error) {
-	return ecdsa.Sign(rand.Reader, n.PrivKey, hash)
+	return key.Sign(n.PrivKey, hash)
 }
 
 // Checks to see if the hash is legit
@@ -641,10 +898,10 @@ func (n *NodeCommInterface) CheckAuthenticityOfMoveCommit(identifier string, m *
 	if err != nil {
 		fmt.Println("Trouble converting string to big int")
 	}
-	return ecdsa.Verify(n.NodeKeys[identifier], m.MoveHash, rBigInt, sBigInt)
+	return key.Verify(n.NodeKeys[identifier], m.MoveHash, rBigInt, sBigInt)
 }
 
-func (n *NodeCommInterface) CheckAuthenticityOfMove(publicKey *ecdsa.PublicKey, m *shared.SignedMove)(bool){
+func (n *NodeCommInterface) CheckAuthenticityOfMove(publicKey crypto.PublicKey, m *shared.SignedMove)(bool){
 	if publicKey == nil{
 		// public key is nil for some tests, just pass if this is the case
 		return true
@@ -658,7 +915,7 @@ func (n *NodeCommInterface) CheckAuthenticityOfMove(publicKey *ecdsa.PublicKey,
 		fmt.Println("Trouble converting string to big int")
 	}
 
-	return ecdsa.Verify(publicKey, m.MoveByte, rBigInt, sBigInt)
+	return key.Verify(publicKey, m.MoveByte, rBigInt, sBigInt)
 }
 ////////////////////////////////////////////// MOVE CHECK FUNCTIONS ////////////////////////////////////////////////////
 
@@ -693,22 +950,24 @@ func (n *NodeCommInterface) CheckGotPrey(move shared.Coord) (err error) {
 	return wolferrors.InvalidPreyCaptureError("[" + string(move.X) + ", " + string(move.Y) + "]")
 }
 
-func (n *NodeCommInterface) CheckAndUpdateScore(identifier string, score int) (err error) {
-	_, exists := n.PreyNode.GameState.PlayerScores.Data[identifier]
-	playerScore := n.PreyNode.GameState.PlayerScores.Data[identifier]
-
-	if !exists && score == n.PreyNode.GameConfig.CatchWorth {
-		n.PreyNode.GameState.PlayerScores.Lock()
-		defer n.PreyNode.GameState.PlayerScores.Unlock()
-		n.PreyNode.GameState.PlayerScores.Data[identifier] = score
+// Checks the score a node sent with a capture is the one we hold for it plus the capture's worth (if the partition
+// policy counts it), and if so counts the capture event. A capture event we've already counted is let through unchanged.
+// Returns InvalidScoreUpdateError if the scores don't agree
+func (n *NodeCommInterface) CheckAndUpdateScore(eventId string, event shared.CaptureEvent, score int) (err error) {
+	scores := &n.PreyNode.GameState.PlayerScores
+	if li.HasCaptureEvent(scores, eventId) {
 		return nil
 	}
 
-	if exists && score != playerScore + n.PreyNode.GameConfig.CatchWorth {
+	scores.RLock()
+	expected := scores.Data[event.Player]
+	scores.RUnlock()
+	if li.CountsTowardScore(scores.Policy, event) {
+		expected += event.Worth
+	}
+	if score != expected {
 		return wolferrors.InvalidScoreUpdateError(string(score))
 	}
-	n.PreyNode.GameState.PlayerScores.Lock()
-	defer n.PreyNode.GameState.PlayerScores.Unlock()
-	n.PreyNode.GameState.PlayerScores.Data[identifier] += n.PreyNode.GameConfig.CatchWorth
+	li.AddCaptureEvent(scores, eventId, event)
 	return nil
 }
\ No newline at end of file
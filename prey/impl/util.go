@@ -2,31 +2,16 @@ package impl
 
 import (
 	"net"
-	"log"
+	li "../../logic/impl"
 )
 
-// Starts a UDP listener over the given address string, returns the address and the connection
-func StartListenerUDP(ip_addr string) (*net.UDPAddr, *net.UDPConn) {
-	// takes an ip address and port to listen on
-	// returns the udp address and listener client
-	// starts Listener
-	udp_addr, _ := net.ResolveUDPAddr("udp", ip_addr)
-	client, err := net.ListenUDP("udp", udp_addr)
-	local_udp := client.LocalAddr().(*net.UDPAddr)
-	local_udp.IP = GetOutboundIP()
-	if err != nil {
-		panic(err)
-	}
-	return local_udp, client
+// Starts a UDP listener over the given address string, returns the address to advertise and the connection, or an
+// error if it can't listen there. The advertise address and loopback mode come from the environment, as for logic
+// nodes (see li.DefaultListenConfig).
+func StartListenerUDP(ip_addr string) (*net.UDPAddr, *net.UDPConn, error) {
+	return li.StartListenerUDP(ip_addr)
 }
 
 func GetOutboundIP() net.IP {
-	// https://stackoverflow.com/questions/23558425/how-do-i-get-the-local-ip-address-in-go
-	conn, err := net.Dial("udp", "8.8.8.8:80")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer conn.Close()
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	return localAddr.IP
-}
\ No newline at end of file
+	return li.GetOutboundIP()
+}
@@ -9,6 +9,7 @@ import (
 	"../key-helpers"
 )
 
+// Usage: go run prey.go [other-node-listener-addr] [pixel-listener-addr] [server-addr]; see also "wolfpack prey"
 func main() {
 	fmt.Println("I AM IN PREY MAIN FUNCTION")
 
@@ -0,0 +1,152 @@
+package impl
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"../../shared"
+)
+
+// A relay forwards messages between nodes that can't reach each other directly. Each node using the relay sends it a
+// "register" envelope every RELAY_KEEPALIVE, so the relay knows the address to reach it at, as seen from outside any
+// NAT it is behind. "forward" envelopes have their payload sent on to the node they name, or to every registered node
+// but the sender; the payload arrives exactly as if the sender had sent it directly.
+// A registration only counts if it proves the node holds the token the server issued it for this relay (see
+// shared.RelayToken and shared.RelayRegisterProof), and is later than the node's last registration, so one seen on the
+// wire can't be sent again from another address to take over the node's traffic. Envelopes to forward are only taken
+// from the address their sender registered from, so the relay can't be used to send to addresses of anyone's choosing.
+
+// How often nodes re-register with the relay
+const RELAY_KEEPALIVE = 5 * time.Second
+
+// How long the relay keeps forwarding to a node it hasn't heard from
+const RELAY_PEER_TIMEOUT = 4 * RELAY_KEEPALIVE
+
+// The largest envelope the relay will read
+const MAX_ENVELOPE_SIZE = 65507
+
+// A node the relay forwards to
+type relayPeer struct {
+	addr     *net.UDPAddr
+	lastSeen time.Time
+}
+
+type Relay struct {
+	sync.Mutex
+
+	// The connection the relay listens and forwards on
+	conn  *net.UDPConn
+
+	// The nodes registered with the relay, by identifier
+	peers map[string]*relayPeer
+
+	// The time of each node's last registration, by identifier; kept after the node times out, so its old
+	// registrations can't be used again
+	registered map[string]int64
+
+	// The secret the server gave the relay when it registered; until it is set, no node can register
+	secret []byte
+}
+
+// Creates a relay listening on the given UDP address
+// Returns an error if it can't listen there
+func CreateRelay(addr string) (*Relay, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetReadBuffer(1048576)
+	return &Relay{conn: conn, peers: make(map[string]*relayPeer), registered: make(map[string]int64)}, nil
+}
+
+// Returns the address the relay is listening on
+func (r *Relay) Addr() (net.Addr) {
+	return r.conn.LocalAddr()
+}
+
+// Reads and forwards envelopes until the relay is closed; should be run in a goroutine
+func (r *Relay) Run() {
+	buf := make([]byte, MAX_ENVELOPE_SIZE)
+	for {
+		n, from, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			fmt.Println("Relay stopped:", err)
+			return
+		}
+		var envelope shared.RelayEnvelope
+		err = json.Unmarshal(buf[:n], &envelope)
+		if err != nil {
+			fmt.Println("Relay could not unmarshal envelope:", err)
+			continue
+		}
+		r.handle(&envelope, from)
+	}
+}
+
+// Stops the relay
+func (r *Relay) Close() {
+	r.conn.Close()
+}
+
+// Sets the secret the server gave the relay, which nodes' tokens are checked with
+func (r *Relay) SetSecret(secret []byte) {
+	r.Lock()
+	defer r.Unlock()
+	r.secret = secret
+}
+
+// Registers or forwards a received envelope
+func (r *Relay) handle(envelope *shared.RelayEnvelope, from *net.UDPAddr) {
+	r.Lock()
+	defer r.Unlock()
+	if envelope.Type == "register" {
+		if r.secret == nil || !hmac.Equal([]byte(envelope.Proof),
+			[]byte(shared.RelayRegisterProof(shared.RelayToken(r.secret, envelope.From), envelope.From, envelope.Time))) {
+			fmt.Printf("DEBUG - Relay dropped registration from [%s] with a bad token\n", from)
+			return
+		}
+		if envelope.Time <= r.registered[envelope.From] {
+			fmt.Printf("DEBUG - Relay dropped a replayed registration for %s from [%s]\n", envelope.From, from)
+			return
+		}
+		r.registered[envelope.From] = envelope.Time
+		r.peers[envelope.From] = &relayPeer{addr: from, lastSeen: time.Now()}
+		return
+	}
+
+	if envelope.Type != "forward" {
+		return
+	}
+	sender, ok := r.peers[envelope.From]
+	if !ok || sender.addr.String() != from.String() {
+		return
+	}
+	sender.lastSeen = time.Now()
+	for id, peer := range r.peers {
+		if time.Since(peer.lastSeen) > RELAY_PEER_TIMEOUT {
+			delete(r.peers, id)
+			continue
+		}
+		if id == envelope.From || (envelope.To != "all" && envelope.To != id) {
+			continue
+		}
+		_, err := r.conn.WriteToUDP(envelope.Payload, peer.addr)
+		if err != nil {
+			fmt.Printf("Relay could not forward to %s: %s\n", id, err)
+		}
+	}
+}
+
+// Returns the number of nodes currently registered with the relay
+func (r *Relay) PeerCount() (int) {
+	r.Lock()
+	defer r.Unlock()
+	return len(r.peers)
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	relayImpl "./impl"
+	li "../logic/impl"
+	key "../key-helpers"
+	"../shared"
+)
+
+// Runs a standalone relay for a game, forwarding messages between nodes that can't reach each other directly
+// Usage: go run relay.go [listen-addr] [public-addr] [server-addr] [key-file]
+// The public address is the one nodes should send to; it defaults to the listen address
+// The key file holds the relay's private key, unencrypted; the server must be started with its public key
+// (wolfpack server --relay-key-file) to let the relay register
+// If WOLFPACK_SERVER_CA is set, the server is dialed over TLS
+func main() {
+	listenAddr := ":9090"
+	serverAddr := ":8081"
+	if len(os.Args) > 1 {
+		listenAddr = os.Args[1]
+	}
+	publicAddr := listenAddr
+	keyFile := "relay.key"
+	if len(os.Args) > 4 {
+		keyFile = os.Args[4]
+	}
+	if len(os.Args) > 3 {
+		publicAddr = os.Args[2]
+		serverAddr = os.Args[3]
+	} else if len(os.Args) > 2 {
+		publicAddr = os.Args[2]
+	}
+
+	privKey, err := key.LoadKeyFile(keyFile, "")
+	if err != nil {
+		fmt.Println("Could not load relay key:", err)
+		os.Exit(1)
+	}
+
+	relay, err := relayImpl.CreateRelay(listenAddr)
+	if err != nil {
+		fmt.Println("Could not start relay:", err)
+		os.Exit(1)
+	}
+
+	// Tell the server about us, so it can hand our address out to the nodes in the game
+	serverConn, err := li.DialServer(serverAddr)
+	if err != nil {
+		fmt.Println("Cannot dial server. Please ensure the server is running and try again.")
+		os.Exit(1)
+	}
+	auth, err := li.SignServerCall(serverConn, privKey, "GServer.RegisterRelay")
+	var secret []byte
+	if err == nil {
+		err = serverConn.Call("GServer.RegisterRelay", shared.RelayRegistration{Addr: publicAddr, Auth: auth}, &secret)
+	}
+	if err != nil {
+		fmt.Println("Could not register relay with server:", err)
+		os.Exit(1)
+	}
+	relay.SetSecret(secret)
+
+	fmt.Println("Relay running on", relay.Addr())
+	relay.Run()
+}
@@ -0,0 +1,311 @@
+package impl
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"github.com/faiface/pixel"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+	"../../geometry"
+	"../../shared"
+)
+
+// Draws game states into images, laid out as the pixel client draws them in its window (see pixel/impl/pixel-node.go),
+// with no window or GPU needed; for match highlights, bug reports and checking the layout in tests.
+//
+// Text is drawn in basicfont.Face7x13 from golang.org/x/image, the face the pixel client draws its scoreboard in, so
+// frames read as they do in the client. It is no new dependency: setup.sh already fetches golang.org/x/image for the
+// pixel client, and the font package is pure Go, so the renderer still builds without cgo or OpenGL.
+
+// Sprite size
+const spriteStep = 30
+
+// The sprites the renderer loads from its sprite directory, as the pixel client does
+const (
+	PLAYER_SPRITE       = "wolf.jpg"
+	OTHER_PLAYER_SPRITE = "other-player.jpg"
+	PREY_SPRITE         = "prey.jpg"
+	WALL_SPRITE         = "wall.jpg"
+)
+
+// The metrics of basicfont.Face7x13, which scoreboard text is drawn in
+const (
+	textAscent     = 11
+	textLineHeight = 13
+)
+
+// How long each frame of a GIF is shown, in hundredths of a second
+const DEFAULT_GIF_DELAY = 20
+
+// The colour behind the board, and behind the scoreboard
+var BackgroundColour = color.RGBA{0x2d, 0x2d, 0x2d, 0xff}
+var ScoreboardColour = color.RGBA{0, 0, 0, 0xff}
+
+// The colours of the mini-map, as the pixel client draws it
+var (
+	MinimapBackground = color.RGBA{0x2e, 0x2e, 0x2e, 0xff}
+	MinimapWall       = color.RGBA{0x80, 0x80, 0x80, 0xff}
+	MinimapPrey       = color.RGBA{0xff, 0x80, 0, 0xff}
+	MinimapWolf       = color.RGBA{0x99, 0x99, 0xff, 0xff}
+	MinimapPlayer     = color.RGBA{0xff, 0xff, 0, 0xff}
+	MinimapView       = color.RGBA{0xff, 0xff, 0xff, 0xff}
+)
+
+// A match to render: the settings the logic node sent, and the states it sent after them, in order
+type Match struct {
+	Settings shared.InitialGameSettings
+	States   []shared.GameRenderState
+}
+
+type Renderer struct {
+	// The PixelManager used to convert coordinates to positions on the board
+	Geom              geometry.PixelManager
+
+	// The walls, for the mini-map
+	walls             []shared.Coord
+
+	// The sprites for the player, the other players, the prey and the walls
+	PlayerSprite      image.Image
+	OtherPlayerSprite image.Image
+	PreySprite        image.Image
+	WallSprite        image.Image
+}
+
+// Creates a renderer for a game with the given settings, loading sprites from spriteDir
+// Returns an error if a sprite can't be loaded
+func CreateRenderer(settings shared.InitialGameSettings, spriteDir string) (*Renderer, error) {
+	r := &Renderer{Geom: geometry.CreateScrollingPixelManager(settings, spriteStep), walls: settings.WallCoordinates}
+	for _, sprite := range []struct {
+		file string
+		into *image.Image
+	}{
+		{PLAYER_SPRITE, &r.PlayerSprite},
+		{OTHER_PLAYER_SPRITE, &r.OtherPlayerSprite},
+		{PREY_SPRITE, &r.PreySprite},
+		{WALL_SPRITE, &r.WallSprite},
+	} {
+		img, err := LoadImage(filepath.Join(spriteDir, sprite.file))
+		if err != nil {
+			return nil, err
+		}
+		*sprite.into = img
+	}
+	return r, nil
+}
+
+// Draws a game state
+func (r *Renderer) RenderFrame(state shared.GameRenderState) (*image.RGBA) {
+	width := int(r.Geom.GetX() + r.Geom.GetScoreboardWidth())
+	height := int(r.Geom.GetY())
+	frame := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(frame, frame.Bounds(), &image.Uniform{BackgroundColour}, image.ZP, draw.Src)
+
+	// Point the camera at this player, or for a spectator, the prey, as the pixel client does
+	if state.Spectator {
+		r.Geom.CenterOn(r.Geom.GetMapVectorFromCoords(state.Prey))
+	} else {
+		r.Geom.CenterOn(r.Geom.GetMapVectorFromCoords(state.PlayerLoc))
+	}
+
+	// Walls first, then the prey, the other players and this player on top, as the pixel client does
+	for _, wall := range r.Geom.GetWallVectors() {
+		r.drawSprite(frame, r.WallSprite, wall)
+	}
+	r.drawSprite(frame, r.PreySprite, r.Geom.GetVectorFromCoords(state.Prey))
+	for _, player := range state.OtherPlayers {
+		r.drawSprite(frame, r.OtherPlayerSprite, r.Geom.GetVectorFromCoords(player))
+	}
+	// A spectator's state has no player of its own
+	if !state.Spectator {
+		r.drawSprite(frame, r.PlayerSprite, r.Geom.GetVectorFromCoords(state.PlayerLoc))
+	}
+
+	r.drawScore(frame, state)
+	if r.Geom.Scrolls() {
+		r.drawMinimap(frame, state)
+	}
+	return frame
+}
+
+// Draws every state to a PNG in dir, named frame-00000.png onwards
+// Returns an error if a file can't be written
+func (r *Renderer) WritePNGs(states []shared.GameRenderState, dir string) (error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+	for i, state := range states {
+		file, err := os.Create(filepath.Join(dir, fmt.Sprintf("frame-%05d.png", i)))
+		if err != nil {
+			return err
+		}
+		err = png.Encode(file, r.RenderFrame(state))
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Draws every state as a frame of an animated GIF, each shown for delay hundredths of a second, looping forever
+func (r *Renderer) WriteGIF(states []shared.GameRenderState, out io.Writer, delay int) (error) {
+	animation := gif.GIF{}
+	for _, state := range states {
+		frame := r.RenderFrame(state)
+		paletted := image.NewPaletted(frame.Bounds(), palette.Plan9)
+		draw.Draw(paletted, frame.Bounds(), frame, image.ZP, draw.Src)
+		animation.Image = append(animation.Image, paletted)
+		animation.Delay = append(animation.Delay, delay)
+	}
+	return gif.EncodeAll(out, &animation)
+}
+
+// Helper function to draw a sprite centred on a position on the board, given as the pixel client would place it (from
+// the bottom left)
+func (r *Renderer) drawSprite(frame *image.RGBA, sprite image.Image, at pixel.Vec) {
+	size := sprite.Bounds().Size()
+	x := int(at.X) - size.X/2
+	y := int(r.Geom.GetY() - at.Y) - size.Y/2
+	draw.Draw(frame, image.Rect(x, y, x+size.X, y+size.Y), sprite, sprite.Bounds().Min, draw.Over)
+}
+
+// Helper function to draw the scoreboard, as the pixel client's DrawScore does
+func (r *Renderer) drawScore(frame *image.RGBA, state shared.GameRenderState) {
+	boardX := int(r.Geom.GetX())
+	boardY := int(r.Geom.GetY())
+	draw.Draw(frame, image.Rect(boardX, 0, frame.Bounds().Max.X, boardY), &image.Uniform{ScoreboardColour},
+		image.ZP, draw.Src)
+
+	const textHeight = 10
+	const titleMultiplier = 3
+	const scoreMultiplier = 1.5
+	const padding = 10
+
+	// Positions are measured up from the bottom, as in pixel
+	drawText(frame, boardX + padding*4, textHeight * titleMultiplier, "SCORES", titleMultiplier)
+	drawText(frame, boardX + padding, (titleMultiplier + 2) * textHeight, shared.SortScores(state.Scores), 1)
+	if state.Spectator {
+		return
+	}
+	drawText(frame, boardX + padding, boardY - int(textHeight * scoreMultiplier),
+		fmt.Sprintf("SCORE: %10d", state.Scores["ME"]), scoreMultiplier)
+	if held := state.HeldScores["ME"]; held > 0 {
+		drawText(frame, boardX + padding, boardY - int(textHeight * scoreMultiplier * 3),
+			fmt.Sprintf("HELD: %11d", held), 1)
+	}
+}
+
+// Helper function to draw the whole map small in the scoreboard column, as the pixel client's DrawMinimap does
+func (r *Renderer) drawMinimap(frame *image.RGBA, state shared.GameRenderState) {
+	corner, cell := r.Geom.GetMinimap()
+	mapX, mapY := r.Geom.GetMapSize()
+	scale := cell / r.Geom.GetSpriteSize()
+	r.fillRect(frame, corner.X, corner.Y, mapX * scale, mapY * scale, MinimapBackground)
+	for _, wall := range r.walls {
+		r.fillMinimapCell(frame, corner, cell, wall, MinimapWall)
+	}
+	for _, player := range state.OtherPlayers {
+		r.fillMinimapCell(frame, corner, cell, player, MinimapWolf)
+	}
+	r.fillMinimapCell(frame, corner, cell, state.Prey, MinimapPrey)
+	if !state.Spectator {
+		r.fillMinimapCell(frame, corner, cell, state.PlayerLoc, MinimapPlayer)
+	}
+
+	// Outline the part of the map on the board
+	camera := r.Geom.GetCamera()
+	x, y := corner.X + camera.X * scale, corner.Y + camera.Y * scale
+	width, height := r.Geom.GetX() * scale, r.Geom.GetY() * scale
+	r.fillRect(frame, x, y, width, 1, MinimapView)
+	r.fillRect(frame, x, y + height - 1, width, 1, MinimapView)
+	r.fillRect(frame, x, y, 1, height, MinimapView)
+	r.fillRect(frame, x + width - 1, y, 1, height, MinimapView)
+}
+
+// Helper function to fill a grid cell on the mini-map, at least 2 pixels square so it can be seen
+func (r *Renderer) fillMinimapCell(frame *image.RGBA, corner pixel.Vec, cell float64, coord shared.Coord,
+	colour color.Color) {
+	size := cell
+	if size < 2 {
+		size = 2
+	}
+	r.fillRect(frame, corner.X + float64(coord.X) * cell, corner.Y + float64(coord.Y) * cell, size, size, colour)
+}
+
+// Helper function to fill a rectangle given as in pixel, by its bottom left corner measured up from the bottom
+func (r *Renderer) fillRect(frame *image.RGBA, x float64, y float64, width float64, height float64,
+	colour color.Color) {
+	top := int(r.Geom.GetY() - y - height)
+	rect := image.Rect(int(x), top, int(x + width), int(r.Geom.GetY() - y))
+	draw.Draw(frame, rect, &image.Uniform{colour}, image.ZP, draw.Src)
+}
+
+// Helper function to draw white text, scaled up from its first baseline, which is fromTop pixels below the top
+func drawText(frame *image.RGBA, x int, fromTop int, text string, scale float64) {
+	lines := strings.Split(text, "\n")
+	longest := 0
+	for _, line := range lines {
+		if len(line) > longest {
+			longest = len(line)
+		}
+	}
+	if longest == 0 {
+		return
+	}
+
+	// Draw the text at its own size, then copy it over scaled
+	plain := image.NewAlpha(image.Rect(0, 0, longest * 7 + 1, len(lines) * textLineHeight))
+	drawer := font.Drawer{Dst: plain, Src: image.Opaque, Face: basicfont.Face7x13}
+	for i, line := range lines {
+		drawer.Dot = fixed.P(0, textAscent + i * textLineHeight)
+		drawer.DrawString(line)
+	}
+	top := float64(fromTop) - textAscent * scale
+	bounds := plain.Bounds()
+	for py := 0; py < bounds.Max.Y; py++ {
+		for px := 0; px < bounds.Max.X; px++ {
+			if plain.AlphaAt(px, py).A == 0 {
+				continue
+			}
+			block := image.Rect(x + int(float64(px) * scale), int(top + float64(py) * scale),
+				x + int(float64(px + 1) * scale), int(top + float64(py + 1) * scale))
+			draw.Draw(frame, block, image.White, image.ZP, draw.Src)
+		}
+	}
+}
+
+// Helper function to load an image
+func LoadImage(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// Reads a match from a JSON file
+func ReadMatch(path string) (Match, error) {
+	var match Match
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return match, err
+	}
+	err = json.Unmarshal(data, &match)
+	return match, err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"./impl"
+)
+
+// Renders a match to an animated GIF, or to a directory of PNG frames, with no display needed
+// Usage: go run renderer.go <match.json> <out.gif|out-dir> [sprite-dir]
+// The match file holds the game's settings and the states to draw (see impl.Match)
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Println("Usage: go run renderer.go <match.json> <out.gif|out-dir> [sprite-dir]")
+		os.Exit(2)
+	}
+	spriteDir := "../sprites"
+	if len(os.Args) > 3 {
+		spriteDir = os.Args[3]
+	}
+	err := render(os.Args[1], os.Args[2], spriteDir)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func render(matchFile string, out string, spriteDir string) (error) {
+	match, err := impl.ReadMatch(matchFile)
+	if err != nil {
+		return err
+	}
+	r, err := impl.CreateRenderer(match.Settings, spriteDir)
+	if err != nil {
+		return err
+	}
+	if !strings.HasSuffix(out, ".gif") {
+		return r.WritePNGs(match.States, out)
+	}
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return r.WriteGIF(match.States, file, impl.DEFAULT_GIF_DELAY)
+}
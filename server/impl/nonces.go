@@ -0,0 +1,88 @@
+package impl
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"time"
+	"../../shared"
+	keys "../../key-helpers"
+	"../../wolferrors"
+)
+
+// Every call that names a node's key must prove the caller holds it: the node asks for a nonce with GServer.Nonce,
+// then signs it, with the method it is calling, in the call's RPCAuth. Each nonce can be used once, within NONCE_TTL
+// of being handed out, so a signed call can't be replayed, by someone watching the connection or anyone else.
+
+// How long a nonce can be used for after it is handed out
+const NONCE_TTL = 30 * time.Second
+
+// The most nonces handed out and not yet used or expired; past this, no more are handed out until some are
+const MAX_NONCES = 10000
+
+type NonceStore struct {
+	sync.Mutex
+	// The unused nonces, and when they expire
+	issued map[string]time.Time
+}
+
+var nonces = NonceStore{issued: make(map[string]time.Time)}
+
+// Hands out a new nonce
+// Returns an error if too many are outstanding
+func (ns *NonceStore) Issue() (string, error) {
+	ns.Lock()
+	defer ns.Unlock()
+	now := time.Now()
+	if len(ns.issued) >= MAX_NONCES {
+		for nonce, expires := range ns.issued {
+			if now.After(expires) {
+				delete(ns.issued, nonce)
+			}
+		}
+		if len(ns.issued) >= MAX_NONCES {
+			return "", wolferrors.UnauthenticatedError("too many nonces outstanding")
+		}
+	}
+	raw := make([]byte, 16)
+	_, err := rand.Read(raw)
+	if err != nil {
+		return "", err
+	}
+	nonce := hex.EncodeToString(raw)
+	ns.issued[nonce] = now.Add(NONCE_TTL)
+	return nonce, nil
+}
+
+// Uses up a nonce
+// Returns false if it wasn't handed out, has been used, or has expired
+func (ns *NonceStore) Use(nonce string) (bool) {
+	ns.Lock()
+	defer ns.Unlock()
+	expires, ok := ns.issued[nonce]
+	delete(ns.issued, nonce)
+	return ok && time.Now().Before(expires)
+}
+
+// Hands out a nonce for the next signed call
+func (foo *GServer) Nonce(_ignored bool, nonce *string) error {
+	issued, err := nonces.Issue()
+	if err != nil {
+		return err
+	}
+	*nonce = issued
+	return nil
+}
+
+// Checks that a call to the given method was signed, over an unused nonce, by the key it names
+// Returns the key in its canonical encoding, or an error if the call isn't authentic
+func authenticate(auth shared.RPCAuth, method string) (string, error) {
+	if !nonces.Use(auth.Nonce) {
+		return "", wolferrors.UnauthenticatedError(method)
+	}
+	publicKey, err := keys.VerifyRPC(auth, method)
+	if err != nil {
+		return "", err
+	}
+	return keys.EncodePublicKey(publicKey)
+}
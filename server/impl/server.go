@@ -0,0 +1,519 @@
+package impl
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"net/rpc"
+	"net"
+	"../../shared"
+	"sync"
+	"../../wolferrors"
+	"time"
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"crypto/elliptic"
+	"strconv"
+	keys "../../key-helpers"
+)
+
+// The global server: registers nodes, hands out the game config and tells nodes about each other
+// Prey mode "replicated" starts a game with no prey node, where every logic node simulates the prey itself
+// Relay mode "node" has the first logic node to join run a relay for the game, unless a standalone relay registers
+
+// How the server is started
+type ServerConfig struct {
+	// The TCP address to listen for RPCs on, e.g. ":8081"
+	Addr      string
+
+	// The map to play on ("0", "1" or "2"); see getSettingsByConfigString
+	Map       string
+
+	// "replicated" for a game with no prey node; anything else expects one to join
+	PreyMode  string
+
+	// "node" to have a logic node run the game's relay; anything else waits for a standalone relay
+	RelayMode string
+
+	// If true, nodes in the game encrypt all their traffic to each other
+	EncryptTraffic bool
+
+	// The certificate and key files to serve RPCs over TLS with; if empty, RPCs are served without TLS
+	TLSCert   string
+	TLSKey    string
+
+	// The public key file of the standalone relay allowed to register; if empty, only a node the server picked can
+	RelayKeyFile string
+
+	// Wolves further apart than this many cells only hear each other's positions now and then; 0 (the default) sends
+	// every move to every node
+	InterestRadius int
+}
+
+type GServer struct {
+	SelectConfig string
+}
+
+type Player struct {
+	Address net.Addr
+	RecentHB int64
+	Identifier string
+	// Nodes only hear about the other nodes in their room
+	Room string
+}
+
+type AllPlayers struct {
+	sync.RWMutex
+	all map[string]*Player
+}
+
+var (
+	heartBeat = uint32(5000)
+	ping = uint32(3)
+	tickMs = uint32(50)
+	historyTicks = uint64(200)
+	maxLagTicks = uint64(10)
+	digestMs = uint32(1000)
+	// Only captures made on the majority side of a network partition count; see logic/impl/partition.go
+	partitionPolicy = "majority"
+	// Wolves further apart than this many cells only hear each other's positions every summaryMs; 0 turns this off
+	interestRadius = 0
+	summaryMs = uint32(1000)
+	id = 0
+	allPlayers = AllPlayers{all: make(map[string]*Player)}
+	// Every node in this game seeds the prey's moves with this, so they all see the prey do the same thing
+	preySeed = time.Now().UnixNano()
+	replicatedPrey = false
+	// Whether nodes agree session keys and encrypt their traffic to each other; see key-helpers/session.go
+	encryptTraffic = false
+	// The relay for this game, if one has registered; with relay mode "node", the server picks a node to run it
+	relay = GameRelay{}
+	// The identifier each public key was given, so a player rejoining with the same key gets the same identifier back,
+	// and with it their scores
+	identities = make(map[string]string)
+)
+
+type GameRelay struct {
+	sync.Mutex
+	addr string
+	mode string
+	assigned bool
+	// The key of the node picked to run the relay, if one has been
+	assignedKey string
+	// The key of the standalone relay, if one was configured
+	standaloneKey string
+	// The secret the registered relay checks nodes' tokens with (see shared.RelayToken)
+	secret []byte
+}
+
+// Runs the server as configured; only returns if the config is bad or it can't listen
+func RunServer(config ServerConfig) error {
+	// Nodes simulating the prey each need every wolf's moves to agree on its captures
+	if config.InterestRadius > 0 && config.PreyMode == "replicated" {
+		err := wolferrors.BadConfigError("an interest radius needs a prey node; it can't be used with replicated prey")
+		fmt.Println("Server:", err)
+		return err
+	}
+	replicatedPrey = config.PreyMode == "replicated"
+	relay.mode = config.RelayMode
+	interestRadius = config.InterestRadius
+	if config.RelayKeyFile != "" {
+		data, err := ioutil.ReadFile(config.RelayKeyFile)
+		if err == nil {
+			relay.standaloneKey, err = canonicalKey(string(data))
+		}
+		if err != nil {
+			fmt.Println("Server: could not load the relay key:", err)
+			return err
+		}
+	}
+	if config.TLSCert != "" {
+		fmt.Println("Server: serving RPCs over TLS")
+	}
+	encryptTraffic = config.EncryptTraffic
+
+	gob.Register(&net.UDPAddr{})
+	gob.Register(&elliptic.CurveParams{})
+	gob.Register(&shared.PlayerInfo{})
+
+	gserver := new(GServer)
+	gserver.SelectConfig = config.Map
+
+	server := rpc.NewServer()
+	server.Register(gserver)
+
+	var l net.Listener
+	var err error
+	if config.TLSCert != "" {
+		tlsConfig, tlsErr := keys.ServerTLSConfig(config.TLSCert, config.TLSKey)
+		if tlsErr != nil {
+			fmt.Println("Server: could not load the TLS certificate:", tlsErr)
+			return tlsErr
+		}
+		l, err = tls.Listen("tcp", config.Addr, tlsConfig)
+	} else {
+		l, err = net.Listen("tcp", config.Addr)
+	}
+	if err != nil {
+		fmt.Printf("Server: error listening for incoming connections on port [%s]. Ensure there is not another" +
+			" server already running", config.Addr)
+		return err
+	}
+	defer l.Close()
+
+	for {
+		conn, _ := l.Accept()
+		go server.ServeConn(conn)
+	}
+}
+
+func monitor(pubKeyStr string, heartBeatInterval time.Duration) {
+	for {
+		allPlayers.Lock()
+		if time.Now().UnixNano() - allPlayers.all[pubKeyStr].RecentHB > int64(heartBeatInterval) {
+			fmt.Printf("Disconnected and deleted: %s\n", allPlayers.all[pubKeyStr].Address.String())
+			delete(allPlayers.all, pubKeyStr)
+			allPlayers.Unlock()
+			return
+		}
+		allPlayers.Unlock()
+		time.Sleep(heartBeatInterval)
+	}
+}
+
+func (foo *GServer) Register(p shared.PlayerInfo, response *shared.GameConfig) error {
+	id++
+	idStr := strconv.Itoa(id)
+	allPlayers.Lock()
+	defer allPlayers.Unlock()
+
+	pubKeyStr, err := authenticate(p.Auth, "GServer.Register")
+	if err != nil {
+		return err
+	}
+	if claimed, err := canonicalKey(p.PubKey); err != nil || claimed != pubKeyStr {
+		return wolferrors.UnauthenticatedError("GServer.Register")
+	}
+
+	// TODO: This needs to be fixed
+	//if player, exists := allPlayers.all[pubKeyStr]; exists {
+	//	fmt.Printf("DEBUG - Key Already Registered Error [%s]\n",
+	//		player.Address.String())
+	//	return wolferrors.KeyAlreadyRegisteredError(player.Address.String())
+	//}
+
+	for _, player := range allPlayers.all {
+		if player.Address.Network() == p.Address.Network() && player.Address.String() == p.Address.String() {
+			fmt.Printf("DEBUG - Address Already Registered Error [%s], [%s]\n",
+				player.Address.Network(), player.Address.String())
+			return wolferrors.AddressAlreadyRegisteredError(p.Address.String())
+		}
+	}
+
+	rejoined := false
+	if p.Observer {
+		// Spectators don't take the identifier, or the scores, of a player with the same key
+		idStr = shared.OBSERVER_PREFIX + idStr
+	} else if p.Prey {
+		idStr = "prey"
+	} else if known, ok := identities[pubKeyStr]; ok {
+		idStr = known
+		rejoined = true
+	}
+	if !p.Observer {
+		identities[pubKeyStr] = idStr
+	}
+	_, alive := allPlayers.all[pubKeyStr]
+
+	// once all checks are made to ensure that this connecting player has not already been registered,
+	// add this player to allPlayers struct
+	allPlayers.all[pubKeyStr] = &Player {
+		Address: p.Address,
+		RecentHB: time.Now().UnixNano(),
+		Identifier: idStr,
+		Room: p.Room,
+	}
+
+	fmt.Printf("DEBUG - [%s] Connected to room [%s]\n", p.Address.String(), p.Room)
+
+	// A player rejoining before their last session timed out is already being monitored
+	if !alive {
+		go monitor(pubKeyStr, time.Duration(heartBeat)*time.Millisecond)
+	}
+
+	settings := getSettingsByConfigString(foo.SelectConfig)
+	settings.Identifier = idStr
+	settings.Rejoined = rejoined
+
+	relay.Lock()
+	settings.RelayAddr = relay.addr
+	if relay.secret != nil {
+		settings.RelayToken = shared.RelayToken(relay.secret, idStr)
+	}
+	// In relay mode "node", the first logic node to join without a relay running runs it
+	if relay.mode == "node" && relay.addr == "" && !relay.assigned && !p.Prey && !p.Observer {
+		settings.ActAsRelay = true
+		relay.assigned = true
+		relay.assignedKey = pubKeyStr
+	}
+	relay.Unlock()
+
+	*response = settings
+
+	return nil
+}
+
+// Registers the relay for this game; nodes joining from now on are told to use it
+// Only the node picked to run the relay, or the configured standalone relay, may register
+// Replies with the secret the relay checks nodes' tokens with
+func (foo *GServer) RegisterRelay(r shared.RelayRegistration, secret *[]byte) error {
+	pubKeyStr, err := authenticate(r.Auth, "GServer.RegisterRelay")
+	if err != nil {
+		return err
+	}
+
+	relay.Lock()
+	defer relay.Unlock()
+	if pubKeyStr != relay.assignedKey && pubKeyStr != relay.standaloneKey {
+		fmt.Println("DEBUG - Relay Not Assigned Error")
+		return wolferrors.RelayNotAssignedError(r.Addr)
+	}
+	relay.secret = make([]byte, 32)
+	if _, err := rand.Read(relay.secret); err != nil {
+		relay.secret = nil
+		return err
+	}
+	relay.addr = r.Addr
+	*secret = relay.secret
+	fmt.Printf("DEBUG - Relay registered at [%s]\n", r.Addr)
+	return nil
+}
+
+// Returns the address of the relay for this game, or "" if there is none, and the token to register with it as
+func (foo *GServer) GetRelay(auth shared.RPCAuth, info *shared.RelayInfo) error {
+	pubKeyStr, err := authenticate(auth, "GServer.GetRelay")
+	if err != nil {
+		return err
+	}
+
+	allPlayers.RLock()
+	player, ok := allPlayers.all[pubKeyStr]
+	allPlayers.RUnlock()
+	if !ok {
+		fmt.Println("DEBUG - Unknown Key Error")
+		return wolferrors.UnknownKeyError(pubKeyStr)
+	}
+
+	relay.Lock()
+	defer relay.Unlock()
+	info.Addr = relay.addr
+	if relay.secret != nil {
+		info.Token = shared.RelayToken(relay.secret, player.Identifier)
+	}
+	return nil
+}
+
+func (foo *GServer) GetNodes(auth shared.RPCAuth, addrSet * map[string]shared.NodeRegistrationInfo) error {
+	pubKeyStr, err := authenticate(auth, "GServer.GetNodes")
+	if err != nil {
+		return err
+	}
+
+	allPlayers.RLock()
+	defer allPlayers.RUnlock()
+
+	if _, ok := allPlayers.all[pubKeyStr]; !ok {
+		fmt.Println("DEBUG - Unknown Key Error")
+		return wolferrors.UnknownKeyError(pubKeyStr)
+	}
+
+	playerAddresses := make(map[string]shared.NodeRegistrationInfo)
+
+	room := allPlayers.all[pubKeyStr].Room
+	for k, player := range allPlayers.all {
+		if k == pubKeyStr || player.Room != room {
+			continue
+		}
+		idString := player.Identifier
+		playerAddresses[idString] = shared.NodeRegistrationInfo{Id: idString, Addr: player.Address, PubKey: k}
+	}
+
+	*addrSet = playerAddresses
+
+	return nil
+}
+
+func (foo *GServer) Heartbeat(auth shared.RPCAuth, _ignored *bool) error {
+	pubKeyStr, err := authenticate(auth, "GServer.Heartbeat")
+	if err != nil {
+		return err
+	}
+
+	allPlayers.Lock()
+	defer allPlayers.Unlock()
+
+	if _, ok := allPlayers.all[pubKeyStr]; !ok {
+		fmt.Println("DEBUG - Unknown Key Error")
+		return wolferrors.UnknownKeyError(pubKeyStr)
+	}
+
+	allPlayers.all[pubKeyStr].RecentHB = time.Now().UnixNano()
+
+	return nil
+}
+
+// Decodes and re-encodes a public key sent by a node, so each key has exactly one string to be looked up by
+// Returns an error if it isn't a public key
+func canonicalKey(pubKey string) (string, error) {
+	decoded, err := keys.DecodePublicKey(pubKey)
+	if err != nil {
+		return "", err
+	}
+	return keys.EncodePublicKey(decoded)
+}
+
+// Returns the server's clock in nanoseconds since the epoch; nodes use this to synchronise their game clocks
+func (foo *GServer) GetTime(auth shared.RPCAuth, now *int64) error {
+	pubKeyStr, err := authenticate(auth, "GServer.GetTime")
+	if err != nil {
+		return err
+	}
+
+	allPlayers.RLock()
+	_, ok := allPlayers.all[pubKeyStr]
+	allPlayers.RUnlock()
+	if !ok {
+		fmt.Println("DEBUG - Unknown Key Error")
+		return wolferrors.UnknownKeyError(pubKeyStr)
+	}
+
+	*now = time.Now().UnixNano()
+	return nil
+}
+
+// The width and height of map "2", in grid cells; much bigger than the board, which scrolls to follow the player
+const LARGE_MAP_SIZE = 100
+
+// Returns the walls of map "2": a border, and an L-shaped block every 10 cells across the inside
+func largeMapWalls() ([]shared.Coord) {
+	var walls []shared.Coord
+	last := LARGE_MAP_SIZE - 1
+	for i := 0; i < LARGE_MAP_SIZE; i++ {
+		walls = append(walls, shared.Coord{X: i, Y: 0}, shared.Coord{X: i, Y: last})
+		if i > 0 && i < last {
+			walls = append(walls, shared.Coord{X: 0, Y: i}, shared.Coord{X: last, Y: i})
+		}
+	}
+	for x := 5; x < last; x += 10 {
+		for y := 5; y < last; y += 10 {
+			walls = append(walls, shared.Coord{X: x, Y: y}, shared.Coord{X: x + 1, Y: y}, shared.Coord{X: x, Y: y + 1})
+		}
+	}
+	return walls
+}
+
+func getSettingsByConfigString(configString string) (shared.GameConfig) {
+	var response shared.GameConfig
+	switch configString {
+	case "1":
+		settings := shared.InitialGameSettings {
+			WindowsX: 600,
+			WindowsY: 600,
+			WallCoordinates: []shared.Coord{
+				// Left side
+				{X: 0, Y:0}, {X: 0, Y:1}, {X: 0, Y:2}, {X: 0, Y:3}, {X: 0, Y:4}, {X: 0, Y:5},{X: 0, Y:6}, {X: 0, Y:7},
+				{X: 0, Y:8}, {X: 0, Y:9}, {X: 0, Y:10}, {X: 0, Y:11},{X: 0, Y:12}, {X: 0, Y:13}, {X: 0, Y:14}, {X: 0, Y:15},
+				{X: 0, Y:16}, {X: 0, Y:17}, {X: 0, Y:18}, {X: 0, Y:19},
+				// Right side
+				{X:19, Y:0}, {X:19, Y:1}, {X:19, Y:2}, {X:19, Y:3}, {X:19, Y:4}, {X:19, Y:5},{X:19, Y:6}, {X:19, Y:7},
+				{X:19, Y:8}, {X:19, Y:9}, {X:19, Y:10}, {X:19, Y:11},{X:19, Y:12}, {X:19, Y:13}, {X:19, Y:14}, {X:19, Y:15},
+				{X:19, Y:16}, {X:19, Y:17}, {X:19, Y:18}, {X:19, Y:19},
+				//Bottom
+				{X: 1, Y:0}, {X: 2, Y:0}, {X: 3, Y:0}, {X: 4, Y:0}, {X: 5, Y:0}, {X: 6, Y:0},{X: 7, Y:0}, {X: 8, Y:0},
+				{X: 9, Y:0}, {X: 10, Y:0}, {X: 11, Y:0}, {X: 12, Y:0},{X: 13, Y:0}, {X:14, Y:0}, {X:15, Y:0}, {X: 16, Y:0},
+				{X: 17, Y:0}, {X: 18, Y:0}, {X: 19, Y:0},
+				// Top
+				{X: 1, Y:19}, {X: 2, Y:19}, {X: 3, Y:19}, {X: 4, Y:19}, {X: 5, Y:19}, {X: 6, Y:19},{X: 7, Y:19}, {X: 8, Y:19},
+				{X: 9, Y:19}, {X: 10, Y:19}, {X: 11, Y:19}, {X: 12, Y:19},{X: 13, Y:19}, {X:14, Y:19}, {X:15, Y:19}, {X: 16, Y:19},
+				{X: 17, Y:19}, {X: 18, Y:19}, {X: 19, Y:19},
+				// Draw inside from top to bottom, then left to right
+				{X: 1, Y:16}, {X: 2, Y:16},
+				{X: 2, Y:11}, {X: 3, Y:11}, {X: 4, Y:11},
+				{X: 2, Y:12}, {X: 3, Y:12}, {X: 4, Y:12},
+				{X: 5, Y:7}, {X: 5, Y:8}, {X: 5, Y:9}, {X: 4, Y:8}, {X: 6, Y:7},
+				{X: 4, Y:3}, {X: 5, Y:3}, {X: 4, Y:4}, {X: 5, Y:4},{X: 3, Y:3},{X: 4, Y:2},
+				{X: 7, Y:17},{X: 8, Y:17}, {X: 8, Y:16}, {X: 9, Y:16},
+				{X: 8, Y:13}, {X: 9, Y:13},
+				{X: 10, Y:10}, {X: 11, Y:10},{X: 12, Y:10},{X: 11, Y:9},
+				{X: 12, Y:5}, {X: 11, Y:4},{X: 12, Y:4},{X: 13, Y:4},{X: 12, Y:3},{X: 13, Y:3},{X: 14, Y:3},
+				{X: 12, Y:1},
+				{X: 13, Y:17},{X: 14, Y:16},
+				{X: 17, Y:14},{X: 16, Y:13},{X: 15, Y:12},
+				{X: 15, Y:9},{X: 15, Y:8},{X: 14, Y:8},{X: 14, Y:7},{X: 13, Y:7},
+				{X: 18, Y:5},{X: 18, Y:4},{X: 18, Y:3},
+				},
+			ScoreboardWidth: 200,
+		}
+
+		initState := shared.InitialState {
+			Settings: settings,
+			CatchWorth: 1,
+		}
+
+		response = shared.GameConfig {
+			InitState: 	initState,
+			GlobalServerHB: heartBeat,
+			Ping: 		ping,
+		}
+	case "2":
+		settings := shared.InitialGameSettings {
+			WindowsX: 600,
+			WindowsY: 600,
+			WallCoordinates: largeMapWalls(),
+			ScoreboardWidth: 200,
+			MapX: LARGE_MAP_SIZE,
+			MapY: LARGE_MAP_SIZE,
+		}
+
+		initState := shared.InitialState {
+			Settings: settings,
+			CatchWorth: 1,
+		}
+
+		response = shared.GameConfig {
+			InitState: 	initState,
+			GlobalServerHB: heartBeat,
+			Ping: 		ping,
+		}
+	default:
+		settings := shared.InitialGameSettings {
+			WindowsX: 300,
+			WindowsY: 300,
+			WallCoordinates: []shared.Coord{{X: 4, Y:3}, {X: 9, Y:9}},
+			ScoreboardWidth: 200,
+		}
+
+		initState := shared.InitialState {
+			Settings: settings,
+			CatchWorth: 1,
+		}
+
+		response = shared.GameConfig {
+			InitState: 	initState,
+			GlobalServerHB: heartBeat,
+			Ping: 		ping,
+		}
+	}
+	response.PreySeed = preySeed
+	response.ReplicatedPrey = replicatedPrey
+	response.TickMs = tickMs
+	response.HistoryTicks = historyTicks
+	response.MaxLagTicks = maxLagTicks
+	response.DigestMs = digestMs
+	response.PartitionPolicy = partitionPolicy
+	response.InterestRadius = interestRadius
+	response.SummaryMs = summaryMs
+	response.EncryptTraffic = encryptTraffic
+
+	return response
+}
\ No newline at end of file
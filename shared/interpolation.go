@@ -0,0 +1,187 @@
+package shared
+
+import (
+	"sync"
+	"time"
+)
+
+// Entity interpolation. States from the logic node put the other wolves and the prey on whole cells, and arrive only
+// when something changes, so drawing each state as it comes makes them jump from cell to cell. Instead, a client
+// remembers when each entity moved where, and draws it INTERPOLATION_DELAY in the past, sliding between the two
+// positions either side of that time. Entities left out of every state for STALE_AFTER (a wolf that left, or every
+// entity once the logic node goes quiet) fade out over FADE_TIME and are then forgotten.
+
+// How far behind the latest state entities are drawn; a move is slid over this long
+const INTERPOLATION_DELAY = 150 * time.Millisecond
+
+// How many positions are kept for each entity
+const INTERPOLATION_BUFFER = 10
+
+// How long an entity can go unseen before it starts fading out
+const STALE_AFTER = 2 * time.Second
+
+// How long an entity takes to fade out
+const FADE_TIME = time.Second
+
+// The ID the prey is tracked under
+const PREY_ID = "prey"
+
+// An entity's position as of a state from the logic node
+type Sighting struct {
+	Pos Coord
+	At  time.Time
+}
+
+// What is known of an entity
+type track struct {
+	// Where it moved, oldest first
+	sightings []Sighting
+
+	// When it was last in a state
+	seen      time.Time
+}
+
+// Where to draw an entity: Progress of the way from From to To, and how opaque (1 is fully, 0 is gone)
+type Tween struct {
+	From     Coord
+	To       Coord
+	Progress float64
+	Alpha    float64
+}
+
+// Remembers where the other wolves and the prey were seen, to draw them between states
+type Interpolator struct {
+	sync.Mutex
+
+	// Each entity's track, by ID
+	tracks map[string]*track
+}
+
+// Creates an interpolator that has seen nothing yet
+func CreateInterpolator() (*Interpolator) {
+	return &Interpolator{tracks: make(map[string]*track)}
+}
+
+// Records where a state from the logic node has the other wolves and the prey, as of now
+func (ip *Interpolator) Update(state GameRenderState, now time.Time) {
+	ip.Lock()
+	defer ip.Unlock()
+	ip.sight(PREY_ID, state.Prey, now)
+	for id, pos := range state.OtherPlayers {
+		ip.sight(id, pos, now)
+	}
+}
+
+// Returns where to draw the entity with the given ID (PREY_ID for the prey) as of now, or false if it isn't to be
+// drawn: it hasn't been seen, or has faded out
+func (ip *Interpolator) Tween(id string, now time.Time) (Tween, bool) {
+	ip.Lock()
+	defer ip.Unlock()
+	t, ok := ip.tracks[id]
+	if !ok {
+		return Tween{}, false
+	}
+	alpha := fade(now.Sub(t.seen))
+	if alpha <= 0 {
+		delete(ip.tracks, id)
+		return Tween{}, false
+	}
+
+	// Find the sightings either side of the time to draw
+	sightings := t.sightings
+	last := sightings[len(sightings)-1]
+	drawAt := now.Add(-INTERPOLATION_DELAY)
+	if !drawAt.After(sightings[0].At) {
+		return Tween{From: sightings[0].Pos, To: sightings[0].Pos, Progress: 1, Alpha: alpha}, true
+	}
+	for i := 1; i < len(sightings); i++ {
+		from, to := sightings[i-1], sightings[i]
+		if drawAt.After(to.At) {
+			continue
+		}
+		// A jump of more than one cell (a respawn) isn't slid across the board
+		if !adjacent(from.Pos, to.Pos) {
+			return Tween{From: to.Pos, To: to.Pos, Progress: 1, Alpha: alpha}, true
+		}
+		progress := float64(drawAt.Sub(from.At)) / float64(to.At.Sub(from.At))
+		return Tween{From: from.Pos, To: to.Pos, Progress: progress, Alpha: alpha}, true
+	}
+	return Tween{From: last.Pos, To: last.Pos, Progress: 1, Alpha: alpha}, true
+}
+
+// Returns the IDs of the wolves being drawn (not the prey), whether or not they are in the latest state
+func (ip *Interpolator) Wolves() ([]string) {
+	ip.Lock()
+	defer ip.Unlock()
+	var ids []string
+	for id := range ip.tracks {
+		if id != PREY_ID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// Returns true if any entity is still to be drawn somewhere other than it was last drawn as of now: it is sliding
+// between cells, or fading
+func (ip *Interpolator) Animating(now time.Time) (bool) {
+	ip.Lock()
+	defer ip.Unlock()
+	for _, t := range ip.tracks {
+		moved := t.sightings[len(t.sightings)-1].At
+		if now.Sub(moved) < INTERPOLATION_DELAY || now.Sub(t.seen) > STALE_AFTER {
+			return true
+		}
+	}
+	return false
+}
+
+// Forgets everything seen, e.g. when the client moves to another game
+func (ip *Interpolator) Reset() {
+	ip.Lock()
+	defer ip.Unlock()
+	ip.tracks = make(map[string]*track)
+}
+
+func (ip *Interpolator) sight(id string, pos Coord, now time.Time) {
+	t, ok := ip.tracks[id]
+	// An entity seen for the first time, or again after fading out, appears where it is rather than sliding there
+	if !ok || fade(now.Sub(t.seen)) <= 0 {
+		ip.tracks[id] = &track{sightings: []Sighting{{Pos: pos, At: now}}, seen: now}
+		return
+	}
+	t.seen = now
+	last := t.sightings[len(t.sightings)-1]
+	if last.Pos == pos {
+		return
+	}
+	// An entity that had stood still is taken to have set off just now, so the move is slid over INTERPOLATION_DELAY
+	// rather than over the time it stood still
+	if setOff := now.Add(-INTERPOLATION_DELAY); last.At.Before(setOff) {
+		t.sightings = append(t.sightings, Sighting{Pos: last.Pos, At: setOff})
+	}
+	t.sightings = append(t.sightings, Sighting{Pos: pos, At: now})
+	if len(t.sightings) > INTERPOLATION_BUFFER {
+		t.sightings = t.sightings[len(t.sightings)-INTERPOLATION_BUFFER:]
+	}
+}
+
+// Returns how opaque to draw an entity last seen the given time ago
+func fade(unseen time.Duration) (float64) {
+	if unseen <= STALE_AFTER {
+		return 1
+	}
+	return 1 - float64(unseen-STALE_AFTER)/float64(FADE_TIME)
+}
+
+// Returns true if the cells are the same or side by side
+func adjacent(a Coord, b Coord) (bool) {
+	dx, dy := a.X-b.X, a.Y-b.Y
+	if dx < 0 {
+		dx = -dx
+	}
+	if dy < 0 {
+		dy = -dy
+	}
+	return dx+dy <= 1
+}
@@ -0,0 +1,190 @@
+package shared
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	"../wolferrors"
+)
+
+// The client's end of the pixel protocol (see pixel-protocol.go), for front-ends to a logic node: pixel/ and terminal/
+
+// How long to wait before trying to reach the logic node again, at first and at most; the wait doubles with each try
+const RECONNECT_MIN_BACKOFF = 100 * time.Millisecond
+const RECONNECT_MAX_BACKOFF = 5 * time.Second
+
+// How long to keep trying to reach the logic node when starting up
+const CONNECT_TIMEOUT = 30 * time.Second
+
+// The connection with a logic node, which is replaced when it is lost and the client reconnects
+type LogicLink struct {
+	sync.Mutex
+
+	// The logic node's address
+	addr  string
+
+	// The current connection
+	conn  *PixelConn
+
+	// The session token the logic node handed out, presented when reconnecting
+	token string
+
+	// The number of the last input sent
+	inputs uint64
+}
+
+// Connects to the logic node at addr, resuming the session with the given token (from the logic node's output) if
+// another client has played on it before; the logic node sends the latest state to render straight after the config.
+// Keeps trying for CONNECT_TIMEOUT while the logic node can't be reached.
+// Returns the link and the game config, or an error if the logic node turns us away or can't be reached
+func ConnectLogicNode(addr string, token string) (*LogicLink, InitialGameSettings, error) {
+	link := &LogicLink{addr: addr, token: token}
+	settings, err := link.Reconnect(CONNECT_TIMEOUT)
+	return link, settings, err
+}
+
+// Greets the logic node with the version of the protocol we speak, and the session token we are resuming, if any, and
+// waits for its config
+// Returns the config and the session token, or an error if the logic node doesn't speak our version or turns us away
+func PixelHandshake(conn *PixelConn, token string) (InitialGameSettings, string, error) {
+	err := conn.Send(PixelFrame{Type: FRAME_HELLO, Version: PIXEL_PROTOCOL_VERSION, Token: token})
+	if err != nil {
+		return InitialGameSettings{}, "", err
+	}
+	greeted := false
+	for {
+		frame, err := conn.Receive()
+		if err != nil {
+			return InitialGameSettings{}, "", err
+		}
+		switch frame.Type {
+		case FRAME_HELLO:
+			if frame.Version != PIXEL_PROTOCOL_VERSION {
+				return InitialGameSettings{}, "", wolferrors.PixelProtocolError(fmt.Sprintf(
+					"logic node speaks version %d, we speak %d", frame.Version, PIXEL_PROTOCOL_VERSION))
+			}
+			token = frame.Token
+			greeted = true
+		case FRAME_CONFIG:
+			if greeted && frame.Config != nil {
+				return *frame.Config, token, nil
+			}
+		case FRAME_ERROR:
+			return InitialGameSettings{}, "", wolferrors.PixelProtocolError(frame.Error)
+		}
+	}
+}
+
+// Connects to the logic node again and resumes the session, retrying with backoff while it can't be reached; gives up
+// after giveUpAfter, if it isn't 0
+// Returns the game config, or an error if the logic node turns us away or can't be reached in time
+func (link *LogicLink) Reconnect(giveUpAfter time.Duration) (InitialGameSettings, error) {
+	start := time.Now()
+	backoff := RECONNECT_MIN_BACKOFF
+	for {
+		tcpConn, err := net.Dial("tcp", link.addr)
+		if err == nil {
+			conn := CreatePixelConn(tcpConn)
+			var settings InitialGameSettings
+			token := link.Token()
+			settings, token, err = PixelHandshake(conn, token)
+			if err == nil {
+				link.Lock()
+				link.conn = conn
+				link.token = token
+				link.Unlock()
+				return settings, nil
+			}
+			conn.Close()
+			if _, ok := err.(wolferrors.PixelProtocolError); ok {
+				return settings, err
+			}
+		}
+		if giveUpAfter != 0 && time.Since(start) + backoff > giveUpAfter {
+			return InitialGameSettings{}, err
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > RECONNECT_MAX_BACKOFF {
+			backoff = RECONNECT_MAX_BACKOFF
+		}
+	}
+}
+
+// Passes the states the logic node sends on to the channel, in full, reconnecting whenever the connection is lost;
+// returns only if the logic node turns us away
+func (link *LogicLink) RunListener(states chan<- GameRenderState) {
+	node := link.Current()
+	// The latest state, which deltas apply to, and its number; nil while waiting for a keyframe
+	var state *GameRenderState
+	var seq uint64
+	for {
+		frame, err := node.Receive()
+		if err != nil {
+			fmt.Println("Lost the logic node, reconnecting:", err)
+			_, err = link.Reconnect(0)
+			if err != nil {
+				fmt.Println("Could not reconnect to logic node:", err)
+				return
+			}
+			node = link.Current()
+			state = nil
+			continue
+		}
+		switch frame.Type {
+		case FRAME_STATE:
+			if frame.State != nil {
+				state = frame.State
+				seq = frame.Seq
+				states <- *state
+			}
+		case FRAME_DELTA:
+			if frame.Delta == nil || state == nil {
+				continue
+			}
+			if frame.Seq != seq+1 {
+				fmt.Printf("Missed states %d to %d from the logic node; asking for the latest in full\n", seq+1,
+					frame.Seq-1)
+				state = nil
+				node.Send(PixelFrame{Type: FRAME_STATE})
+				continue
+			}
+			next := ApplyDelta(*state, *frame.Delta)
+			state = &next
+			seq = frame.Seq
+			states <- next
+		case FRAME_PING:
+			if !frame.Reply {
+				node.Send(PixelFrame{Type: FRAME_PING, Time: frame.Time, Reply: true})
+			}
+		case FRAME_ERROR:
+			fmt.Println("Logic node reported an error:", frame.Error)
+		}
+	}
+}
+
+// Sends a move as inputted by the player to the logic node, numbered one more than the last
+// Returns the number it was sent with, which states from the logic node acknowledge (see GameRenderState.InputAck)
+func (link *LogicLink) SendInput(move string) (uint64, error) {
+	link.Lock()
+	link.inputs++
+	seq := link.inputs
+	conn := link.conn
+	link.Unlock()
+	return seq, conn.Send(PixelFrame{Type: FRAME_INPUT, Input: move, Seq: seq})
+}
+
+// Returns the current connection with the logic node
+func (link *LogicLink) Current() (*PixelConn) {
+	link.Lock()
+	defer link.Unlock()
+	return link.conn
+}
+
+// Returns the session token the logic node handed out
+func (link *LogicLink) Token() (string) {
+	link.Lock()
+	defer link.Unlock()
+	return link.token
+}
@@ -0,0 +1,149 @@
+package shared
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"../wolferrors"
+)
+
+// A logic node and its pixel client talk over TCP in frames: a 4-byte big-endian length, then that many bytes of a
+// JSON-encoded PixelFrame. The client opens with a hello carrying the protocol version it speaks; the logic node
+// answers with a hello of its own and the game's config, or with an error and closes the connection if it doesn't
+// speak that version. After that, the logic node sends states, the client sends inputs, and either may send pings
+// (answered with a ping with Reply set), errors, or ask again for the config with a config frame with none in it.
+// The logic node's hello carries a session token; a client that reconnects after losing the connection presents it in
+// its hello to take the session back, and is sent the latest state straight after the config.
+// States are sent in full only now and then; in between, the logic node sends deltas (see state-delta.go). A client
+// asks for a state in full with a state frame with none in it.
+
+// The version of the protocol spoken by this build
+const PIXEL_PROTOCOL_VERSION = 2
+
+// The longest frame either side will read; a longer length means the stream is corrupt
+const MAX_PIXEL_FRAME = 1 << 20
+
+// The types of frame
+const (
+	FRAME_HELLO  = "hello"
+	FRAME_CONFIG = "config"
+	FRAME_STATE  = "state"
+	FRAME_DELTA  = "delta"
+	FRAME_INPUT  = "input"
+	FRAME_PING   = "ping"
+	FRAME_ERROR  = "error"
+)
+
+// The inputs a client can send
+var PixelInputs = map[string]bool{"up": true, "down": true, "left": true, "right": true}
+
+type PixelFrame struct {
+	Type    string
+
+	// hello: the protocol version the sender speaks
+	Version int                  `json:",omitempty"`
+
+	// hello: the session token the logic node handed out, or, from a client, the one it is resuming
+	Token   string               `json:",omitempty"`
+
+	// config: the game's settings; empty when asking for them
+	Config  *InitialGameSettings `json:",omitempty"`
+
+	// state: the game state to render; empty when asking for it
+	State   *GameRenderState     `json:",omitempty"`
+
+	// delta: what changed since the state before
+	Delta   *StateDelta          `json:",omitempty"`
+
+	// input: the player's move, one of PixelInputs
+	Input   string               `json:",omitempty"`
+
+	// input: the number the client gave the input, counting up from 1; 0 if it doesn't number them
+	// state, delta: the number of the state, counting up from 1 on each connection
+	Seq     uint64               `json:",omitempty"`
+
+	// ping: the sender's time in nanoseconds, echoed back in the reply
+	Time    int64                `json:",omitempty"`
+	Reply   bool                 `json:",omitempty"`
+
+	// error: what went wrong
+	Error   string               `json:",omitempty"`
+}
+
+// One end of a connection between a logic node and its pixel client; safe for one reader and many writers
+type PixelConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	writeLock sync.Mutex
+}
+
+func CreatePixelConn(conn net.Conn) (*PixelConn) {
+	return &PixelConn{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// Returns a frame as it is written on the wire
+func EncodePixelFrame(frame PixelFrame) ([]byte, error) {
+	body, err := json.Marshal(frame)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 4+len(body))
+	binary.BigEndian.PutUint32(buf, uint32(len(body)))
+	copy(buf[4:], body)
+	return buf, nil
+}
+
+// Writes a frame
+func (pc *PixelConn) Send(frame PixelFrame) (err error) {
+	buf, err := EncodePixelFrame(frame)
+	if err != nil {
+		return err
+	}
+
+	pc.writeLock.Lock()
+	defer pc.writeLock.Unlock()
+	_, err = pc.conn.Write(buf)
+	return err
+}
+
+// Reads the next frame
+// Returns an error if the connection is closed or the frame can't be read, after which the stream can't be trusted
+func (pc *PixelConn) Receive() (PixelFrame, error) {
+	var frame PixelFrame
+	var length [4]byte
+	_, err := io.ReadFull(pc.reader, length[:])
+	if err != nil {
+		return frame, err
+	}
+	size := binary.BigEndian.Uint32(length[:])
+	if size > MAX_PIXEL_FRAME {
+		return frame, wolferrors.PixelProtocolError(fmt.Sprintf("frame of %d bytes", size))
+	}
+	body := make([]byte, size)
+	_, err = io.ReadFull(pc.reader, body)
+	if err != nil {
+		return frame, err
+	}
+	err = json.Unmarshal(body, &frame)
+	if err != nil {
+		return frame, wolferrors.PixelProtocolError(err.Error())
+	}
+	return frame, nil
+}
+
+// Sends an error frame
+func (pc *PixelConn) SendError(message string) (error) {
+	return pc.Send(PixelFrame{Type: FRAME_ERROR, Error: message})
+}
+
+func (pc *PixelConn) Close() (error) {
+	return pc.conn.Close()
+}
+
+func (pc *PixelConn) RemoteAddr() (net.Addr) {
+	return pc.conn.RemoteAddr()
+}
@@ -0,0 +1,112 @@
+package shared
+
+import (
+	"sync"
+	"time"
+)
+
+// Client-side prediction. A client shows the player where their moves take them as soon as the keys are pressed,
+// rather than once the logic node has played them and heard back from a quorum of the other nodes. It remembers the
+// inputs the logic node hasn't acknowledged yet (see GameRenderState.InputAck), and on every state from the logic
+// node, replays them over the position in the state. Where the logic node didn't play an input the way it was
+// predicted (the move was blocked, or overtaken, or never reached a quorum), the replay puts the player back where the
+// logic node has them.
+
+// How long an input can go unacknowledged before it is taken as lost, and the prediction falls back on the position
+// from the logic node
+const PREDICTION_TIMEOUT = time.Second
+
+// An input sent to the logic node and not yet acknowledged
+type PendingInput struct {
+	Seq  uint64
+	Move string
+	Sent time.Time
+}
+
+// Predicts where the player is from the last state the logic node sent and the inputs it hasn't acknowledged
+type Predictor struct {
+	sync.Mutex
+
+	// Returns true if the player can move from one cell to the other
+	valid     func(from Coord, to Coord) bool
+
+	// The player's position in the last state from the logic node
+	confirmed Coord
+
+	// The inputs not yet acknowledged, oldest first
+	pending   []PendingInput
+}
+
+// Creates a predictor that checks moves with valid, starting from the given position
+func CreatePredictor(valid func(from Coord, to Coord) bool, start Coord) (*Predictor) {
+	return &Predictor{valid: valid, confirmed: start}
+}
+
+// Returns the cell a move ("up", "down", "left" or "right") leads to from pos, whether or not it can be moved to
+func MoveCoord(pos Coord, move string) (Coord) {
+	switch move {
+	case "up":
+		pos.Y = pos.Y + 1
+	case "down":
+		pos.Y = pos.Y - 1
+	case "left":
+		pos.X = pos.X - 1
+	case "right":
+		pos.X = pos.X + 1
+	}
+	return pos
+}
+
+// Records an input sent to the logic node with the given number
+// Returns where the player is predicted to be now
+func (p *Predictor) Input(seq uint64, move string, now time.Time) (Coord) {
+	p.Lock()
+	defer p.Unlock()
+	p.pending = append(p.pending, PendingInput{Seq: seq, Move: move, Sent: now})
+	return p.predict()
+}
+
+// Takes a state from the logic node: drops the inputs it acknowledges, and any unacknowledged for longer than
+// PREDICTION_TIMEOUT
+// Returns where the player is predicted to be now, and true if that isn't where they were predicted to be before the
+// state came in; that is, the logic node played an input differently from how it was predicted
+func (p *Predictor) Reconcile(state GameRenderState, now time.Time) (predicted Coord, corrected bool) {
+	p.Lock()
+	defer p.Unlock()
+	before := p.predict()
+	p.confirmed = state.PlayerLoc
+	var pending []PendingInput
+	for _, input := range p.pending {
+		if input.Seq > state.InputAck && now.Sub(input.Sent) < PREDICTION_TIMEOUT {
+			pending = append(pending, input)
+		}
+	}
+	p.pending = pending
+	predicted = p.predict()
+	return predicted, predicted != before
+}
+
+// Returns where the player is predicted to be
+func (p *Predictor) Predicted() (Coord) {
+	p.Lock()
+	defer p.Unlock()
+	return p.predict()
+}
+
+// Returns the number of inputs not yet acknowledged
+func (p *Predictor) Pending() (int) {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.pending)
+}
+
+func (p *Predictor) predict() (Coord) {
+	pos := p.confirmed
+	for _, input := range p.pending {
+		next := MoveCoord(pos, input.Move)
+		if p.valid(pos, next) {
+			pos = next
+		}
+	}
+	return pos
+}
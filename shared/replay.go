@@ -0,0 +1,132 @@
+package shared
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"../wolferrors"
+)
+
+// A replay file records a match as one logic node saw it: a header, then the events that changed its game state, in
+// order. It is gzipped JSON, one value per line, with short field names to keep it small.
+
+// The version of the replay format written by this build
+const REPLAY_VERSION = 1
+
+// The kinds of replay event
+const (
+	// A player (or the prey) appeared at a position
+	EVENT_JOIN    = "join"
+	// A player (or the prey) moved to a position
+	EVENT_MOVE    = "move"
+	// A player (or the prey) left the game
+	EVENT_LEAVE   = "leave"
+	// A player captured the prey; Event names the capture and Value is what it is worth
+	EVENT_CAPTURE = "capture"
+	// A capture was revoked
+	EVENT_REVOKE  = "revoke"
+	// A player's score changed to Value
+	EVENT_SCORE   = "score"
+	// The points held back from a player under the partition policy changed to Value
+	EVENT_HELD    = "held"
+)
+
+type ReplayHeader struct {
+	Version  int
+	// The identifier of the node that recorded the match
+	Self     string
+	Settings InitialGameSettings
+	// When recording started, in milliseconds since the Unix epoch
+	Start    int64
+}
+
+type ReplayEvent struct {
+	// Milliseconds since recording started
+	Time   int64  `json:"t"`
+	Kind   string `json:"k"`
+	Player string `json:"p,omitempty"`
+	At     *Coord `json:"c,omitempty"`
+	Value  int    `json:"v,omitempty"`
+	Event  string `json:"e,omitempty"`
+}
+
+type ReplayWriter struct {
+	file    *os.File
+	zip     *gzip.Writer
+	encoder *json.Encoder
+}
+
+// Creates a replay file and writes its header
+func CreateReplay(path string, header ReplayHeader) (*ReplayWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	zip := gzip.NewWriter(file)
+	rw := &ReplayWriter{file: file, zip: zip, encoder: json.NewEncoder(zip)}
+	header.Version = REPLAY_VERSION
+	err = rw.encoder.Encode(header)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return rw, rw.zip.Flush()
+}
+
+// Writes events, and flushes them so they are on disk even if the node never closes the file
+func (rw *ReplayWriter) Write(events []ReplayEvent) (error) {
+	for _, event := range events {
+		err := rw.encoder.Encode(event)
+		if err != nil {
+			return err
+		}
+	}
+	return rw.zip.Flush()
+}
+
+func (rw *ReplayWriter) Close() (error) {
+	err := rw.zip.Close()
+	if err != nil {
+		rw.file.Close()
+		return err
+	}
+	return rw.file.Close()
+}
+
+// Reads a replay file
+// Returns an error if it isn't one, or is from a newer version; a file cut off part way through an event (e.g. by the
+// recording node dying) is read up to that event
+func ReadReplay(path string) (ReplayHeader, []ReplayEvent, error) {
+	var header ReplayHeader
+	file, err := os.Open(path)
+	if err != nil {
+		return header, nil, err
+	}
+	defer file.Close()
+	zip, err := gzip.NewReader(bufio.NewReader(file))
+	if err != nil {
+		return header, nil, err
+	}
+	decoder := json.NewDecoder(zip)
+	err = decoder.Decode(&header)
+	if err != nil {
+		return header, nil, err
+	}
+	if header.Version < 1 || header.Version > REPLAY_VERSION {
+		return header, nil, wolferrors.BadReplayError(path)
+	}
+	var events []ReplayEvent
+	for {
+		var event ReplayEvent
+		err := decoder.Decode(&event)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return header, events, nil
+		}
+		if err != nil {
+			return header, events, err
+		}
+		events = append(events, event)
+	}
+}
@@ -0,0 +1,34 @@
+package shared
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Helper function to take the score map and return a sorted list of all scores by player, formatted as a single string
+// for the scoreboard.
+// Couldn't be bothered to figure the sorting out myself, reference:
+// https://stackoverflow.com/questions/18695346/how-to-sort-a-mapstringint-by-its-values
+func SortScores (scoreMap map[string]int) (string) {
+	n := map[int][]string{}
+	var a []int
+	for k, v := range scoreMap {
+		n[v] = append(n[v], k)
+	}
+	for k := range n {
+		a = append(a, k)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(a)))
+
+	i := 1
+	scoreString := ""
+	for _, k := range a {
+		sort.Strings(n[k])
+		for _, s := range n[k] {
+			scoreString += fmt.Sprintf("%2d. %-4s %9d points\n\n", i, s, k)
+		}
+		i++
+	}
+
+	return scoreString
+}
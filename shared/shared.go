@@ -2,10 +2,23 @@ package shared
 
 import (
 	_ "crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"sync"
 	"net"
+	"strconv"
+	"strings"
 )
 
+// Spectators are registered under identifiers starting with this; they follow the game but never move or score
+const OBSERVER_PREFIX = "observer-"
+
+// Returns true if the identifier is a spectator's
+func IsObserver(identifier string) (bool) {
+	return strings.HasPrefix(identifier, OBSERVER_PREFIX)
+}
+
 // Coordinates of an element in game
 type Coord struct {
 	X int
@@ -18,14 +31,61 @@ type GameConfig struct {
 	GlobalServerHB		uint32
 	// Number of times we ping another player before we drop them
 	Ping				uint32
+	// Seed for the prey's random moves; every node simulating the prey must use the same one
+	PreySeed			int64
+	// If true, there is no prey node and every logic node simulates the prey locally
+	ReplicatedPrey		bool
+	// Length of a game tick in milliseconds
+	TickMs				uint32
+	// Number of ticks of move history each node keeps for checking captures
+	HistoryTicks		uint64
+	// How many ticks old a capture can be and still be checked against where the prey was back then
+	MaxLagTicks			uint64
+	// How often, in milliseconds, each node broadcasts a digest of its game state to check it agrees with the others
+	DigestMs			uint32
+	// How captures made during a network partition are counted: "majority" or "keep-both"
+	PartitionPolicy		string
+	// Nodes within this many grid cells of a node get every one of its moves; 0 sends every move to every node
+	InterestRadius		int
+	// How often, in milliseconds, nodes outside the interest radius are sent a node's latest position
+	SummaryMs			uint32
+	// The address of the relay forwarding messages between nodes that can't reach each other directly, if any
+	RelayAddr			string
+	// The token this node registers with the relay with (see RelayToken)
+	RelayToken			string
+	// If true, the server has picked this node to run the relay for the game
+	ActAsRelay			bool
+	// If true, this node's public key has played in this game before, and it has been given its old identifier back
+	Rejoined			bool
+	// If true, nodes agree session keys with each other and encrypt all their traffic; see key-helpers/session.go
+	EncryptTraffic		bool
 }
 
 // Initial game settings sent out by global server to start the game
 type InitialGameSettings struct {
+	// The size in pixels of the board in the pixel client's window; a map bigger than that scrolls
 	WindowsX			float64
 	WindowsY			float64
 	WallCoordinates		[]Coord
 	ScoreboardWidth		float64
+	// The size of the map in grid cells; 0 to fit it to the board, a cell every GRID_CELL_PIXELS
+	MapX				int
+	MapY				int
+}
+
+// The size in pixels of a grid cell on the board
+const GRID_CELL_PIXELS = 30
+
+// Returns the width and height of the map in grid cells
+func (settings InitialGameSettings) GridSize() (int, int) {
+	x, y := settings.MapX, settings.MapY
+	if x == 0 {
+		x = int(settings.WindowsX) / GRID_CELL_PIXELS
+	}
+	if y == 0 {
+		y = int(settings.WindowsY) / GRID_CELL_PIXELS
+	}
+	return x, y
 }
 
 type InitialState struct {
@@ -52,9 +112,37 @@ type PlayerLockMap struct {
 	Data map[string]Coord
 }
 
+// Scores are a replicated counter: every capture is an event with an id that is the same on every node, and each
+// player's score is the total worth of their events that haven't been revoked. Merging two nodes' scores is the union
+// of their events and of their revocations, which comes out the same whatever order it's done in, and however often.
 type ScoresLockMap struct {
 	sync.RWMutex
+	// Each player's score, as totalled from Base, Events and Revoked
 	Data map[string]int
+	// Every capture event seen since Horizon, by event id
+	Events map[string]CaptureEvent
+	// The ids of capture events that have been revoked; once revoked, an event stays revoked
+	Revoked map[string]bool
+	// Each player's points from captures made before Horizon, which have been settled and folded out of Events
+	Base map[string]int
+	// The tick captures are settled up to
+	Horizon uint64
+	// Points from captures that don't count under the partition policy, by player; shown, but not in Data
+	Held map[string]int
+	// The game's partition policy, which decides which captures count
+	Policy string
+}
+
+// A single capture of the prey, and the points it is worth to the player who made it
+type CaptureEvent struct {
+	Player string
+	Worth  int
+	// The players the capturer could reach when it made the capture, itself included
+	View    []string
+	// The number of players in the game as far as the capturer knew, reachable or not
+	Members int
+	// The game tick the capture was made in
+	Tick    uint64
 }
 
 // Game state sent from logic node to pixel for rendering
@@ -63,6 +151,12 @@ type GameRenderState struct {
 	Prey Coord
 	OtherPlayers map[string]Coord
 	Scores map[string]int
+	// Points from captures made on the minority side of a network partition, not counted in Scores
+	HeldScores map[string]int
+	// True if the state is for a spectator: there is no "ME", PlayerLoc is unused and every wolf is in OtherPlayers
+	Spectator bool
+	// The number of the last input from the client that PlayerLoc reflects (see PixelFrame.Seq)
+	InputAck uint64
 }
 
 // Move commitment sent by player, must be ACK'ed by all other players in game
@@ -85,6 +179,94 @@ type SignedMove struct{
 	S					string
 }
 
+// A message to or through a relay. Nodes register with the relay, then send it messages to forward to other nodes.
+type RelayEnvelope struct {
+	// "register" to tell the relay where to reach the sender, or "forward"
+	Type	string
+	// The identifier of the sending node
+	From	string
+	// The identifier of the node to forward to, or "all"
+	To		string
+	// The message to forward, exactly as it would have been sent directly
+	Payload	[]byte
+	// On "register", when the sender registered, in nanoseconds since the epoch; each registration from a node must be
+	// later than the last
+	Time	int64
+	// On "register", proof the sender holds the token the server issued it for this relay (see RelayRegisterProof)
+	Proof	string
+}
+
+// The relay for a game and the token to register with it as, as the server hands them out (GServer.GetRelay)
+type RelayInfo struct {
+	Addr	string
+	Token	string
+}
+
+// Returns the token the node with the given identifier registers with a relay as. The server gives each relay a
+// secret when it registers, and each node the token for its identifier under that secret, so the relay only takes
+// registrations from nodes the server knows of without asking it about each one.
+func RelayToken(secret []byte, identifier string) (string) {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(identifier))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Returns the proof a node registering with a relay at the given time sends in place of its token. The token itself
+// never goes over the wire, so a registration seen on the way can't be altered or made again later; only sent again
+// as is, which the relay refuses as not later than the last (see RelayEnvelope.Time).
+func RelayRegisterProof(token string, identifier string, time int64) (string) {
+	mac := hmac.New(sha256.New, []byte(token))
+	mac.Write([]byte(identifier))
+	mac.Write([]byte(strconv.FormatInt(time, 10)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// One half of the handshake two nodes agree a session key with, signed with the sender's identity key
+type SessionHello struct {
+	// The identifier of the node the hello is for
+	To			string
+	// The sender's ephemeral X25519 public key
+	Ephemeral	[]byte
+	// When the sender made the ephemeral key, in nanoseconds since the epoch; hellos older than the last one accepted
+	// from the same node are replays
+	Time		int64
+	// True if this hello answers one from the node it is for
+	Reply		bool
+	R			string
+	S			string
+}
+
+// Proof that a call to the server comes from the holder of an identity key: a signature over the method called and a
+// nonce the server handed out for the call (see key-helpers.SignRPC)
+type RPCAuth struct {
+	// The caller's public key, in the canonical encoding
+	PubKey	string
+	Nonce	string
+	R		string
+	S		string
+}
+
+// What a node registers with the server as (GServer.Register). Shared by the server and every kind of node, so gob
+// knows it under one name in a process that runs both.
+type PlayerInfo struct {
+	Address 			net.Addr
+	// In the canonical encoding (see key-helpers)
+	PubKey 				string
+	Prey				bool
+	Room				string
+	// Proof the node holds PubKey (see server/impl/nonces.go)
+	Auth				RPCAuth
+	// True for a spectator, which is given an identifier of its own (see IsObserver) and never a spawn or score
+	Observer			bool
+}
+
+// What a relay registers with the server as (GServer.RegisterRelay): the address nodes should send to it at, and
+// proof it holds the key of the node the server picked to run it, or the standalone relay key the server was given
+type RelayRegistration struct {
+	Addr	string
+	Auth	RPCAuth
+}
+
 // A struct to communicate between the server and other nodes and also between nodes the identification details of
 // a player node; includes identifier, public key, and address
 type NodeRegistrationInfo struct {
@@ -0,0 +1,55 @@
+package shared
+
+import (
+	"sort"
+)
+
+// A spectator's node sends its client game states with no player of their own (see GameRenderState.Spectator). The
+// client follows one thing in the game instead, the prey or any wolf, and the arrow keys pick which.
+
+// What a spectator follows until they pick something else
+const FOLLOW_PREY = "prey"
+
+// Returns everything a spectator can follow in a state: the prey, then the wolves in order of identifier
+func FollowTargets(state GameRenderState) ([]string) {
+	var wolves []string
+	for id := range state.OtherPlayers {
+		wolves = append(wolves, id)
+	}
+	sort.Strings(wolves)
+	return append([]string{FOLLOW_PREY}, wolves...)
+}
+
+// Returns the target step places after current in FollowTargets (before it, if step is negative), wrapping around;
+// from a target that has left the game, steps from the prey
+func NextFollowTarget(state GameRenderState, current string, step int) (string) {
+	targets := FollowTargets(state)
+	at := 0
+	for i, target := range targets {
+		if target == current {
+			at = i
+		}
+	}
+	next := (at + step) % len(targets)
+	if next < 0 {
+		next += len(targets)
+	}
+	return targets[next]
+}
+
+// Returns how far through the follow targets an arrow key moves a spectator: forward for right and up, back for left
+// and down
+func FollowStep(key string) (int) {
+	if key == "left" || key == "down" {
+		return -1
+	}
+	return 1
+}
+
+// Returns where the target is in a state, and the target actually followed: the prey, if the target has left the game
+func FollowedLoc(state GameRenderState, target string) (Coord, string) {
+	if loc, ok := state.OtherPlayers[target]; ok && target != FOLLOW_PREY {
+		return loc, target
+	}
+	return state.Prey, FOLLOW_PREY
+}
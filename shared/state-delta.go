@@ -0,0 +1,148 @@
+package shared
+
+import "time"
+
+// Delta-encoded states. Rather than every state in full, a logic node sends its pixel client a keyframe (a state
+// frame) when it connects and every KEYFRAME_INTERVAL, and in between, delta frames with only what changed since the
+// state before. States and deltas are numbered one after the other on each connection (PixelFrame.Seq); a client that
+// misses one, or gets a delta with no state to apply it to, drops deltas until it has asked for and got a keyframe.
+
+// How often a logic node sends its pixel client a keyframe, whether or not anything changed
+const KEYFRAME_INTERVAL = time.Second
+
+// What changed in a GameRenderState since the one before
+type StateDelta struct {
+	// This player's position, if it changed
+	PlayerLoc *Coord          `json:",omitempty"`
+
+	// The prey's position, if it changed
+	Prey      *Coord          `json:",omitempty"`
+
+	// Other wolves that moved or joined, and where they are now
+	Moved     map[string]Coord `json:",omitempty"`
+
+	// Other wolves no longer in the game
+	Left      []string        `json:",omitempty"`
+
+	// Scores that changed or are new
+	Scores    map[string]int  `json:",omitempty"`
+
+	// Scores no longer kept
+	Unscored  []string        `json:",omitempty"`
+
+	// Held scores that changed; 0 if no points are held any more
+	Held      map[string]int  `json:",omitempty"`
+
+	// The input acknowledged, whether or not it changed
+	InputAck  uint64          `json:",omitempty"`
+}
+
+// Returns the changes that make next out of prev
+func DiffStates(prev GameRenderState, next GameRenderState) (StateDelta) {
+	var delta StateDelta
+	if next.PlayerLoc != prev.PlayerLoc {
+		loc := next.PlayerLoc
+		delta.PlayerLoc = &loc
+	}
+	if next.Prey != prev.Prey {
+		prey := next.Prey
+		delta.Prey = &prey
+	}
+	for id, loc := range next.OtherPlayers {
+		if before, ok := prev.OtherPlayers[id]; !ok || before != loc {
+			if delta.Moved == nil {
+				delta.Moved = make(map[string]Coord)
+			}
+			delta.Moved[id] = loc
+		}
+	}
+	for id := range prev.OtherPlayers {
+		if _, ok := next.OtherPlayers[id]; !ok {
+			delta.Left = append(delta.Left, id)
+		}
+	}
+	for id, score := range next.Scores {
+		if before, ok := prev.Scores[id]; !ok || before != score {
+			if delta.Scores == nil {
+				delta.Scores = make(map[string]int)
+			}
+			delta.Scores[id] = score
+		}
+	}
+	for id := range prev.Scores {
+		if _, ok := next.Scores[id]; !ok {
+			delta.Unscored = append(delta.Unscored, id)
+		}
+	}
+	for id, held := range next.HeldScores {
+		if prev.HeldScores[id] != held {
+			if delta.Held == nil {
+				delta.Held = make(map[string]int)
+			}
+			delta.Held[id] = held
+		}
+	}
+	for id, held := range prev.HeldScores {
+		if _, ok := next.HeldScores[id]; !ok && held != 0 {
+			if delta.Held == nil {
+				delta.Held = make(map[string]int)
+			}
+			delta.Held[id] = 0
+		}
+	}
+	delta.InputAck = next.InputAck
+	return delta
+}
+
+// Returns true if the delta changes nothing in a state whose last acknowledged input is inputAck
+func (delta StateDelta) Empty(inputAck uint64) (bool) {
+	return delta.PlayerLoc == nil && delta.Prey == nil && len(delta.Moved) == 0 && len(delta.Left) == 0 &&
+		len(delta.Scores) == 0 && len(delta.Unscored) == 0 && len(delta.Held) == 0 && delta.InputAck == inputAck
+}
+
+// Returns the state the delta makes out of state; state itself is left as it is
+func ApplyDelta(state GameRenderState, delta StateDelta) (GameRenderState) {
+	next := state
+	if delta.PlayerLoc != nil {
+		next.PlayerLoc = *delta.PlayerLoc
+	}
+	if delta.Prey != nil {
+		next.Prey = *delta.Prey
+	}
+
+	next.OtherPlayers = make(map[string]Coord)
+	for id, loc := range state.OtherPlayers {
+		next.OtherPlayers[id] = loc
+	}
+	for id, loc := range delta.Moved {
+		next.OtherPlayers[id] = loc
+	}
+	for _, id := range delta.Left {
+		delete(next.OtherPlayers, id)
+	}
+
+	next.Scores = make(map[string]int)
+	for id, score := range state.Scores {
+		next.Scores[id] = score
+	}
+	for id, score := range delta.Scores {
+		next.Scores[id] = score
+	}
+	for _, id := range delta.Unscored {
+		delete(next.Scores, id)
+	}
+
+	next.HeldScores = make(map[string]int)
+	for id, held := range state.HeldScores {
+		next.HeldScores[id] = held
+	}
+	for id, held := range delta.Held {
+		if held == 0 {
+			delete(next.HeldScores, id)
+		} else {
+			next.HeldScores[id] = held
+		}
+	}
+	next.InputAck = delta.InputAck
+	return next
+}
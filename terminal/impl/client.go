@@ -0,0 +1,149 @@
+package impl
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"../../shared"
+)
+
+// Terminal control sequences
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	hideCursor  = "\x1b[?25l"
+	showCursor  = "\x1b[?25h"
+)
+
+// The key that quits the client
+const QUIT_KEY = "quit"
+
+// Plays in the terminal for the logic node at nodeAddr until the player quits, resuming the session with the given
+// token if another client has played on it before. Needs a terminal that understands ANSI escapes, and stty to read
+// keys as they are pressed.
+// Returns an error if the logic node can't be reached or turns us away
+func RunClient(nodeAddr string, token string) (error) {
+	link, settings, err := shared.ConnectLogicNode(nodeAddr, token)
+	if err != nil {
+		return err
+	}
+	screen := CreateScreen(settings)
+	screen.Colour = true
+
+	restore, err := rawMode()
+	if err != nil {
+		return err
+	}
+	defer restore()
+	fmt.Print(hideCursor)
+	defer fmt.Print(showCursor)
+
+	states := make(chan shared.GameRenderState, 5)
+	go link.RunListener(states)
+	keys := make(chan string, 5)
+	go ReadKeys(os.Stdin, keys)
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupted)
+
+	fmt.Print(clearScreen + "Waiting for the game state...\n")
+	screen.Following = shared.FOLLOW_PREY
+	var last *shared.GameRenderState
+	for {
+		select {
+		case state := <-states:
+			last = &state
+			draw(&screen, state)
+		case key, ok := <-keys:
+			if !ok || key == QUIT_KEY {
+				return nil
+			}
+			// A spectator has no wolf to move; the arrow keys pick who to follow instead
+			if last != nil && last.Spectator {
+				screen.Following = shared.NextFollowTarget(*last, screen.Following, shared.FollowStep(key))
+				draw(&screen, *last)
+				continue
+			}
+			_, err := link.SendInput(key)
+			if err != nil {
+				fmt.Println("Error sending move to logic node:", err)
+			}
+		case <-interrupted:
+			return nil
+		}
+	}
+}
+
+// Clears the terminal and draws the state
+func draw(screen *Screen, state shared.GameRenderState) {
+	help := "arrow keys move, q quits"
+	if state.Spectator {
+		help = "arrow keys pick who to follow, q quits"
+	}
+	fmt.Print(clearScreen + screen.Render(state) + "\n" + help + "\n")
+}
+
+// Reads key presses from the terminal and writes the moves and quits they stand for to the channel, closing it when
+// the terminal closes; should be run in a goroutine
+func ReadKeys(terminal io.Reader, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := terminal.Read(buf)
+		for _, key := range ParseKeys(buf[:n]) {
+			keys <- key
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Returns the moves and quits in bytes read from the terminal: arrow keys are moves, q and Ctrl-D quit, and anything
+// else is ignored
+func ParseKeys(input []byte) ([]string) {
+	var keys []string
+	for i := 0; i < len(input); i++ {
+		switch input[i] {
+		case 'q', 'Q', 0x04:
+			keys = append(keys, QUIT_KEY)
+		case 0x1b:
+			// Arrow keys are ESC [ A-D, or ESC O A-D in application mode
+			if i+2 < len(input) && (input[i+1] == '[' || input[i+1] == 'O') {
+				if move, ok := arrows[input[i+2]]; ok {
+					keys = append(keys, move)
+				}
+				i += 2
+			}
+		}
+	}
+	return keys
+}
+
+var arrows = map[byte]string{'A': "up", 'B': "down", 'C': "right", 'D': "left"}
+
+// Puts the terminal into a mode where keys are read as they are pressed and not echoed
+// Returns a function that puts it back as it was
+func rawMode() (func(), error) {
+	saved, err := stty("-g")
+	if err != nil {
+		return nil, err
+	}
+	_, err = stty("-icanon", "-echo", "min", "1")
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		stty(strings.TrimSpace(saved))
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}
@@ -0,0 +1,156 @@
+package impl
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"../../geometry"
+	"../../shared"
+)
+
+// What each thing on the board is drawn as; every grid cell is two characters wide, so the board comes out roughly
+// square in most terminals
+const (
+	CELL_EMPTY = ". "
+	CELL_WALL  = "##"
+	CELL_ME    = "@ "
+	CELL_WOLF  = "W "
+	CELL_PREY  = "P "
+)
+
+// The ANSI colours the board is drawn in, when it is drawn in colour
+const (
+	colourReset = "\x1b[0m"
+	colourWall  = "\x1b[90m"
+	colourMe    = "\x1b[1;33m"
+	colourWolf  = "\x1b[31m"
+	colourPrey  = "\x1b[32m"
+)
+
+// The gap between the board and the scoreboard
+const scoreboardGap = "   "
+
+// Draws game states as text: the board as a character grid, with the scoreboard beside it
+type Screen struct {
+	// The game board, for its size and walls
+	grid   geometry.GridManager
+
+	// If true, the board is drawn with ANSI colours
+	Colour bool
+
+	// For a spectator, who to follow (see shared.FollowTargets); a followed wolf is drawn as this player would be
+	Following string
+}
+
+// Creates a screen for a game with the given settings
+func CreateScreen(settings shared.InitialGameSettings) (Screen) {
+	return Screen{grid: geometry.CreateNewGridManager(settings)}
+}
+
+// Returns the game state drawn as lines of text, top row first
+func (s *Screen) Render(state shared.GameRenderState) (string) {
+	width, height := s.grid.GetSize()
+	me := state.PlayerLoc
+	following := ""
+	if state.Spectator {
+		me, following = shared.FollowedLoc(state, s.Following)
+		// The prey is drawn as the prey, even when followed
+		if following == shared.FOLLOW_PREY {
+			me = shared.Coord{X: -1, Y: -1}
+		}
+	}
+	others := make(map[shared.Coord]bool)
+	for _, player := range state.OtherPlayers {
+		others[player] = true
+	}
+
+	var board []string
+	border := "+" + strings.Repeat("-", 2*width) + "+"
+	board = append(board, border)
+	// The top of the board is the highest Y
+	for y := height - 1; y >= 0; y-- {
+		row := "|"
+		for x := 0; x < width; x++ {
+			row += s.cell(shared.Coord{X: x, Y: y}, me, state, others)
+		}
+		board = append(board, row + "|")
+	}
+	board = append(board, border)
+
+	scoreboard := Scoreboard(state)
+	if state.Spectator {
+		scoreboard = append(scoreboard, "", fmt.Sprintf("WATCHING: %7s", following))
+		if following != shared.FOLLOW_PREY {
+			scoreboard = append(scoreboard, fmt.Sprintf("SCORE: %10d", state.Scores[following]))
+		}
+	}
+	lines := len(board)
+	if len(scoreboard) > lines {
+		lines = len(scoreboard)
+	}
+	out := ""
+	for i := 0; i < lines; i++ {
+		if i < len(board) {
+			out += board[i]
+		} else {
+			out += strings.Repeat(" ", len(border))
+		}
+		if i < len(scoreboard) {
+			out += scoreboardGap + scoreboard[i]
+		}
+		out += "\n"
+	}
+	return out
+}
+
+// Returns what is drawn in one grid cell; this player (or who a spectator follows, at me) is drawn over everything,
+// and the prey over other wolves
+func (s *Screen) cell(coord shared.Coord, me shared.Coord, state shared.GameRenderState,
+	others map[shared.Coord]bool) (string) {
+	switch {
+	case coord == me:
+		return s.paint(CELL_ME, colourMe)
+	case coord == state.Prey:
+		return s.paint(CELL_PREY, colourPrey)
+	case others[coord]:
+		return s.paint(CELL_WOLF, colourWolf)
+	case !s.grid.IsNotWall(coord):
+		return s.paint(CELL_WALL, colourWall)
+	}
+	return CELL_EMPTY
+}
+
+func (s *Screen) paint(text string, colour string) (string) {
+	if !s.Colour {
+		return text
+	}
+	return colour + text + colourReset
+}
+
+// Returns the scoreboard as lines of text: every player's score, highest first, then this player's, unless the state
+// is a spectator's
+func Scoreboard(state shared.GameRenderState) ([]string) {
+	var players []string
+	for player := range state.Scores {
+		players = append(players, player)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		if state.Scores[players[i]] != state.Scores[players[j]] {
+			return state.Scores[players[i]] > state.Scores[players[j]]
+		}
+		return players[i] < players[j]
+	})
+
+	lines := []string{"SCORES", ""}
+	for i, player := range players {
+		lines = append(lines, fmt.Sprintf("%2d. %-6s %7d", i+1, player, state.Scores[player]))
+	}
+	if state.Spectator {
+		return lines
+	}
+	lines = append(lines, "", fmt.Sprintf("SCORE: %10d", state.Scores["ME"]))
+	if held := state.HeldScores["ME"]; held > 0 {
+		lines = append(lines, fmt.Sprintf("HELD:  %10d", held))
+	}
+	return lines
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"./impl"
+)
+
+// Main entrypoint for playing in a terminal, with no display or OpenGL needed
+// Usage: go run terminal.go [logic-node-addr]
+// To replace a client that has already played on the logic node, set WOLFPACK_TOKEN to the session token it printed
+// See also "wolfpack tui", which takes the same settings as flags
+func main() {
+	nodeAddr := ":12345" // use port 12345 on localhost for remote node if no input provided
+	if len(os.Args) > 1 {
+		nodeAddr = os.Args[1]
+	}
+	err := impl.RunClient(nodeAddr, os.Getenv("WOLFPACK_TOKEN"))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,117 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"image"
+	"image/color"
+	"../geometry"
+	r "../renderer/impl"
+	"../shared"
+)
+
+// A 100x100 map, seen through a 300x300 board
+var scrollingSettings = shared.InitialGameSettings{WindowsX: 300, WindowsY: 300, ScoreboardWidth: 200,
+	WallCoordinates: []shared.Coord{{X: 50, Y: 55}, {X: 0, Y: 50}}, MapX: 100, MapY: 100}
+
+func TestMapSizeInCells(t *testing.T) {
+	if x, y := scrollingSettings.GridSize(); x != 100 || y != 100 {
+		fmt.Println("Expected a 100x100 map, got", x, y)
+		t.Fail()
+	}
+	// With no size given, the map fits the board
+	if x, y := renderSettings.GridSize(); x != 10 || y != 10 {
+		fmt.Println("Expected a 10x10 map, got", x, y)
+		t.Fail()
+	}
+
+	grid := geometry.CreateNewGridManager(scrollingSettings)
+	if !grid.IsInBounds(shared.Coord{X: 99, Y: 99}) || grid.IsInBounds(shared.Coord{X: 100, Y: 0}) {
+		fmt.Println("Grid isn't the size of the map")
+		t.Fail()
+	}
+}
+
+func TestCameraFollows(t *testing.T) {
+	pm := geometry.CreateScrollingPixelManager(scrollingSettings, shared.GRID_CELL_PIXELS)
+	if !pm.Scrolls() || pm.GetX() != 300 || pm.GetY() != 300 {
+		fmt.Println("Board not a window onto the map")
+		t.FailNow()
+	}
+
+	for _, check := range []struct {
+		what    string
+		centre  shared.Coord
+		onBoard float64
+	}{
+		{"in the middle of the map", shared.Coord{X: 50, Y: 50}, 150},
+		// The camera stops at the edges of the map
+		{"near the bottom left", shared.Coord{X: 1, Y: 1}, 45},
+		{"near the top right", shared.Coord{X: 98, Y: 98}, 255},
+	} {
+		pm.CenterOn(pm.GetMapVectorFromCoords(check.centre))
+		vec := pm.GetVectorFromCoords(check.centre)
+		if vec.X != check.onBoard || vec.Y != check.onBoard || !pm.InView(vec) {
+			fmt.Println("Player", check.what, "drawn at", vec, "not", check.onBoard)
+			t.Fail()
+		}
+	}
+	if pm.InView(pm.GetVectorFromCoords(shared.Coord{X: 50, Y: 50})) {
+		fmt.Println("Cell far from the camera in view")
+		t.Fail()
+	}
+	if walls := pm.GetWallVectors(); walls[0].X != 50 * shared.GRID_CELL_PIXELS + 15 - 2700 {
+		fmt.Println("Walls not moved with the camera:", walls[0])
+		t.Fail()
+	}
+
+	// A map that fits on the board stays put
+	small := geometry.CreateScrollingPixelManager(renderSettings, shared.GRID_CELL_PIXELS)
+	small.CenterOn(small.GetMapVectorFromCoords(shared.Coord{X: 9, Y: 9}))
+	if small.Scrolls() || small.GetCamera().X != 0 || small.GetCamera().Y != 0 {
+		fmt.Println("Map that fits on the board scrolled")
+		t.Fail()
+	}
+}
+
+func TestRendererScrollsWithMinimap(t *testing.T) {
+	renderer, err := r.CreateRenderer(scrollingSettings, "../sprites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := shared.GameRenderState{
+		PlayerLoc:    shared.Coord{X: 50, Y: 50},
+		Prey:         shared.Coord{X: 52, Y: 50},
+		OtherPlayers: map[string]shared.Coord{"2": {X: 90, Y: 90}},
+		Scores:       map[string]int{"ME": 10, "2": 30},
+	}
+	frame := renderer.RenderFrame(state)
+	if frame.Bounds() != image.Rect(0, 0, 500, 300) {
+		fmt.Println("Frame isn't the board and scoreboard:", frame.Bounds())
+		t.FailNow()
+	}
+
+	// The player is in the middle of the board, and the rest of the map moved along with them; the mini-map is 120
+	// pixels square, 10 pixels in and 65 up from the bottom of the scoreboard, so cell (x, y) is at
+	// (310 + 1.2x, 300 - 65 - 1.2y) in the image
+	centre := image.Pt(15, 15)
+	for _, check := range []struct {
+		what   string
+		at     image.Point
+		colour color.Color
+	}{
+		{"player", image.Pt(150, 150), renderer.PlayerSprite.At(centre.X, centre.Y)},
+		{"prey", image.Pt(210, 150), renderer.PreySprite.At(centre.X, centre.Y)},
+		{"wall half off the board", image.Pt(150, 5), renderer.WallSprite.At(15, 20)},
+		{"player on the mini-map", image.Pt(371, 174), r.MinimapPlayer},
+		{"other player on the mini-map", image.Pt(419, 126), r.MinimapWolf},
+		{"wall on the mini-map", image.Pt(311, 174), r.MinimapWall},
+		{"empty cell on the mini-map", image.Pt(335, 210), r.MinimapBackground},
+		{"edge of the view on the mini-map", image.Pt(364, 170), r.MinimapView},
+	} {
+		if !sameColour(frame.At(check.at.X, check.at.Y), check.colour) {
+			fmt.Printf("Expected the %s at %v, found %v\n", check.what, check.at, frame.At(check.at.X, check.at.Y))
+			t.Fail()
+		}
+	}
+}
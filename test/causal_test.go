@@ -0,0 +1,76 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	l "../logic/impl"
+)
+
+func TestCompareClocks(t *testing.T) {
+	a := map[string]uint64{"LogicNodeId-1": 2, "LogicNodeId-2": 1}
+	b := map[string]uint64{"LogicNodeId-1": 3, "LogicNodeId-2": 1}
+	c := map[string]uint64{"LogicNodeId-1": 1, "LogicNodeId-2": 4}
+	if l.CompareClocks(a, b) != -1 || l.CompareClocks(b, a) != 1 {
+		fmt.Println("Happened-before not detected")
+		t.Fail()
+	}
+	if l.CompareClocks(b, c) != 0 || l.CompareClocks(a, a) != 0 {
+		fmt.Println("Concurrent or equal clocks not detected")
+		t.Fail()
+	}
+}
+
+func TestConcurrentCapturesResolveTheSameEitherWay(t *testing.T) {
+	first := &l.CaptureClaim{Identifier: "2", PreySeq: 7, Tick: 100,
+		VClock: map[string]uint64{"LogicNodeId-2": 5, "LogicNodeId-prey": 7}}
+	second := &l.CaptureClaim{Identifier: "1", PreySeq: 7, Tick: 100,
+		VClock: map[string]uint64{"LogicNodeId-1": 3, "LogicNodeId-prey": 7}}
+
+	// Two nodes that hear about the captures in opposite orders must agree on the winner
+	for _, order := range [][]*l.CaptureClaim{{first, second}, {second, first}} {
+		arbiter := l.CreateCaptureArbiter()
+		standing := ""
+		for _, claim := range order {
+			if arbiter.Beats(claim) {
+				arbiter.Record(claim)
+				standing = claim.Identifier
+			}
+		}
+		if standing != "1" {
+			fmt.Println("Concurrent captures with equal ticks should go to the smaller identifier, got", standing)
+			t.Fail()
+		}
+	}
+}
+
+func TestEarlierCaptureBeatsLowerTick(t *testing.T) {
+	arbiter := l.CreateCaptureArbiter()
+	early := &l.CaptureClaim{Identifier: "2", PreySeq: 3, Tick: 50,
+		VClock: map[string]uint64{"LogicNodeId-2": 1}}
+	// Happened after early (it has seen node 2's capture), but claims a lower tick
+	late := &l.CaptureClaim{Identifier: "1", PreySeq: 3, Tick: 40,
+		VClock: map[string]uint64{"LogicNodeId-1": 1, "LogicNodeId-2": 1}}
+	arbiter.Record(early)
+	if arbiter.Beats(late) {
+		fmt.Println("A capture causally after another should never win")
+		t.Fail()
+	}
+}
+
+func TestStaleCaptureRejected(t *testing.T) {
+	arbiter := l.CreateCaptureArbiter()
+	arbiter.RecordPreyMove(4, map[string]uint64{"LogicNodeId-prey": 10})
+	arbiter.RecordPreyMove(5, map[string]uint64{"LogicNodeId-prey": 12})
+
+	// Claims the prey at move 4, having already heard from the prey at or after move 5
+	stale := &l.CaptureClaim{Identifier: "1", PreySeq: 4, VClock: map[string]uint64{"LogicNodeId-prey": 12}}
+	if arbiter.CheckNotStale(stale) == nil {
+		fmt.Println("Capture made after the prey moved on was accepted")
+		t.Fail()
+	}
+	fresh := &l.CaptureClaim{Identifier: "1", PreySeq: 4, VClock: map[string]uint64{"LogicNodeId-prey": 11}}
+	if arbiter.CheckNotStale(fresh) != nil {
+		fmt.Println("Capture made before the prey moved on was rejected")
+		t.Fail()
+	}
+}
@@ -0,0 +1,88 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"net"
+	"net/rpc"
+	"time"
+	key "../key-helpers"
+	l "../logic/impl"
+	"../shared"
+)
+
+// A stand-in for the global server whose clock runs an hour ahead of ours
+type skewedServer struct{}
+
+func (s *skewedServer) Nonce(_ignored bool, nonce *string) error {
+	*nonce = "nonce"
+	return nil
+}
+
+func (s *skewedServer) GetTime(auth shared.RPCAuth, now *int64) error {
+	if _, err := key.VerifyRPC(auth, "GServer.GetTime"); err != nil {
+		return err
+	}
+	*now = time.Now().Add(time.Hour).UnixNano()
+	return nil
+}
+
+func TestClockSyncEstimatesOffset(t *testing.T) {
+	server := rpc.NewServer()
+	server.RegisterName("GServer", &skewedServer{})
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go server.Accept(listener)
+
+	conn, err := rpc.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock := l.CreateGameClock(50)
+	_, privKey := key.GenerateKeys()
+	err = clock.Sync(conn, privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drift := clock.Offset() - time.Hour
+	if drift < -100*time.Millisecond || drift > 100*time.Millisecond {
+		fmt.Println("Clock offset estimate too far off:", clock.Offset())
+		t.Fail()
+	}
+	if clock.CurrentTick() < uint64(time.Now().Add(time.Hour).UnixNano()/int64(50*time.Millisecond))-2 {
+		fmt.Println("Current tick does not follow the server's clock")
+		t.Fail()
+	}
+}
+
+func TestTickQueueAppliesInTickOrder(t *testing.T) {
+	queue := l.TickQueue{}
+	var applied []string
+	push := func(tick uint64, id string, seq uint64) {
+		queue.Push(&l.TickedMessage{Tick: tick, Identifier: id, Seq: seq, Apply: func() {
+			applied = append(applied, fmt.Sprintf("%d/%s/%d", tick, id, seq))
+		}})
+	}
+	push(12, "2", 1)
+	push(10, "3", 4)
+	push(12, "1", 7)
+	push(10, "3", 2)
+	push(15, "1", 8)
+
+	for _, message := range queue.PopUpTo(12) {
+		message.Apply()
+	}
+	expected := []string{"10/3/2", "10/3/4", "12/1/7", "12/2/1"}
+	if fmt.Sprint(applied) != fmt.Sprint(expected) {
+		fmt.Println("Messages applied out of order:", applied)
+		t.Fail()
+	}
+	if queue.Len() != 1 {
+		fmt.Println("Message from a future tick was applied early")
+		t.Fail()
+	}
+}
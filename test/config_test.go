@@ -0,0 +1,159 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"os"
+	"io/ioutil"
+	"path/filepath"
+	key "../key-helpers"
+	w "../wolfpack/impl"
+	"../wolferrors"
+)
+
+func writeConfigFile(t *testing.T, name string, contents string) (string) {
+	dir, err := ioutil.TempDir("", "wolfpack-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, name)
+	err = ioutil.WriteFile(path, []byte(contents), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestConfigDefaults(t *testing.T) {
+	config, err := w.ParseConfig("player", []string{})
+	if err != nil {
+		fmt.Println("Could not parse empty command line:", err)
+		t.FailNow()
+	}
+	if config.Server != ":8081" || config.Listen != ":0" || config.Pixel != ":12345" || config.LogDir != "." {
+		fmt.Println("Wrong defaults:", config)
+		t.Fail()
+	}
+
+	// The server sends every move to every node unless given an interest radius
+	config, err = w.ParseConfig("server", []string{})
+	if err != nil || config.InterestRadius != 0 {
+		fmt.Println("Interest radius on by default:", config.InterestRadius, err)
+		t.Fail()
+	}
+	config, err = w.ParseConfig("server", []string{"-interest-radius", "8"})
+	if err != nil || config.InterestRadius != 8 {
+		fmt.Println("Interest radius not set:", config.InterestRadius, err)
+		t.Fail()
+	}
+}
+
+func TestConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "wolfpack.json",
+		`{"server": "file:8081", "room": "file-room", "log-dir": "file-logs", "loopback": true, "map": 1}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	os.Setenv("WOLFPACK_ROOM", "env-room")
+	os.Setenv("WOLFPACK_LOG_DIR", "env-logs")
+	defer os.Unsetenv("WOLFPACK_ROOM")
+	defer os.Unsetenv("WOLFPACK_LOG_DIR")
+
+	config, err := w.ParseConfig("player", []string{"-config", path, "-log-dir", "flag-logs"})
+	if err != nil {
+		fmt.Println("Could not parse config:", err)
+		t.FailNow()
+	}
+	if config.Server != "file:8081" || !config.Loopback {
+		fmt.Println("Config file not read:", config)
+		t.Fail()
+	}
+	if config.Room != "env-room" {
+		fmt.Println("Environment doesn't override the config file:", config.Room)
+		t.Fail()
+	}
+	if config.LogDir != "flag-logs" {
+		fmt.Println("Flag doesn't override the environment:", config.LogDir)
+		t.Fail()
+	}
+
+	// The same file configures the server, which takes the map but not the room
+	config, err = w.ParseConfig("server", []string{"-config", path})
+	if err != nil || config.Map != "1" || config.Server != "file:8081" {
+		fmt.Println("Server config not read from shared file:", config, err)
+		t.Fail()
+	}
+}
+
+func TestConfigYAML(t *testing.T) {
+	path := writeConfigFile(t, "wolfpack.yaml", "---\n# a bot\nserver: \"[::1]:8081\"\nstrategy: random # wander\n\n")
+	defer os.RemoveAll(filepath.Dir(path))
+	os.Setenv("WOLFPACK_CONFIG", path)
+	defer os.Unsetenv("WOLFPACK_CONFIG")
+
+	config, err := w.ParseConfig("bot", []string{})
+	if err != nil || config.Server != "[::1]:8081" || config.Strategy != "random" {
+		fmt.Println("YAML config not read:", config, err)
+		t.Fail()
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	if _, err := w.ParseConfig("referee", []string{}); err == nil {
+		fmt.Println("Unknown command accepted")
+		t.Fail()
+	} else if _, ok := err.(wolferrors.UnknownCommandError); !ok {
+		fmt.Println("Wrong error for unknown command:", err)
+		t.Fail()
+	}
+	if _, err := w.ParseConfig("client", []string{"-room", "lobby"}); err == nil {
+		fmt.Println("Flag accepted by a command that doesn't take it")
+		t.Fail()
+	}
+
+	path := writeConfigFile(t, "wolfpack.json", `{"sever": ":8081"}`)
+	defer os.RemoveAll(filepath.Dir(path))
+	if _, err := w.ParseConfig("player", []string{"-config", path}); err == nil {
+		fmt.Println("Misspelt setting in config file accepted")
+		t.Fail()
+	}
+
+	os.Setenv("WOLFPACK_LOOPBACK", "sometimes")
+	defer os.Unsetenv("WOLFPACK_LOOPBACK")
+	if _, err := w.ParseConfig("player", []string{}); err == nil {
+		fmt.Println("Bad boolean in environment accepted")
+		t.Fail()
+	}
+}
+
+func TestConfigKeyFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wolfpack-keys")
+	defer os.RemoveAll(dir)
+	created, err := key.OpenKeystore(dir).Create("alice", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A key file is only ever named by -key-file
+	config, err := w.ParseConfig("player", []string{"-keystore", dir, "-key-file", filepath.Join(dir, "alice.key")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := config.LoadKey()
+	if err != nil || !key.CheckKeyRestore(created.Public(), loaded) {
+		fmt.Println("Did not load the key file:", err)
+		t.Fail()
+	}
+
+	// and -key always names an identity, even one that looks like a file
+	config, err = w.ParseConfig("player", []string{"-keystore", dir, "-key", "alice.v2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.LoadKey(); err != nil {
+		fmt.Println("Could not create an identity with a dot in its name:", err)
+		t.Fail()
+	}
+	if _, err := os.Stat(filepath.Join(dir, "alice.v2.key")); err != nil {
+		fmt.Println("Identity not created in the keystore:", err)
+		t.Fail()
+	}
+}
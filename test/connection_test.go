@@ -27,7 +27,10 @@ func TestHeartbeat(t *testing.T) {
 	node := n.CreateNodeCommInterface(pubKey, privKey, ":8081")
 	go node.ManageOtherNodes()
 
-	addr1, nodeConn := n.StartListenerUDP(":2124")
+	addr1, nodeConn, err := n.StartListenerUDP(":2124")
+	if err != nil {
+		t.Fatal(err)
+	}
 	node.LocalAddr = addr1
 	go node.RunListener(nodeConn, addr1.String())
 
@@ -38,7 +41,10 @@ func TestHeartbeat(t *testing.T) {
 	node2 := n.CreateNodeCommInterface(pubKey, privKey, ":8081")
 	go node2.ManageOtherNodes()
 
-	addr2, nodeConn2 := n.StartListenerUDP(":2125")
+	addr2, nodeConn2, err := n.StartListenerUDP(":2125")
+	if err != nil {
+		t.Fatal(err)
+	}
 	node2.LocalAddr = addr2
 	go node2.RunListener(nodeConn2, addr2.String())
 	_ = node2.ServerRegister()
@@ -181,7 +187,7 @@ func TestServerDies(t *testing.T) {
 	// Test if still alive
 
 	var _ignored bool
-	err := node.ServerConn.Call("GServer.Heartbeat", *node.PubKey, &_ignored)
+	err := node.CallServer("GServer.Heartbeat", &_ignored)
 	if err == nil {
 		fmt.Println("Server should be dead")
 		os.Exit(1)
@@ -197,7 +203,7 @@ func TestServerDies(t *testing.T) {
 	}
 	time.Sleep(3*time.Second)
 	node.Reregister()
-	err = node.ServerConn.Call("GServer.Heartbeat", *node.PubKey, &_ignored)
+	err = node.CallServer("GServer.Heartbeat", &_ignored)
 	if err != nil {
 		fmt.Println("Server should be alive" )
 		os.Exit(1)
@@ -222,7 +228,10 @@ func TestPubKey(t *testing.T) {
 	node := n.CreateNodeCommInterface(pubKey1, privKey1, ":8081")
 	go node.ManageOtherNodes()
 
-	addr1, nodeConn := n.StartListenerUDP(":2140")
+	addr1, nodeConn, err := n.StartListenerUDP(":2140")
+	if err != nil {
+		t.Fatal(err)
+	}
 	node.LocalAddr = addr1
 	go node.RunListener(nodeConn, addr1.String())
 
@@ -233,34 +242,21 @@ func TestPubKey(t *testing.T) {
 	node2 := n.CreateNodeCommInterface(pubKey2, privKey2, ":8081")
 	go node2.ManageOtherNodes()
 
-	addr2, nodeConn2 := n.StartListenerUDP(":2150")
+	addr2, nodeConn2, err := n.StartListenerUDP(":2150")
+	if err != nil {
+		t.Fatal(err)
+	}
 	node2.LocalAddr = addr2
 	go node2.RunListener(nodeConn2, addr2.String())
 	node2Id := node2.ServerRegister()
 
 	time.Sleep(2*time.Second)
 
-	if pubKey1.X.Cmp(node2.NodeKeys[nodeId].X) != 0 {
-		fmt.Printf("Fail, node 2 does not have node 1's public key")
-	}
-
-	if pubKey1.Y.Cmp(node2.NodeKeys[nodeId].Y) != 0 {
+	if key_helpers.PubKeyToString(pubKey1) != key_helpers.PubKeyToString(node2.NodeKeys[nodeId]) {
 		fmt.Printf("Fail, node 2 does not have node 1's public key")
 	}
 
-	if pubKey1.Curve != node2.NodeKeys[nodeId].Curve {
-		fmt.Printf("Fail, node 2 does not have node 1's public key")
-	}
-
-	if pubKey2.X.Cmp(node.NodeKeys[node2Id].X) != 0 {
-		fmt.Printf("Fail, node 1 does not have node 2's public key")
-	}
-
-	if pubKey2.Y.Cmp(node.NodeKeys[node2Id].Y) != 0 {
-		fmt.Printf("Fail, node 1 does not have node 2's public key")
-	}
-
-	if pubKey2.Curve != node.NodeKeys[node2Id].Curve {
+	if key_helpers.PubKeyToString(pubKey2) != key_helpers.PubKeyToString(node.NodeKeys[node2Id]) {
 		fmt.Printf("Fail, node 1 does not have node 2's public key")
 	}
 
@@ -0,0 +1,127 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"bytes"
+	"../shared"
+	l "../logic/impl"
+)
+
+func digestState(locs map[string]shared.Coord, scores map[string]int) (*shared.GameState) {
+	return &shared.GameState{
+		PlayerLocs:   shared.PlayerLockMap{Data: locs},
+		PlayerScores: shared.ScoresLockMap{Data: scores},
+	}
+}
+
+func TestGameStateDigest(t *testing.T) {
+	a := digestState(map[string]shared.Coord{"1": {1, 2}, "2": {3, 4}, "prey": {5, 5}}, map[string]int{"1": 2, "2": 0})
+	b := digestState(map[string]shared.Coord{"prey": {5, 5}, "2": {3, 4}, "1": {1, 2}}, map[string]int{"2": 0, "1": 2})
+	if !bytes.Equal(l.GameStateDigest(a, 3, "1", true), l.GameStateDigest(b, 3, "1", true)) {
+		fmt.Println("Equal gamestates gave different digests")
+		t.Fail()
+	}
+	if bytes.Equal(l.GameStateDigest(a, 3, "1", true), l.GameStateDigest(b, 4, "1", true)) {
+		fmt.Println("Digest ignores the prey epoch")
+		t.Fail()
+	}
+	b.PlayerScores.Data["2"] = 1
+	if bytes.Equal(l.GameStateDigest(a, 3, "1", true), l.GameStateDigest(b, 3, "1", true)) {
+		fmt.Println("Digest ignores scores")
+		t.Fail()
+	}
+	b.PlayerScores.Data["2"] = 0
+	b.PlayerScores.Data["3"] = 0
+	if !bytes.Equal(l.GameStateDigest(a, 3, "1", true), l.GameStateDigest(b, 3, "1", true)) {
+		fmt.Println("A score of 0 and no score gave different digests")
+		t.Fail()
+	}
+	b.PlayerLocs.Data["1"] = shared.Coord{2, 1}
+	if bytes.Equal(l.GameStateDigest(a, 3, "1", true), l.GameStateDigest(b, 3, "1", true)) {
+		fmt.Println("Digest ignores the sender's position")
+		t.Fail()
+	}
+	// Node 1 can't repair where anyone else is, so its digest doesn't cover it
+	b.PlayerLocs.Data["1"] = shared.Coord{1, 2}
+	b.PlayerLocs.Data["2"] = shared.Coord{4, 3}
+	b.PlayerLocs.Data["prey"] = shared.Coord{6, 6}
+	if !bytes.Equal(l.GameStateDigest(a, 3, "1", true), l.GameStateDigest(b, 3, "1", true)) {
+		fmt.Println("Digest covers positions the sender isn't the authority on")
+		t.Fail()
+	}
+}
+
+func TestMergeGameStateConverges(t *testing.T) {
+	a := digestState(map[string]shared.Coord{"1": {1, 1}, "2": {2, 2}, "prey": {5, 5}}, map[string]int{})
+	b := digestState(map[string]shared.Coord{"1": {1, 2}, "2": {2, 3}, "prey": {7, 7}}, map[string]int{})
+	aCopy := digestState(map[string]shared.Coord{"1": {1, 1}, "2": {2, 2}, "prey": {5, 5}}, map[string]int{})
+	for _, scores := range []*shared.ScoresLockMap{&a.PlayerScores, &aCopy.PlayerScores} {
+		l.AddCaptureEvent(scores, "1/4", shared.CaptureEvent{Player: "1", Worth: 1})
+		l.AddCaptureEvent(scores, "1/9", shared.CaptureEvent{Player: "1", Worth: 1})
+	}
+	l.AddCaptureEvent(&b.PlayerScores, "1/4", shared.CaptureEvent{Player: "1", Worth: 1})
+	l.AddCaptureEvent(&b.PlayerScores, "2/6", shared.CaptureEvent{Player: "2", Worth: 1})
+
+	// Both sides send each other their gamestates, as in a digest repair between nodes 1 and 2
+	epochA, _ := l.MergeGameState(a, 1, "1", b, 2, "2")
+	epochB, _ := l.MergeGameState(b, 2, "2", aCopy, 1, "1")
+
+	if epochA != 2 || epochB != 2 {
+		fmt.Println("Prey epochs did not converge:", epochA, epochB)
+		t.Fail()
+	}
+	if !bytes.Equal(l.GameStateDigest(a, epochA, "2", true), l.GameStateDigest(b, epochB, "2", true)) {
+		fmt.Println("Gamestates still differ after repair:", a.PlayerLocs.Data, a.PlayerScores.Data, "vs",
+			b.PlayerLocs.Data, b.PlayerScores.Data)
+		t.Fail()
+	}
+	if a.PlayerLocs.Data["1"] != (shared.Coord{1, 1}) || a.PlayerLocs.Data["prey"] != (shared.Coord{7, 7}) {
+		fmt.Println("Node kept the wrong positions:", a.PlayerLocs.Data)
+		t.Fail()
+	}
+	if a.PlayerScores.Data["1"] != 2 || a.PlayerScores.Data["2"] != 1 {
+		fmt.Println("Node has the wrong scores:", a.PlayerScores.Data)
+		t.Fail()
+	}
+}
+
+func TestDigestRepairConvergesOnThirdPlayer(t *testing.T) {
+	ids := []string{"1", "2", "3"}
+	states := map[string]*shared.GameState{
+		"1": digestState(map[string]shared.Coord{"1": {1, 1}, "2": {2, 2}, "3": {4, 4}, "prey": {5, 5}}, map[string]int{}),
+		"2": digestState(map[string]shared.Coord{"1": {1, 1}, "2": {2, 2}, "3": {6, 6}, "prey": {5, 5}}, map[string]int{}),
+		"3": digestState(map[string]shared.Coord{"1": {1, 1}, "2": {2, 2}, "3": {3, 3}, "prey": {5, 5}}, map[string]int{}),
+	}
+	// Every node sends every other its digest; a receiver that disagrees swaps gamestates with the sender
+	exchange := func() (mismatches int) {
+		for _, from := range ids {
+			digest := l.GameStateDigest(states[from], 0, from, true)
+			for _, to := range ids {
+				if to == from || bytes.Equal(digest, l.GameStateDigest(states[to], 0, from, true)) {
+					continue
+				}
+				mismatches++
+				l.MergeGameState(states[to], 0, to, states[from], 0, from)
+				l.MergeGameState(states[from], 0, from, states[to], 0, to)
+			}
+		}
+		return mismatches
+	}
+
+	// Nodes 1 and 2 disagree about where node 3 is; that's for node 3's digests to repair, not theirs
+	if mismatches := exchange(); mismatches != 2 {
+		fmt.Println("Expected nodes 1 and 2 to each disagree with node 3 once, got", mismatches, "mismatches")
+		t.Fail()
+	}
+	if mismatches := exchange(); mismatches != 0 {
+		fmt.Println("Digests still disagree after a repair:", mismatches)
+		t.Fail()
+	}
+	for _, id := range ids {
+		if states[id].PlayerLocs.Data["3"] != (shared.Coord{3, 3}) {
+			fmt.Println("Node", id, "has node 3 at", states[id].PlayerLocs.Data["3"])
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"bytes"
+	"../shared"
+	l "../logic/impl"
+	serverImpl "../server/impl"
+	"../wolferrors"
+)
+
+func TestWithinInterest(t *testing.T) {
+	pos := shared.Coord{5, 5}
+	if !l.WithinInterest(pos, shared.Coord{8, 7}, 5) {
+		fmt.Println("Node 5 cells away should be within a radius of 5")
+		t.Fail()
+	}
+	if l.WithinInterest(pos, shared.Coord{9, 7}, 5) {
+		fmt.Println("Node 6 cells away should be outside a radius of 5")
+		t.Fail()
+	}
+	if !l.WithinInterest(pos, shared.Coord{100, 100}, 0) {
+		fmt.Println("With no radius, every node should be of interest")
+		t.Fail()
+	}
+}
+
+func TestDigestWithoutPositions(t *testing.T) {
+	a := digestState(map[string]shared.Coord{"1": {1, 2}, "2": {3, 4}, "prey": {5, 5}}, map[string]int{"2": 1})
+	b := digestState(map[string]shared.Coord{"1": {1, 2}, "2": {9, 9}, "prey": {5, 5}}, map[string]int{"2": 1})
+	// With an interest radius, far away wolves' positions are only roughly known, so they mustn't count as divergence
+	if !bytes.Equal(l.GameStateDigest(a, 0, "2", false), l.GameStateDigest(b, 0, "2", false)) {
+		fmt.Println("Wolf positions included in digest without positions")
+		t.Fail()
+	}
+	b.PlayerScores.Data["2"] = 2
+	if bytes.Equal(l.GameStateDigest(a, 0, "2", false), l.GameStateDigest(b, 0, "2", false)) {
+		fmt.Println("Scores left out of digest without positions")
+		t.Fail()
+	}
+}
+
+func TestInterestRadiusNeedsPreyNode(t *testing.T) {
+	err := serverImpl.RunServer(serverImpl.ServerConfig{Addr: "127.0.0.1:8095", Map: "0", PreyMode: "replicated",
+		InterestRadius: 8})
+	if _, ok := err.(wolferrors.BadConfigError); !ok {
+		fmt.Println("Server took an interest radius with replicated prey:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,96 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"time"
+	"../shared"
+)
+
+func interpolationState(prey shared.Coord, wolves map[string]shared.Coord) (shared.GameRenderState) {
+	return shared.GameRenderState{Prey: prey, OtherPlayers: wolves}
+}
+
+func TestInterpolatorSlidesBetweenCells(t *testing.T) {
+	ip := shared.CreateInterpolator()
+	start := time.Now()
+	ip.Update(interpolationState(shared.Coord{X: 5, Y: 5}, map[string]shared.Coord{"1": {X: 1, Y: 1}}), start)
+
+	// Seen for the first time, an entity is drawn where it is
+	if tween, ok := ip.Tween("1", start); !ok || tween.To != (shared.Coord{X: 1, Y: 1}) || tween.Progress != 1 {
+		fmt.Println("New wolf not drawn in place:", tween, ok)
+		t.Fail()
+	}
+
+	// The wolf moves after standing still a while: the move is slid over INTERPOLATION_DELAY
+	moved := start.Add(time.Second)
+	ip.Update(interpolationState(shared.Coord{X: 5, Y: 5}, map[string]shared.Coord{"1": {X: 2, Y: 1}}), moved)
+	if !ip.Animating(moved) {
+		fmt.Println("Not animating a move")
+		t.Fail()
+	}
+	tween, _ := ip.Tween("1", moved)
+	if tween.From != (shared.Coord{X: 1, Y: 1}) || (tween.Progress != 0 && tween.To != tween.From) {
+		fmt.Println("Move not drawn from the start:", tween)
+		t.Fail()
+	}
+	tween, _ = ip.Tween("1", moved.Add(shared.INTERPOLATION_DELAY / 2))
+	if tween.From != (shared.Coord{X: 1, Y: 1}) || tween.To != (shared.Coord{X: 2, Y: 1}) || tween.Progress != 0.5 {
+		fmt.Println("Move not drawn halfway:", tween)
+		t.Fail()
+	}
+	done := moved.Add(shared.INTERPOLATION_DELAY)
+	tween, _ = ip.Tween("1", done)
+	if tween.To != (shared.Coord{X: 2, Y: 1}) || tween.Progress != 1 || ip.Animating(done) {
+		fmt.Println("Move not finished:", tween)
+		t.Fail()
+	}
+
+	// A respawn isn't slid across the board
+	ip.Update(interpolationState(shared.Coord{X: 1, Y: 8}, map[string]shared.Coord{"1": {X: 2, Y: 1}}), done)
+	tween, _ = ip.Tween(shared.PREY_ID, done.Add(shared.INTERPOLATION_DELAY / 2))
+	if tween.From != (shared.Coord{X: 1, Y: 8}) || tween.To != (shared.Coord{X: 1, Y: 8}) {
+		fmt.Println("Respawned prey slid:", tween)
+		t.Fail()
+	}
+}
+
+func TestInterpolatorFadesStaleEntities(t *testing.T) {
+	ip := shared.CreateInterpolator()
+	start := time.Now()
+	ip.Update(interpolationState(shared.Coord{X: 5, Y: 5},
+		map[string]shared.Coord{"1": {X: 1, Y: 1}, "2": {X: 3, Y: 3}}), start)
+	// Wolf 2 leaves; wolf 1 and the prey keep appearing in the states
+	later := start.Add(shared.STALE_AFTER + shared.FADE_TIME / 2)
+	ip.Update(interpolationState(shared.Coord{X: 5, Y: 5}, map[string]shared.Coord{"1": {X: 1, Y: 1}}), later)
+
+	if tween, ok := ip.Tween("1", later); !ok || tween.Alpha != 1 {
+		fmt.Println("Wolf still in the states faded:", tween, ok)
+		t.Fail()
+	}
+	if tween, ok := ip.Tween("2", later); !ok || tween.Alpha != 0.5 || tween.To != (shared.Coord{X: 3, Y: 3}) {
+		fmt.Println("Stale wolf not fading where it was last seen:", tween, ok)
+		t.Fail()
+	}
+	if !ip.Animating(later) {
+		fmt.Println("Not animating a fade")
+		t.Fail()
+	}
+
+	gone := start.Add(shared.STALE_AFTER + shared.FADE_TIME)
+	if _, ok := ip.Tween("2", gone); ok {
+		fmt.Println("Stale wolf not gone once faded out")
+		t.Fail()
+	}
+	if wolves := ip.Wolves(); len(wolves) != 1 || wolves[0] != "1" {
+		fmt.Println("Expected only wolf 1 left, got", wolves)
+		t.Fail()
+	}
+
+	// Back again, the wolf appears where it is
+	ip.Update(interpolationState(shared.Coord{X: 5, Y: 5}, map[string]shared.Coord{"2": {X: 7, Y: 7}}), gone)
+	if tween, ok := ip.Tween("2", gone); !ok || tween.From != (shared.Coord{X: 7, Y: 7}) || tween.Alpha != 1 {
+		fmt.Println("Returning wolf not drawn in place:", tween, ok)
+		t.Fail()
+	}
+}
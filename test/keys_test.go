@@ -0,0 +1,137 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	key "../key-helpers"
+	l "../logic/impl"
+	"../shared"
+)
+
+func TestPublicKeyEncodingRoundTrip(t *testing.T) {
+	p256, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	p384, _ := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	edPub, edPriv, _ := key.GenerateKeysForScheme(key.SCHEME_ED25519)
+	for name, pub := range map[string]interface{}{"P-256": &p256.PublicKey, "P-384": &p384.PublicKey, "Ed25519": edPub} {
+		encoded, err := key.EncodePublicKey(pub)
+		if err != nil {
+			fmt.Println("Could not encode", name, "key:", err)
+			t.Fail()
+			continue
+		}
+		decoded, err := key.DecodePublicKey(encoded)
+		if err != nil || key.PubKeyToString(decoded) != encoded {
+			fmt.Println(name, "key didn't survive encoding:", err)
+			t.Fail()
+		}
+	}
+
+	// Keys held by value encode the same as by pointer
+	if key.PubKeyToString(p384.PublicKey) != key.PubKeyToString(&p384.PublicKey) {
+		fmt.Println("ECDSA key by value encoded differently")
+		t.Fail()
+	}
+
+	privPEM, pubPEM := key.Encode(edPriv, edPub)
+	restored, err := key.ParsePrivateKey(privPEM)
+	if err != nil || key.PubKeyToString(restored.Public()) != pubPEM {
+		fmt.Println("Ed25519 private key didn't survive encoding:", err)
+		t.Fail()
+	}
+}
+
+func TestKeyParseErrors(t *testing.T) {
+	if _, err := key.DecodePublicKey("not a key"); err == nil {
+		fmt.Println("Garbage decoded as a public key")
+		t.Fail()
+	}
+	garbled := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("garbled")}))
+	if _, err := key.DecodePublicKey(garbled); err == nil {
+		fmt.Println("Garbled PEM decoded as a public key")
+		t.Fail()
+	}
+	if _, err := key.ParsePrivateKey("not a key"); err == nil {
+		fmt.Println("Garbage parsed as a private key")
+		t.Fail()
+	}
+
+	// Keys in the SEC 1 format keystores used to write still load
+	_, priv := key.GenerateKeys()
+	sec1, _ := x509.MarshalECPrivateKey(priv)
+	restored, err := key.ParsePrivateKey(string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: sec1})))
+	if err != nil || !key.CheckKeyRestore(&priv.PublicKey, restored) {
+		fmt.Println("SEC 1 private key didn't load:", err)
+		t.Fail()
+	}
+}
+
+func TestSignAndVerifySchemes(t *testing.T) {
+	data := []byte("up")
+	for _, scheme := range []string{key.SCHEME_ECDSA, key.SCHEME_ED25519} {
+		pub, priv, err := key.GenerateKeysForScheme(scheme)
+		if err != nil {
+			fmt.Println("Could not generate", scheme, "keys:", err)
+			t.Fail()
+			continue
+		}
+		otherPub, _, _ := key.GenerateKeysForScheme(scheme)
+		// Enough signatures that some Ed25519 halves have leading zero bytes
+		for i := 0; i < 100; i++ {
+			r, s, err := key.Sign(priv, data)
+			if err != nil || !key.Verify(pub, data, r, s) {
+				fmt.Println(scheme, "signature didn't verify:", err)
+				t.Fail()
+				break
+			}
+			if key.Verify(otherPub, data, r, s) || key.Verify(pub, []byte("down"), r, s) {
+				fmt.Println(scheme, "signature verified against the wrong key or data")
+				t.Fail()
+				break
+			}
+		}
+	}
+	if _, _, err := key.GenerateKeysForScheme("rot13"); err == nil {
+		fmt.Println("Unknown scheme accepted")
+		t.Fail()
+	}
+}
+
+func TestEd25519MovesAndCommits(t *testing.T) {
+	pub, priv, _ := key.GenerateKeysForScheme(key.SCHEME_ED25519)
+	pn := l.PlayerNode{Identifier: "ed"}
+	n := l.NodeCommInterface{PlayerNode: &pn, PubKey: pub, PrivKey: priv}
+
+	move := shared.Coord{3, 4}
+	signed := n.CreateMove(&move)
+	if !n.CheckAuthenticityOfMove(pub, &signed) {
+		fmt.Println("Ed25519 move didn't verify")
+		t.Fail()
+	}
+	ecPub, _ := key.GenerateKeys()
+	if n.CheckAuthenticityOfMove(ecPub, &signed) {
+		fmt.Println("Ed25519 move verified against an ECDSA key")
+		t.Fail()
+	}
+
+	hash := n.CalculateHash(move, "ed")
+	r, s, err := n.SignMoveCommit(hash)
+	if err != nil {
+		fmt.Println("Could not sign move commit:", err)
+		t.FailNow()
+	}
+	commit := shared.MoveCommit{MoveHash: hash, PubKey: key.PubKeyToString(pub), R: r.String(), S: s.String()}
+	if !n.CheckAuthenticityOfMoveCommit(&commit) {
+		fmt.Println("Ed25519 move commit didn't verify")
+		t.Fail()
+	}
+	commit.PubKey = "not a key"
+	if n.CheckAuthenticityOfMoveCommit(&commit) {
+		fmt.Println("Move commit with a bad key verified")
+		t.Fail()
+	}
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"os"
+	"io/ioutil"
+	key "../key-helpers"
+	"../wolferrors"
+)
+
+func TestKeystoreCreateAndLoad(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wolfpack-keys")
+	defer os.RemoveAll(dir)
+	keystore := key.OpenKeystore(dir)
+
+	created, err := keystore.Create("alice", "")
+	if err != nil {
+		fmt.Println("Could not create identity:", err)
+		t.FailNow()
+	}
+	loaded, err := keystore.Load("alice", "")
+	if err != nil || !key.CheckKeyRestore(created.Public(), loaded) {
+		fmt.Println("Loaded key doesn't match the created one:", err)
+		t.Fail()
+	}
+	if _, err := keystore.Create("alice", ""); err == nil {
+		fmt.Println("Identity created twice")
+		t.Fail()
+	}
+
+	again, err := keystore.LoadOrCreate("alice", "")
+	if err != nil || !key.CheckKeyRestore(created.Public(), again) {
+		fmt.Println("LoadOrCreate made a new key for an existing identity:", err)
+		t.Fail()
+	}
+	if _, err := keystore.LoadOrCreate("bob", ""); err != nil {
+		fmt.Println("LoadOrCreate could not create identity:", err)
+		t.Fail()
+	}
+
+	names, err := keystore.List()
+	if err != nil || fmt.Sprint(names) != "[alice bob]" {
+		fmt.Println("Wrong identities listed:", names, err)
+		t.Fail()
+	}
+
+	pubPEM, err := keystore.ExportPublic("alice")
+	if err != nil || pubPEM != key.PubKeyToString(created.Public()) {
+		fmt.Println("Exported public key doesn't match:", err)
+		t.Fail()
+	}
+	if _, err := keystore.Load("../alice", ""); err == nil {
+		fmt.Println("Loaded an identity from outside the keystore")
+		t.Fail()
+	}
+}
+
+func TestKeystorePassphrase(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wolfpack-keys")
+	defer os.RemoveAll(dir)
+	keystore := key.OpenKeystore(dir)
+
+	created, err := keystore.Create("carol", "correct horse")
+	if err != nil {
+		fmt.Println("Could not create encrypted identity:", err)
+		t.FailNow()
+	}
+	if encrypted, _ := keystore.Encrypted("carol"); !encrypted {
+		fmt.Println("Identity with a passphrase not encrypted")
+		t.Fail()
+	}
+	if _, err := keystore.Load("carol", "battery staple"); err == nil {
+		fmt.Println("Wrong passphrase accepted")
+		t.Fail()
+	} else if _, ok := err.(wolferrors.BadPassphraseError); !ok {
+		fmt.Println("Wrong error for wrong passphrase:", err)
+		t.Fail()
+	}
+	if _, err := keystore.Load("carol", ""); err == nil {
+		fmt.Println("Encrypted key loaded without a passphrase")
+		t.Fail()
+	}
+	loaded, err := keystore.Load("carol", "correct horse")
+	if err != nil || !key.CheckKeyRestore(created.Public(), loaded) {
+		fmt.Println("Could not decrypt identity:", err)
+		t.Fail()
+	}
+	// The public key can be exported without the passphrase
+	if _, err := keystore.ExportPublic("carol"); err != nil {
+		fmt.Println("Could not export encrypted identity's public key:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,85 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"net"
+	l "../logic/impl"
+)
+
+func TestListenLoopback(t *testing.T) {
+	addr, conn, err := l.StartListener(l.ListenConfig{Bind: ":0", Loopback: true})
+	if err != nil {
+		fmt.Println("Could not listen:", err)
+		t.FailNow()
+	}
+	defer conn.Close()
+	bound := conn.LocalAddr().(*net.UDPAddr)
+	if !addr.IP.IsLoopback() || !bound.IP.IsLoopback() {
+		fmt.Println("Loopback mode bound", bound, "and advertised", addr)
+		t.Fail()
+	}
+	if addr.Port != bound.Port {
+		fmt.Println("Advertised port", addr.Port, "differs from bound port", bound.Port)
+		t.Fail()
+	}
+}
+
+func TestListenAdvertise(t *testing.T) {
+	addr, conn, err := l.StartListener(l.ListenConfig{Bind: "127.0.0.1:0", Advertise: "203.0.113.7"})
+	if err != nil {
+		fmt.Println("Could not listen:", err)
+		t.FailNow()
+	}
+	defer conn.Close()
+	if addr.String() != fmt.Sprintf("203.0.113.7:%d", conn.LocalAddr().(*net.UDPAddr).Port) {
+		fmt.Println("Advertised", addr, "instead of the configured address")
+		t.Fail()
+	}
+	conn.Close()
+
+	addr, conn, err = l.StartListener(l.ListenConfig{Bind: "127.0.0.1:0", Advertise: "[2001:db8::1]:4000"})
+	if err != nil {
+		fmt.Println("Could not listen:", err)
+		t.FailNow()
+	}
+	if addr.String() != "[2001:db8::1]:4000" {
+		fmt.Println("Advertised", addr, "instead of the configured IPv6 address")
+		t.Fail()
+	}
+	conn.Close()
+
+	_, _, err = l.StartListener(l.ListenConfig{Bind: "127.0.0.1:0", Advertise: "[2001:db8::1"})
+	if err == nil {
+		fmt.Println("Bad advertise address accepted")
+		t.Fail()
+	}
+}
+
+func TestListenIPv6(t *testing.T) {
+	addr, conn, err := l.StartListener(l.ListenConfig{Bind: "[::1]:0"})
+	if err != nil {
+		t.Skip("No IPv6 loopback:", err)
+	}
+	defer conn.Close()
+	if !addr.IP.Equal(net.IPv6loopback) {
+		fmt.Println("Bound to [::1] but advertised", addr)
+		t.Fail()
+	}
+}
+
+func TestListenPortInUse(t *testing.T) {
+	_, conn, err := l.StartListenerUDP("127.0.0.1:0")
+	if err != nil {
+		fmt.Println("Could not listen:", err)
+		t.FailNow()
+	}
+	defer conn.Close()
+
+	// A port already taken is reported, not panicked over
+	_, _, err = l.StartListenerUDP(conn.LocalAddr().String())
+	if err == nil {
+		fmt.Println("Listened on a port already in use")
+		t.Fail()
+	}
+}
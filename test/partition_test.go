@@ -0,0 +1,193 @@
+package test
+
+import (
+	"testing"
+	"time"
+	"os/exec"
+	"syscall"
+	"fmt"
+	"context"
+	"net"
+	key "../key-helpers"
+	l "../logic/impl"
+	"../shared"
+)
+
+// A stand-in for a game's nodes, wired together by a network that drops packets between sides of a partition
+type lossyMesh struct {
+	now      time.Time
+	trackers map[string]*l.PartitionTracker
+	scores   map[string]*shared.ScoresLockMap
+	// The side of the partition each node is on; nodes on different sides can't hear each other
+	side     map[string]int
+}
+
+func createLossyMesh(policy string, ids ...string) (*lossyMesh) {
+	mesh := &lossyMesh{now: time.Now(), trackers: make(map[string]*l.PartitionTracker),
+		scores: make(map[string]*shared.ScoresLockMap), side: make(map[string]int)}
+	for _, id := range ids {
+		mesh.trackers[id] = l.CreatePartitionTracker(3 * time.Second)
+		mesh.trackers[id].SetSelf(id)
+		mesh.scores[id] = &shared.ScoresLockMap{Data: map[string]int{}, Policy: policy}
+	}
+	mesh.tick()
+	return mesh
+}
+
+// Every node sends every other node a digest and a second passes; packets crossing the partition are dropped
+func (m *lossyMesh) tick() (healed int) {
+	m.now = m.now.Add(time.Second)
+	for to, tracker := range m.trackers {
+		for from := range m.trackers {
+			if from != to && m.side[from] == m.side[to] && tracker.Heard(from, m.now) {
+				healed++
+				// As in a real heal, the two nodes swap gamestates
+				l.MergeScores(m.scores[to], m.scores[from])
+				l.MergeScores(m.scores[from], m.scores[to])
+			}
+		}
+		tracker.Sweep(m.now)
+	}
+	return healed
+}
+
+// A node captures the prey and the capture reaches every node on its side
+func (m *lossyMesh) capture(id string, seq uint64) {
+	view, members := m.trackers[id].View()
+	event := shared.CaptureEvent{Player: id, Worth: 1, View: view, Members: members}
+	for to := range m.scores {
+		if m.side[to] == m.side[id] {
+			l.AddCaptureEvent(m.scores[to], l.CaptureEventId(id, seq), event)
+		}
+	}
+}
+
+func (m *lossyMesh) settle() {
+	for _, scores := range m.scores {
+		l.SettlePartition(scores)
+	}
+}
+
+func splitMesh(t *testing.T, policy string) (*lossyMesh) {
+	mesh := createLossyMesh(policy, "1", "2", "3", "4", "5")
+	mesh.capture("1", 1)
+
+	// Cut nodes 4 and 5 off from the rest
+	mesh.side["4"], mesh.side["5"] = 1, 1
+	for i := 0; i < 5; i++ {
+		mesh.tick()
+	}
+	if view, members := mesh.trackers["4"].View(); len(view) != 2 || members != 5 {
+		fmt.Println("Node 4 has the wrong partition view:", view, members)
+		t.Fail()
+	}
+
+	mesh.capture("2", 2)
+	mesh.capture("4", 3)
+	mesh.capture("5", 4)
+
+	// Heal
+	mesh.side["4"], mesh.side["5"] = 0, 0
+	if mesh.tick() == 0 {
+		fmt.Println("Heal not detected")
+		t.Fail()
+	}
+	mesh.tick()
+	return mesh
+}
+
+func TestPartitionMajorityWins(t *testing.T) {
+	mesh := splitMesh(t, l.PARTITION_MAJORITY)
+	if mesh.scores["4"].Held["4"] != 1 {
+		fmt.Println("Minority capture not held before settling:", mesh.scores["4"].Held)
+		t.Fail()
+	}
+	mesh.settle()
+	expected := fmt.Sprint(map[string]int{"1": 1, "2": 1, "4": 0, "5": 0})
+	for id, scores := range mesh.scores {
+		if fmt.Sprint(scores.Data) != expected || len(scores.Held) != 0 {
+			fmt.Println("Node", id, "has the wrong scores after the heal:", scores.Data, scores.Held)
+			t.Fail()
+		}
+	}
+}
+
+func TestPartitionKeepBoth(t *testing.T) {
+	mesh := splitMesh(t, l.PARTITION_KEEP_BOTH)
+	mesh.settle()
+	expected := fmt.Sprint(map[string]int{"1": 1, "2": 1, "4": 1, "5": 1})
+	for id, scores := range mesh.scores {
+		if fmt.Sprint(scores.Data) != expected {
+			fmt.Println("Node", id, "has the wrong scores after the heal:", scores.Data)
+			t.Fail()
+		}
+	}
+}
+
+// Checks cond every 50ms until it holds or the timeout passes
+// Returns true if it held in time
+func waitFor(timeout time.Duration, cond func() bool) (bool) {
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+func TestNodePartitionDetected(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60 * time.Second)
+	defer cancel()
+	serverStart := exec.CommandContext(ctx, "go", "run", "server.go")
+	serverStart.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	serverStart.Dir = "../server"
+	serverStart.Start()
+	defer func() {
+		syscall.Kill(-serverStart.Process.Pid, syscall.SIGKILL)
+		serverStart.Process.Kill()
+	}()
+
+	// A node that can't reach the server exits the process, so make sure it's up first
+	serverUp := waitFor(15 * time.Second, func() bool {
+		conn, err := net.DialTimeout("tcp", "127.0.0.1:8081", 100 * time.Millisecond)
+		if err == nil {
+			conn.Close()
+		}
+		return err == nil
+	})
+	if !serverUp {
+		t.Fatal("Server not listening on :8081")
+	}
+	pub, priv := key.GenerateKeys()
+	node1 := l.CreatePlayerNode(":13820", ":13821", pub, priv, ":8081")
+	pub, priv = key.GenerateKeys()
+	node2 := l.CreatePlayerNode(":13920", ":13921", pub, priv, ":8081")
+	n1 := node1.GetNodeInterface()
+	n2 := node2.GetNodeInterface()
+
+	// Both nodes have to have heard from each other before a partition between them means anything
+	if !waitFor(5 * time.Second, func() bool {
+		view1, _ := n1.Partition.View()
+		view2, _ := n2.Partition.View()
+		return len(view1) == 2 && len(view2) == 2
+	}) {
+		t.Fatal("Nodes never heard from each other")
+	}
+
+	// Drop every packet between the two nodes
+	n1.SetDropIncoming(func(identifier string) bool { return identifier == node2.Identifier })
+	n2.SetDropIncoming(func(identifier string) bool { return identifier == node1.Identifier })
+	if !waitFor(10 * time.Second, func() bool { return n1.Partition.Split() && n2.Partition.Split() }) {
+		fmt.Println("Partition not detected")
+		t.Fail()
+	}
+
+	n1.SetDropIncoming(nil)
+	n2.SetDropIncoming(nil)
+	if !waitFor(5 * time.Second, func() bool { return !n1.Partition.Split() && !n2.Partition.Split() }) {
+		fmt.Println("Heal not detected")
+		t.Fail()
+	}
+}
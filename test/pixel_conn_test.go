@@ -14,7 +14,6 @@ import (
 	"regexp"
 	"net"
 	"os"
-	"encoding/json"
 )
 
 // Reference for killing exec.Command processes + childen:
@@ -252,21 +251,16 @@ func TestGetGameConfigCall(t *testing.T) {
 		fmt.Println(err)
 		t.Fail()
 	}
-	buf := make([]byte, 2048)
-	rlen, err := tcpConn.Read(buf)
-	var settings shared.InitialGameSettings
-	err = json.Unmarshal(buf[0:rlen], &settings)
-	if err != nil{
+	conn := shared.CreatePixelConn(tcpConn)
+	settings, _, err := shared.PixelHandshake(conn, "")
+	if err != nil || settings.WindowsY == 0 {
 		fmt.Println(err)
-		t.Fail()
+		t.FailNow()
 	}
-	buf2 := make([]byte, 2048)
-	tcpConn.Write([]byte("getgameconfig"))
-	rlen, err = tcpConn.Read(buf2)
-	err = json.Unmarshal(buf2[0:rlen], &settings)
-	if err != nil{
-		fmt.Println(string(buf2[0:rlen]))
-		fmt.Println(err)
+	conn.Send(shared.PixelFrame{Type: shared.FRAME_CONFIG})
+	frame, err := conn.Receive()
+	if err != nil || frame.Type != shared.FRAME_CONFIG || frame.Config == nil {
+		fmt.Println(frame, err)
 		t.Fail()
 	}
 
@@ -0,0 +1,257 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"net"
+	"time"
+	l "../logic/impl"
+	p "../pixel/impl"
+	"../shared"
+)
+
+func TestPixelFramesSurviveCoalescing(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	raw, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	accepted, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := shared.CreatePixelConn(accepted)
+	defer conn.Close()
+
+	// Two inputs arriving in one read are still two inputs
+	up, _ := shared.EncodePixelFrame(shared.PixelFrame{Type: shared.FRAME_INPUT, Input: "up"})
+	left, _ := shared.EncodePixelFrame(shared.PixelFrame{Type: shared.FRAME_INPUT, Input: "left"})
+	raw.Write(append(up, left...))
+	for _, expected := range []string{"up", "left"} {
+		frame, err := conn.Receive()
+		if err != nil || frame.Type != shared.FRAME_INPUT || frame.Input != expected {
+			fmt.Println("Expected input", expected, "got", frame, err)
+			t.Fail()
+		}
+	}
+
+	// and one split over several reads is one
+	state, _ := shared.EncodePixelFrame(shared.PixelFrame{Type: shared.FRAME_STATE,
+		State: &shared.GameRenderState{PlayerLoc: shared.Coord{X: 3, Y: 4}}})
+	go func() {
+		for _, b := range state {
+			raw.Write([]byte{b})
+		}
+	}()
+	frame, err := conn.Receive()
+	if err != nil || frame.State == nil || frame.State.PlayerLoc.X != 3 || frame.State.PlayerLoc.Y != 4 {
+		fmt.Println("State split over reads not received:", frame, err)
+		t.Fail()
+	}
+
+	// An impossible length is an error, not an allocation
+	raw.Write([]byte{0xff, 0xff, 0xff, 0xff})
+	if _, err := conn.Receive(); err == nil {
+		fmt.Println("Read an oversized frame")
+		t.Fail()
+	}
+}
+
+func TestPixelHandshake(t *testing.T) {
+	commChannel := make(chan string, 5)
+	settings := shared.InitialGameSettings{WindowsX: 300, WindowsY: 300, ScoreboardWidth: 200}
+	pi := l.CreatePixelInterface(commChannel, make(chan shared.GameState, 5), settings, "1")
+	go pi.RunPlayerListener("127.0.0.1:12610")
+	time.Sleep(200 * time.Millisecond) // wait for the listener to start
+
+	// A client speaking another version is told so and turned away
+	raw, err := net.Dial("tcp", "127.0.0.1:12610")
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := shared.CreatePixelConn(raw)
+	old.Send(shared.PixelFrame{Type: shared.FRAME_HELLO, Version: shared.PIXEL_PROTOCOL_VERSION + 1})
+	frame, err := old.Receive()
+	if err != nil || frame.Type != shared.FRAME_ERROR {
+		fmt.Println("Other version not told it was rejected:", frame, err)
+		t.Fail()
+	}
+	if _, err := old.Receive(); err == nil {
+		fmt.Println("Connection with other version left open")
+		t.Fail()
+	}
+
+	// while one speaking ours gets the config
+	raw, err = net.Dial("tcp", "127.0.0.1:12610")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := shared.CreatePixelConn(raw)
+	received, _, err := shared.PixelHandshake(conn, "")
+	if err != nil || received.WindowsX != 300 || received.ScoreboardWidth != 200 {
+		fmt.Println("Config not received:", received, err)
+		t.FailNow()
+	}
+
+	// Unknown inputs are reported rather than dropped silently
+	conn.Send(shared.PixelFrame{Type: shared.FRAME_INPUT, Input: "upleft"})
+	frame, err = conn.Receive()
+	if err != nil || frame.Type != shared.FRAME_ERROR {
+		fmt.Println("Unknown input not reported:", frame, err)
+		t.Fail()
+	}
+	conn.Send(shared.PixelFrame{Type: shared.FRAME_INPUT, Input: "up"})
+	select {
+	case move := <-commChannel:
+		if move != "up" {
+			fmt.Println("Expected up, got", move)
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		fmt.Println("Input never reached the logic node")
+		t.Fail()
+	}
+
+	conn.Send(shared.PixelFrame{Type: shared.FRAME_PING, Time: 42})
+	frame, err = conn.Receive()
+	if err != nil || frame.Type != shared.FRAME_PING || !frame.Reply || frame.Time != 42 {
+		fmt.Println("Ping not answered:", frame, err)
+		t.Fail()
+	}
+}
+
+// Returns a game state with this node at the given position
+func stateAt(id string, x int, y int) (shared.GameState) {
+	return shared.GameState{PlayerLocs: shared.PlayerLockMap{Data: map[string]shared.Coord{id: {X: x, Y: y}}}}
+}
+
+// Returns the next state frame from the connection, skipping anything else
+func nextState(conn *shared.PixelConn) (*shared.GameRenderState, error) {
+	for {
+		frame, err := conn.Receive()
+		if err != nil {
+			return nil, err
+		}
+		if frame.Type == shared.FRAME_STATE {
+			return frame.State, nil
+		}
+	}
+}
+
+func TestPixelSessionResumes(t *testing.T) {
+	pi := l.CreatePixelInterface(make(chan string, 5), make(chan shared.GameState, 5),
+		shared.InitialGameSettings{WindowsX: 300, WindowsY: 300}, "1")
+	go pi.RunPlayerListener("127.0.0.1:12611")
+	time.Sleep(200 * time.Millisecond) // wait for the listener to start
+
+	raw, err := net.Dial("tcp", "127.0.0.1:12611")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := shared.CreatePixelConn(raw)
+	_, token, err := shared.PixelHandshake(first, "")
+	if err != nil || token == "" {
+		fmt.Println("No session token handed out:", err)
+		t.FailNow()
+	}
+	pi.SendPlayerGameState(stateAt("1", 2, 3))
+	if state, err := nextState(first); err != nil || state.PlayerLoc.X != 2 {
+		fmt.Println("State not received:", state, err)
+		t.Fail()
+	}
+
+	// The logic node plays on with no client
+	first.Close()
+	time.Sleep(100 * time.Millisecond)
+	pi.SendPlayerGameState(stateAt("1", 4, 5))
+	time.Sleep(100 * time.Millisecond)
+
+	// Only a client with the token can take the session back
+	raw, _ = net.Dial("tcp", "127.0.0.1:12611")
+	stranger := shared.CreatePixelConn(raw)
+	if _, _, err := shared.PixelHandshake(stranger, "not the token"); err == nil {
+		fmt.Println("Session taken without its token")
+		t.Fail()
+	}
+	raw, _ = net.Dial("tcp", "127.0.0.1:12611")
+	second := shared.CreatePixelConn(raw)
+	if _, _, err := shared.PixelHandshake(second, token); err != nil {
+		fmt.Println("Could not resume the session:", err)
+		t.FailNow()
+	}
+	state, err := nextState(second)
+	if err != nil || state.PlayerLoc.X != 4 || state.PlayerLoc.Y != 5 {
+		fmt.Println("Latest state not resent on resuming:", state, err)
+		t.Fail()
+	}
+
+	// A client resuming the session takes it over from one still connected
+	raw, _ = net.Dial("tcp", "127.0.0.1:12611")
+	third := shared.CreatePixelConn(raw)
+	if _, _, err := shared.PixelHandshake(third, token); err != nil {
+		fmt.Println("Could not take over the session:", err)
+		t.FailNow()
+	}
+	if _, err := nextState(second); err == nil {
+		fmt.Println("Old client still connected after takeover")
+		t.Fail()
+	}
+}
+
+func TestPixelClientReconnects(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// A logic node that drops the client after one state, and checks it comes back with the token
+	resumedWith := make(chan string, 1)
+	go func() {
+		for i := 1; i <= 2; i++ {
+			raw, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conn := shared.CreatePixelConn(raw)
+			hello, _ := conn.Receive()
+			if i == 2 {
+				resumedWith <- hello.Token
+			}
+			conn.Send(shared.PixelFrame{Type: shared.FRAME_HELLO, Version: shared.PIXEL_PROTOCOL_VERSION,
+				Token: "token"})
+			conn.Send(shared.PixelFrame{Type: shared.FRAME_CONFIG,
+				Config: &shared.InitialGameSettings{WindowsX: 300, WindowsY: 300}})
+			conn.Send(shared.PixelFrame{Type: shared.FRAME_STATE,
+				State: &shared.GameRenderState{PlayerLoc: shared.Coord{X: i, Y: i}}})
+			if i == 1 {
+				time.Sleep(100 * time.Millisecond)
+				conn.Close()
+			}
+		}
+	}()
+
+	pixel := p.CreatePixelNode(listener.Addr().String())
+	go pixel.RunRemoteNodeListener()
+	for i := 1; i <= 2; i++ {
+		select {
+		case state := <-pixel.NewGameStates:
+			if state.PlayerLoc.X != i {
+				fmt.Println("Expected state", i, "got", state)
+				t.Fail()
+			}
+		case <-time.After(5 * time.Second):
+			fmt.Println("No state", i)
+			t.FailNow()
+		}
+	}
+	if token := <-resumedWith; token != "token" {
+		fmt.Println("Reconnected without the session token:", token)
+		t.Fail()
+	}
+}
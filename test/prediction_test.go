@@ -0,0 +1,169 @@
+package test
+
+import (
+	"testing"
+	"context"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"time"
+	"../geometry"
+	key "../key-helpers"
+	l "../logic/impl"
+	"../shared"
+)
+
+// A predictor on an open 10x10 board with a wall at (2, 1)
+func createTestPredictor() (*shared.Predictor) {
+	grid := geometry.CreateNewGridManager(shared.InitialGameSettings{WindowsX: 300, WindowsY: 300,
+		WallCoordinates: []shared.Coord{{X: 2, Y: 1}}})
+	return shared.CreatePredictor(func(from shared.Coord, to shared.Coord) bool {
+		return grid.IsValidMove(to) && grid.IsNotTeleporting(from, to)
+	}, shared.Coord{X: 1, Y: 1})
+}
+
+func TestPredictorAppliesInputsAtOnce(t *testing.T) {
+	p := createTestPredictor()
+	now := time.Now()
+	if pos := p.Input(1, "up", now); pos != (shared.Coord{X: 1, Y: 2}) {
+		fmt.Println("Move not predicted:", pos)
+		t.Fail()
+	}
+	// A move into a wall is predicted to be blocked
+	p.Input(2, "down", now)
+	if pos := p.Input(3, "right", now); pos != (shared.Coord{X: 1, Y: 1}) {
+		fmt.Println("Predicted a move into a wall:", pos)
+		t.Fail()
+	}
+
+	// The logic node has played the first input: the rest are replayed over its position
+	pos, corrected := p.Reconcile(shared.GameRenderState{PlayerLoc: shared.Coord{X: 1, Y: 2}, InputAck: 1}, now)
+	if pos != (shared.Coord{X: 1, Y: 1}) || corrected || p.Pending() != 2 {
+		fmt.Println("Acknowledged input not dropped cleanly:", pos, corrected, p.Pending())
+		t.Fail()
+	}
+}
+
+func TestPredictorRollsBack(t *testing.T) {
+	p := createTestPredictor()
+	now := time.Now()
+	p.Input(1, "up", now)
+	p.Input(2, "up", now)
+
+	// The logic node only played one of the moves
+	pos, corrected := p.Reconcile(shared.GameRenderState{PlayerLoc: shared.Coord{X: 1, Y: 2}, InputAck: 2}, now)
+	if pos != (shared.Coord{X: 1, Y: 2}) || !corrected || p.Pending() != 0 {
+		fmt.Println("Not put back where the logic node has the player:", pos, corrected)
+		t.Fail()
+	}
+
+	// An input that is never acknowledged is given up on
+	p.Input(3, "left", now)
+	pos, _ = p.Reconcile(shared.GameRenderState{PlayerLoc: shared.Coord{X: 1, Y: 2}, InputAck: 2},
+		now.Add(shared.PREDICTION_TIMEOUT))
+	if pos != (shared.Coord{X: 1, Y: 2}) || p.Pending() != 0 {
+		fmt.Println("Lost input still predicted:", pos, p.Pending())
+		t.Fail()
+	}
+}
+
+func TestInputAcks(t *testing.T) {
+	acks := l.CreateInputAcks()
+	acks.Settled(1)
+	acks.Played(2, 100)
+	acks.Played(3, 101)
+	acks.Settled(4)
+	if ack := acks.Ack(); ack != 1 {
+		fmt.Println("Acknowledged inputs whose moves are waiting for a quorum:", ack)
+		t.Fail()
+	}
+	acks.Applied(100)
+	if ack := acks.Ack(); ack != 2 {
+		fmt.Println("Expected ack 2 once the first move is applied, got", ack)
+		t.Fail()
+	}
+	// Applying a move overtakes every earlier one
+	acks.Applied(101)
+	if ack := acks.Ack(); ack != 4 {
+		fmt.Println("Expected ack 4 once every move is applied, got", ack)
+		t.Fail()
+	}
+
+	// A move applied before it is recorded as played is settled
+	acks.Applied(102)
+	acks.Played(5, 102)
+	if ack := acks.Ack(); ack != 5 {
+		fmt.Println("Move applied before being played left waiting:", ack)
+		t.Fail()
+	}
+
+	// Inputs are taken in the order they came in
+	acks.Received(6)
+	acks.Received(7)
+	if first, second, none := acks.Next(), acks.Next(), acks.Next(); first != 6 || second != 7 || none != 0 {
+		fmt.Println("Inputs taken out of order:", first, second, none)
+		t.Fail()
+	}
+	acks.Reset()
+	if ack := acks.Ack(); ack != 0 {
+		fmt.Println("Acks not reset for a new client:", ack)
+		t.Fail()
+	}
+}
+
+func TestLogicNodeAcknowledgesInputs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Second)
+	defer cancel()
+	serverStart := exec.CommandContext(ctx, "go", "run", "server.go", "8095")
+	serverStart.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	serverStart.Dir = "../server"
+	serverStart.Start()
+	defer func() {
+		// Kill after done + all children
+		syscall.Kill(-serverStart.Process.Pid, syscall.SIGKILL)
+		serverStart.Process.Kill()
+	}()
+	time.Sleep(3 * time.Second) // wait for server to get started
+
+	pub, priv := key.GenerateKeys()
+	node := l.CreatePlayerNode("127.0.0.1:13850", "127.0.0.1:13851", pub, priv, "127.0.0.1:8095")
+	go node.RunGame("127.0.0.1:13851")
+	time.Sleep(200 * time.Millisecond) // wait for the listener to start
+
+	link, settings, err := shared.ConnectLogicNode("127.0.0.1:13851", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(chan shared.GameRenderState, 30)
+	go link.RunListener(states)
+	grid := geometry.CreateNewGridManager(settings)
+	predictor := shared.CreatePredictor(func(from shared.Coord, to shared.Coord) bool {
+		return grid.IsValidMove(to) && grid.IsNotTeleporting(from, to)
+	}, shared.Coord{X: 1, Y: 1})
+
+	// Whether the move goes through or is blocked, the logic node acknowledges it, and ends up where it was predicted
+	for _, move := range []string{"up", "right"} {
+		seq, err := link.SendInput(move)
+		if err != nil {
+			t.Fatal(err)
+		}
+		predicted := predictor.Input(seq, move, time.Now())
+		deadline := time.After(3 * time.Second)
+		for acked := false; !acked; {
+			select {
+			case state := <-states:
+				if state.InputAck < seq {
+					continue
+				}
+				acked = true
+				if pos, _ := predictor.Reconcile(state, time.Now()); pos != predicted || state.PlayerLoc != predicted {
+					fmt.Println(move, "predicted to end at", predicted, "but the logic node has", state.PlayerLoc)
+					t.Fail()
+				}
+			case <-deadline:
+				fmt.Println(move, "never acknowledged")
+				t.FailNow()
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"../geometry"
+	"../shared"
+	l "../logic/impl"
+)
+
+func preySimSetup() (geometry.GridManager) {
+	gs := shared.InitialGameSettings{300, 300,
+		[]shared.Coord{{4, 3}, {9, 9}}, 200, 0, 0}
+	return geometry.CreateNewGridManager(gs)
+}
+
+func TestPreyMovesAreReproducible(t *testing.T) {
+	gm := preySimSetup()
+	wolves := map[string]shared.Coord{"1": {1, 1}, "2": {8, 2}}
+
+	// Two independent runs from the same seed must walk the prey along exactly the same path
+	preyA := shared.Coord{5, 5}
+	preyB := shared.Coord{5, 5}
+	for tick := uint64(1000); tick < 1200; tick++ {
+		preyA = l.NextPreyMove(42, tick, preyA, wolves, &gm)
+		preyB = l.NextPreyMove(42, tick, preyB, wolves, &gm)
+		if preyA != preyB {
+			fmt.Println("Prey diverged at tick", tick, preyA, preyB)
+			t.FailNow()
+		}
+	}
+}
+
+func TestPreyNeverEntersWall(t *testing.T) {
+	gm := preySimSetup()
+	wolves := map[string]shared.Coord{"1": {0, 0}}
+
+	prey := shared.Coord{5, 5}
+	for tick := uint64(0); tick < 500; tick++ {
+		next := l.NextPreyMove(7, tick, prey, wolves, &gm)
+		if !gm.IsValidMove(next) || !gm.IsNotTeleporting(prey, next) {
+			fmt.Println("Invalid prey step", prey, next)
+			t.FailNow()
+		}
+		prey = next
+	}
+}
+
+func TestPreySpawnIsReproducible(t *testing.T) {
+	gm := preySimSetup()
+	for epoch := uint64(1); epoch < 20; epoch++ {
+		a := l.NextPreySpawn(99, epoch, shared.Coord{5, 5}, &gm)
+		b := l.NextPreySpawn(99, epoch, shared.Coord{5, 5}, &gm)
+		if a != b || !gm.IsValidMove(a) {
+			fmt.Println("Bad spawn for epoch", epoch, a, b)
+			t.Fail()
+		}
+	}
+}
+
+func TestPreyStartsOffWalls(t *testing.T) {
+	gm := preySimSetup()
+	if start := l.PreyStart(&gm); start != l.PREY_START {
+		fmt.Println("Prey moved from a free start", start)
+		t.Fail()
+	}
+
+	// Map "2" has a wall where the prey usually starts
+	gs := shared.InitialGameSettings{300, 300,
+		[]shared.Coord{{5, 5}, {6, 5}, {5, 6}}, 200, 100, 100}
+	walled := geometry.CreateNewGridManager(gs)
+	start := l.PreyStart(&walled)
+	if start != (shared.Coord{4, 5}) && start != (shared.Coord{5, 4}) {
+		fmt.Println("Prey not started on the nearest free cell", start)
+		t.Fail()
+	}
+	if again := l.PreyStart(&walled); again != start {
+		fmt.Println("Prey start not the same every time", start, again)
+		t.Fail()
+	}
+}
@@ -0,0 +1,220 @@
+package test
+
+import (
+	"testing"
+	"crypto"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"time"
+	key "../key-helpers"
+	l "../logic/impl"
+	r "../relay/impl"
+	serverImpl "../server/impl"
+	"../shared"
+)
+
+func readFrom(t *testing.T, conn *net.UDPConn) (string) {
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	n, _, err := conn.ReadFromUDP(buf)
+	if err != nil {
+		return ""
+	}
+	return string(buf[:n])
+}
+
+// Returns the register envelope a node with the given token sends a relay at the given time
+func registerEnvelope(id string, token string, at int64) ([]byte) {
+	return []byte(fmt.Sprintf(`{"Type":"register","From":"%s","Time":%d,"Proof":"%s"}`, id, at,
+		shared.RelayRegisterProof(token, id, at)))
+}
+
+func TestRelayForwards(t *testing.T) {
+	relay, err := r.CreateRelay("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+	secret := []byte("relay secret")
+	relay.SetSecret(secret)
+	go relay.Run()
+
+	// Nodes that can only be reached through the relay: each listens where the relay will forward to
+	conns := make(map[string]*net.UDPConn)
+	registers := make(map[string][]byte)
+	for _, id := range []string{"1", "2", "3"} {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		conns[id] = conn
+		registers[id] = registerEnvelope(id, shared.RelayToken(secret, id), time.Now().UnixNano())
+		conn.WriteToUDP(registers[id], relay.Addr().(*net.UDPAddr))
+	}
+
+	// A node without a token from the server can't register, under its own name or another's
+	stranger, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stranger.Close()
+	stranger.WriteToUDP([]byte(`{"Type":"register","From":"4"}`), relay.Addr().(*net.UDPAddr))
+	stranger.WriteToUDP(registerEnvelope("1", shared.RelayToken(secret, "4"), time.Now().UnixNano()),
+		relay.Addr().(*net.UDPAddr))
+	// Nor can it take over a node's traffic by sending a registration it saw go by again from its own address
+	stranger.WriteToUDP(registers["1"], relay.Addr().(*net.UDPAddr))
+	time.Sleep(100 * time.Millisecond)
+	if relay.PeerCount() != 3 {
+		fmt.Println("Relay has the wrong number of peers:", relay.PeerCount())
+		t.Fail()
+	}
+
+	// "aGk=" is "hi"
+	forward := `{"Type":"forward","From":"1","To":"2","Payload":"aGk="}`
+	conns["1"].WriteToUDP([]byte(forward), relay.Addr().(*net.UDPAddr))
+	if got := readFrom(t, conns["2"]); got != "hi" {
+		fmt.Println("Node 2 did not get the message forwarded to it, got", got)
+		t.Fail()
+	}
+	toOne := `{"Type":"forward","From":"2","To":"1","Payload":"aGk="}`
+	conns["2"].WriteToUDP([]byte(toOne), relay.Addr().(*net.UDPAddr))
+	if got := readFrom(t, conns["1"]); got != "hi" {
+		fmt.Println("Node 1's traffic no longer reaches it after a replayed registration, got", got)
+		t.Fail()
+	}
+	if got := readFrom(t, conns["3"]); got != "" {
+		fmt.Println("Node 3 got a message meant for node 2")
+		t.Fail()
+	}
+
+	broadcast := `{"Type":"forward","From":"3","To":"all","Payload":"aGk="}`
+	conns["3"].WriteToUDP([]byte(broadcast), relay.Addr().(*net.UDPAddr))
+	if readFrom(t, conns["1"]) != "hi" || readFrom(t, conns["2"]) != "hi" {
+		fmt.Println("Broadcast not forwarded to every other node")
+		t.Fail()
+	}
+	if readFrom(t, conns["3"]) != "" {
+		fmt.Println("Broadcast sent back to its sender")
+		t.Fail()
+	}
+
+	// Envelopes naming a registered node but not sent from its address are dropped
+	stranger.WriteToUDP([]byte(broadcast), relay.Addr().(*net.UDPAddr))
+	if readFrom(t, conns["1"]) != "" || readFrom(t, conns["2"]) != "" {
+		fmt.Println("Forwarded an envelope from an address its sender didn't register from")
+		t.Fail()
+	}
+}
+
+func TestRelayLinkRegisters(t *testing.T) {
+	relay, err := r.CreateRelay("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer relay.Close()
+	secret := []byte("relay secret")
+	relay.SetSecret(secret)
+	go relay.Run()
+
+	link := &l.RelayLink{}
+	err = link.Connect(relay.Addr().String(), "1", shared.RelayToken(secret, "1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	badLink := &l.RelayLink{}
+	err = badLink.Connect(relay.Addr().String(), "2", shared.RelayToken([]byte("another secret"), "2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if relay.PeerCount() != 1 {
+		fmt.Println("Relay has the wrong number of peers:", relay.PeerCount())
+		t.Fail()
+	}
+}
+
+func TestOnlyAssignedRelayRegisters(t *testing.T) {
+	relayPub, relayPriv := key.GenerateKeys()
+	_, relayPubPEM := key.Encode(relayPriv, relayPub)
+	keyFile, _ := ioutil.TempFile("", "relay-pub")
+	keyFile.WriteString(relayPubPEM)
+	keyFile.Close()
+	defer os.Remove(keyFile.Name())
+
+	addr := "127.0.0.1:8094"
+	go serverImpl.RunServer(serverImpl.ServerConfig{Addr: addr, Map: "0", PreyMode: "replicated", RelayMode: "node",
+		RelayKeyFile: keyFile.Name()})
+	time.Sleep(500 * time.Millisecond) // give server time to start
+
+	var nodes []l.NodeCommInterface
+	for i, port := range []string{"2150", "2151"} {
+		pubKey, privKey := key.GenerateKeys()
+		node := l.CreateNodeCommInterface(pubKey, privKey, addr)
+		node.LocalAddr, _ = net.ResolveUDPAddr("udp", "127.0.0.1:"+port)
+		config, err := l.DialAndRegister(&node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.ActAsRelay != (i == 0) {
+			fmt.Println("Node", i, "told to run the relay:", config.ActAsRelay)
+			t.Fail()
+		}
+		node.Config = config
+		nodes = append(nodes, node)
+	}
+
+	var secret []byte
+	register := func(conn *l.NodeCommInterface, signer crypto.Signer, relayAddr string) (error) {
+		auth, err := l.SignServerCall(conn.ServerConn, signer, "GServer.RegisterRelay")
+		if err != nil {
+			return err
+		}
+		return conn.ServerConn.Call("GServer.RegisterRelay", shared.RelayRegistration{Addr: relayAddr, Auth: auth},
+			&secret)
+	}
+	if register(&nodes[1], nodes[1].PrivKey, "127.0.0.1:9999") == nil {
+		fmt.Println("A node the server didn't pick registered a relay")
+		t.Fail()
+	}
+	if err := register(&nodes[0], nodes[0].PrivKey, "127.0.0.1:9091"); err != nil {
+		fmt.Println("The node picked to run the relay could not register it:", err)
+		t.Fail()
+	}
+	if err := register(&nodes[1], relayPriv, "127.0.0.1:9092"); err != nil {
+		fmt.Println("The configured standalone relay could not register:", err)
+		t.Fail()
+	}
+
+	var info shared.RelayInfo
+	if err := nodes[1].CallServer("GServer.GetRelay", &info); err != nil || info.Addr != "127.0.0.1:9092" {
+		fmt.Println("Wrong relay handed out:", info.Addr, err)
+		t.Fail()
+	}
+	if info.Token != shared.RelayToken(secret, nodes[1].Config.Identifier) {
+		fmt.Println("Relay token not made with the registered relay's secret")
+		t.Fail()
+	}
+	var now int64
+	if nodes[1].ServerConn.Call("GServer.GetRelay", shared.RPCAuth{}, &info) == nil ||
+		nodes[1].ServerConn.Call("GServer.GetTime", shared.RPCAuth{}, &now) == nil {
+		fmt.Println("Unsigned relay or clock call accepted")
+		t.Fail()
+	}
+}
+
+func TestUnreachableNodeSkipped(t *testing.T) {
+	pubKey, privKey := key.GenerateKeys()
+	node := l.CreateNodeCommInterface(pubKey, privKey, "127.0.0.1:8081")
+	otherPub, otherPriv := key.GenerateKeys()
+	_, otherPubPEM := key.Encode(otherPriv, otherPub)
+
+	// With no relay to fall back to, a node that can't be dialed is refused rather than crashing this one
+	node.HandleIncomingConnectionRequest("2", "not an address", otherPubPEM)
+	if len(node.NodesToAdd) != 0 {
+		fmt.Println("Added a node that can't be reached")
+		t.Fail()
+	}
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"testing"
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	r "../renderer/impl"
+	"../shared"
+)
+
+var renderSettings = shared.InitialGameSettings{WindowsX: 300, WindowsY: 300, ScoreboardWidth: 200,
+	WallCoordinates: []shared.Coord{{X: 0, Y: 0}}}
+
+// Returns the state with this player at the given position
+func renderState(x int) (shared.GameRenderState) {
+	return shared.GameRenderState{
+		PlayerLoc:    shared.Coord{X: x, Y: 2},
+		Prey:         shared.Coord{X: 5, Y: 5},
+		OtherPlayers: map[string]shared.Coord{"2": {X: 8, Y: 8}},
+		Scores:       map[string]int{"ME": 10, "2": 30},
+	}
+}
+
+func sameColour(a color.Color, b color.Color) (bool) {
+	return color.RGBAModel.Convert(a) == color.RGBAModel.Convert(b)
+}
+
+func TestRendererLayout(t *testing.T) {
+	renderer, err := r.CreateRenderer(renderSettings, "../sprites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := renderer.RenderFrame(renderState(2))
+	if frame.Bounds() != image.Rect(0, 0, 500, 300) {
+		fmt.Println("Frame isn't the board and scoreboard:", frame.Bounds())
+		t.FailNow()
+	}
+
+	// Cells are drawn from the bottom left, as in the pixel client, so cell (x, y) is centred at
+	// (30x + 15, 300 - (30y + 15)) in the image
+	centre := image.Pt(15, 15)
+	for _, check := range []struct {
+		what   string
+		at     image.Point
+		colour color.Color
+	}{
+		{"player", image.Pt(75, 225), renderer.PlayerSprite.At(centre.X, centre.Y)},
+		{"prey", image.Pt(165, 135), renderer.PreySprite.At(centre.X, centre.Y)},
+		{"other player", image.Pt(255, 45), renderer.OtherPlayerSprite.At(centre.X, centre.Y)},
+		{"wall", image.Pt(15, 285), renderer.WallSprite.At(centre.X, centre.Y)},
+		{"empty cell", image.Pt(135, 225), r.BackgroundColour},
+		{"scoreboard", image.Pt(498, 5), r.ScoreboardColour},
+	} {
+		if !sameColour(frame.At(check.at.X, check.at.Y), check.colour) {
+			fmt.Printf("Expected the %s at %v, found %v\n", check.what, check.at, frame.At(check.at.X, check.at.Y))
+			t.Fail()
+		}
+	}
+
+	// The same state always draws the same
+	again := renderer.RenderFrame(renderState(2))
+	if !bytes.Equal(frame.Pix, again.Pix) {
+		fmt.Println("Same state drawn differently")
+		t.Fail()
+	}
+}
+
+func TestRendererWritesGIF(t *testing.T) {
+	renderer, err := r.CreateRenderer(renderSettings, "../sprites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	err = renderer.WriteGIF([]shared.GameRenderState{renderState(1), renderState(2), renderState(3)}, &out, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	animation, err := gif.DecodeAll(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(animation.Image) != 3 || animation.Delay[0] != 10 {
+		fmt.Println("Expected 3 frames of 10, got", len(animation.Image), animation.Delay)
+		t.Fail()
+	}
+	for _, frame := range animation.Image {
+		if frame.Bounds().Dx() != 500 || frame.Bounds().Dy() != 300 {
+			fmt.Println("Frame is the wrong size:", frame.Bounds())
+			t.Fail()
+		}
+	}
+}
+
+func TestRendererWritesPNGs(t *testing.T) {
+	renderer, err := r.CreateRenderer(renderSettings, "../sprites")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, _ := ioutil.TempDir("", "wolfpack-frames")
+	defer os.RemoveAll(dir)
+	err = renderer.WritePNGs([]shared.GameRenderState{renderState(1), renderState(2)}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"frame-00000.png", "frame-00001.png"} {
+		file, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			fmt.Println("Missing", name)
+			t.Fail()
+			continue
+		}
+		frame, err := png.Decode(file)
+		file.Close()
+		if err != nil || frame.Bounds().Dx() != 500 {
+			fmt.Println("Bad frame", name, err)
+			t.Fail()
+		}
+	}
+
+	if _, err := r.CreateRenderer(renderSettings, dir); err == nil {
+		fmt.Println("Created a renderer with no sprites")
+		t.Fail()
+	}
+}
@@ -0,0 +1,245 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+	l "../logic/impl"
+	"../shared"
+)
+
+// Returns a game state with the given positions and scores
+func replayState(locs map[string]shared.Coord, scores map[string]int) (shared.GameState) {
+	return shared.GameState{
+		PlayerLocs:   shared.PlayerLockMap{Data: locs},
+		PlayerScores: shared.ScoresLockMap{Data: scores, Held: make(map[string]int),
+			Events: make(map[string]shared.CaptureEvent), Revoked: make(map[string]bool)},
+	}
+}
+
+// Records a short match: player 1 and the prey join, 1 moves and catches the prey, and 2 joins then leaves
+func recordMatch(t *testing.T, path string) {
+	settings := shared.InitialGameSettings{WindowsX: 300, WindowsY: 300}
+	recorder, err := l.CreateRecorder(path, "1", settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := replayState(map[string]shared.Coord{"1": {X: 1, Y: 1}, "prey": {X: 5, Y: 5}}, map[string]int{"1": 0})
+	recorder.Record(&state)
+	time.Sleep(20 * time.Millisecond)
+	state.PlayerLocs.Data["1"] = shared.Coord{X: 2, Y: 1}
+	state.PlayerLocs.Data["2"] = shared.Coord{X: 7, Y: 7}
+	recorder.Record(&state)
+	time.Sleep(20 * time.Millisecond)
+	state.PlayerScores.Events["1-0"] = shared.CaptureEvent{Player: "1", Worth: 1}
+	state.PlayerScores.Data["1"] = 1
+	delete(state.PlayerLocs.Data, "2")
+	recorder.Record(&state)
+	// Nothing changed, so nothing is recorded
+	recorder.Record(&state)
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecordMatch(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wolfpack-replay")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "match.replay")
+	recordMatch(t, path)
+
+	header, events, err := shared.ReadReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Self != "1" || header.Settings.WindowsX != 300 || header.Version != shared.REPLAY_VERSION {
+		fmt.Println("Wrong header:", header)
+		t.Fail()
+	}
+	expected := []string{
+		shared.EVENT_JOIN, shared.EVENT_JOIN, shared.EVENT_SCORE,
+		shared.EVENT_MOVE, shared.EVENT_JOIN,
+		shared.EVENT_LEAVE, shared.EVENT_CAPTURE, shared.EVENT_SCORE,
+	}
+	if len(events) != len(expected) {
+		fmt.Println("Expected", len(expected), "events, got", events)
+		t.FailNow()
+	}
+	for i, kind := range expected {
+		if events[i].Kind != kind {
+			fmt.Println("Event", i, "should be", kind, "but is", events[i])
+			t.Fail()
+		}
+		if i > 0 && events[i].Time < events[i-1].Time {
+			fmt.Println("Events out of order:", events[i-1], events[i])
+			t.Fail()
+		}
+	}
+	if events[3].At == nil || events[3].At.X != 2 || events[6].Player != "1" || events[6].Value != 1 {
+		fmt.Println("Wrong event details:", events[3], events[6])
+		t.Fail()
+	}
+
+	// A replay cut short, by a node that crashed, still reads up to where it stops
+	data, _ := ioutil.ReadFile(path)
+	ioutil.WriteFile(path, data[:len(data)-10], 0644)
+	if _, _, err := shared.ReadReplay(path); err != nil {
+		fmt.Println("Truncated replay unreadable:", err)
+		t.Fail()
+	}
+
+	// while a file that isn't a replay is an error
+	ioutil.WriteFile(path, []byte("not a replay"), 0644)
+	if _, _, err := shared.ReadReplay(path); err == nil {
+		fmt.Println("Read a file that isn't a replay")
+		t.Fail()
+	}
+}
+
+func TestReplayToClient(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wolfpack-replay")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "match.replay")
+	recordMatch(t, path)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.RunReplay(path, "127.0.0.1:12620", l.ReplaySpeed{Multiple: 4})
+	}()
+	time.Sleep(200 * time.Millisecond) // wait for the listener to start
+
+	link, settings, err := shared.ConnectLogicNode("127.0.0.1:12620", "")
+	if err != nil || settings.WindowsX != 300 {
+		fmt.Println("Could not connect to the replay:", err)
+		t.FailNow()
+	}
+	states := make(chan shared.GameRenderState, 10)
+	go link.RunListener(states)
+
+	var last shared.GameRenderState
+	for received := 0; received < 3; received++ {
+		select {
+		case last = <-states:
+		case <-time.After(2 * time.Second):
+			fmt.Println("Only", received, "states replayed")
+			t.FailNow()
+		}
+	}
+	if last.PlayerLoc.X != 2 || last.Prey.X != 5 || last.Scores["ME"] != 1 || len(last.OtherPlayers) != 0 {
+		fmt.Println("Wrong final state:", last)
+		t.Fail()
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			fmt.Println("Replay failed:", err)
+			t.Fail()
+		}
+	case <-time.After(2 * time.Second):
+		fmt.Println("Replay never finished")
+		t.Fail()
+	}
+}
+
+func TestReplaySteps(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wolfpack-replay")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "match.replay")
+	recordMatch(t, path)
+
+	go l.RunReplay(path, "127.0.0.1:12621", l.ReplaySpeed{Step: true})
+	time.Sleep(200 * time.Millisecond) // wait for the listener to start
+
+	link, _, err := shared.ConnectLogicNode("127.0.0.1:12621", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(chan shared.GameRenderState, 10)
+	go link.RunListener(states)
+
+	// Nothing plays until a key is pressed
+	select {
+	case state := <-states:
+		fmt.Println("Replay stepped without input:", state)
+		t.Fail()
+	case <-time.After(300 * time.Millisecond):
+	}
+	for step := 1; step <= 2; step++ {
+		link.SendInput("right")
+		select {
+		case state := <-states:
+			if step == 2 && state.PlayerLoc.X != 2 {
+				fmt.Println("Second step should move player 1:", state)
+				t.Fail()
+			}
+		case <-time.After(time.Second):
+			fmt.Println("Step", step, "never replayed")
+			t.FailNow()
+		}
+	}
+}
+
+func TestParseReplaySpeed(t *testing.T) {
+	if speed, err := l.ParseReplaySpeed("4"); err != nil || speed.Multiple != 4 || speed.Step {
+		fmt.Println("4 parsed as", speed, err)
+		t.Fail()
+	}
+	if speed, err := l.ParseReplaySpeed("step"); err != nil || !speed.Step {
+		fmt.Println("step parsed as", speed, err)
+		t.Fail()
+	}
+	for _, bad := range []string{"fast", "0", "-1"} {
+		if _, err := l.ParseReplaySpeed(bad); err == nil {
+			fmt.Println("Parsed bad speed", bad)
+			t.Fail()
+		}
+	}
+}
+
+func TestRecordAppliedChanges(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wolfpack-replay")
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "match.replay")
+	recorder, err := l.CreateRecorder(path, "1", shared.InitialGameSettings{WindowsX: 300, WindowsY: 300})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pn := l.PlayerNode{Identifier: "1",
+		GameState: replayState(map[string]shared.Coord{"1": {X: 1, Y: 1}}, map[string]int{"1": 0})}
+	pn.RecordWith(recorder)
+	n := l.NodeCommInterface{PlayerNode: &pn, HasGameState: true, GameStateToSend: make(chan bool, 10),
+		Partition: l.CreatePartitionTracker(time.Second)}
+
+	// Two repairs moving node 2 are applied before any state is sent to the pixel node; both are recorded, each when
+	// it was applied
+	for _, x := range []int{3, 4} {
+		remote := replayState(map[string]shared.Coord{"2": {X: x, Y: 1}}, map[string]int{})
+		n.HandleReceivedGameState("2", &remote, 0)
+		time.Sleep(20 * time.Millisecond)
+	}
+	recorder.Close()
+
+	_, events, err := shared.ReadReplay(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var moves []shared.ReplayEvent
+	for _, event := range events {
+		if event.Player == "2" {
+			moves = append(moves, event)
+		}
+	}
+	if len(moves) != 2 || moves[0].Kind != shared.EVENT_JOIN || moves[1].Kind != shared.EVENT_MOVE ||
+		moves[1].At.X != 4 {
+		fmt.Println("Applied changes not all recorded:", moves)
+		t.FailNow()
+	}
+	if moves[1].Time-moves[0].Time < 15 {
+		fmt.Println("Changes not recorded when they were applied:", moves)
+		t.Fail()
+	}
+}
@@ -0,0 +1,105 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"fmt"
+	"../shared"
+	l "../logic/impl"
+)
+
+func TestCaptureEventsAreIdempotent(t *testing.T) {
+	scores := shared.ScoresLockMap{Data: map[string]int{}}
+	l.AddCaptureEvent(&scores, l.CaptureEventId("1", 3), shared.CaptureEvent{Player: "1", Worth: 1})
+	// The same capture heard about twice, say from the capturer and again in a gamestate
+	l.AddCaptureEvent(&scores, l.CaptureEventId("1", 3), shared.CaptureEvent{Player: "1", Worth: 1})
+	if scores.Data["1"] != 1 {
+		fmt.Println("Repeated capture event counted twice:", scores.Data["1"])
+		t.Fail()
+	}
+
+	// Revoked before it arrives; it mustn't count when it does
+	l.RevokeCaptureEvent(&scores, l.CaptureEventId("1", 5))
+	l.AddCaptureEvent(&scores, l.CaptureEventId("1", 5), shared.CaptureEvent{Player: "1", Worth: 1})
+	if scores.Data["1"] != 1 {
+		fmt.Println("Revoked capture event counted:", scores.Data["1"])
+		t.Fail()
+	}
+}
+
+func TestScoreMergeIsOrderIndependent(t *testing.T) {
+	replica := func() (*shared.ScoresLockMap) {
+		return &shared.ScoresLockMap{Data: map[string]int{}}
+	}
+	a, b, c := replica(), replica(), replica()
+	l.AddCaptureEvent(a, "1/1", shared.CaptureEvent{Player: "1", Worth: 1})
+	l.AddCaptureEvent(a, "2/2", shared.CaptureEvent{Player: "2", Worth: 1})
+	l.AddCaptureEvent(b, "1/1", shared.CaptureEvent{Player: "1", Worth: 1})
+	l.AddCaptureEvent(b, "1/7", shared.CaptureEvent{Player: "1", Worth: 1})
+	l.RevokeCaptureEvent(c, "2/2")
+	l.AddCaptureEvent(c, "3/4", shared.CaptureEvent{Player: "3", Worth: 1})
+
+	// Merge all three into two fresh replicas in opposite orders, merging one of them twice
+	x, y := replica(), replica()
+	for _, from := range []*shared.ScoresLockMap{a, b, c, a} {
+		l.MergeScores(x, from)
+	}
+	for _, from := range []*shared.ScoresLockMap{c, b, a} {
+		l.MergeScores(y, from)
+	}
+
+	expected := map[string]int{"1": 2, "2": 0, "3": 1}
+	if fmt.Sprint(x.Data) != fmt.Sprint(expected) || fmt.Sprint(y.Data) != fmt.Sprint(expected) {
+		fmt.Println("Merged scores disagree:", x.Data, y.Data, "expected", expected)
+		t.Fail()
+	}
+}
+
+func TestSettledCapturesFoldIntoBase(t *testing.T) {
+	a := &shared.ScoresLockMap{Data: map[string]int{}}
+	for seq := uint64(0); seq < 200; seq++ {
+		l.AddCaptureEvent(a, l.CaptureEventId("1", seq), shared.CaptureEvent{Player: "1", Worth: 1, Tick: seq,
+			View: []string{"1", "2", "3"}, Members: 3})
+	}
+	l.RevokeCaptureEvent(a, l.CaptureEventId("1", 10))
+	if settled := l.SettleScores(a, 150); settled != 150 || len(a.Events) != 50 || len(a.Revoked) != 0 {
+		fmt.Println("Settled", settled, "captures, leaving", len(a.Events), "events and", len(a.Revoked), "revocations")
+		t.Fail()
+	}
+	if a.Base["1"] != 149 || a.Data["1"] != 199 {
+		fmt.Println("Settling changed the score:", a.Base, a.Data)
+		t.Fail()
+	}
+
+	// A gamestate full of settled captures has to stay well inside a datagram
+	encoded, _ := json.Marshal(a)
+	if len(encoded) > l.MAX_DATAGRAM_SIZE/4 {
+		fmt.Println("Settled scores still take", len(encoded), "bytes")
+		t.Fail()
+	}
+
+	// Captures from before the horizon turning up late are already settled one way or the other
+	l.AddCaptureEvent(a, l.CaptureEventId("2", 5), shared.CaptureEvent{Player: "2", Worth: 1, Tick: 5})
+	if a.Data["2"] != 0 {
+		fmt.Println("Capture from before the horizon counted:", a.Data["2"])
+		t.Fail()
+	}
+}
+
+func TestMergeTakesLaterHorizon(t *testing.T) {
+	a, b := &shared.ScoresLockMap{Data: map[string]int{}}, &shared.ScoresLockMap{Data: map[string]int{}}
+	for seq := uint64(0); seq < 20; seq++ {
+		event := shared.CaptureEvent{Player: "1", Worth: 1, Tick: seq}
+		l.AddCaptureEvent(a, l.CaptureEventId("1", seq), event)
+		l.AddCaptureEvent(b, l.CaptureEventId("1", seq), event)
+	}
+	l.SettleScores(a, 5)
+	l.SettleScores(b, 15)
+
+	l.MergeScores(a, b)
+	l.MergeScores(b, a)
+	if a.Horizon != 15 || len(a.Events) != 5 || a.Data["1"] != 20 || b.Data["1"] != 20 {
+		fmt.Println("Merge across horizons gave", a.Horizon, len(a.Events), a.Data, b.Data)
+		t.Fail()
+	}
+}
@@ -0,0 +1,254 @@
+package test
+
+import (
+	"testing"
+	"bytes"
+	"fmt"
+	"crypto"
+	key "../key-helpers"
+	"../shared"
+)
+
+// Creates the session table of a node with a new identity key of the given scheme
+func sessionNode(t *testing.T, identifier string, scheme string) (*key.SessionTable, crypto.PublicKey) {
+	pub, priv, err := key.GenerateKeysForScheme(scheme)
+	if err != nil {
+		t.Fatal(err)
+	}
+	table := key.CreateSessionTable(priv)
+	table.SetSelf(identifier)
+	return table, pub
+}
+
+func TestSessionHandshake(t *testing.T) {
+	a, aPub := sessionNode(t, "1", key.SCHEME_ECDSA)
+	b, bPub := sessionNode(t, "2", key.SCHEME_ED25519)
+
+	// With no session yet, the message waits for one and a hello is sent instead
+	sealed, hello, err := a.Seal("2", []byte("first"))
+	if err != nil || sealed != nil || hello == nil {
+		fmt.Println("Sealed before a session was agreed:", err)
+		t.FailNow()
+	}
+	reply, queued, err := b.HandleHello("1", aPub, hello)
+	if err != nil || reply == nil || len(queued) != 0 || !b.Established("1") {
+		fmt.Println("Hello not answered:", err)
+		t.FailNow()
+	}
+	reply2, queued, err := a.HandleHello("2", bPub, reply)
+	if err != nil || reply2 != nil || len(queued) != 1 || !a.Established("2") {
+		fmt.Println("Answer not taken:", err)
+		t.FailNow()
+	}
+
+	peer, plaintext, err := b.Open(queued[0])
+	if err != nil || peer != "1" || string(plaintext) != "first" {
+		fmt.Println("Held message not delivered:", peer, string(plaintext), err)
+		t.Fail()
+	}
+	if bytes.Contains(queued[0], []byte("first")) {
+		fmt.Println("Sealed message is readable")
+		t.Fail()
+	}
+
+	sealed, hello, err = b.Seal("1", []byte("second"))
+	if err != nil || hello != nil {
+		fmt.Println("Handshake started again:", err)
+		t.FailNow()
+	}
+	peer, plaintext, err = a.Open(sealed)
+	if err != nil || peer != "2" || string(plaintext) != "second" {
+		fmt.Println("Message not delivered the other way:", peer, string(plaintext), err)
+		t.Fail()
+	}
+}
+
+func TestSimultaneousHandshake(t *testing.T) {
+	a, aPub := sessionNode(t, "1", key.SCHEME_ECDSA)
+	b, bPub := sessionNode(t, "2", key.SCHEME_ECDSA)
+
+	_, helloA, _ := a.Seal("2", []byte("from a"))
+	_, helloB, _ := b.Seal("1", []byte("from b"))
+
+	replyA, queuedA, err := a.HandleHello("2", bPub, helloB)
+	if err != nil || len(queuedA) != 1 {
+		fmt.Println("a didn't take b's hello:", err)
+		t.FailNow()
+	}
+	replyB, queuedB, err := b.HandleHello("1", aPub, helloA)
+	if err != nil || len(queuedB) != 1 {
+		fmt.Println("b didn't take a's hello:", err)
+		t.FailNow()
+	}
+
+	// Each side agreed on the two hellos already sent, so the answers change nothing
+	if _, _, err := a.HandleHello("2", bPub, replyB); err != nil {
+		fmt.Println("a didn't take b's answer:", err)
+		t.Fail()
+	}
+	if _, _, err := b.HandleHello("1", aPub, replyA); err != nil {
+		fmt.Println("b didn't take a's answer:", err)
+		t.Fail()
+	}
+	if _, plaintext, err := b.Open(queuedA[0]); err != nil || string(plaintext) != "from a" {
+		fmt.Println("b couldn't open a's message:", err)
+		t.Fail()
+	}
+	if _, plaintext, err := a.Open(queuedB[0]); err != nil || string(plaintext) != "from b" {
+		fmt.Println("a couldn't open b's message:", err)
+		t.Fail()
+	}
+}
+
+// Agrees a session between two tables, returning the hello that started it
+func agreeSession(t *testing.T, a *key.SessionTable, aId string, aPub crypto.PublicKey,
+	b *key.SessionTable, bId string, bPub crypto.PublicKey) (*shared.SessionHello) {
+	_, hello, _ := a.Seal(bId, []byte("hello"))
+	reply, queued, err := b.HandleHello(aId, aPub, hello)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, queued, err = a.HandleHello(bId, bPub, reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, sealed := range queued {
+		b.Open(sealed)
+	}
+	return hello
+}
+
+func TestSessionRejectsTamperingAndReplays(t *testing.T) {
+	a, aPub := sessionNode(t, "1", key.SCHEME_ECDSA)
+	b, bPub := sessionNode(t, "2", key.SCHEME_ECDSA)
+	agreeSession(t, a, "1", aPub, b, "2", bPub)
+
+	first, _, _ := a.Seal("2", []byte("first"))
+	second, _, _ := a.Seal("2", []byte("second"))
+
+	tampered := append([]byte{}, second...)
+	tampered[len(tampered)-1] ^= 1
+	if _, _, err := b.Open(tampered); err == nil {
+		fmt.Println("Tampered message opened")
+		t.Fail()
+	}
+
+	// Out of order is fine, but each message opens once
+	if _, _, err := b.Open(second); err != nil {
+		fmt.Println("Could not open message:", err)
+		t.Fail()
+	}
+	if _, _, err := b.Open(first); err != nil {
+		fmt.Println("Could not open message that arrived late:", err)
+		t.Fail()
+	}
+	if _, _, err := b.Open(first); err == nil {
+		fmt.Println("Replayed message opened")
+		t.Fail()
+	}
+
+	// Messages sealed for another node don't open
+	c, cPub := sessionNode(t, "3", key.SCHEME_ECDSA)
+	agreeSession(t, a, "1", aPub, c, "3", cPub)
+	forC, _, _ := a.Seal("3", []byte("for c"))
+	if _, _, err := b.Open(forC); err == nil {
+		fmt.Println("Opened a message sealed for another node")
+		t.Fail()
+	}
+}
+
+func TestSessionRejectsForgedHellos(t *testing.T) {
+	a, aPub := sessionNode(t, "1", key.SCHEME_ECDSA)
+	b, _ := sessionNode(t, "2", key.SCHEME_ECDSA)
+	mallory, malloryPub := sessionNode(t, "1", key.SCHEME_ECDSA)
+
+	// Mallory claims to be node 1, but the server registered a's key for it
+	_, forged, _ := mallory.Seal("2", []byte("hi"))
+	if _, _, err := b.HandleHello("1", aPub, forged); err == nil {
+		fmt.Println("Took a hello signed with the wrong key")
+		t.Fail()
+	}
+	if _, _, err := b.HandleHello("1", malloryPub, forged); err != nil {
+		fmt.Println("Didn't take a hello signed with the registered key:", err)
+		t.Fail()
+	}
+
+	// A hello for another node
+	_, toC, _ := a.Seal("3", []byte("hi"))
+	if _, _, err := b.HandleHello("1", aPub, toC); err == nil {
+		fmt.Println("Took a hello meant for another node")
+		t.Fail()
+	}
+
+	// A hello with its contents changed
+	_, hello, _ := a.Seal("2", []byte("hi"))
+	changed := *hello
+	changed.Reply = true
+	if _, _, err := b.HandleHello("1", aPub, &changed); err == nil {
+		fmt.Println("Took a hello that was changed after signing")
+		t.Fail()
+	}
+}
+
+func TestSessionRekeys(t *testing.T) {
+	a, aPub := sessionNode(t, "1", key.SCHEME_ECDSA)
+	b, bPub := sessionNode(t, "2", key.SCHEME_ED25519)
+	a.RekeyMessages = 3
+	firstHello := agreeSession(t, a, "1", aPub, b, "2", bPub)
+
+	var sealed [][]byte
+	var hello *shared.SessionHello
+	for i := 0; i < 4; i++ {
+		message, h, err := a.Seal("2", []byte(fmt.Sprint(i)))
+		if err != nil || message == nil {
+			fmt.Println("Could not seal while rekeying:", err)
+			t.FailNow()
+		}
+		sealed = append(sealed, message)
+		if h != nil && hello == nil {
+			hello = h
+		}
+	}
+	if hello == nil {
+		fmt.Println("No new handshake after RekeyMessages messages")
+		t.FailNow()
+	}
+
+	reply, _, err := b.HandleHello("1", aPub, hello)
+	if err != nil {
+		fmt.Println("Rekeying hello not taken:", err)
+		t.FailNow()
+	}
+	if _, _, err := a.HandleHello("2", bPub, reply); err != nil {
+		fmt.Println("Rekeying answer not taken:", err)
+		t.FailNow()
+	}
+
+	// Messages sealed under the old session that were still in flight open
+	for i, message := range sealed {
+		if _, plaintext, err := b.Open(message); err != nil || string(plaintext) != fmt.Sprint(i) {
+			fmt.Println("Message from the old session lost:", err)
+			t.Fail()
+		}
+	}
+	message, _, _ := a.Seal("2", []byte("new"))
+	if bytes.Equal(message[4:12], sealed[0][4:12]) {
+		fmt.Println("Still sealing under the old key")
+		t.Fail()
+	}
+	if _, plaintext, err := b.Open(message); err != nil || string(plaintext) != "new" {
+		fmt.Println("Message from the new session lost:", err)
+		t.Fail()
+	}
+
+	// The first session's hello can't be replayed to knock b back onto it
+	if _, _, err := b.HandleHello("1", aPub, firstHello); err == nil {
+		fmt.Println("Took a replayed hello")
+		t.Fail()
+	}
+	// but the current session's hello, resent, is answered again
+	if again, _, err := b.HandleHello("1", aPub, hello); err != nil || again == nil {
+		fmt.Println("Resent hello not answered:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,182 @@
+package test
+
+import (
+	"testing"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+	key "../key-helpers"
+	l "../logic/impl"
+	term "../terminal/impl"
+	"../shared"
+)
+
+func TestFollowTargets(t *testing.T) {
+	state := shared.GameRenderState{Spectator: true, Prey: shared.Coord{X: 5, Y: 5},
+		OtherPlayers: map[string]shared.Coord{"3": {X: 3, Y: 3}, "1": {X: 1, Y: 1}}}
+	targets := shared.FollowTargets(state)
+	if strings.Join(targets, ",") != "prey,1,3" {
+		fmt.Println("Wrong follow targets:", targets)
+		t.Fail()
+	}
+
+	// The arrow keys step through the targets, wrapping around
+	following := shared.FOLLOW_PREY
+	for _, expected := range []string{"1", "3", "prey"} {
+		following = shared.NextFollowTarget(state, following, shared.FollowStep("right"))
+		if following != expected {
+			fmt.Println("Expected to follow", expected, "but following", following)
+			t.Fail()
+		}
+	}
+	if following = shared.NextFollowTarget(state, following, shared.FollowStep("left")); following != "3" {
+		fmt.Println("Stepping back from the prey should follow 3, not", following)
+		t.Fail()
+	}
+
+	// A wolf that leaves is no longer followed
+	delete(state.OtherPlayers, "3")
+	if loc, followed := shared.FollowedLoc(state, "3"); followed != shared.FOLLOW_PREY || loc != state.Prey {
+		fmt.Println("Followed a wolf that left:", followed, loc)
+		t.Fail()
+	}
+}
+
+func TestTerminalDrawsSpectator(t *testing.T) {
+	settings := shared.InitialGameSettings{WindowsX: 90, WindowsY: 90}
+	screen := term.CreateScreen(settings)
+	state := shared.GameRenderState{
+		Spectator:    true,
+		Prey:         shared.Coord{X: 2, Y: 2},
+		OtherPlayers: map[string]shared.Coord{"1": {X: 0, Y: 0}, "2": {X: 2, Y: 0}},
+		Scores:       map[string]int{"1": 10, "2": 30},
+	}
+
+	// Following the prey, there is no player on the board
+	screen.Following = shared.FOLLOW_PREY
+	out := screen.Render(state)
+	if strings.Contains(out, "@") || !strings.Contains(out, "WATCHING:    prey") || strings.Contains(out, "SCORE:") {
+		fmt.Println("Spectator following the prey drawn wrong:\n" + out)
+		t.Fail()
+	}
+
+	// Following a wolf, it is drawn as the player, with its score
+	screen.Following = "2"
+	lines := strings.Split(screen.Render(state), "\n")
+	if !strings.HasPrefix(lines[3], "|W . @ |") {
+		fmt.Println("Followed wolf not drawn as the player:", lines[3])
+		t.Fail()
+	}
+	out = strings.Join(lines, "\n")
+	if !strings.Contains(out, "WATCHING:       2") || !strings.Contains(out, "SCORE:         30") {
+		fmt.Println("Followed wolf's score not shown:\n" + out)
+		t.Fail()
+	}
+}
+
+func TestSpectatorRenderState(t *testing.T) {
+	pi := l.CreatePixelInterface(make(chan string, 5), make(chan shared.GameState, 5),
+		shared.InitialGameSettings{WindowsX: 300, WindowsY: 300}, shared.OBSERVER_PREFIX + "4")
+	go pi.RunPlayerListener("127.0.0.1:12630")
+	time.Sleep(200 * time.Millisecond) // wait for the listener to start
+
+	link, _, err := shared.ConnectLogicNode("127.0.0.1:12630", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(chan shared.GameRenderState, 5)
+	go link.RunListener(states)
+	pi.SendPlayerGameState(replayState(map[string]shared.Coord{"1": {X: 1, Y: 1}, "2": {X: 2, Y: 2},
+		"prey": {X: 5, Y: 5}}, map[string]int{"1": 3, "2": 4}))
+	select {
+	case state := <-states:
+		if !state.Spectator || len(state.OtherPlayers) != 2 || state.Prey.X != 5 {
+			fmt.Println("Spectator not sent every wolf:", state)
+			t.Fail()
+		}
+		if _, ok := state.Scores["ME"]; ok {
+			fmt.Println("Spectator sent a score of its own:", state.Scores)
+			t.Fail()
+		}
+	case <-time.After(2 * time.Second):
+		fmt.Println("No state sent to the spectator's client")
+		t.Fail()
+	}
+}
+
+func TestSpectatorFollowsGame(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20 * time.Second)
+	defer cancel()
+	serverStart := exec.CommandContext(ctx, "go", "run", "server.go", "8094", "0", "replicated")
+	serverStart.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	serverStart.Dir = "../server"
+	serverStart.Start()
+	defer func() {
+		// Kill after done + all children
+		syscall.Kill(-serverStart.Process.Pid, syscall.SIGKILL)
+		serverStart.Process.Kill()
+	}()
+	time.Sleep(3 * time.Second) // wait for server to get started
+	addr := "127.0.0.1:8094"
+
+	pub, priv := key.GenerateKeys()
+	player := l.CreatePlayerNode("127.0.0.1:13830", "127.0.0.1:13831", pub, priv, addr)
+	pub, priv = key.GenerateKeys()
+	spectator := l.CreateSpectatorNode("127.0.0.1:13840", "127.0.0.1:13841", pub, priv, addr)
+	go spectator.RunSpectator("127.0.0.1:13841")
+	time.Sleep(time.Second)
+
+	if !shared.IsObserver(spectator.Identifier) || shared.IsObserver(player.Identifier) {
+		fmt.Println("Wrong identifiers: player", player.Identifier, "spectator", spectator.Identifier)
+		t.FailNow()
+	}
+	link, _, err := shared.ConnectLogicNode("127.0.0.1:13841", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(chan shared.GameRenderState, 30)
+	go link.RunListener(states)
+
+	// The spectator hears the player's moves
+	move := shared.Coord{X: 7, Y: 7}
+	player.GetNodeInterface().SendMoveToNodes(&move)
+	time.Sleep(300 * time.Millisecond)
+	spectatorState := &spectator.GetNodeInterface().PlayerNode.GameState
+	spectatorState.PlayerLocs.RLock()
+	heard := spectatorState.PlayerLocs.Data[player.Identifier]
+	_, spawned := spectatorState.PlayerLocs.Data[spectator.Identifier]
+	spectatorState.PlayerLocs.RUnlock()
+	if heard != move || spawned {
+		fmt.Println("Spectator heard the move as", heard, "and spawned:", spawned)
+		t.Fail()
+	}
+
+	// and its client gets a state following the game, with no player of its own
+	deadline := time.After(2 * time.Second)
+	for followed := false; !followed; {
+		select {
+		case state := <-states:
+			followed = state.Spectator && state.OtherPlayers[player.Identifier] == move
+		case <-deadline:
+			fmt.Println("Spectator's client never saw the move")
+			t.FailNow()
+		}
+	}
+
+	// The player doesn't see the spectator, on the board, the scoreboard or when counting who it can reach
+	time.Sleep(1500 * time.Millisecond) // let digests go round
+	playerState := &player.GetNodeInterface().PlayerNode.GameState
+	playerState.PlayerLocs.RLock()
+	_, onBoard := playerState.PlayerLocs.Data[spectator.Identifier]
+	playerState.PlayerLocs.RUnlock()
+	playerState.PlayerScores.RLock()
+	_, scored := playerState.PlayerScores.Data[spectator.Identifier]
+	playerState.PlayerScores.RUnlock()
+	if view, members := player.GetNodeInterface().Partition.View(); onBoard || scored || members != 1 {
+		fmt.Println("Spectator visible to the player:", onBoard, scored, view)
+		t.Fail()
+	}
+}
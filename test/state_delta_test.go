@@ -0,0 +1,179 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"net"
+	"reflect"
+	"time"
+	l "../logic/impl"
+	"../shared"
+)
+
+func TestDiffAndApplyStates(t *testing.T) {
+	prev := shared.GameRenderState{PlayerLoc: shared.Coord{X: 1, Y: 1}, Prey: shared.Coord{X: 5, Y: 5},
+		OtherPlayers: map[string]shared.Coord{"2": {X: 2, Y: 2}, "3": {X: 3, Y: 3}},
+		Scores: map[string]int{"ME": 1, "2": 2, "3": 3}, HeldScores: map[string]int{"ME": 4}, InputAck: 6}
+	next := shared.GameRenderState{PlayerLoc: shared.Coord{X: 1, Y: 1}, Prey: shared.Coord{X: 5, Y: 6},
+		OtherPlayers: map[string]shared.Coord{"2": {X: 2, Y: 3}, "4": {X: 4, Y: 4}},
+		Scores: map[string]int{"ME": 1, "2": 3, "4": 0}, HeldScores: map[string]int{}, InputAck: 7}
+
+	delta := shared.DiffStates(prev, next)
+	if delta.PlayerLoc != nil || len(delta.Moved) != 2 || !reflect.DeepEqual(delta.Left, []string{"3"}) ||
+		len(delta.Scores) != 2 || delta.Held["ME"] != 0 || len(delta.Held) != 1 {
+		fmt.Printf("Delta doesn't hold only the changes: %+v\n", delta)
+		t.Fail()
+	}
+	if applied := shared.ApplyDelta(prev, delta); !reflect.DeepEqual(applied, next) {
+		fmt.Printf("Expected %+v, got %+v\n", next, applied)
+		t.Fail()
+	}
+	if prev.OtherPlayers["3"] != (shared.Coord{X: 3, Y: 3}) || prev.Scores["2"] != 2 {
+		fmt.Println("Applying a delta changed the state it was applied to")
+		t.Fail()
+	}
+
+	if !shared.DiffStates(next, next).Empty(next.InputAck) {
+		fmt.Println("Delta between equal states not empty")
+		t.Fail()
+	}
+	next.InputAck++
+	if shared.DiffStates(prev, next).Empty(prev.InputAck) {
+		fmt.Println("New acknowledgement not sent")
+		t.Fail()
+	}
+}
+
+// Returns the next state or delta frame from the connection, skipping anything else
+func nextStateFrame(conn *shared.PixelConn) (shared.PixelFrame, error) {
+	for {
+		frame, err := conn.Receive()
+		if err != nil || frame.Type == shared.FRAME_STATE || frame.Type == shared.FRAME_DELTA {
+			return frame, err
+		}
+	}
+}
+
+func TestPixelInterfaceSendsDeltas(t *testing.T) {
+	pi := l.CreatePixelInterface(make(chan string, 5), make(chan shared.GameState, 5),
+		shared.InitialGameSettings{WindowsX: 300, WindowsY: 300}, "1")
+	go pi.RunPlayerListener("127.0.0.1:12650")
+	time.Sleep(200 * time.Millisecond) // wait for the listener to start
+
+	raw, err := net.Dial("tcp", "127.0.0.1:12650")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := shared.CreatePixelConn(raw)
+	defer conn.Close()
+	if _, _, err := shared.PixelHandshake(conn, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	locs := map[string]shared.Coord{"1": {X: 1, Y: 1}, "2": {X: 2, Y: 2}, "3": {X: 3, Y: 3}}
+	state := func() (shared.GameState) {
+		data := make(map[string]shared.Coord)
+		for id, loc := range locs {
+			data[id] = loc
+		}
+		return shared.GameState{PlayerLocs: shared.PlayerLockMap{Data: data}}
+	}
+
+	// The first state is sent in full
+	pi.SendPlayerGameState(state())
+	frame, err := nextStateFrame(conn)
+	if err != nil || frame.Type != shared.FRAME_STATE || frame.Seq != 1 || len(frame.State.OtherPlayers) != 2 {
+		fmt.Println("First state not sent in full:", frame, err)
+		t.FailNow()
+	}
+
+	// After that, only what changed
+	locs["3"] = shared.Coord{X: 3, Y: 4}
+	pi.SendPlayerGameState(state())
+	frame, err = nextStateFrame(conn)
+	if err != nil || frame.Type != shared.FRAME_DELTA || frame.Seq != 2 || len(frame.Delta.Moved) != 1 ||
+		frame.Delta.Moved["3"] != (shared.Coord{X: 3, Y: 4}) || frame.Delta.PlayerLoc != nil {
+		fmt.Println("Expected a delta moving wolf 3, got", frame, err)
+		t.Fail()
+	}
+
+	// Nothing is sent for an unchanged state, and a state sent in full when asked for
+	pi.SendPlayerGameState(state())
+	time.Sleep(100 * time.Millisecond)
+	conn.Send(shared.PixelFrame{Type: shared.FRAME_STATE})
+	frame, err = nextStateFrame(conn)
+	if err != nil || frame.Type != shared.FRAME_STATE || frame.Seq != 3 ||
+		frame.State.OtherPlayers["3"] != (shared.Coord{X: 3, Y: 4}) {
+		fmt.Println("Expected the latest state in full, got", frame, err)
+		t.Fail()
+	}
+
+	// and again every KEYFRAME_INTERVAL
+	frame, err = nextStateFrame(conn)
+	if err != nil || frame.Type != shared.FRAME_STATE || frame.Seq != 4 {
+		fmt.Println("Expected a keyframe, got", frame, err)
+		t.Fail()
+	}
+}
+
+func TestClientAsksForKeyframeAfterGap(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	// A logic node that skips a delta, then answers the request for a keyframe
+	moved := func(x int) (*shared.StateDelta) {
+		return &shared.StateDelta{PlayerLoc: &shared.Coord{X: x, Y: 1}}
+	}
+	go func() {
+		raw, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conn := shared.CreatePixelConn(raw)
+		defer conn.Close()
+		conn.Receive()
+		conn.Send(shared.PixelFrame{Type: shared.FRAME_HELLO, Version: shared.PIXEL_PROTOCOL_VERSION})
+		conn.Send(shared.PixelFrame{Type: shared.FRAME_CONFIG,
+			Config: &shared.InitialGameSettings{WindowsX: 300, WindowsY: 300}})
+		conn.Send(shared.PixelFrame{Type: shared.FRAME_STATE, Seq: 1,
+			State: &shared.GameRenderState{PlayerLoc: shared.Coord{X: 1, Y: 1}}})
+		conn.Send(shared.PixelFrame{Type: shared.FRAME_DELTA, Seq: 2, Delta: moved(2)})
+		conn.Send(shared.PixelFrame{Type: shared.FRAME_DELTA, Seq: 4, Delta: moved(4)})
+		conn.Send(shared.PixelFrame{Type: shared.FRAME_DELTA, Seq: 5, Delta: moved(5)})
+		for {
+			frame, err := conn.Receive()
+			if err != nil {
+				return
+			}
+			if frame.Type == shared.FRAME_STATE && frame.State == nil {
+				conn.Send(shared.PixelFrame{Type: shared.FRAME_STATE, Seq: 6,
+					State: &shared.GameRenderState{PlayerLoc: shared.Coord{X: 6, Y: 1}}})
+				conn.Send(shared.PixelFrame{Type: shared.FRAME_DELTA, Seq: 7, Delta: moved(7)})
+			}
+		}
+	}()
+
+	link, _, err := shared.ConnectLogicNode(listener.Addr().String(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := make(chan shared.GameRenderState, 10)
+	go link.RunListener(states)
+
+	// Deltas after the gap are dropped until the keyframe comes
+	for _, expected := range []int{1, 2, 6, 7} {
+		select {
+		case state := <-states:
+			if state.PlayerLoc.X != expected {
+				fmt.Println("Expected the player at", expected, "got", state.PlayerLoc)
+				t.Fail()
+			}
+		case <-time.After(3 * time.Second):
+			fmt.Println("No state with the player at", expected)
+			t.FailNow()
+		}
+	}
+}
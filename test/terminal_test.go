@@ -0,0 +1,75 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"strings"
+	"reflect"
+	term "../terminal/impl"
+	"../shared"
+)
+
+func TestTerminalDrawsBoard(t *testing.T) {
+	// A 3x3 board with a wall in the middle
+	settings := shared.InitialGameSettings{WindowsX: 90, WindowsY: 90, WallCoordinates: []shared.Coord{{X: 1, Y: 1}}}
+	screen := term.CreateScreen(settings)
+	state := shared.GameRenderState{
+		PlayerLoc:    shared.Coord{X: 0, Y: 0},
+		Prey:         shared.Coord{X: 2, Y: 2},
+		OtherPlayers: map[string]shared.Coord{"2": {X: 2, Y: 0}},
+		Scores:       map[string]int{"ME": 10, "2": 30},
+	}
+	lines := strings.Split(screen.Render(state), "\n")
+
+	// The top row is the highest Y
+	board := []string{
+		"+------+",
+		"|. . P |",
+		"|. ##. |",
+		"|@ . W |",
+		"+------+",
+	}
+	for i, row := range board {
+		if !strings.HasPrefix(lines[i], row) {
+			fmt.Printf("Row %d: expected %q, got %q\n", i, row, lines[i])
+			t.Fail()
+		}
+	}
+	if !strings.Contains(lines[0], "SCORES") {
+		fmt.Println("No scoreboard beside the board:", lines[0])
+		t.Fail()
+	}
+	if strings.Contains(screen.Render(state), "\x1b[") {
+		fmt.Println("Colour used when not asked for")
+		t.Fail()
+	}
+}
+
+func TestTerminalScoreboard(t *testing.T) {
+	state := shared.GameRenderState{
+		Scores:     map[string]int{"ME": 10, "2": 30, "3": 30},
+		HeldScores: map[string]int{"ME": 5},
+	}
+	lines := term.Scoreboard(state)
+	expected := []string{"SCORES", "", " 1. 2           30", " 2. 3           30", " 3. ME          10", "",
+		"SCORE:         10", "HELD:           5"}
+	if !reflect.DeepEqual(lines, expected) {
+		fmt.Printf("Expected %q, got %q\n", expected, lines)
+		t.Fail()
+	}
+}
+
+func TestTerminalParsesKeys(t *testing.T) {
+	keys := term.ParseKeys([]byte("\x1b[A\x1b[Dx\x1bOB\x1b[C\x1b[Zq"))
+	expected := []string{"up", "left", "down", "right", term.QUIT_KEY}
+	if !reflect.DeepEqual(keys, expected) {
+		fmt.Printf("Expected %q, got %q\n", expected, keys)
+		t.Fail()
+	}
+
+	// A lone escape is ignored
+	if keys := term.ParseKeys([]byte{0x1b}); len(keys) != 0 {
+		fmt.Println("Read a key from a lone escape:", keys)
+		t.Fail()
+	}
+}
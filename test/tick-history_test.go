@@ -0,0 +1,53 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"../shared"
+	l "../logic/impl"
+)
+
+func TestTickHistoryRewinds(t *testing.T) {
+	history := l.CreateTickHistory(100)
+	history.Add("prey", 10, shared.Coord{5, 5})
+	history.Add("prey", 15, shared.Coord{5, 6})
+	// Recorded late, but should still slot in before tick 15
+	history.Add("prey", 12, shared.Coord{6, 5})
+
+	if pos, ok := history.At("prey", 13); !ok || pos != (shared.Coord{6, 5}) {
+		fmt.Println("Wrong position at tick 13:", pos)
+		t.Fail()
+	}
+	if pos, ok := history.At("prey", 40); !ok || pos != (shared.Coord{5, 6}) {
+		fmt.Println("Latest position should hold until the next move:", pos)
+		t.Fail()
+	}
+	if _, ok := history.At("prey", 9); ok {
+		fmt.Println("Position returned from before the history began")
+		t.Fail()
+	}
+
+	if !history.WasAt("prey", shared.Coord{6, 5}, 13, 20) {
+		fmt.Println("Prey was at (6, 5) until tick 15, so a capture window from 13 should find it")
+		t.Fail()
+	}
+	if history.WasAt("prey", shared.Coord{6, 5}, 15, 20) {
+		fmt.Println("Prey had left (6, 5) by tick 15")
+		t.Fail()
+	}
+}
+
+func TestTickHistoryRetention(t *testing.T) {
+	history := l.CreateTickHistory(20)
+	for tick := uint64(0); tick < 100; tick++ {
+		history.Add("1", tick, shared.Coord{int(tick), 0})
+	}
+	if _, ok := history.At("1", 50); ok {
+		fmt.Println("History older than the retention window was kept")
+		t.Fail()
+	}
+	if pos, ok := history.At("1", 80); !ok || pos.X != 80 {
+		fmt.Println("History inside the retention window was lost")
+		t.Fail()
+	}
+}
@@ -0,0 +1,159 @@
+package test
+
+import (
+	"testing"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/rpc"
+	"os"
+	"path/filepath"
+	"time"
+	key "../key-helpers"
+	l "../logic/impl"
+	serverImpl "../server/impl"
+	"../shared"
+)
+
+func TestSignedRPCs(t *testing.T) {
+	for _, scheme := range []string{key.SCHEME_ECDSA, key.SCHEME_ED25519} {
+		pub, priv, _ := key.GenerateKeysForScheme(scheme)
+		auth, err := key.SignRPC(priv, "GServer.Heartbeat", "nonce")
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := key.VerifyRPC(auth, "GServer.Heartbeat")
+		if err != nil || key.PubKeyToString(signer) != key.PubKeyToString(pub) {
+			fmt.Println(scheme, "signed call not verified:", err)
+			t.Fail()
+		}
+
+		// A signature is for one method and one nonce
+		if _, err := key.VerifyRPC(auth, "GServer.GetNodes"); err == nil {
+			fmt.Println(scheme, "signature verified for another method")
+			t.Fail()
+		}
+		changed := auth
+		changed.Nonce = "another nonce"
+		if _, err := key.VerifyRPC(changed, "GServer.Heartbeat"); err == nil {
+			fmt.Println(scheme, "signature verified for another nonce")
+			t.Fail()
+		}
+
+		// and for the key that made it
+		otherPub, _, _ := key.GenerateKeysForScheme(scheme)
+		changed = auth
+		changed.PubKey = key.PubKeyToString(otherPub)
+		if _, err := key.VerifyRPC(changed, "GServer.Heartbeat"); err == nil {
+			fmt.Println(scheme, "signature verified for another key")
+			t.Fail()
+		}
+	}
+}
+
+func TestCreateCerts(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wolfpack-certs")
+	defer os.RemoveAll(dir)
+
+	err := key.CreateCerts(dir, []string{"game.example", "10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{key.CA_CERT_FILE, key.CA_KEY_FILE, key.SERVER_CERT_FILE, key.SERVER_KEY_FILE} {
+		if _, err := os.Stat(filepath.Join(dir, file)); err != nil {
+			fmt.Println("Missing", file)
+			t.Fail()
+		}
+	}
+	if info, err := os.Stat(filepath.Join(dir, key.SERVER_KEY_FILE)); err == nil && info.Mode().Perm() != 0600 {
+		fmt.Println("Server key readable by others:", info.Mode())
+		t.Fail()
+	}
+	if _, err := key.ServerTLSConfig(filepath.Join(dir, key.SERVER_CERT_FILE),
+		filepath.Join(dir, key.SERVER_KEY_FILE)); err != nil {
+		fmt.Println("Could not load the server certificate:", err)
+		t.Fail()
+	}
+	if _, err := key.ClientTLSConfig(filepath.Join(dir, key.CA_CERT_FILE), "game.example"); err != nil {
+		fmt.Println("Could not load the CA:", err)
+		t.Fail()
+	}
+
+	// An existing CA isn't overwritten
+	if err := key.CreateCerts(dir, nil); err == nil {
+		fmt.Println("Overwrote an existing CA")
+		t.Fail()
+	}
+}
+
+func TestServerOverTLS(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "wolfpack-certs")
+	defer os.RemoveAll(dir)
+	err := key.CreateCerts(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := "127.0.0.1:8093"
+	go serverImpl.RunServer(serverImpl.ServerConfig{Addr: addr, Map: "0", PreyMode: "replicated",
+		TLSCert: filepath.Join(dir, key.SERVER_CERT_FILE), TLSKey: filepath.Join(dir, key.SERVER_KEY_FILE)})
+	time.Sleep(500 * time.Millisecond) // give server time to start
+
+	defer func(ca string) {
+		l.DefaultNodeOptions.ServerCA = ca
+	}(l.DefaultNodeOptions.ServerCA)
+	l.DefaultNodeOptions.ServerCA = filepath.Join(dir, key.CA_CERT_FILE)
+
+	pubKey, privKey := key.GenerateKeys()
+	node := l.CreateNodeCommInterface(pubKey, privKey, addr)
+	node.LocalAddr, _ = net.ResolveUDPAddr("udp", "127.0.0.1:2140")
+	node.Config, err = l.DialAndRegister(&node)
+	if err != nil {
+		fmt.Println("Could not register over TLS:", err)
+		t.FailNow()
+	}
+	// The node registers its types with gob alongside the server's in this process, as anything running both does
+	node.ServerRegister()
+	var _ignored bool
+	if err := node.CallServer("GServer.Heartbeat", &_ignored); err != nil {
+		fmt.Println("Heartbeat over TLS failed:", err)
+		t.Fail()
+	}
+
+	// A client that doesn't speak TLS gets nowhere
+	plain, err := rpc.Dial("tcp", addr)
+	if err == nil {
+		var nonce string
+		if plain.Call("GServer.Nonce", true, &nonce) == nil {
+			fmt.Println("Server answered a call without TLS")
+			t.Fail()
+		}
+		plain.Close()
+	}
+
+	// A signed call can't be replayed
+	auth, err := l.SignServerCall(node.ServerConn, privKey, "GServer.Heartbeat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := node.ServerConn.Call("GServer.Heartbeat", auth, &_ignored); err != nil {
+		fmt.Println("Signed heartbeat failed:", err)
+		t.Fail()
+	}
+	if err := node.ServerConn.Call("GServer.Heartbeat", auth, &_ignored); err == nil {
+		fmt.Println("Replayed heartbeat accepted")
+		t.Fail()
+	}
+
+	// and another key can't call as this node: signed with one key, a call is about that key
+	_, otherKey := key.GenerateKeys()
+	forged, err := l.SignServerCall(node.ServerConn, otherKey, "GServer.GetNodes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.PubKey = key.PubKeyToString(pubKey)
+	var nodes map[string]shared.NodeRegistrationInfo
+	if err := node.ServerConn.Call("GServer.GetNodes", forged, &nodes); err == nil {
+		fmt.Println("Call signed with another key accepted")
+		t.Fail()
+	}
+}
@@ -11,7 +11,7 @@ func wnSetup() (wolfnode.WolfNodeImpl) {
 	wn := wolfnode.WolfNodeImpl{}
 	info := wolfnode.PlayerInfo{}
 	settings := shared.InitialGameSettings{3000, 3000,
-	[]shared.Coord{{1, 1}, {10, 90}, {23, 99}}, 200}
+	[]shared.Coord{{1, 1}, {10, 90}, {23, 99}}, 200, 0, 0}
 	pub, priv := key_helpers.GenerateKeys()
 	info.InitGameSettings = settings
 	info.PubKey = pub
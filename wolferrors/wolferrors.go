@@ -44,6 +44,12 @@ func (e InvalidPreyCaptureError) Error() string {
 	return fmt.Sprintf("WolfPack: prey was not captured")
 }
 
+type CaptureTooLateError string
+
+func (e CaptureTooLateError) Error() string {
+	return fmt.Sprintf("WolfPack: capture by [%s] arrived too long after it was made", string(e))
+}
+
 type IncorrectPlayerError string
 
 func (e IncorrectPlayerError) Error() string {
@@ -72,4 +78,75 @@ type UnknownSequenceError string
 
 func (e UnknownSequenceError) Error() string {
 	return fmt.Sprintf("WolfPack: unknown sequence number [%s]", string(e))
-}
\ No newline at end of file
+}
+type UnknownBotStrategyError string
+
+func (e UnknownBotStrategyError) Error() string {
+	return fmt.Sprintf("WolfPack: unknown bot strategy [%s]", string(e))
+}
+
+type UnknownCommandError string
+
+func (e UnknownCommandError) Error() string {
+	return fmt.Sprintf("WolfPack: unknown command [%s]", string(e))
+}
+
+type BadConfigError string
+
+func (e BadConfigError) Error() string {
+	return fmt.Sprintf("WolfPack: bad config [%s]", string(e))
+}
+
+type IdentityExistsError string
+
+func (e IdentityExistsError) Error() string {
+	return fmt.Sprintf("WolfPack: identity already exists [%s]", string(e))
+}
+
+type UnknownIdentityError string
+
+func (e UnknownIdentityError) Error() string {
+	return fmt.Sprintf("WolfPack: unknown identity [%s]", string(e))
+}
+
+type BadKeyError string
+
+func (e BadKeyError) Error() string {
+	return fmt.Sprintf("WolfPack: bad key [%s]", string(e))
+}
+
+type BadPassphraseError string
+
+func (e BadPassphraseError) Error() string {
+	return fmt.Sprintf("WolfPack: %s", string(e))
+}
+
+type SessionError string
+
+func (e SessionError) Error() string {
+	return fmt.Sprintf("WolfPack: session [%s]", string(e))
+}
+
+type UnauthenticatedError string
+
+func (e UnauthenticatedError) Error() string {
+	return fmt.Sprintf("WolfPack: call not signed by its key, or nonce unknown or already used [%s]", string(e))
+}
+
+type PixelProtocolError string
+
+func (e PixelProtocolError) Error() string {
+	return fmt.Sprintf("WolfPack: pixel protocol [%s]", string(e))
+}
+
+type BadReplayError string
+
+func (e BadReplayError) Error() string {
+	return fmt.Sprintf("WolfPack: not a replay, or from a newer version [%s]", string(e))
+}
+
+type RelayNotAssignedError string
+
+func (e RelayNotAssignedError) Error() string {
+	return fmt.Sprintf("WolfPack: key not picked to run the relay, nor the configured relay key [%s]", string(e))
+}
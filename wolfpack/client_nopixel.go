@@ -0,0 +1,13 @@
+// +build !pixel
+
+package main
+
+import (
+	wolfpackImpl "./impl"
+	"../wolferrors"
+)
+
+// Stands in for the pixel client in a build without it, so the rest of wolfpack builds without OpenGL or cgo
+func runPixelClient(config wolfpackImpl.Config) (err error) {
+	return wolferrors.UnknownCommandError("client (built without the pixel client; build with -tags pixel, or use tui)")
+}
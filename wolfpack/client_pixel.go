@@ -0,0 +1,16 @@
+// +build pixel
+
+package main
+
+import (
+	_ "image/png"
+	_ "image/jpeg"
+	wolfpackImpl "./impl"
+	pixelImpl "../pixel/impl"
+)
+
+// Runs the pixel client; only built with -tags pixel, as it needs OpenGL and cgo
+func runPixelClient(config wolfpackImpl.Config) (err error) {
+	pixelImpl.RunClient(config.Pixel, config.Sprites, config.Token)
+	return nil
+}
@@ -0,0 +1,391 @@
+package impl
+
+import (
+	"crypto"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"../../key-helpers"
+	"../../wolferrors"
+)
+
+// Settings for the wolfpack command are looked up, in order of precedence, from:
+//   - the command line, as flags (e.g. -log-dir logs)
+//   - the environment, named WOLFPACK_ followed by the flag upper-cased with dashes as underscores (WOLFPACK_LOG_DIR)
+//   - the config file given by -config or WOLFPACK_CONFIG, keyed by flag name ("log-dir")
+//   - the defaults in DefaultConfig
+// One config file can be shared by every subcommand; each reads the keys it uses and ignores the rest. Config files
+// are JSON objects, or, if named .yaml or .yml, YAML with one "key: value" per line (no nesting).
+
+type Config struct {
+	// The config file the rest of the settings were read from, if any
+	ConfigFile string
+
+	// The server's RPC address; the server itself listens here
+	Server     string
+
+	// The address a node listens on for other nodes
+	Listen     string
+
+	// The address a node tells other nodes to reach it at (see logic/impl.ListenConfig)
+	Advertise  string
+
+	// If true, a node only listens on and advertises the loopback interface
+	Loopback   bool
+
+	// The address a logic node listens on for its pixel node, and the pixel node sends to
+	Pixel      string
+
+	// The identity to play as: the name of one in the keystore. Players default to the "default" identity, created on
+	// first use; other nodes, or a player given -key "", get a key for the session.
+	Key        string
+
+	// A private key file to play as instead of an identity in the keystore
+	KeyFile    string
+
+	// The directory identities are kept in (see key-helpers/keystore.go)
+	Keystore   string
+
+	// A file holding the passphrase the identity's key is encrypted with, if it is
+	PassphraseFile string
+
+	// The signing scheme new keys are made for: "ecdsa" or "ed25519"
+	Scheme     string
+
+	// The room to join on the server
+	Room       string
+
+	// The map the server hosts ("0", "1" or "2")
+	Map        string
+
+	// "replicated" for a game with no prey node
+	PreyMode   string
+
+	// "node" to have a logic node run the game's relay
+	RelayMode  string
+
+	// The public key file of the standalone relay the server lets register
+	RelayKeyFile string
+
+	// Wolves further apart than this many cells only hear each other's positions now and then; 0 for every move
+	InterestRadius int
+
+	// If true, the server has the nodes in its game encrypt their traffic to each other
+	Encrypt    bool
+
+	// The certificate and key files the server serves RPCs over TLS with; without them, it serves them in the clear
+	TLSCert    string
+	TLSKey     string
+
+	// The CA certificate file nodes check the server's certificate against; without it, they dial it without TLS
+	ServerCA   string
+
+	// The directory the certs command writes to
+	CertDir    string
+
+	// The directory nodes write their logs to
+	LogDir     string
+
+	// The strategy a bot plays with (see logic/impl.BotStrategies)
+	Strategy   string
+
+	// The directory the client loads its sprites from
+	Sprites    string
+
+	// The session token the client resumes, printed by the logic node when its first client connected
+	Token      string
+
+	// The file a logic node records its match to; if empty, it doesn't record it
+	Record     string
+
+	// How fast the replay command plays a match back: a multiple of real time ("1", "4"), or "step"
+	Speed      string
+
+	// The arguments after the flags, for the commands that take any
+	Args       []string
+}
+
+var DefaultConfig = Config{
+	Server:   ":8081",
+	Listen:   ":0",
+	Pixel:    ":12345",
+	Map:      "0",
+	LogDir:   ".",
+	Strategy: "chase",
+	Sprites:  "sprites",
+	Keystore: key_helpers.DefaultKeystoreDir(),
+	Scheme:   key_helpers.SCHEME_ECDSA,
+	CertDir:  "certs",
+	Speed:    "1",
+}
+
+// The flags each subcommand takes, besides -config
+var Commands = map[string][]string{
+	"server": {"server", "map", "prey-mode", "relay-mode", "relay-key-file", "interest-radius", "encrypt", "tls-cert",
+		"tls-key"},
+	"player": {"server", "server-ca", "listen", "advertise", "loopback", "pixel", "key", "key-file", "keystore",
+		"passphrase-file", "scheme", "room", "log-dir", "record"},
+	"bot":    {"server", "server-ca", "listen", "advertise", "loopback", "pixel", "key", "key-file", "keystore",
+		"passphrase-file", "scheme", "room", "log-dir", "strategy", "record"},
+	"spectate": {"server", "server-ca", "listen", "advertise", "loopback", "pixel", "key", "key-file", "keystore",
+		"passphrase-file", "scheme", "room", "log-dir", "record"},
+	"prey":   {"server", "server-ca", "listen", "advertise", "loopback", "pixel", "key", "key-file", "keystore",
+		"passphrase-file", "scheme", "room", "log-dir"},
+	"client": {"pixel", "sprites", "token"},
+	"tui":    {"pixel", "token"},
+	// replay <file>
+	"replay": {"pixel", "speed"},
+	// identity <create|list|export> [name]
+	"identity": {"keystore", "passphrase-file", "scheme"},
+	// certs [host...]
+	"certs":    {"cert-dir"},
+}
+
+// The most arguments each command takes after its flags
+var CommandArgs = map[string]int{
+	"identity": 2,
+	"certs":    16,
+	"replay":   1,
+}
+
+// Returns the environment variable that overrides the given flag
+func EnvName(flagName string) (string) {
+	return "WOLFPACK_" + strings.ToUpper(strings.Replace(flagName, "-", "_", -1))
+}
+
+// Parses the settings for a subcommand from its arguments, the environment and its config file
+// Returns flag.ErrHelp if help was asked for, and an error if the command, a flag or the config file is bad
+func ParseConfig(command string, args []string) (Config, error) {
+	names, ok := Commands[command]
+	if !ok {
+		return Config{}, wolferrors.UnknownCommandError(command)
+	}
+	config := DefaultConfig
+	if command == "player" {
+		config.Key = key_helpers.DEFAULT_IDENTITY
+	}
+	flags := flag.NewFlagSet("wolfpack "+command, flag.ContinueOnError)
+	flags.StringVar(&config.ConfigFile, "config", "", "read settings from this JSON or YAML file")
+	for _, name := range names {
+		bindFlag(flags, &config, name)
+	}
+	err := flags.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+	if flags.NArg() > CommandArgs[command] {
+		return Config{}, wolferrors.BadConfigError(fmt.Sprintf("unexpected argument %q",
+			flags.Arg(CommandArgs[command])))
+	}
+	config.Args = flags.Args()
+
+	fromCommandLine := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		fromCommandLine[f.Name] = true
+	})
+	if !fromCommandLine["config"] {
+		config.ConfigFile = os.Getenv(EnvName("config"))
+	}
+	fromFile := make(map[string]string)
+	if config.ConfigFile != "" {
+		fromFile, err = ReadConfigFile(config.ConfigFile)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, name := range names {
+		if fromCommandLine[name] {
+			continue
+		}
+		value, ok := os.LookupEnv(EnvName(name))
+		source := EnvName(name)
+		if !ok {
+			value, ok = fromFile[name]
+			source = config.ConfigFile
+		}
+		if !ok {
+			continue
+		}
+		err = flags.Set(name, value)
+		if err != nil {
+			return Config{}, wolferrors.BadConfigError(fmt.Sprintf("%s: %s: %s", source, name, err))
+		}
+	}
+	return config, nil
+}
+
+// Registers the named setting as a flag
+func bindFlag(flags *flag.FlagSet, config *Config, name string) {
+	switch name {
+	case "server":
+		flags.StringVar(&config.Server, name, config.Server, "the server's address (for the server, the address to listen on)")
+	case "listen":
+		flags.StringVar(&config.Listen, name, config.Listen, "the address to listen on for other nodes")
+	case "advertise":
+		flags.StringVar(&config.Advertise, name, config.Advertise, "the address other nodes should reach this one at")
+	case "loopback":
+		flags.BoolVar(&config.Loopback, name, config.Loopback, "only listen on and advertise loopback, for local testing")
+	case "pixel":
+		flags.StringVar(&config.Pixel, name, config.Pixel, "the address the logic node and pixel client talk on")
+	case "key":
+		flags.StringVar(&config.Key, name, config.Key, "the identity to play as (\"\" for a new key)")
+	case "key-file":
+		flags.StringVar(&config.KeyFile, name, config.KeyFile, "a private key file to play as, instead of an identity")
+	case "keystore":
+		flags.StringVar(&config.Keystore, name, config.Keystore, "the directory identities are kept in")
+	case "passphrase-file":
+		flags.StringVar(&config.PassphraseFile, name, config.PassphraseFile, "a file holding the identity's passphrase")
+	case "scheme":
+		flags.StringVar(&config.Scheme, name, config.Scheme, "the signing scheme for new keys (ecdsa or ed25519)")
+	case "room":
+		flags.StringVar(&config.Room, name, config.Room, "the room to join")
+	case "map":
+		flags.StringVar(&config.Map, name, config.Map, "the map to play on (0, 1 or 2, a 100x100 map that scrolls)")
+	case "prey-mode":
+		flags.StringVar(&config.PreyMode, name, config.PreyMode, "\"replicated\" to play without a prey node")
+	case "relay-mode":
+		flags.StringVar(&config.RelayMode, name, config.RelayMode, "\"node\" to have a player node run the relay")
+	case "relay-key-file":
+		flags.StringVar(&config.RelayKeyFile, name, config.RelayKeyFile, "the public key file of the standalone relay")
+	case "interest-radius":
+		flags.IntVar(&config.InterestRadius, name, config.InterestRadius,
+			"send moves only to wolves within this many cells, and positions to the rest now and then (0 for all moves)")
+	case "encrypt":
+		flags.BoolVar(&config.Encrypt, name, config.Encrypt, "have nodes encrypt their traffic to each other")
+	case "tls-cert":
+		flags.StringVar(&config.TLSCert, name, config.TLSCert, "the certificate file to serve RPCs over TLS with")
+	case "tls-key":
+		flags.StringVar(&config.TLSKey, name, config.TLSKey, "the key file for the TLS certificate")
+	case "server-ca":
+		flags.StringVar(&config.ServerCA, name, config.ServerCA, "the CA certificate file to check the server's against")
+	case "cert-dir":
+		flags.StringVar(&config.CertDir, name, config.CertDir, "the directory to write the CA and server certificate to")
+	case "log-dir":
+		flags.StringVar(&config.LogDir, name, config.LogDir, "the directory to write logs to")
+	case "strategy":
+		flags.StringVar(&config.Strategy, name, config.Strategy, "the bot's strategy (chase or random)")
+	case "sprites":
+		flags.StringVar(&config.Sprites, name, config.Sprites, "the directory to load sprites from")
+	case "token":
+		flags.StringVar(&config.Token, name, config.Token, "the session token to resume a player's session with")
+	case "record":
+		flags.StringVar(&config.Record, name, config.Record, "a file to record the match to, for replaying")
+	case "speed":
+		flags.StringVar(&config.Speed, name, config.Speed, "the replay speed: 1, 4 (times real time) or step")
+	}
+}
+
+// Returns the passphrase in the configured passphrase file, or "" if there is none
+func (config Config) Passphrase() (string, error) {
+	if config.PassphraseFile == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(config.PassphraseFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// Loads the configured private key: from KeyFile, if there is one, or else the Key identity's from the keystore,
+// creating it there on first use; with neither, generates a key for this session
+func (config Config) LoadKey() (crypto.Signer, error) {
+	if config.KeyFile == "" && config.Key == "" {
+		_, privKey, err := key_helpers.GenerateKeysForScheme(config.Scheme)
+		return privKey, err
+	}
+	passphrase, err := config.Passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if config.KeyFile != "" {
+		return key_helpers.LoadKeyFile(config.KeyFile, passphrase)
+	}
+	keystore := key_helpers.OpenKeystore(config.Keystore)
+	keystore.Scheme = config.Scheme
+	return keystore.LoadOrCreate(config.Key, passphrase)
+}
+
+// Returns true if the name is a setting any subcommand takes
+func knownSetting(name string) (bool) {
+	for _, names := range Commands {
+		for _, known := range names {
+			if known == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Reads a config file into a map of setting names to values
+// Returns an error if the file can't be read or parsed, or names a setting no subcommand takes
+func ReadConfigFile(path string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var settings map[string]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		settings, err = parseFlatYAML(string(data))
+	default:
+		settings, err = parseJSONConfig(data)
+	}
+	if err != nil {
+		return nil, wolferrors.BadConfigError(fmt.Sprintf("%s: %s", path, err))
+	}
+	for name := range settings {
+		if !knownSetting(name) {
+			return nil, wolferrors.BadConfigError(fmt.Sprintf("%s: unknown setting %q", path, name))
+		}
+	}
+	return settings, nil
+}
+
+func parseJSONConfig(data []byte) (map[string]string, error) {
+	var raw map[string]interface{}
+	err := json.Unmarshal(data, &raw)
+	if err != nil {
+		return nil, err
+	}
+	settings := make(map[string]string)
+	for name, value := range raw {
+		switch value.(type) {
+		case string, bool, float64:
+			settings[name] = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("%s must be a string, number or boolean", name)
+		}
+	}
+	return settings, nil
+}
+
+func parseFlatYAML(data string) (map[string]string, error) {
+	settings := make(map[string]string)
+	for i, line := range strings.Split(data, "\n") {
+		if hash := strings.Index(line, "#"); hash == 0 || (hash > 0 && line[hash-1] == ' ') {
+			line = line[:hash]
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+		colon := strings.Index(trimmed, ":")
+		if colon < 0 || line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+		name := strings.TrimSpace(trimmed[:colon])
+		value := strings.TrimSpace(trimmed[colon+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		settings[name] = value
+	}
+	return settings, nil
+}
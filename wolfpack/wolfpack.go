@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto"
+	"flag"
+	"fmt"
+	"os"
+	wolfpackImpl "./impl"
+	serverImpl "../server/impl"
+	logicImpl "../logic/impl"
+	preyImpl "../prey/impl"
+	terminalImpl "../terminal/impl"
+	"../key-helpers"
+	"../wolferrors"
+)
+
+// Runs any part of a game of Wolfpack
+// Usage: go run ./wolfpack <server|player|bot|spectate|prey|client|tui|replay|identity|certs> [flags]
+// Run a subcommand with -h for its flags; see wolfpack/impl/config.go for environment variables and config files
+// The client subcommand needs OpenGL and cgo, so is only built with -tags pixel (see client_pixel.go)
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	command := os.Args[1]
+	config, err := wolfpackImpl.ParseConfig(command, os.Args[2:])
+	if err == flag.ErrHelp {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Println(err)
+		if _, ok := err.(wolferrors.UnknownCommandError); ok {
+			usage()
+		}
+		os.Exit(2)
+	}
+
+	var privKey crypto.Signer
+	switch command {
+	case "server":
+		err = serverImpl.RunServer(serverImpl.ServerConfig{Addr: config.Server, Map: config.Map,
+			PreyMode: config.PreyMode, RelayMode: config.RelayMode, EncryptTraffic: config.Encrypt,
+			TLSCert: config.TLSCert, TLSKey: config.TLSKey, RelayKeyFile: config.RelayKeyFile,
+			InterestRadius: config.InterestRadius})
+	case "player", "bot":
+		if _, ok := logicImpl.BotStrategies[config.Strategy]; command == "bot" && !ok {
+			err = wolferrors.UnknownBotStrategyError(config.Strategy)
+			break
+		}
+		setNodeOptions(config)
+		privKey, err = config.LoadKey()
+		if err != nil {
+			break
+		}
+		node := logicImpl.CreatePlayerNode(config.Listen, config.Pixel, privKey.Public(), privKey, config.Server)
+		if command == "bot" {
+			err = node.RunBotStrategy(config.Strategy)
+		} else {
+			node.RunGame(config.Pixel)
+		}
+	case "spectate":
+		setNodeOptions(config)
+		privKey, err = config.LoadKey()
+		if err != nil {
+			break
+		}
+		node := logicImpl.CreateSpectatorNode(config.Listen, config.Pixel, privKey.Public(), privKey, config.Server)
+		node.RunSpectator(config.Pixel)
+	case "prey":
+		setNodeOptions(config)
+		privKey, err = config.LoadKey()
+		if err != nil {
+			break
+		}
+		node := preyImpl.CreatePreyNode(config.Listen, config.Pixel, privKey.Public(), privKey, config.Server)
+		node.RunGame(config.Pixel)
+	case "client":
+		err = runPixelClient(config)
+	case "tui":
+		err = terminalImpl.RunClient(config.Pixel, config.Token)
+	case "replay":
+		if len(config.Args) == 0 {
+			usage()
+			err = wolferrors.BadConfigError("replay needs a replay file")
+			break
+		}
+		var speed logicImpl.ReplaySpeed
+		speed, err = logicImpl.ParseReplaySpeed(config.Speed)
+		if err != nil {
+			break
+		}
+		err = logicImpl.RunReplay(config.Args[0], config.Pixel, speed)
+	case "identity":
+		err = runIdentity(config)
+	case "certs":
+		err = key_helpers.CreateCerts(config.CertDir, config.Args)
+		if err == nil {
+			fmt.Println("Wrote a CA and server certificate to", config.CertDir)
+		}
+	}
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage: wolfpack <command> [flags]")
+	fmt.Println("Commands:")
+	fmt.Println("  server  run the game server")
+	fmt.Println("  player  run a logic node for a player")
+	fmt.Println("  bot     run a logic node that plays by itself")
+	fmt.Println("  spectate run a logic node that watches the game, for a client or tui to follow")
+	fmt.Println("  prey    run the prey node")
+	fmt.Println("  client  run the pixel client for a player's logic node (built with -tags pixel)")
+	fmt.Println("  tui     play on a player's logic node in the terminal")
+	fmt.Println("  replay [flags] <file>           play a recorded match back to a client or tui")
+	fmt.Println("  identity [flags] create [name]  create an identity in the keystore")
+	fmt.Println("  identity [flags] list           list the identities in the keystore")
+	fmt.Println("  identity [flags] export [name]  print an identity's public key")
+	fmt.Println("  certs [flags] [host...]         make a local CA and a server certificate for the hosts")
+}
+
+// Creates, lists or exports the identities in the keystore
+func runIdentity(config wolfpackImpl.Config) (err error) {
+	if len(config.Args) == 0 {
+		usage()
+		return wolferrors.BadConfigError("identity needs create, list or export")
+	}
+	keystore := key_helpers.OpenKeystore(config.Keystore)
+	keystore.Scheme = config.Scheme
+	name := key_helpers.DEFAULT_IDENTITY
+	if len(config.Args) > 1 {
+		name = config.Args[1]
+	}
+	switch config.Args[0] {
+	case "create":
+		passphrase, err := config.Passphrase()
+		if err != nil {
+			return err
+		}
+		_, err = keystore.Create(name, passphrase)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created identity %s in %s\n", name, keystore.Dir)
+	case "list":
+		names, err := keystore.List()
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			encrypted, _ := keystore.Encrypted(name)
+			if encrypted {
+				fmt.Println(name, "(encrypted)")
+			} else {
+				fmt.Println(name)
+			}
+		}
+	case "export":
+		pubPEM, err := keystore.ExportPublic(name)
+		if err != nil {
+			return err
+		}
+		fmt.Print(pubPEM)
+	default:
+		return wolferrors.UnknownCommandError("identity " + config.Args[0])
+	}
+	return nil
+}
+
+// Passes the settings the node constructors don't take on to the nodes
+func setNodeOptions(config wolfpackImpl.Config) {
+	logicImpl.DefaultListenConfig.Advertise = config.Advertise
+	logicImpl.DefaultListenConfig.Loopback = config.Loopback
+	logicImpl.DefaultNodeOptions.Room = config.Room
+	logicImpl.DefaultNodeOptions.LogDir = config.LogDir
+	logicImpl.DefaultNodeOptions.ServerCA = config.ServerCA
+	logicImpl.DefaultNodeOptions.Record = config.Record
+}